@@ -0,0 +1,36 @@
+package main
+
+import "path/filepath"
+
+// sgrDim renders -show-ancestors context rows faint.
+const sgrDim = "\033[2m"
+
+// withAncestors returns list with a context row for every ancestor of a
+// listed entry, up to root, that is not listed itself, such as a parent
+// a filter left out. Each is added once and sized from the walk-time
+// totals in parentSizes. list itself is left alone, so totals, counts
+// and every other consumer of the results never see the additions.
+func withAncestors(root string, list []FileInfo) []FileInfo {
+	listed := make(map[string]bool, len(list))
+	for _, res := range list {
+		listed[res.Path] = true
+	}
+	out := append([]FileInfo(nil), list...)
+	for _, res := range list {
+		// A listed or already added directory has its chain covered.
+		for dir := filepath.Dir(res.Path); pathWithin(dir, root) && !listed[dir]; dir = filepath.Dir(dir) {
+			listed[dir] = true
+			size, _ := parentSizes.total(dir)
+			out = append(out, FileInfo{Path: dir, Size: size, IsDir: true, Context: true})
+		}
+	}
+	return out
+}
+
+// contextSuffix is the text-listing note for a context row.
+func contextSuffix(res FileInfo) string {
+	if res.Context {
+		return "  (context)"
+	}
+	return ""
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestShowAncestors(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"a/b/c/big":  strings.Repeat("x", 3000),
+		"a/b/d/big2": strings.Repeat("x", 2000),
+		"a/small":    strings.Repeat("x", 100),
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+
+	// -max-files=0 leaves every directory out, so only the two files
+	// qualify and their whole chains are context.
+	scan := func(extra ...string) jsonReport {
+		t.Helper()
+		resetResults()
+		out, err := runCaptured(t, append(append([]string{"-format=json", "-max-files=0"}, extra...), tmpDir, "1K")...)
+		if err != nil {
+			t.Fatalf("run failed: %v\n%s", err, out)
+		}
+		var rep jsonReport
+		if err := json.Unmarshal([]byte(out), &rep); err != nil {
+			t.Fatalf("invalid JSON: %v\n%s", err, out)
+		}
+		return rep
+	}
+	plain, withCtx := scan(), scan("-show-ancestors")
+	if withCtx.Total != plain.Total {
+		t.Errorf("total = %d with -show-ancestors, %d without", withCtx.Total, plain.Total)
+	}
+
+	var qualifying, context []string
+	sizes := make(map[string]uint64)
+	for _, e := range withCtx.Entries {
+		if e.Context {
+			context = append(context, e.Path)
+			sizes[e.Path] = e.Size
+		} else {
+			qualifying = append(qualifying, e.Path)
+		}
+	}
+	var want []string
+	for _, e := range plain.Entries {
+		want = append(want, e.Path)
+	}
+	if !reflect.DeepEqual(qualifying, want) {
+		t.Errorf("qualifying entries = %q, want %q", qualifying, want)
+	}
+	sort.Strings(context)
+	wantCtx := []string{tmpDir, filepath.Join(tmpDir, "a"), filepath.Join(tmpDir, "a", "b"),
+		filepath.Join(tmpDir, "a", "b", "c"), filepath.Join(tmpDir, "a", "b", "d")}
+	sort.Strings(wantCtx)
+	if !reflect.DeepEqual(context, wantCtx) {
+		t.Errorf("context rows = %q\nwant           %q", context, wantCtx)
+	}
+	// Sizes are the walk-time totals, though none of these was listed.
+	if sizes[filepath.Join(tmpDir, "a")] != 5100 || sizes[filepath.Join(tmpDir, "a", "b", "c")] != 3000 {
+		t.Errorf("context sizes = %v", sizes)
+	}
+
+	resetResults()
+	out, err := runCaptured(t, "-max-files=0", "-show-ancestors", "-tree", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("tree run failed: %v\n%s", err, out)
+	}
+	if n := strings.Count(out, "(context)"); n != len(wantCtx) {
+		t.Errorf("tree shows %d context rows, want %d:\n%s", n, len(wantCtx), out)
+	}
+	if !strings.Contains(out, "\n    4.88 KiB    b/  (context)\n") {
+		t.Errorf("tree lacks a/b as context at its depth:\n%s", out)
+	}
+}
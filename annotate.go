@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Annotator adds one named column to the listed entries. Annotate is
+// called concurrently for different entries and must be safe for that.
+// An error affects only the entry it was returned for.
+type Annotator interface {
+	Name() string
+	Annotate(FileInfo) (string, error)
+}
+
+// annotation is one annotator's value for an entry.
+type annotation struct {
+	Name  string
+	Value string
+}
+
+// annotateConcurrency bounds how many entries are annotated at once, so
+// an annotator that does I/O cannot flood the filesystem.
+const annotateConcurrency = 8
+
+// builtinAnnotators are the annotators -annotate can name.
+var builtinAnnotators = map[string]func() Annotator{
+	"sidecar": func() Annotator { return sidecarAnnotator{} },
+}
+
+// parseAnnotators resolves a comma-separated -annotate value.
+func parseAnnotators(spec string) ([]Annotator, error) {
+	var anns []Annotator
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		newAnnotator, ok := builtinAnnotators[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown annotator %q (available: sidecar)", name)
+		}
+		if !seen[name] {
+			seen[name] = true
+			anns = append(anns, newAnnotator())
+		}
+	}
+	return anns, nil
+}
+
+// annotatorNames returns the column names of anns in order.
+func annotatorNames(anns []Annotator) []string {
+	names := make([]string, len(anns))
+	for i, a := range anns {
+		names[i] = a.Name()
+	}
+	return names
+}
+
+// annotateEntries runs every annotator over the listed entries, at most
+// workers entries at a time. Like the other annotations it runs after the
+// scan, over the report only. A failing annotator leaves an empty value
+// for that entry and is reported on stderr; other entries and annotators
+// are unaffected.
+func annotateEntries(list []FileInfo, anns []Annotator, workers int) {
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i := range list {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(res *FileInfo) {
+			defer func() { <-sem; wg.Done() }()
+			values := make([]annotation, len(anns))
+			for j, a := range anns {
+				v, err := a.Annotate(*res)
+				if err != nil {
+					fmt.Fprintf(stderr, "Error annotating %s with %s: %v\n", displayPath(res.Path), a.Name(), err)
+					v = ""
+				}
+				values[j] = annotation{Name: a.Name(), Value: v}
+			}
+			res.Annotations = values
+		}(&list[i])
+	}
+	wg.Wait()
+}
+
+// annotationSuffix renders the non-empty annotations of an entry.
+func annotationSuffix(res FileInfo) string {
+	suffix := ""
+	for _, a := range res.Annotations {
+		if a.Value != "" {
+			suffix += "  " + a.Name + "=" + a.Value
+		}
+	}
+	return suffix
+}
+
+// annotationMap returns the annotations keyed by name, or nil if there
+// are none, for JSON output.
+func annotationMap(res FileInfo) map[string]string {
+	if len(res.Annotations) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(res.Annotations))
+	for _, a := range res.Annotations {
+		m[a.Name] = a.Value
+	}
+	return m
+}
+
+// sidecarAnnotator reads the first line of a "<path>.meta" file next to
+// the entry, such as an asset tag. Entries without one get no value.
+type sidecarAnnotator struct{}
+
+func (sidecarAnnotator) Name() string { return "sidecar" }
+
+func (sidecarAnnotator) Annotate(res FileInfo) (string, error) {
+	openFiles.acquire()
+	defer openFiles.release()
+	f, err := os.Open(res.Path + ".meta")
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	if sc.Scan() {
+		return strings.TrimSpace(sc.Text()), nil
+	}
+	return "", sc.Err()
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeAnnotator returns a fixed value, fails on paths containing "bad", and
+// records how many calls overlapped.
+type fakeAnnotator struct {
+	name    string
+	active  atomic.Int64
+	mu      sync.Mutex
+	maxSeen int64
+}
+
+func (a *fakeAnnotator) Name() string { return a.name }
+
+func (a *fakeAnnotator) Annotate(res FileInfo) (string, error) {
+	n := a.active.Add(1)
+	defer a.active.Add(-1)
+	a.mu.Lock()
+	a.maxSeen = max(a.maxSeen, n)
+	a.mu.Unlock()
+	time.Sleep(time.Millisecond)
+	if a.name == "flaky" && strings.Contains(res.Path, "bad") {
+		return "", errors.New("no label")
+	}
+	return a.name + ":" + filepath.Base(res.Path), nil
+}
+
+func TestAnnotateEntries(t *testing.T) {
+	var list []FileInfo
+	for _, name := range []string{"a", "bad1", "b", "c", "bad2", "d", "e", "f", "g", "h"} {
+		list = append(list, FileInfo{Path: "/r/" + name})
+	}
+	tag := &fakeAnnotator{name: "tag"}
+	flaky := &fakeAnnotator{name: "flaky"}
+
+	var errs strings.Builder
+	stdout, stderr = newOutputs(&strings.Builder{}, &errs, false)
+	defer setupOutput(os.Stdout, os.Stderr)
+	annotateEntries(list, []Annotator{tag, flaky}, 3)
+
+	for _, res := range list {
+		if len(res.Annotations) != 2 || res.Annotations[0] != (annotation{"tag", "tag:" + filepath.Base(res.Path)}) {
+			t.Errorf("%s: annotations = %v", res.Path, res.Annotations)
+			continue
+		}
+		want := "flaky:" + filepath.Base(res.Path)
+		if strings.Contains(res.Path, "bad") {
+			want = ""
+		}
+		if got := res.Annotations[1]; got != (annotation{"flaky", want}) {
+			t.Errorf("%s: flaky annotation = %v, want %q", res.Path, got, want)
+		}
+	}
+	if n := strings.Count(errs.String(), "Error annotating"); n != 2 {
+		t.Errorf("reported %d annotation errors, want 2:\n%s", n, errs.String())
+	}
+	if tag.maxSeen > 3 || flaky.maxSeen > 3 {
+		t.Errorf("up to %d concurrent calls, want at most 3", max(tag.maxSeen, flaky.maxSeen))
+	}
+}
+
+func TestRunSidecarAnnotator(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"data/video.mp4":      strings.Repeat("v", 400),
+		"data/video.mp4.meta": "ASSET-1042\nowner: media\n",
+		"data/other.bin":      strings.Repeat("o", 300),
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+
+	resetResults()
+	out, err := runCaptured(t, "-annotate=sidecar", tmpDir, "200B")
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if !strings.Contains(out, filepath.Join(tmpDir, "data", "video.mp4")+"  sidecar=ASSET-1042\n") {
+		t.Errorf("text output lacks the sidecar column:\n%s", out)
+	}
+
+	resetResults()
+	out, err = runCaptured(t, "-annotate=sidecar", "-format=csv", tmpDir, "200B")
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	rows, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(rows[0], ","); got != "type,size_bytes,size_human,path,sidecar" {
+		t.Errorf("header = %s", got)
+	}
+	for _, row := range rows[1:] {
+		want := ""
+		if filepath.Base(row[3]) == "video.mp4" {
+			want = "ASSET-1042"
+		}
+		if row[4] != want {
+			t.Errorf("%s: sidecar = %q, want %q", row[3], row[4], want)
+		}
+	}
+}
+
+func TestParseAnnotatorsRejectsUnknown(t *testing.T) {
+	if _, err := parseAnnotators("sidecar,ml"); err == nil || !strings.Contains(err.Error(), `"ml"`) {
+		t.Errorf("error = %v, want the unknown annotator named", err)
+	}
+}
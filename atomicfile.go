@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// atomicOps are the filesystem operations behind atomicFile and
+// appendRecord. It is a variable so tests can fail any one stage.
+var atomicOps = defaultAtomicOps()
+
+type fileOps struct {
+	createTemp func(dir, pattern string) (*os.File, error)
+	openAppend func(name string) (*os.File, error)
+	write      func(f *os.File, p []byte) (int, error)
+	sync       func(f *os.File) error
+	chmod      func(f *os.File, mode os.FileMode) error
+	close      func(f *os.File) error
+	rename     func(oldpath, newpath string) error
+	remove     func(name string) error
+	syncDir    func(dir string) error
+}
+
+// defaultAtomicOps returns the real implementations.
+func defaultAtomicOps() fileOps {
+	return fileOps{
+		createTemp: os.CreateTemp,
+		openAppend: func(name string) (*os.File, error) {
+			return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		},
+		write:   (*os.File).Write,
+		sync:    (*os.File).Sync,
+		chmod:   (*os.File).Chmod,
+		close:   (*os.File).Close,
+		rename:  os.Rename,
+		remove:  os.Remove,
+		syncDir: syncDir,
+	}
+}
+
+// atomicFile is written under a temporary name next to its destination
+// and renamed into place by commit, so that the destination never holds a
+// partial file: it has either its old contents or all of the new ones,
+// even across a crash. Every file spacehogs replaces goes through it.
+type atomicFile struct {
+	tmp  *os.File
+	path string
+	done bool
+	err  error // first write error, reported again by commit
+}
+
+// createAtomic starts a replacement for path. The temporary file is in the
+// same directory, so the final rename does not cross filesystems.
+func createAtomic(path string) (*atomicFile, error) {
+	tmp, err := atomicOps.createTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFile{tmp: tmp, path: path}, nil
+}
+
+// Write implements io.Writer.
+func (f *atomicFile) Write(p []byte) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	n, err := atomicOps.write(f.tmp, p)
+	if err != nil {
+		f.err = f.stageError("writing", err)
+	}
+	return n, f.err
+}
+
+// stageError describes a failure at one stage of writing f, naming the
+// temporary file, which is removed.
+func (f *atomicFile) stageError(stage string, err error) error {
+	return fmt.Errorf("%s temporary file %s for %s: %w", stage, f.tmp.Name(), f.path, err)
+}
+
+// commit flushes the file to disk, renames it over the destination and
+// flushes the directory entry. Until the rename the destination keeps its
+// previous contents; on any failure the temporary file is removed.
+func (f *atomicFile) commit() error {
+	if f.done {
+		return fmt.Errorf("%s: already finished", f.path)
+	}
+	f.done = true
+	err := f.err
+	if err == nil {
+		if serr := atomicOps.sync(f.tmp); serr != nil {
+			err = f.stageError("syncing", serr)
+		}
+	}
+	if err == nil {
+		// CreateTemp makes the file private; keep the mode of the file
+		// being replaced, or give it the one a plain create would.
+		mode := newFileMode()
+		if st, serr := os.Stat(f.path); serr == nil {
+			mode = st.Mode().Perm()
+		}
+		if cerr := atomicOps.chmod(f.tmp, mode); cerr != nil {
+			err = f.stageError("setting the mode of", cerr)
+		}
+	}
+	if cerr := atomicOps.close(f.tmp); cerr != nil && err == nil {
+		err = f.stageError("closing", cerr)
+	}
+	if err == nil {
+		if rerr := atomicOps.rename(f.tmp.Name(), f.path); rerr != nil {
+			err = f.stageError("renaming", rerr)
+		}
+	}
+	if err != nil {
+		atomicOps.remove(f.tmp.Name())
+		return err
+	}
+	if err := atomicOps.syncDir(filepath.Dir(f.path)); err != nil {
+		return fmt.Errorf("%s is written but its directory could not be synced: %w", f.path, err)
+	}
+	return nil
+}
+
+// abort discards the temporary file, leaving the destination as it was.
+// It does nothing after commit, so it can be deferred.
+func (f *atomicFile) abort() {
+	if f.done {
+		return
+	}
+	f.done = true
+	atomicOps.close(f.tmp)
+	atomicOps.remove(f.tmp.Name())
+}
+
+// replaceFile atomically replaces path with data.
+func replaceFile(path string, data []byte) error {
+	f, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.abort()
+		return err
+	}
+	return f.commit()
+}
+
+// appendRecord adds data to the end of path, creating it if needed, and
+// syncs it before returning, so that a record reported written survives a
+// crash. Append-only files such as the history are not replaced on every
+// write; at worst a crash mid-write leaves a final partial record, which
+// their readers skip.
+func appendRecord(path string, data []byte) error {
+	f, err := atomicOps.openAppend(path)
+	if err != nil {
+		return err
+	}
+	_, err = atomicOps.write(f, data)
+	if err == nil {
+		err = atomicOps.sync(f)
+	}
+	if cerr := atomicOps.close(f); err == nil {
+		err = cerr
+	}
+	return err
+}
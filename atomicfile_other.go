@@ -0,0 +1,17 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// newFileMode is the mode a plain create gives a new file. There is no
+// umask here.
+func newFileMode() os.FileMode {
+	return 0o666
+}
+
+// syncDir does nothing: directories cannot be synced here, and the
+// filesystems involved commit renames on their own.
+func syncDir(string) error {
+	return nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// dirNames lists the names in dir.
+func dirNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestAtomicFileAbortMidWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.json")
+	if err := os.WriteFile(path, []byte("old\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := createAtomic(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte(`{"entries": [`))
+	f.abort()
+
+	if data, _ := os.ReadFile(path); string(data) != "old\n" {
+		t.Errorf("destination = %q after abort, want the old contents", data)
+	}
+	if names := dirNames(t, dir); len(names) != 1 {
+		t.Errorf("directory holds %v after abort, want only report.json", names)
+	}
+
+	f, err = createAtomic(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("new\n"))
+	if err := f.commit(); err != nil {
+		t.Fatal(err)
+	}
+	f.abort() // A deferred abort after commit must not undo it.
+	if data, _ := os.ReadFile(path); string(data) != "new\n" {
+		t.Errorf("destination = %q after commit, want the new contents", data)
+	}
+	if runtime.GOOS != "windows" {
+		if st, err := os.Stat(path); err != nil || st.Mode().Perm() != 0o644 {
+			t.Errorf("mode = %v, %v; want 0644", st.Mode(), err)
+		}
+	}
+}
+
+func TestAtomicFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no Unix permissions")
+	}
+	dir := t.TempDir()
+
+	// A replaced file keeps its mode, however private.
+	path := filepath.Join(dir, "private.json")
+	if err := os.WriteFile(path, []byte("old\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := replaceFile(path, []byte("new\n")); err != nil {
+		t.Fatal(err)
+	}
+	if st, err := os.Stat(path); err != nil || st.Mode().Perm() != 0o600 {
+		t.Errorf("replaced mode = %v, %v; want 0600", st.Mode(), err)
+	}
+
+	// A new file gets the mode a plain create gives it under the umask.
+	plain := filepath.Join(dir, "plain")
+	if err := os.WriteFile(plain, nil, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.Stat(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path = filepath.Join(dir, "new.json")
+	if err := replaceFile(path, []byte("new\n")); err != nil {
+		t.Fatal(err)
+	}
+	if st, err := os.Stat(path); err != nil || st.Mode().Perm() != want.Mode().Perm() {
+		t.Errorf("new mode = %v, %v; want %v", st.Mode(), err, want.Mode().Perm())
+	}
+}
+
+func TestAtomicFileStageFailures(t *testing.T) {
+	injected := errors.New("injected failure")
+	stages := map[string]func(ops *fileOps){
+		"writing":             func(ops *fileOps) { ops.write = func(*os.File, []byte) (int, error) { return 0, injected } },
+		"syncing":             func(ops *fileOps) { ops.sync = func(*os.File) error { return injected } },
+		"setting the mode of": func(ops *fileOps) { ops.chmod = func(*os.File, os.FileMode) error { return injected } },
+		"closing": func(ops *fileOps) {
+			ops.close = func(f *os.File) error { f.Close(); return injected }
+		},
+		"renaming": func(ops *fileOps) { ops.rename = func(string, string) error { return injected } },
+	}
+	for stage, inject := range stages {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "report.json")
+		if err := os.WriteFile(path, []byte("old\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		ops := defaultAtomicOps()
+		inject(&ops)
+		atomicOps = ops
+
+		err := replaceFile(path, []byte("new\n"))
+		atomicOps = defaultAtomicOps()
+		if !errors.Is(err, injected) || !strings.Contains(err.Error(), stage+" temporary file "+filepath.Join(dir, ".report.json.tmp")) {
+			t.Errorf("%s: error = %v, want the injected failure naming the temporary file", stage, err)
+		}
+		if data, _ := os.ReadFile(path); string(data) != "old\n" {
+			t.Errorf("%s: destination = %q, want the previous version", stage, data)
+		}
+		if names := dirNames(t, dir); len(names) != 1 {
+			t.Errorf("%s: directory holds %v, want no temporary files", stage, names)
+		}
+	}
+
+	// A failed directory sync comes after the rename: the new version is
+	// in place, but the error says it may not be durable.
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.json")
+	ops := defaultAtomicOps()
+	ops.syncDir = func(string) error { return injected }
+	atomicOps = ops
+	err := replaceFile(path, []byte("new\n"))
+	atomicOps = defaultAtomicOps()
+	if !errors.Is(err, injected) || !strings.Contains(err.Error(), "directory could not be synced") {
+		t.Errorf("syncDir: error = %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new\n" {
+		t.Errorf("syncDir: destination = %q, want the new version", data)
+	}
+}
+
+func TestAppendRecordSyncs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	synced := 0
+	ops := defaultAtomicOps()
+	ops.sync = func(f *os.File) error { synced++; return f.Sync() }
+	atomicOps = ops
+	defer func() { atomicOps = defaultAtomicOps() }()
+
+	for _, rec := range []string{"one\n", "two\n"} {
+		if err := appendRecord(path, []byte(rec)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if data, _ := os.ReadFile(path); string(data) != "one\ntwo\n" || synced != 2 {
+		t.Errorf("file = %q after %d syncs, want both records and a sync each", data, synced)
+	}
+}
+
+func TestRunOutputFile(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"dir/big.bin": strings.Repeat("x", 2000),
+	})
+	defer os.RemoveAll(tmpDir)
+	outDir := t.TempDir()
+
+	for _, format := range []string{"text", "json", "csv", "tsv", "ndjson", "xml", "html", "ncdu"} {
+		path := filepath.Join(outDir, "out."+format)
+		resetResults()
+		term, err := runCaptured(t, "-format="+format, "-o", path, tmpDir, "1K")
+		if err != nil {
+			t.Fatalf("-format=%s: run failed: %v\n%s", format, err, term)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("-format=%s: %v", format, err)
+		}
+		if !strings.Contains(string(data), "big.bin") {
+			t.Errorf("-format=%s: file lacks the results:\n%s", format, data)
+		}
+		// The banner is on the terminal however the results are written.
+		if !strings.Contains(term, "Scanning") || strings.Contains(string(data), "Scanning") {
+			t.Errorf("-format=%s: banner not kept on the terminal:\n%s", format, term)
+		}
+		if format == "json" {
+			var rep jsonReport
+			if err := json.Unmarshal(data, &rep); err != nil {
+				t.Errorf("-o JSON does not parse: %v", err)
+			}
+		}
+	}
+}
+
+func TestRunOutputFileFailureLeavesNoFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a file name containing the delimiter")
+	}
+	tmpDir := createTestDir(t, map[string]string{
+		"a|b/big.bin": strings.Repeat("x", 2000),
+	})
+	defer os.RemoveAll(tmpDir)
+	outDir := t.TempDir()
+	path := filepath.Join(outDir, "out.tsv")
+	if err := os.WriteFile(path, []byte("previous run\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	resetResults()
+	// Formatting fails once the scan is done: the path holds the delimiter.
+	if _, err := runCaptured(t, "-format=tsv", "-delimiter=|", "-o", path, tmpDir, "1K"); err == nil {
+		t.Fatal("run succeeded, want a TSV error")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "previous run\n" {
+		t.Errorf("-o file = %q after a failed run, want it untouched", data)
+	}
+	if names := dirNames(t, outDir); len(names) != 1 {
+		t.Errorf("output directory holds %v, want no temporary files", names)
+	}
+}
@@ -0,0 +1,31 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"sync"
+	"syscall"
+)
+
+// newFileMode is the mode a plain create gives a new file: 0666 less the
+// umask. Reading the umask means setting it, so it is read once.
+var newFileMode = sync.OnceValue(func() os.FileMode {
+	mask := syscall.Umask(0)
+	syscall.Umask(mask)
+	return 0o666 &^ os.FileMode(mask)
+})
+
+// syncDir flushes the directory dir, so that a rename into it survives a
+// crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
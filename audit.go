@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Classes of discrepancy between the two passes of -audit-determinism.
+const (
+	auditChanged     = "changed"     // the filesystem changed between or during the passes
+	auditError       = "error"       // an entry could not be read in one pass
+	auditUnexplained = "unexplained" // neither: a bug in the walk
+)
+
+// changeLog collects the paths the walk finds modified since an audit
+// began: files by their modification time, directories by their own,
+// which moves when an entry is created, removed or renamed in them. It is
+// nil unless -audit-determinism is given.
+type changeLog struct {
+	since time.Time
+
+	mu    sync.Mutex
+	paths map[string]bool
+}
+
+// auditChanges is the log of the pass under way, if any.
+var auditChanges *changeLog
+
+// newChangeLog starts a log of changes at or after since. since is
+// truncated to the second, so that filesystems keeping coarse times do
+// not hide a change made in the second the audit began.
+func newChangeLog(since time.Time) *changeLog {
+	return &changeLog{since: since.Truncate(time.Second), paths: make(map[string]bool)}
+}
+
+// noteFile records path if its modification time is recent.
+func (c *changeLog) noteFile(path string, mtime time.Time) {
+	if !mtime.Before(c.since) {
+		c.mu.Lock()
+		c.paths[path] = true
+		c.mu.Unlock()
+	}
+}
+
+// noteDir records the directory at path if its own modification time is
+// recent. It costs a stat per directory, which only the audit pays.
+func (c *changeLog) noteDir(path string) {
+	if fi, err := os.Lstat(path); err == nil {
+		c.noteFile(path, fi.ModTime())
+	}
+}
+
+// auditPass is what one pass of the audit saw.
+type auditPass struct {
+	Since   time.Time // when the audit began, as changes are timed
+	Total   subtreeStats
+	Results map[string]FileInfo // the listed entries and the root
+	Skipped map[string]int      // directories with unreadable entries
+	Changed map[string]bool     // recently modified paths
+}
+
+// discrepancy is an entry the two passes disagree on. First or Second is
+// nil when the entry was listed in only one pass.
+type discrepancy struct {
+	Path          string
+	First, Second *FileInfo
+	Class         string
+	Reason        string
+}
+
+// runDeterminismAudit walks root twice and reports where the passes
+// disagree. With serial the second pass lists one directory at a time,
+// which tells a race in the accumulation from a change on disk. Only
+// unexplained discrepancies fail the run.
+func runDeterminismAudit(root string, threshold uint64, excludeSet map[string]struct{}, serial bool) error {
+	since := time.Now()
+	var passes [2]auditPass
+	for i := range passes {
+		p, err := auditWalk(root, threshold, excludeSet, since, serial && i == 1)
+		if err != nil {
+			return err
+		}
+		passes[i] = p
+	}
+	ds := diffPasses(passes[0], passes[1])
+	for i := range ds {
+		ds[i].Class, ds[i].Reason = classifyDiscrepancy(ds[i], passes[0], passes[1])
+	}
+	return printAudit(root, passes, ds, serial)
+}
+
+// auditWalk runs one pass of the audit over a fresh result list.
+func auditWalk(root string, threshold uint64, excludeSet map[string]struct{}, since time.Time, serial bool) (auditPass, error) {
+	resultsMutex.Lock()
+	results = nil
+	resultsMutex.Unlock()
+	skippedMutex.Lock()
+	skippedEntries = make(map[string]int)
+	skippedMutex.Unlock()
+	auditChanges = newChangeLog(since)
+	defer func() { auditChanges = nil }()
+	if serial {
+		old := walkWorkers
+		walkWorkers = 1
+		defer func() { walkWorkers = old }()
+	}
+
+	total, err := walkDir(root, threshold, excludeSet)
+	if err != nil {
+		return auditPass{}, err
+	}
+	p := auditPass{Since: auditChanges.since, Total: total, Results: make(map[string]FileInfo), Skipped: skippedEntries, Changed: auditChanges.paths}
+	for _, res := range results {
+		p.Results[res.Path] = res
+	}
+	p.Results[root] = FileInfo{Path: root, Size: total.Size, IsDir: true}
+	return p, nil
+}
+
+// diffPasses returns the entries listed in only one pass or at different
+// sizes, in path order.
+func diffPasses(a, b auditPass) []discrepancy {
+	var ds []discrepancy
+	for path, ra := range a.Results {
+		rb, ok := b.Results[path]
+		switch {
+		case !ok:
+			ds = append(ds, discrepancy{Path: path, First: &ra})
+		case ra.Size != rb.Size || ra.IsDir != rb.IsDir:
+			ds = append(ds, discrepancy{Path: path, First: &ra, Second: &rb})
+		}
+	}
+	for path, rb := range b.Results {
+		if _, ok := a.Results[path]; !ok {
+			ds = append(ds, discrepancy{Path: path, Second: &rb})
+		}
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i].Path < ds[j].Path })
+	return ds
+}
+
+// classifyDiscrepancy decides why d's passes disagree. Errors come first:
+// an unreadable entry in or below d, or beside a file listed only once,
+// explains it. Then changes: a path in or below d, or the directory
+// holding it, modified since the audit began, or a re-stat of d now
+// finding it gone or modified.
+func classifyDiscrepancy(d discrepancy, a, b auditPass) (class, reason string) {
+	parent := filepath.Dir(d.Path)
+	for i, p := range []auditPass{a, b} {
+		for dir, n := range p.Skipped {
+			if pathWithin(dir, d.Path) || dir == parent && (d.First == nil || d.Second == nil) {
+				return auditError, fmt.Sprintf("%d unreadable %s in %s in the %s pass", n, plural(n, "entry", "entries"), displayPath(dir), passName(i))
+			}
+		}
+	}
+	for _, p := range []auditPass{a, b} {
+		for path := range p.Changed {
+			if pathWithin(path, d.Path) || path == parent {
+				return auditChanged, displayPath(path) + " was modified since the audit began"
+			}
+		}
+	}
+	fi, err := os.Lstat(d.Path)
+	switch {
+	case err != nil && d.Second != nil:
+		return auditChanged, "no longer exists"
+	case err == nil && !fi.ModTime().Before(a.Since):
+		return auditChanged, "was modified since the audit began"
+	}
+	return auditUnexplained, "no error or change on disk accounts for it"
+}
+
+func passName(i int) string {
+	if i == 0 {
+		return "first"
+	}
+	return "second"
+}
+
+// describePass formats an entry as listed in one pass.
+func describePass(res *FileInfo) string {
+	if res == nil {
+		return "not listed"
+	}
+	return humanReadableSize(res.Size)
+}
+
+// printAudit writes the audit report. Unexplained discrepancies are
+// dumped in full, for a bug report, and fail the run.
+func printAudit(root string, passes [2]auditPass, ds []discrepancy, serial bool) error {
+	fmt.Fprintf(stdout, "\nDeterminism audit of %s:\n", displayPath(root))
+	for i, p := range passes {
+		label := passName(i) + " pass"
+		if i == 1 && serial {
+			label += ", one worker"
+		}
+		fmt.Fprintf(stdout, "  %s: %s in %d files and %d directories, %d unreadable entries\n",
+			label, humanReadableSize(p.Total.Size), p.Total.Files, p.Total.Dirs, skippedCount(p.Skipped))
+	}
+	if len(ds) == 0 {
+		fmt.Fprintln(stdout, "The passes agree on every listed entry.")
+		return nil
+	}
+	fmt.Fprintf(stdout, "%d %s:\n", len(ds), plural(len(ds), "discrepancy", "discrepancies"))
+	unexplained := 0
+	for _, d := range ds {
+		fmt.Fprintf(stdout, "  %-11s  %s: %s -> %s; %s\n", d.Class, displayPath(d.Path), describePass(d.First), describePass(d.Second), d.Reason)
+		if d.Class == auditUnexplained {
+			unexplained++
+			fmt.Fprintf(stdout, "               first:  %+v\n               second: %+v\n", d.First, d.Second)
+		}
+	}
+	if unexplained > 0 {
+		return fmt.Errorf("error: %d unexplained %s between the passes; please report them with the details above",
+			unexplained, plural(unexplained, "discrepancy", "discrepancies"))
+	}
+	return nil
+}
+
+// skippedCount sums the unreadable entries of a pass.
+func skippedCount(skipped map[string]int) int {
+	n := 0
+	for _, k := range skipped {
+		n += k
+	}
+	return n
+}
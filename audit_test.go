@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// auditLines returns the discrepancy lines of an audit report, keyed by
+// the path relative to root.
+func auditLines(t *testing.T, root, out string) map[string]string {
+	t.Helper()
+	lines := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.HasSuffix(fields[1], ":") {
+			continue
+		}
+		switch fields[0] {
+		case auditChanged, auditError, auditUnexplained:
+			lines[canonicalPath(root, strings.TrimSuffix(fields[1], ":"))] = fields[0]
+		}
+	}
+	return lines
+}
+
+func TestAuditCleanTree(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"a/f": strings.Repeat("x", 3000),
+		"b/g": strings.Repeat("x", 2000),
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+
+	resetResults()
+	out, err := runCaptured(t, "-audit-determinism", "-audit-serial", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("audit: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "The passes agree on every listed entry.") || strings.Contains(out, "TYPE") {
+		t.Errorf("clean tree reported discrepancies or a listing:\n%s", out)
+	}
+}
+
+func TestAuditClassifiesDiscrepancies(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"grow/f":  strings.Repeat("x", 2000),
+		"flaky/g": strings.Repeat("x", 2000),
+		"calm/h":  strings.Repeat("x", 2000),
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+
+	// The first listing of flaky fails; the second listing of grow comes
+	// after its file has grown.
+	listed := make(map[string]int)
+	old := readDir
+	readDir = func(name string) ([]fs.DirEntry, error) {
+		base := filepath.Base(name)
+		listed[base]++
+		switch {
+		case base == "flaky" && listed[base] == 1:
+			return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EACCES}
+		case base == "grow" && listed[base] == 2:
+			if err := os.WriteFile(filepath.Join(name, "f"), []byte(strings.Repeat("x", 5000)), 0o644); err != nil {
+				t.Error(err)
+			}
+		}
+		return old(name)
+	}
+	defer func() { readDir = old }()
+
+	resetResults()
+	out, err := runCaptured(t, "-audit-determinism", "-workers=1", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("audit: %v\n%s", err, out)
+	}
+	got := auditLines(t, tmpDir, out)
+	want := map[string]string{
+		"grow":    auditChanged,
+		"grow/f":  auditChanged,
+		"flaky":   auditError,
+		"flaky/g": auditError,
+	}
+	for path, class := range want {
+		if got[path] != class {
+			t.Errorf("%s classified %q, want %q\n%s", path, got[path], class, out)
+		}
+	}
+	if _, ok := got["calm"]; ok {
+		t.Errorf("unchanged directory reported:\n%s", out)
+	}
+	if _, ok := got["."]; !ok {
+		t.Errorf("root total difference not reported:\n%s", out)
+	}
+}
+
+func TestAuditUnexplained(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "f")
+	if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Nothing on disk is newer than an audit that began in an hour.
+	since := time.Now().Add(time.Hour)
+	a := auditPass{Since: since, Results: map[string]FileInfo{path: {Path: path, Size: 100}}}
+	b := auditPass{Since: since, Results: map[string]FileInfo{path: {Path: path, Size: 200}}}
+	ds := diffPasses(a, b)
+	if len(ds) != 1 {
+		t.Fatalf("got %d discrepancies, want 1", len(ds))
+	}
+	if class, _ := classifyDiscrepancy(ds[0], a, b); class != auditUnexplained {
+		t.Errorf("class = %q, want %q", class, auditUnexplained)
+	}
+	ds[0].Class = auditUnexplained
+	var buf bytes.Buffer
+	stdout, stderr = newOutputs(&buf, &buf, true)
+	defer setupOutput(os.Stdout, os.Stderr)
+	if err := printAudit(dir, [2]auditPass{a, b}, ds, false); err == nil {
+		t.Error("unexplained discrepancy did not fail the audit")
+	}
+	if !strings.Contains(buf.String(), "first:  &{Path:"+path) {
+		t.Errorf("unexplained discrepancy not dumped in full:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// baselineVersion is the format version written to and accepted from
+// baseline files.
+const baselineVersion = 1
+
+// defaultBaselineTolerance is the growth a new baseline allows tracked
+// files; edit the file to change it.
+const defaultBaselineTolerance = "5%"
+
+// baselineFile is the committed state that spacehogs check compares a
+// scan against. Paths are relative to the scan root with forward slashes,
+// so one baseline serves every checkout. Only files are tracked:
+// directory totals are policed with allowances instead.
+type baselineFile struct {
+	Version int `json:"version"`
+	// Tolerance is how far a tracked file may grow, as a size such as
+	// "1M" or a share of its recorded size such as "10%".
+	Tolerance  string              `json:"tolerance"`
+	Entries    []baselineEntry     `json:"entries"`
+	Allowances []baselineAllowance `json:"allowances,omitempty"`
+	// Options and Fingerprint record how the scan that wrote the entries
+	// was run, for check to compare with its own.
+	Options     *scanOptions `json:"options,omitempty"`
+	Fingerprint string       `json:"fingerprint,omitempty"`
+}
+
+// baselineEntry is one tracked file at its recorded size.
+type baselineEntry struct {
+	Path string `json:"path"`
+	Size uint64 `json:"size"`
+	// Tolerance overrides the file-wide tolerance for this entry.
+	Tolerance string `json:"tolerance,omitempty"`
+}
+
+// baselineAllowance caps the total size of every file matching Glob,
+// such as "assets/**" with a Total of "50M". Files it matches are exempt
+// from the per-file checks.
+type baselineAllowance struct {
+	Glob  string `json:"glob"`
+	Total string `json:"total"`
+}
+
+// tolerance is a parsed growth allowance: either bytes or percent.
+type tolerance struct {
+	bytes   uint64
+	percent float64
+}
+
+// parseTolerance parses "10%" or a size such as "1M".
+func parseTolerance(s string) (tolerance, error) {
+	if p, ok := strings.CutSuffix(strings.TrimSpace(s), "%"); ok {
+		pct, err := strconv.ParseFloat(p, 64)
+		if err != nil || pct < 0 {
+			return tolerance{}, fmt.Errorf("invalid tolerance %q", s)
+		}
+		return tolerance{percent: pct}, nil
+	}
+	n, err := parseSize(s)
+	if err != nil {
+		return tolerance{}, fmt.Errorf("invalid tolerance %q: %v", s, err)
+	}
+	return tolerance{bytes: n}, nil
+}
+
+// allowed is the largest size a file recorded at size may grow to.
+func (t tolerance) allowed(size uint64) uint64 {
+	if t.percent > 0 {
+		return addSize(size, uint64(float64(size)*t.percent/100))
+	}
+	return addSize(size, t.bytes)
+}
+
+// matchGlob reports whether name matches pattern, both slash-separated.
+// A "**" component matches any number of components, including none;
+// other components follow path.Match.
+func matchGlob(pattern, name string) bool {
+	return matchComponents(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchComponents(pat, name []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			for i := len(name); i >= 0; i-- {
+				if matchComponents(pat[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], name[0]); !ok {
+			return false
+		}
+		pat, name = pat[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// readBaseline loads and validates a baseline file.
+func readBaseline(name string) (*baselineFile, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var b baselineFile
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&b); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if b.Version != baselineVersion {
+		return nil, fmt.Errorf("%s: unsupported version %d, want %d", name, b.Version, baselineVersion)
+	}
+	if _, err := parseTolerance(b.Tolerance); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	for _, e := range b.Entries {
+		if e.Tolerance == "" {
+			continue
+		}
+		if _, err := parseTolerance(e.Tolerance); err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", name, e.Path, err)
+		}
+	}
+	for _, a := range b.Allowances {
+		if _, err := path.Match(strings.ReplaceAll(a.Glob, "**", "*"), ""); err != nil {
+			return nil, fmt.Errorf("%s: glob %q: %v", name, a.Glob, err)
+		}
+		if _, err := parseSize(a.Total); err != nil {
+			return nil, fmt.Errorf("%s: allowance %s: %v", name, a.Glob, err)
+		}
+	}
+	return &b, nil
+}
+
+// allowanceTally sums file sizes per allowance glob during the walk, over
+// every file rather than only the listed ones. It is nil unless
+// spacehogs check is comparing against a baseline with allowances.
+type allowanceTally struct {
+	root  string
+	globs []string
+
+	mu     sync.Mutex
+	totals []uint64
+}
+
+// allowances is the active tally, if any.
+var allowances *allowanceTally
+
+// newAllowanceTally returns an empty tally for the globs of b.
+func newAllowanceTally(root string, b *baselineFile) *allowanceTally {
+	t := &allowanceTally{root: root, totals: make([]uint64, len(b.Allowances))}
+	for _, a := range b.Allowances {
+		t.globs = append(t.globs, a.Glob)
+	}
+	return t
+}
+
+// add counts a file of size bytes at path.
+func (t *allowanceTally) add(path string, size uint64) {
+	rel := canonicalPath(t.root, path)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, g := range t.globs {
+		if matchGlob(g, rel) {
+			t.totals[i] = addSize(t.totals[i], size)
+		}
+	}
+}
+
+// baselineViolation is one way a scan breaks its baseline.
+type baselineViolation struct {
+	Kind   string // "grew", "new" or "total"
+	Path   string // the file, or the allowance glob
+	Detail string
+}
+
+// compareBaseline returns the violations of the listed results, which are
+// at or over threshold, against b: tracked files grown past their
+// tolerance, untracked files, and allowances whose total in tally is
+// exceeded. shrunk counts tracked files now smaller or gone, which
+// -update-baseline would ratchet down.
+func compareBaseline(b *baselineFile, root string, threshold uint64, tally *allowanceTally, lists ...[]FileInfo) (vs []baselineViolation, shrunk int) {
+	def, _ := parseTolerance(b.Tolerance)
+	tracked := make(map[string]baselineEntry, len(b.Entries))
+	for _, e := range b.Entries {
+		tracked[e.Path] = e
+	}
+	seen := make(map[string]bool)
+	for _, list := range lists {
+		for _, res := range list {
+			if res.IsDir {
+				continue
+			}
+			rel := canonicalPath(root, res.Path)
+			if b.allowanceFor(rel) {
+				continue
+			}
+			seen[rel] = true
+			e, ok := tracked[rel]
+			if !ok {
+				vs = append(vs, baselineViolation{"new", rel, fmt.Sprintf("%s, at or over the %s limit for untracked files", humanReadableSize(res.Size), humanReadableSize(threshold))})
+				continue
+			}
+			tol := def
+			if e.Tolerance != "" {
+				tol, _ = parseTolerance(e.Tolerance)
+			}
+			if limit := tol.allowed(e.Size); res.Size > limit {
+				vs = append(vs, baselineViolation{"grew", rel, fmt.Sprintf("%s -> %s, allowed %s", humanReadableSize(e.Size), humanReadableSize(res.Size), humanReadableSize(limit))})
+			} else if res.Size < e.Size {
+				shrunk++
+			}
+		}
+	}
+	for _, e := range b.Entries {
+		if !seen[e.Path] && !b.allowanceFor(e.Path) {
+			shrunk++
+		}
+	}
+	for i, a := range b.Allowances {
+		limit, _ := parseSize(a.Total)
+		if tally != nil && tally.totals[i] > limit {
+			vs = append(vs, baselineViolation{"total", a.Glob, fmt.Sprintf("%s, allowed %s", humanReadableSize(tally.totals[i]), humanReadableSize(limit))})
+		}
+	}
+	sort.SliceStable(vs, func(i, j int) bool {
+		if vs[i].Kind != vs[j].Kind {
+			return vs[i].Kind < vs[j].Kind
+		}
+		return vs[i].Path < vs[j].Path
+	})
+	return vs, shrunk
+}
+
+// allowanceFor reports whether an allowance governs rel.
+func (b *baselineFile) allowanceFor(rel string) bool {
+	for _, a := range b.Allowances {
+		if matchGlob(a.Glob, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// baselineError is returned when a scan breaks its baseline.
+type baselineError struct {
+	File       string
+	Violations int
+}
+
+func (e *baselineError) Error() string {
+	return fmt.Sprintf("baseline check failed: %d %s against %s", e.Violations, plural(e.Violations, "violation", "violations"), e.File)
+}
+
+// printBaselineCheck writes the violations, one per line so that CI logs
+// show each.
+func printBaselineCheck(file string, vs []baselineViolation, shrunk int) {
+	if len(vs) == 0 {
+		fmt.Fprintf(stdout, "\nBaseline %s: no violations.\n", file)
+	} else {
+		fmt.Fprintf(stdout, "\nBaseline %s: %d %s:\n", file, len(vs), plural(len(vs), "violation", "violations"))
+		for _, v := range vs {
+			fmt.Fprintf(stdout, "  %-6s %s  %s\n", strings.ToUpper(v.Kind), v.Path, v.Detail)
+		}
+	}
+	if shrunk > 0 {
+		fmt.Fprintf(stdout, "%d tracked %s smaller or gone; -update-baseline lowers the baseline to match.\n", shrunk, plural(shrunk, "file is", "files are"))
+	}
+}
+
+// updateBaseline writes the listed files to the baseline at name, keeping
+// the tolerance, allowances and per-entry tolerances of an existing one
+// and recording opts as the scan's options. Files an allowance governs are
+// left out.
+func updateBaseline(name, root string, opts scanOptions, lists ...[]FileInfo) (int, error) {
+	b, err := readBaseline(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		b, err = &baselineFile{Version: baselineVersion, Tolerance: defaultBaselineTolerance}, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	kept := make(map[string]string)
+	for _, e := range b.Entries {
+		if e.Tolerance != "" {
+			kept[e.Path] = e.Tolerance
+		}
+	}
+	b.Entries = []baselineEntry{}
+	for _, list := range lists {
+		for _, res := range list {
+			rel := canonicalPath(root, res.Path)
+			if res.IsDir || b.allowanceFor(rel) {
+				continue
+			}
+			b.Entries = append(b.Entries, baselineEntry{Path: rel, Size: res.Size, Tolerance: kept[rel]})
+		}
+	}
+	sort.Slice(b.Entries, func(i, j int) bool { return b.Entries[i].Path < b.Entries[j].Path })
+	b.Options, b.Fingerprint = &opts, opts.fingerprint()
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	return len(b.Entries), replaceFile(name, append(data, '\n'))
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"assets/**", "assets/img/logo.png", true},
+		{"assets/**", "assets", true},
+		{"assets/**", "src/assets/x", false},
+		{"**/*.bin", "a/b/c.bin", true},
+		{"**/*.bin", "c.bin", true},
+		{"*.bin", "a/c.bin", false},
+		{"a/**/z", "a/b/c/z", true},
+		{"a/**/z", "a/z", true},
+	} {
+		if got := matchGlob(tc.pattern, tc.name); got != tc.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tc.pattern, tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParseTolerance(t *testing.T) {
+	if tol, err := parseTolerance("10%"); err != nil || tol.allowed(1000) != 1100 {
+		t.Errorf("10%% of 1000 allows %d, err %v", tol.allowed(1000), err)
+	}
+	if tol, err := parseTolerance("1K"); err != nil || tol.allowed(1000) != 2024 {
+		t.Errorf("1K over 1000 allows %d, err %v", tol.allowed(1000), err)
+	}
+	for _, bad := range []string{"-5%", "lots", "x%"} {
+		if _, err := parseTolerance(bad); err == nil {
+			t.Errorf("parseTolerance(%q) accepted", bad)
+		}
+	}
+}
+
+// writeBaselineFile writes a baseline for the tests below.
+func writeBaselineFile(t *testing.T, body string) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "baseline.json")
+	if err := os.WriteFile(name, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestRunBaselineCheck(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"lib/core.bin":   strings.Repeat("c", 2100),
+		"lib/grown.bin":  strings.Repeat("g", 3000),
+		"assets/a.png":   strings.Repeat("a", 1500),
+		"assets/b.png":   strings.Repeat("b", 1500),
+		"vendor/new.tar": strings.Repeat("n", 1200),
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+
+	baseline := writeBaselineFile(t, `{
+  "version": 1,
+  "tolerance": "10%",
+  "entries": [
+    {"path": "lib/core.bin", "size": 2000},
+    {"path": "lib/grown.bin", "size": 2000},
+    {"path": "lib/gone.bin", "size": 5000}
+  ],
+  "allowances": [{"glob": "assets/**", "total": "2K"}]
+}`)
+	resetResults()
+	out, err := runCaptured(t, "check", "-no-hints", "-baseline="+baseline, tmpDir, "1K")
+	var be *baselineError
+	if !errors.As(err, &be) || be.Violations != 3 || exitCode(err) != exitBaselineViolation {
+		t.Fatalf("err = %v, want 3 baseline violations\n%s", err, out)
+	}
+	for _, want := range []string{
+		"  GREW   lib/grown.bin  1.95 KiB -> 2.93 KiB, allowed 2.15 KiB\n",
+		"  NEW    vendor/new.tar  1.17 KiB, at or over the 1.00 KiB limit for untracked files\n",
+		"  TOTAL  assets/**  2.93 KiB, allowed 2.00 KiB\n",
+		"1 tracked file is smaller or gone",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+	// 2100 bytes is within 10% of 2000: not a violation.
+	if strings.Contains(out, "  GREW   lib/core.bin") {
+		t.Errorf("growth within tolerance reported:\n%s", out)
+	}
+}
+
+func TestRunBaselineUpdate(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"big.bin":      strings.Repeat("b", 2000),
+		"assets/a.png": strings.Repeat("a", 2000),
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+
+	baseline := writeBaselineFile(t, `{"version": 1, "tolerance": "1K", "entries": [{"path": "big.bin", "size": 10, "tolerance": "0"}], "allowances": [{"glob": "assets/**", "total": "1M"}]}`)
+	resetResults()
+	if _, err := runCaptured(t, "check", "-baseline="+baseline, tmpDir, "1K"); err == nil {
+		t.Fatal("growth past a zero tolerance passed")
+	}
+
+	resetResults()
+	out, err := runCaptured(t, "check", "-update-baseline", "-baseline="+baseline, tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("update failed: %v\n%s", err, out)
+	}
+	b, err := readBaseline(baseline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The allowance still governs assets, and the settings are kept.
+	if b.Tolerance != "1K" || len(b.Allowances) != 1 || len(b.Entries) != 1 ||
+		b.Entries[0] != (baselineEntry{Path: "big.bin", Size: 2000, Tolerance: "0"}) {
+		t.Errorf("updated baseline = %+v", b)
+	}
+
+	resetResults()
+	if out, err := runCaptured(t, "check", "-baseline="+baseline, tmpDir, "1K"); err != nil {
+		t.Errorf("check against the updated baseline failed: %v\n%s", err, out)
+	}
+
+	// A fresh baseline gets the default tolerance.
+	fresh := filepath.Join(t.TempDir(), "new.json")
+	resetResults()
+	if _, err := runCaptured(t, "check", "-update-baseline", "-baseline="+fresh, tmpDir, "1K"); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := readBaseline(fresh); err != nil || b.Tolerance != defaultBaselineTolerance || len(b.Entries) != 2 {
+		t.Errorf("fresh baseline = %+v, %v", b, err)
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// blobSample is how many child names of a directory -detect-blobdirs
+// classifies, spread over its listing.
+const blobSample = 256
+
+// blobMinNames is the fewest names a verdict is drawn from: a handful of
+// hashes is a cache entry, not a dump.
+const blobMinNames = 8
+
+// Name patterns, in the order a dominant pattern is preferred on a tie.
+const (
+	blobUUID        = "uuid"
+	blobHex         = "hex"
+	blobBase64      = "base64"
+	blobRandom      = "random"
+	blobFixedLength = "fixed-length"
+)
+
+var blobPatterns = []string{blobUUID, blobHex, blobBase64, blobRandom, blobFixedLength}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// blobVerdict is what classifyNames makes of a directory's names.
+type blobVerdict struct {
+	// Fraction is the share of the sampled names that look generated.
+	Fraction float64
+	// Pattern is the most common generated pattern.
+	Pattern string
+	Sampled int
+}
+
+// nameStem strips a name's leading dots and its extensions, which are
+// chosen by people even where the rest is not: "3f2a….part" is hex.
+func nameStem(name string) string {
+	stem := strings.TrimLeft(name, ".")
+	if i := strings.IndexByte(stem, '.'); i > 0 {
+		stem = stem[:i]
+	}
+	return stem
+}
+
+// nameClass returns the generated pattern a single name matches, or "".
+// fixed-length is decided over the whole directory by classifyNames.
+func nameClass(name string) string {
+	stem := nameStem(name)
+	var upper, lower, digits, other int
+	for _, r := range stem {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			upper++
+		case r >= 'a' && r <= 'z':
+			lower++
+		case r >= '0' && r <= '9':
+			digits++
+		default:
+			other++
+		}
+	}
+	letters := upper + lower
+	switch {
+	case uuidPattern.MatchString(stem):
+		return blobUUID
+	case len(stem) >= 16 && isHex(stem):
+		return blobHex
+	case len(stem) >= 16 && digits > 0 && alnumOr(stem, "+-_=") &&
+		// Random base64 has about as many capitals as small letters;
+		// CamelCase names have a few.
+		upper*4 >= letters && lower*4 >= letters:
+		return blobBase64
+	case len(stem) >= 12 && other == 0 && digits > 0 && letters > 0 &&
+		longestRun(stem, unicode.IsLetter) <= 4 && longestRun(stem, unicode.IsDigit) <= 6 &&
+		nameEntropy(stem) >= 3.3:
+		return blobRandom
+	}
+	return ""
+}
+
+// classifyNames decides how machine-generated a directory's child names
+// look. Besides the per-name patterns, names that nearly all share one
+// length and mix letters and digits throughout, such as cache shards
+// named "a9f3k2x8", count as fixed-length.
+func classifyNames(names []string) blobVerdict {
+	v := blobVerdict{Sampled: len(names)}
+	if len(names) == 0 {
+		return v
+	}
+	counts := make(map[string]int)
+	lengths := make(map[int]int)
+	for _, name := range names {
+		lengths[len(nameStem(name))]++
+	}
+	common, commonN := 0, 0
+	for l, n := range lengths {
+		if n > commonN || n == commonN && l < common {
+			common, commonN = l, n
+		}
+	}
+	uniform := common >= 8 && commonN*10 >= len(names)*9
+	generated := 0
+	for _, name := range names {
+		class := nameClass(name)
+		if class == "" && uniform {
+			if stem := nameStem(name); len(stem) == common && transitions(stem) >= 3 {
+				class = blobFixedLength
+			}
+		}
+		if class != "" {
+			counts[class]++
+			generated++
+		}
+	}
+	v.Fraction = float64(generated) / float64(len(names))
+	best := 0
+	for _, p := range blobPatterns {
+		if counts[p] > best {
+			v.Pattern, best = p, counts[p]
+		}
+	}
+	return v
+}
+
+func isHex(s string) bool {
+	for _, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f' || r >= 'A' && r <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// alnumOr reports whether s has no characters but ASCII letters,
+// digits and those in extra.
+func alnumOr(s, extra string) bool {
+	for _, r := range s {
+		if !(r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) || strings.ContainsRune(extra, r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// longestRun is the length of the longest run of runes in s for which
+// is holds.
+func longestRun(s string, is func(rune) bool) int {
+	longest, run := 0, 0
+	for _, r := range s {
+		if is(r) {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return longest
+}
+
+// transitions counts the switches between letters and digits in s.
+func transitions(s string) int {
+	n := 0
+	var prev rune
+	for i, r := range s {
+		if i > 0 && unicode.IsDigit(r) != unicode.IsDigit(prev) {
+			n++
+		}
+		prev = r
+	}
+	return n
+}
+
+// nameEntropy is the Shannon entropy of s in bits per character.
+func nameEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	var h float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// sampleNames returns up to n of names, spread evenly over them.
+func sampleNames(names []string, n int) []string {
+	if len(names) <= n {
+		return names
+	}
+	sample := make([]string, n)
+	for i := range sample {
+		sample[i] = names[i*len(names)/n]
+	}
+	return sample
+}
+
+// blobDir is a directory -detect-blobdirs flags.
+type blobDir struct {
+	Path string
+	Size uint64
+	blobVerdict
+}
+
+// blobDirIndex collects the flagged directories during the walk. It is
+// nil unless -detect-blobdirs is given.
+type blobDirIndex struct {
+	cutoff float64 // percentage of generated names that flags a directory
+
+	mu    sync.Mutex
+	found []blobDir
+}
+
+// blobDirs is the active index, if any.
+var blobDirs *blobDirIndex
+
+func newBlobDirIndex(cutoff float64) *blobDirIndex {
+	return &blobDirIndex{cutoff: cutoff}
+}
+
+// record classifies the sampled names of a finished directory of size
+// bytes, keeping it if enough look generated.
+func (x *blobDirIndex) record(path string, size uint64, names []string) {
+	if len(names) < blobMinNames {
+		return
+	}
+	v := classifyNames(names)
+	if v.Fraction*100 < x.cutoff {
+		return
+	}
+	x.mu.Lock()
+	x.found = append(x.found, blobDir{Path: path, Size: size, blobVerdict: v})
+	x.mu.Unlock()
+}
+
+// print lists the flagged directories, largest first.
+func (x *blobDirIndex) print() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	sort.Slice(x.found, func(i, j int) bool {
+		if x.found[i].Size != x.found[j].Size {
+			return x.found[i].Size > x.found[j].Size
+		}
+		return x.found[i].Path < x.found[j].Path
+	})
+	fmt.Fprintf(stdout, "\nDirectories of machine-named files (at least %.0f%% of names look generated):\n", x.cutoff)
+	if len(x.found) == 0 {
+		fmt.Fprintln(stdout, "  none found")
+		return
+	}
+	for _, d := range x.found {
+		fmt.Fprintf(stdout, "  %-10s  %s  %.0f%% of %d sampled names, mostly %s\n",
+			humanReadableSize(d.Size), displayPath(d.Path), d.Fraction*100, d.Sampled, d.Pattern)
+	}
+}
+
+// addNames records a sample of child names of n for -detect-blobdirs. A
+// directory listed in two passes keeps a sample of each.
+func (n *dirNode) addNames(names []string) {
+	n.mu.Lock()
+	n.names = append(n.names, sampleNames(names, blobSample)...)
+	n.mu.Unlock()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// uuidNames returns n UUID-style file names.
+func uuidNames(n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("%08x-4b1c-4e2a-9f3d-%012x", 0x3c5a91f0+i*7919, 0x1a2b3c4d5e6f+i*104729)
+	}
+	return names
+}
+
+var sourceTreeNames = []string{
+	"README.md", "LICENSE", "go.mod", "main.go", "main_test.go", "walkqueue.go",
+	"internal", "cmd", "docs", ".gitignore", "Makefile", "CHANGELOG.md", "config_linux.go",
+	"MyDocument2023Final.docx", "IMG_20230105_123456.jpg", "DSC01234.JPG", "deadline-notes.txt",
+}
+
+func TestNameClass(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{"3f1c9a2e-4b1c-4e2a-9f3d-7a8b9c0d1e2f", blobUUID},
+		{"3F1C9A2E-4B1C-4E2A-9F3D-7A8B9C0D1E2F.tmp", blobUUID},
+		{"da39a3ee5e6b4b0d3255bfef95601890afd80709", blobHex},
+		{"d41d8cd98f00b204e9800998ecf8427e.chunk", blobHex},
+		{"aGVsbG8gV29ybGQhIFRoaXM9", blobBase64},
+		{"k3j5h2l9x8q1", blobRandom},
+		{"MyDocument2023Final", ""},
+		{"IMG_20230105_123456", ""},
+		{"walkqueue_test", ""},
+		{"deadbeef", ""}, // too short to tell from a word
+		{".gitignore", ""},
+	}
+	for _, tc := range tests {
+		if got := nameClass(tc.name); got != tc.want {
+			t.Errorf("nameClass(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestClassifyNames(t *testing.T) {
+	if v := classifyNames(uuidNames(40)); v.Fraction != 1 || v.Pattern != blobUUID {
+		t.Errorf("UUID directory: %+v, want all uuid", v)
+	}
+	if v := classifyNames(sourceTreeNames); v.Fraction > 0.1 {
+		t.Errorf("source tree: %+v, want next to nothing generated", v)
+	}
+	shards := []string{"a9f3k2x8", "b7d2m4q1", "c8e1n5r3", "d6g4p7s2", "e5h3t8u9", "f4j6v1w7", "g3k9x2y5", "h1l8z4a6", "i2m7b3c8", "j0n5d9e4"}
+	if v := classifyNames(shards); v.Fraction != 1 || v.Pattern != blobFixedLength {
+		t.Errorf("cache shards: %+v, want all fixed-length", v)
+	}
+	if v := classifyNames(nil); v.Fraction != 0 || v.Pattern != "" {
+		t.Errorf("no names: %+v", v)
+	}
+}
+
+func TestBlobDirCutoff(t *testing.T) {
+	normal := []string{"index.html", "style.css", "notes.txt", "build", "vendor"}
+	mixed := func(generated, other int) []string {
+		return append(uuidNames(generated), normal[:other]...)
+	}
+	tests := []struct {
+		names   []string
+		flagged bool
+	}{
+		{mixed(16, 4), true},  // 80%, at the cutoff
+		{mixed(15, 4), false}, // 79%
+		{mixed(6, 0), false},  // too few names to judge
+	}
+	for i, tc := range tests {
+		x := newBlobDirIndex(80)
+		x.record("/d", 1<<20, tc.names)
+		if got := len(x.found) == 1; got != tc.flagged {
+			t.Errorf("case %d (%d names, %.0f%% generated): flagged = %v, want %v",
+				i, len(tc.names), classifyNames(tc.names).Fraction*100, got, tc.flagged)
+		}
+	}
+}
+
+func TestDetectBlobDirs(t *testing.T) {
+	files := map[string]string{}
+	for _, name := range uuidNames(20) {
+		files["uploads/"+name] = strings.Repeat("x", 200)
+	}
+	for _, name := range sourceTreeNames {
+		files["src/"+name] = strings.Repeat("x", 200)
+	}
+	tmpDir := createTestDir(t, files)
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+
+	resetResults()
+	out, err := runCaptured(t, "-detect-blobdirs", tmpDir, "2K")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	_, report, _ := strings.Cut(out, "Directories of machine-named files")
+	if !strings.Contains(report, filepath.Join(tmpDir, "uploads")+"  100% of 20 sampled names, mostly uuid") {
+		t.Errorf("uploads not flagged:\n%s", out)
+	}
+	if strings.Contains(report, filepath.Join(tmpDir, "src")) {
+		t.Errorf("source tree flagged:\n%s", out)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// canonicalPath returns path relative to root with forward slashes, the
+// form -canonical-paths writes to artifacts so that scans of the same tree
+// on different platforms compare equal. The root itself is ".".
+func canonicalPath(root, path string) string {
+	return relSlash(root, path, filepath.Separator)
+}
+
+// relSlash is canonicalPath for paths using sep as the separator. It works
+// on the strings alone, so Windows paths can be handled on any platform.
+// A path outside root keeps its full form, with sep turned into slashes.
+func relSlash(root, path string, sep byte) string {
+	if path == root {
+		return "."
+	}
+	prefix := root
+	if !strings.HasSuffix(prefix, string(sep)) {
+		prefix += string(sep)
+	}
+	rel, ok := strings.CutPrefix(path, prefix)
+	if !ok || rel == "" {
+		rel = path
+	}
+	if sep != '/' {
+		rel = strings.ReplaceAll(rel, string(sep), "/")
+	}
+	return rel
+}
+
+// canonicalResults returns a copy of list with canonical paths.
+func canonicalResults(root string, list []FileInfo) []FileInfo {
+	out := make([]FileInfo, len(list))
+	for i, res := range list {
+		res.Path = canonicalPath(root, res.Path)
+		out[i] = res
+	}
+	return out
+}
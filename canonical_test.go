@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRelSlashMatchesAcrossPlatforms(t *testing.T) {
+	linux := []string{"/srv/data", "/srv/data/a", "/srv/data/a/b.bin", "/srv/data/c"}
+	windows := []string{`D:\data`, `D:\data\a`, `D:\data\a\b.bin`, `D:\data\c`}
+	want := []string{".", "a", "a/b.bin", "c"}
+	for i := range want {
+		if got := relSlash(linux[0], linux[i], '/'); got != want[i] {
+			t.Errorf("relSlash(%q, %q, '/') = %q, want %q", linux[0], linux[i], got, want[i])
+		}
+		if got := relSlash(windows[0], windows[i], '\\'); got != want[i] {
+			t.Errorf(`relSlash(%q, %q, '\\') = %q, want %q`, windows[0], windows[i], got, want[i])
+		}
+	}
+
+	tests := []struct {
+		root, path string
+		sep        byte
+		want       string
+	}{
+		{`C:\`, `C:\Users\x`, '\\', "Users/x"},
+		{"/", "/var/log", '/', "var/log"},
+		{"/srv/data", "/srv/database", '/', "/srv/database"}, // Not below root
+		{`C:\data`, `E:\other\x`, '\\', "E:/other/x"},
+	}
+	for _, tt := range tests {
+		if got := relSlash(tt.root, tt.path, tt.sep); got != tt.want {
+			t.Errorf("relSlash(%q, %q) = %q, want %q", tt.root, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRunCanonicalPathsJSON(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"dir/big.bin": strings.Repeat("x", 200),
+	})
+	defer os.RemoveAll(tmpDir)
+
+	fakeMounts(t, nil)
+	resetResults()
+	out, err := runCaptured(t, "-format=json", "-canonical-paths", "-exclude=nothing", tmpDir, "100B")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	var got jsonReport
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("output is not a JSON document: %v\n%s", err, out)
+	}
+	if got.Root != tmpDir || !got.CanonicalPaths {
+		t.Errorf("root = %q, canonical_paths = %v; want %q, true", got.Root, got.CanonicalPaths, tmpDir)
+	}
+	var paths []string
+	for _, e := range got.Entries {
+		paths = append(paths, e.Path)
+	}
+	if want := []string{".", "dir", "dir/big.bin"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("paths = %q, want %q", paths, want)
+	}
+}
+
+func TestRunCanonicalPathsKeepsTextNative(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"dir/big.bin": strings.Repeat("x", 200),
+	})
+	defer os.RemoveAll(tmpDir)
+
+	fakeMounts(t, nil)
+	resetResults()
+	out, err := runCaptured(t, "-canonical-paths", "-exclude=nothing", tmpDir, "100B")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	if want := filepath.Join(tmpDir, "dir", "big.bin"); !strings.Contains(out, want) {
+		t.Errorf("text output does not list %s:\n%s", want, out)
+	}
+}
+
+func TestTrendComparesCanonicalPaths(t *testing.T) {
+	now := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	native := historyRecord{Time: now, Root: filepath.FromSlash("/srv/data"), Total: 10,
+		Top: []historyEntry{{Path: filepath.FromSlash("/srv/data/a/b.bin"), Size: 10}}}
+	windows := historyRecord{Time: now.Add(time.Hour), Root: `D:\data`, Total: 20,
+		Top: []historyEntry{{Path: `D:\data\a\b.bin`, Size: 20}}}
+	for i := range windows.Top {
+		windows.Top[i].Path = relSlash(windows.Root, windows.Top[i].Path, '\\')
+	}
+	windows.CanonicalPaths = true
+
+	if got, want := native.trendKey(native.Top[0], true), "a/b.bin"; got != want {
+		t.Errorf("native key = %q, want %q", got, want)
+	}
+	if got, want := windows.trendKey(windows.Top[0], true), "a/b.bin"; got != want {
+		t.Errorf("canonical key = %q, want %q", got, want)
+	}
+	if got, want := native.trendKey(native.Top[0], false), filepath.FromSlash("/srv/data/a/b.bin"); got != want {
+		t.Errorf("key without canonical runs = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// checkWritable reports whether path can be written as an output file,
+// without changing it: an existing file is opened for appending, and a new
+// one is probed with a temporary file in the directory that would hold it.
+// Outputs are checked before the walk so that a typo in a destination does
+// not surface only after a long scan.
+func checkWritable(path string) error {
+	fi, err := os.Stat(path)
+	switch {
+	case err == nil:
+		if fi.IsDir() {
+			return fmt.Errorf("%s is a directory", path)
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	case errors.Is(err, fs.ErrNotExist):
+		probe, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".probe*")
+		if err != nil {
+			return err
+		}
+		probe.Close()
+		return os.Remove(probe.Name())
+	default:
+		return err
+	}
+}
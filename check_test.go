@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckValidatesWithoutScanning(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{"big": strings.Repeat("x", 100)})
+	defer os.RemoveAll(tmpDir)
+	notDir := filepath.Join(tmpDir, "big")
+	history := filepath.Join(tmpDir, "out", "history.jsonl")
+	if err := os.Mkdir(filepath.Dir(history), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"valid", []string{"-history=" + history, "-heatmap=" + filepath.Join(tmpDir, "out", "h.csv"), tmpDir, "1B"}, ""},
+		{"size", []string{tmpDir, "12Q"}, "invalid size format"},
+		{"missing root", []string{filepath.Join(tmpDir, "nope"), "1B"}, "error accessing"},
+		{"root not a directory", []string{notDir, "1B"}, "is not a directory"},
+		{"buckets", []string{"-heatmap=" + filepath.Join(tmpDir, "h.csv"), "-buckets=1G,1M", tmpDir, "1B"}, "-buckets: bucket edges must be ascending"},
+		{"destination spec", []string{"-out=email:root", tmpDir, "1B"}, "-out:"},
+		{"output dir", []string{"-history=" + filepath.Join(tmpDir, "missing", "h.jsonl"), tmpDir, "1B"}, "-history: cannot write"},
+		{"listing", []string{"-from-listing=" + filepath.Join(tmpDir, "none.lst"), tmpDir, "1B"}, "-from-listing:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetResults()
+			out, err := runCaptured(t, append([]string{"-check"}, tt.args...)...)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("run failed: %v", err)
+				}
+				if !strings.Contains(out, "Configuration OK") {
+					t.Errorf("output does not confirm the configuration:\n%s", out)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want it to mention %q", err, tt.wantErr)
+			}
+			if len(results) != 0 || strings.Contains(out, "TYPE   SIZE") {
+				t.Errorf("-check scanned the tree:\n%s", out)
+			}
+		})
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(history))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("-check left files behind: %v", entries)
+	}
+}
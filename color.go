@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ANSI select graphic rendition sequences used by the text listing.
+const (
+	sgrReset  = "\033[0m"
+	sgrRed    = "\033[31m"
+	sgrYellow = "\033[33m"
+	sgrDir    = "\033[1;34m"
+)
+
+// palette colors the text listing: sizes at or over warn and alarm times
+// the threshold in yellow and red, and directories apart from files.
+type palette struct {
+	threshold   uint64
+	warn, alarm float64
+}
+
+// colors is the active palette. It is nil, and the listing plain, unless
+// -color enables it.
+var colors *palette
+
+// parseColorTiers parses -color-tiers, the yellow and red multiples of
+// the threshold, such as "3,10".
+func parseColorTiers(s string) (warn, alarm float64, err error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("%q must be two multiples of the threshold, yellow then red, such as 3,10", s)
+	}
+	warn, err1 := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	alarm, err2 := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err1 != nil || err2 != nil || warn < 1 || alarm <= warn {
+		return 0, 0, fmt.Errorf("%q must be two multiples of the threshold, at least 1 and ascending, such as 3,10", s)
+	}
+	return warn, alarm, nil
+}
+
+// colorEnabled decides -color for output written to w. auto colors only
+// a terminal, and only while NO_COLOR is unset or empty, as
+// https://no-color.org asks; always and never ignore both.
+func colorEnabled(mode string, w io.Writer, noColor string) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		return noColor == "" && writerIsTerminal(w), nil
+	}
+	return false, fmt.Errorf("-color must be auto, always or never, not %q", mode)
+}
+
+// cellColor is the color of a column's cell for res, or "" to leave it
+// plain.
+func (p *palette) cellColor(c column, res FileInfo) string {
+	switch c.name {
+	case "size", "bytes":
+		switch size := float64(res.Size); {
+		case size >= p.alarm*float64(p.threshold):
+			return sgrRed
+		case size >= p.warn*float64(p.threshold):
+			return sgrYellow
+		}
+	case "type", "path":
+		if res.IsDir {
+			return sgrDir
+		}
+	}
+	return ""
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestColorEnabled(t *testing.T) {
+	var buf strings.Builder
+	terminal := &lockedWriter{sink: &outputSink{statusW: &buf}, w: &buf, tty: true}
+	pipe := &lockedWriter{sink: &outputSink{statusW: &buf}, w: &buf}
+	for _, tc := range []struct {
+		mode    string
+		tty     bool
+		noColor string
+		want    bool
+	}{
+		{"auto", true, "", true},
+		{"auto", false, "", false},
+		{"auto", true, "1", false},
+		{"always", false, "1", true},
+		{"never", true, "", false},
+	} {
+		w := pipe
+		if tc.tty {
+			w = terminal
+		}
+		got, err := colorEnabled(tc.mode, w, tc.noColor)
+		if err != nil || got != tc.want {
+			t.Errorf("colorEnabled(%q, tty=%v, NO_COLOR=%q) = %v, %v; want %v", tc.mode, tc.tty, tc.noColor, got, err, tc.want)
+		}
+	}
+	if _, err := colorEnabled("sometimes", terminal, ""); err == nil {
+		t.Error("colorEnabled accepted an unknown mode")
+	}
+}
+
+func TestResultRowColors(t *testing.T) {
+	colors = &palette{threshold: 100, warn: 3, alarm: 10}
+	defer func() { colors = nil }()
+	for _, tc := range []struct {
+		res  FileInfo
+		want []string
+	}{
+		{FileInfo{Path: "/big", Size: 1000, IsDir: true}, []string{sgrDir + "[DIR]" + sgrReset, sgrRed + humanReadableSize(1000) + sgrReset, sgrDir + "/big" + sgrReset}},
+		{FileInfo{Path: "/mid", Size: 300}, []string{sgrYellow + humanReadableSize(300) + sgrReset}},
+	} {
+		row := resultRow(tc.res)
+		for _, want := range tc.want {
+			if !strings.Contains(row, want) {
+				t.Errorf("row %q lacks %q", row, want)
+			}
+		}
+	}
+	if row := resultRow(FileInfo{Path: "/small", Size: 100}); strings.Contains(row, "\033[") {
+		t.Errorf("a small file's row is colored: %q", row)
+	}
+
+	// Padding ignores the escape sequences.
+	res := FileInfo{Path: "/big", Size: 1000, IsDir: true}
+	colored := resultRow(res)
+	colors = nil
+	plain := resultRow(res)
+	for _, sgr := range []string{sgrReset, sgrRed, sgrDir} {
+		colored = strings.ReplaceAll(colored, sgr, "")
+	}
+	if colored != plain {
+		t.Errorf("colored row without escapes = %q, want %q", colored, plain)
+	}
+}
+
+func TestRunColorModes(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{"big": strings.Repeat("x", 5000)})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+
+	for _, tc := range []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"-color=always"}, true},
+		{[]string{"-color=never"}, false},
+		// The captured output is a pipe, not a terminal.
+		{[]string{"-color=auto"}, false},
+		{[]string{"-color=always", "-format=csv"}, false},
+		{[]string{"-color=always", "-format=json"}, false},
+	} {
+		resetResults()
+		out, err := runCaptured(t, append(tc.args, "-no-hints", tmpDir, "1K")...)
+		if err != nil {
+			t.Fatalf("%q: run failed: %v\n%s", tc.args, err, out)
+		}
+		if got := strings.Contains(out, "\033["); got != tc.want {
+			t.Errorf("%q: escape codes in output = %v, want %v:\n%q", tc.args, got, tc.want, out)
+		}
+	}
+
+	// A listing written with -o stays plain.
+	dest := filepath.Join(t.TempDir(), "report.txt")
+	resetResults()
+	if out, err := runCaptured(t, "-color=always", "-o="+dest, tmpDir, "1K"); err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "[FILE]") || strings.Contains(string(data), "\033[") {
+		t.Errorf("-o file is not a plain listing:\n%q", data)
+	}
+}
+
+func TestRunColorErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, args := range [][]string{
+		{"-color=yes", tmpDir, "1K"},
+		{"-color-tiers=10,3", tmpDir, "1K"},
+		{"-color-tiers=5", tmpDir, "1K"},
+	} {
+		if _, err := runCaptured(t, args...); err == nil {
+			t.Errorf("run(%q) accepted", args)
+		}
+	}
+}
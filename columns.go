@@ -0,0 +1,480 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// column is one column of the text, CSV and TSV listings. A new column
+// only needs an entry in columnTable.
+type column struct {
+	name string
+	// heading is the text listing's heading, field the CSV header.
+	heading, field string
+	// width pads the text cell and gap separates it from the next one;
+	// the last column is never padded.
+	width, gap int
+	// text renders the cell for the text listing, value for CSV and TSV.
+	text, value func(res FileInfo) string
+	// free marks values that may contain any character, which TSV must
+	// check for the delimiter.
+	free bool
+	// right aligns the text cell to the right of its width.
+	right bool
+}
+
+// columnTable lists every column -columns accepts, in the order the help
+// text gives them.
+var columnTable = []column{
+	{
+		name: "type", heading: "TYPE", field: "type", width: 6, gap: 1,
+		text: func(res FileInfo) string {
+			switch {
+			case res.IsDir:
+				return "[DIR]"
+			case res.Symlink:
+				return "[LINK]"
+			}
+			return "[FILE]"
+		},
+		value: func(res FileInfo) string {
+			switch {
+			case res.IsDir:
+				return "dir"
+			case res.Symlink:
+				return "link"
+			}
+			return "file"
+		},
+	},
+	{
+		name: "size", heading: "SIZE", field: "size_human", width: 10, gap: 2,
+		text:  func(res FileInfo) string { return humanReadableSize(res.Size) },
+		value: func(res FileInfo) string { return humanReadableSize(res.Size) },
+	},
+	{
+		name: "bytes", heading: "BYTES", field: "size_bytes", width: 14, gap: 2,
+		text:  func(res FileInfo) string { return groupDigits(res.Size) },
+		value: func(res FileInfo) string { return strconv.FormatUint(res.Size, 10) },
+	},
+	{
+		name: "path", heading: "NAME", field: "path", gap: 2, free: true,
+		text:  func(res FileInfo) string { return displayPath(res.Path) },
+		value: func(res FileInfo) string { return res.Path },
+	},
+	{
+		// A directory's time is that of the newest file below it, or its
+		// own with -dir-times=self.
+		name: "mtime", heading: "MODIFIED", field: "mtime", width: 16, gap: 2,
+		text: func(res FileInfo) string {
+			if t := entryTime(res); !t.IsZero() {
+				return t.Format("2006-01-02 15:04")
+			}
+			return "-"
+		},
+		value: func(res FileInfo) string {
+			if t := entryTime(res); !t.IsZero() {
+				return t.Format("2006-01-02T15:04:05Z07:00")
+			}
+			return ""
+		},
+	},
+	{
+		// A directory's own modification time; the column implies
+		// -dir-times=both unless -dir-times=self is given.
+		name: "dir_mtime", heading: "DIR MODIFIED", field: "dir_mtime", width: 16, gap: 2,
+		text: func(res FileInfo) string {
+			if res.IsDir && !res.DirMTime.IsZero() {
+				return res.DirMTime.Format("2006-01-02 15:04")
+			}
+			return "-"
+		},
+		value: func(res FileInfo) string {
+			if res.IsDir && !res.DirMTime.IsZero() {
+				return res.DirMTime.Format("2006-01-02T15:04:05Z07:00")
+			}
+			return ""
+		},
+	},
+	{
+		// The owner and group columns fall back to the numeric id when
+		// it has no name.
+		name: "owner", heading: "OWNER", field: "owner", width: 10, gap: 2, free: true,
+		text: func(res FileInfo) string {
+			if res.Owner == nil {
+				return "-"
+			}
+			return res.Owner.userLabel()
+		},
+		value: func(res FileInfo) string {
+			if res.Owner == nil {
+				return ""
+			}
+			return res.Owner.userLabel()
+		},
+	},
+	{
+		name: "group", heading: "GROUP", field: "group", width: 10, gap: 2, free: true,
+		text: func(res FileInfo) string {
+			if res.Owner == nil {
+				return "-"
+			}
+			return res.Owner.groupLabel()
+		},
+		value: func(res FileInfo) string {
+			if res.Owner == nil {
+				return ""
+			}
+			return res.Owner.groupLabel()
+		},
+	},
+	{
+		// Filled in by -show-device, which the column implies.
+		name: "device", heading: "DEVICE", field: "device", width: 24, gap: 2, free: true,
+		text: func(res FileInfo) string {
+			if res.Device == nil {
+				return "-"
+			}
+			return res.Device.label()
+		},
+		value: func(res FileInfo) string {
+			if res.Device == nil {
+				return ""
+			}
+			return res.Device.label()
+		},
+	},
+	{
+		// The context and acl columns are filled in by -audit-labels,
+		// which they imply.
+		name: "context", heading: "CONTEXT", field: "selinux_context", width: 32, gap: 2, free: true,
+		text: func(res FileInfo) string {
+			if res.SELinuxContext == "" {
+				return "-"
+			}
+			return res.SELinuxContext
+		},
+		value: func(res FileInfo) string { return res.SELinuxContext },
+	},
+	{
+		name: "acl", heading: "ACL", field: "has_acl", width: 4, gap: 2,
+		text: func(res FileInfo) string {
+			if res.HasACL {
+				return "+acl"
+			}
+			return "-"
+		},
+		value: func(res FileInfo) string { return strconv.FormatBool(res.HasACL) },
+	},
+	{
+		// The unique and shared columns imply -link-stats.
+		name: "unique", heading: "UNIQUE", field: "unique_size", width: 10, gap: 2,
+		text:  func(res FileInfo) string { return humanReadableSize(res.Unique) },
+		value: func(res FileInfo) string { return strconv.FormatUint(res.Unique, 10) },
+	},
+	{
+		name: "shared", heading: "SHARED", field: "shared_size", width: 10, gap: 2,
+		text:  func(res FileInfo) string { return humanReadableSize(res.Shared) },
+		value: func(res FileInfo) string { return strconv.FormatUint(res.Shared, 10) },
+	},
+	{
+		// The open_by column implies -check-open.
+		name: "open_by", heading: "OPEN BY", field: "open_by", width: 20, gap: 2, free: true,
+		text: func(res FileInfo) string {
+			if len(res.OpenBy) == 0 {
+				return "-"
+			}
+			return openByText(res)
+		},
+		value: openByText,
+	},
+	{
+		// Files have no count of their own.
+		name: "count", heading: "FILES", field: "file_count", width: 8, gap: 2,
+		text: func(res FileInfo) string {
+			if !res.IsDir {
+				return "-"
+			}
+			return strconv.FormatUint(res.FileCount, 10)
+		},
+		value: func(res FileInfo) string {
+			if !res.IsDir {
+				return ""
+			}
+			return strconv.FormatUint(res.FileCount, 10)
+		},
+	},
+	{
+		// The share is of the scan total unless -percent-of says otherwise.
+		name: "percent", heading: "SHARE", field: "percent", width: 6, gap: 2,
+		text: func(res FileInfo) string {
+			if pct, ok := share(res); ok {
+				return fmt.Sprintf("%.1f%%", pct)
+			}
+			return "-"
+		},
+		value: func(res FileInfo) string {
+			if pct, ok := share(res); ok {
+				return fmt.Sprintf("%.2f", pct)
+			}
+			return ""
+		},
+	},
+}
+
+// exactSizeColumn stands in for the size column under -bytes: exact byte
+// counts, right-aligned so that digits line up, and wide enough for
+// petabytes, or for petabytes with separators under -group-digits.
+var exactSizeColumn = column{
+	name: "size", heading: "BYTES", field: "size_bytes", width: 16, gap: 2, right: true,
+	text:  func(res FileInfo) string { return groupDigits(res.Size) },
+	value: func(res FileInfo) string { return strconv.FormatUint(res.Size, 10) },
+}
+
+// exactSizes returns cols with the size column showing exact bytes.
+func exactSizes(cols []column) []column {
+	out := make([]column, len(cols))
+	for i, c := range cols {
+		if c.name == "size" {
+			c = exactSizeColumn
+			if digitSeparator != 0 {
+				c.width += 5
+			}
+		}
+		out[i] = c
+	}
+	return out
+}
+
+// columnTotal is the scan total the percent column divides by.
+var columnTotal uint64
+
+// percentOf is the percent column's denominator, set by -percent-of:
+// "total" for columnTotal, "parent" for each entry's ParentSize, or "fs"
+// for columnFS.
+var percentOf = "total"
+
+// columnFS is the size of the filesystem holding the scan root, for
+// -percent-of=fs.
+var columnFS uint64
+
+// share is res's size as a percentage of the percentOf denominator. It
+// is not ok when the denominator is unknown or zero, as for the scan
+// root's parent.
+func share(res FileInfo) (float64, bool) {
+	base := columnTotal
+	switch percentOf {
+	case "parent":
+		base = res.ParentSize
+	case "fs":
+		base = columnFS
+	}
+	if base == 0 {
+		return 0, false
+	}
+	return float64(res.Size) / float64(base) * 100, true
+}
+
+// parentTotals keeps the walk-time totals of the directories holding
+// listed entries, so that -percent-of=parent is right even for parents
+// that are not listed themselves. It is nil unless -percent-of=parent or
+// -show-ancestors is given.
+type parentTotals struct {
+	// root, when set, extends each request to every ancestor up to it,
+	// for -show-ancestors.
+	root string
+
+	mu     sync.Mutex
+	wanted map[string]bool
+	totals map[string]uint64
+}
+
+// parentSizes is the active record, if any.
+var parentSizes *parentTotals
+
+func newParentTotals(root string) *parentTotals {
+	return &parentTotals{root: root, wanted: make(map[string]bool), totals: make(map[string]uint64)}
+}
+
+// want asks for the total of dir, which holds a listed entry. The walk
+// finishes a directory after its children, so the request is always in
+// before finishDir.
+func (p *parentTotals) want(dir string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// A wanted directory's ancestors are wanted already.
+	for !p.wanted[dir] {
+		p.wanted[dir] = true
+		if p.root == "" || dir == p.root || !pathWithin(dir, p.root) {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// finishDir records the total of a finished directory that holds a
+// listed entry.
+func (p *parentTotals) finishDir(path string, size uint64) {
+	p.mu.Lock()
+	if p.wanted[path] {
+		p.totals[path] = size
+	}
+	p.mu.Unlock()
+}
+
+// record records the total of path whether or not it is wanted, for
+// listings, whose directories are totalled in no particular order.
+func (p *parentTotals) record(path string, size uint64) {
+	p.mu.Lock()
+	p.totals[path] = size
+	p.mu.Unlock()
+}
+
+// total returns the recorded total of dir.
+func (p *parentTotals) total(dir string) (uint64, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	size, ok := p.totals[dir]
+	return size, ok
+}
+
+// fill sets the ParentSize of each entry in list.
+func (p *parentTotals) fill(list []FileInfo) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := range list {
+		list[i].ParentSize = p.totals[filepath.Dir(list[i].Path)]
+	}
+}
+
+// listColumns are the columns chosen with -columns; nil keeps each
+// format's default.
+var listColumns []column
+
+// Each format's columns when -columns is not given.
+var (
+	textColumns = mustColumns("type,size,path")
+	csvColumns  = mustColumns("type,bytes,size,path")
+	tsvColumns  = mustColumns("type,bytes,path")
+)
+
+// withColumnsBeforePath returns cols with the named columns inserted
+// before the path, for -show-device and -show-owner without -columns.
+func withColumnsBeforePath(cols []column, names ...string) []column {
+	extra := mustColumns(strings.Join(names, ","))
+	var out []column
+	for _, c := range cols {
+		if c.name == "path" {
+			out = append(out, extra...)
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// columnsFor returns the columns to use, given the format's default.
+func columnsFor(def []column) []column {
+	if listColumns != nil {
+		return listColumns
+	}
+	return def
+}
+
+// columnNames lists the valid column names, comma-separated.
+func columnNames() string {
+	names := make([]string, len(columnTable))
+	for i, c := range columnTable {
+		names[i] = c.name
+	}
+	return strings.Join(names, ",")
+}
+
+// parseColumns returns the columns named in a comma-separated list, in
+// the order given.
+func parseColumns(spec string) ([]column, error) {
+	var cols []column
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, c := range columnTable {
+			if c.name == name {
+				cols = append(cols, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column %q; choose from %s", name, columnNames())
+		}
+	}
+	return cols, nil
+}
+
+func mustColumns(spec string) []column {
+	cols, err := parseColumns(spec)
+	if err != nil {
+		panic(err)
+	}
+	return cols
+}
+
+// hasColumn reports whether -columns asked for the named column.
+func hasColumn(name string) bool {
+	for _, c := range listColumns {
+		if c.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// textCells joins one text listing row or heading, cell giving each
+// column's content and color, if not nil, its color sequence. Colors
+// wrap the content only, so they do not upset the padding.
+func textCells(cols []column, cell, color func(c column) string) string {
+	var b strings.Builder
+	for i, c := range cols {
+		s := cell(c)
+		fill := strings.Repeat(" ", max(c.width-utf8.RuneCountInString(s), 0))
+		lead, pad := "", ""
+		if c.right {
+			lead = fill
+		}
+		if i < len(cols)-1 {
+			pad = strings.Repeat(" ", c.gap)
+			if !c.right {
+				pad = fill + pad
+			}
+		}
+		if color != nil {
+			if sgr := color(c); sgr != "" {
+				s = sgr + s + sgrReset
+			}
+		}
+		b.WriteString(lead + s + pad)
+	}
+	return b.String()
+}
+
+// textHeading is the text listing's heading line.
+func textHeading() string {
+	return textCells(columnsFor(textColumns), func(c column) string { return c.heading }, nil)
+}
+
+// entryTime is the mtime column's time: a file's modification time, or
+// the newest file's below a directory, or the directory's own with
+// -dir-times=self.
+func entryTime(res FileInfo) time.Time {
+	if res.IsDir && dirTimes == "self" {
+		return res.DirMTime
+	}
+	if res.IsDir {
+		return res.NewestMTime
+	}
+	return res.ModTime
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseColumns(t *testing.T) {
+	cols, err := parseColumns("path,bytes,type")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range cols {
+		names = append(names, c.name)
+	}
+	if want := []string{"path", "bytes", "type"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("columns = %q, want %q", names, want)
+	}
+
+	_, err = parseColumns("size,inode")
+	if err == nil || !strings.Contains(err.Error(), `"inode"`) || !strings.Contains(err.Error(), columnNames()) {
+		t.Errorf("unknown column error = %v, want the name and the valid columns", err)
+	}
+}
+
+func TestDefaultTextHeading(t *testing.T) {
+	// The default heading predates -columns; scripts match on it.
+	if got := textHeading(); got != "TYPE   SIZE        NAME" {
+		t.Errorf("heading = %q", got)
+	}
+}
+
+func TestRunColumns(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"dir/big": strings.Repeat("x", 300),
+		"small":   strings.Repeat("y", 100),
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+
+	resetResults()
+	out, err := runCaptured(t, "-no-hints", "-columns=path,bytes,percent", tmpDir, "150B")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	for _, want := range []string{
+		"NAME  BYTES           SHARE\n",
+		filepath.Join(tmpDir, "dir", "big") + "  300             75.0%\n",
+		tmpDir + "  400             100.0%\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+
+	resetResults()
+	out, err = runCaptured(t, "-format=csv", "-columns=count,path", tmpDir, "150B")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	rows, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatalf("output is not valid CSV: %v\n%s", err, out)
+	}
+	want := [][]string{
+		{"file_count", "path"},
+		{"2", tmpDir},
+		{"1", filepath.Join(tmpDir, "dir")},
+		{"", filepath.Join(tmpDir, "dir", "big")},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %q\nwant   %q", rows, want)
+	}
+
+	resetResults()
+	out, err = runCaptured(t, "-format=tsv", "-columns=path", tmpDir, "1B")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		if !strings.HasPrefix(line, tmpDir) || strings.Contains(line, "\t") {
+			t.Errorf("single-column row %q is not just a path", line)
+		}
+	}
+}
+
+func TestRunColumnsErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, args := range [][]string{
+		{"-columns=size,colour", tmpDir, "1K"},
+		{"-columns=size", "-format=json", tmpDir, "1K"},
+	} {
+		if _, err := runCaptured(t, args...); err == nil {
+			t.Errorf("run(%q) accepted", args)
+		}
+	}
+}
+
+func TestPercentOf(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"a/big":     strings.Repeat("x", 3000),
+		"a/small1":  strings.Repeat("x", 100),
+		"a/small2":  strings.Repeat("x", 100),
+		"other/big": strings.Repeat("x", 1800),
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+
+	// -max-files=1 drops a, with three files, from the listing, but its
+	// child's share must still come from a's walk-time total.
+	resetResults()
+	out, err := runCaptured(t, "-no-hints", "-format=csv", "-columns=path,percent", "-percent-of=parent", "-max-files=1", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	rows, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatalf("output is not valid CSV: %v\n%s", err, out)
+	}
+	got := make(map[string]string)
+	for _, row := range rows[1:] {
+		got[row[0]] = row[1]
+	}
+	want := map[string]string{
+		filepath.Join(tmpDir, "a", "big"):     "93.75",
+		filepath.Join(tmpDir, "other"):        "36.00",
+		filepath.Join(tmpDir, "other", "big"): "100.00",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("shares = %v\nwant     %v", got, want)
+	}
+
+	resetResults()
+	if _, err := runCaptured(t, "-percent-of=parent", tmpDir, "1K"); err == nil || !strings.Contains(err.Error(), "percent column") {
+		t.Errorf("-percent-of without the percent column: err = %v", err)
+	}
+	resetResults()
+	if _, err := runCaptured(t, "-columns=percent,path", "-percent-of=disk", tmpDir, "1K"); err == nil {
+		t.Error("-percent-of=disk was accepted")
+	}
+}
+
+func TestShare(t *testing.T) {
+	defer func() { percentOf, columnTotal, columnFS = "total", 0, 0 }()
+	columnTotal, columnFS = 200, 1000
+	res := FileInfo{Size: 50, ParentSize: 100}
+	for _, tc := range []struct {
+		base string
+		want float64
+	}{{"total", 25}, {"parent", 50}, {"fs", 5}} {
+		percentOf = tc.base
+		if got, ok := share(res); !ok || got != tc.want {
+			t.Errorf("share of %s = %v, %v, want %v", tc.base, got, ok, tc.want)
+		}
+	}
+	percentOf = "parent"
+	if _, ok := share(FileInfo{Size: 50}); ok {
+		t.Error("share of an unknown parent is ok")
+	}
+}
+
+func TestExactBytes(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"dir/big": strings.Repeat("x", 123456),
+		"small":   strings.Repeat("y", 2048),
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+
+	resetResults()
+	out, err := runCaptured(t, "-no-hints", "-no-summary", "-bytes", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	sizes := make(map[string]uint64)
+	end := -1
+	for _, line := range strings.Split(out, "\n") {
+		if !strings.HasPrefix(line, "[") {
+			continue
+		}
+		// "[DIR]  " plus a right-aligned count: the digits end together.
+		cell := line[7 : 7+16]
+		if e := len(strings.TrimRight(line[:7+16], " ")); end >= 0 && e != end {
+			t.Errorf("sizes are not right-aligned:\n%s", out)
+		} else {
+			end = e
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(cell), 10, 64)
+		if err != nil {
+			t.Fatalf("size cell %q is not a byte count: %v", cell, err)
+		}
+		sizes[strings.TrimSpace(line[7+16:])] = n
+	}
+	want := map[string]uint64{
+		tmpDir:                              125504,
+		filepath.Join(tmpDir, "dir"):        123456,
+		filepath.Join(tmpDir, "dir", "big"): 123456,
+		filepath.Join(tmpDir, "small"):      2048,
+	}
+	if !reflect.DeepEqual(sizes, want) {
+		t.Errorf("sizes = %v\nwant    %v", sizes, want)
+	}
+	if !strings.Contains(out, "TYPE              BYTES  NAME\n") {
+		t.Errorf("heading is not aligned with the sizes:\n%s", out)
+	}
+
+	resetResults()
+	out, err = runCaptured(t, "-format=csv", "-columns=path,size", "-bytes", tmpDir, "100K")
+	if err != nil {
+		t.Fatalf("csv run failed: %v\n%s", err, out)
+	}
+	rows, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatalf("output is not valid CSV: %v\n%s", err, out)
+	}
+	if rows[0][1] != "size_bytes" || rows[1][1] != "125504" {
+		t.Errorf("rows = %q, want exact bytes under size_bytes", rows)
+	}
+}
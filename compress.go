@@ -0,0 +1,49 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// compressionFor resolves -compress against the -o destination: auto
+// gzips a destination ending in .gz and leaves anything else alone.
+func compressionFor(spec, outputFile string) (string, error) {
+	switch spec {
+	case "auto":
+		if strings.HasSuffix(strings.ToLower(outputFile), ".gz") {
+			return "gzip", nil
+		}
+		return "none", nil
+	case "gzip", "none":
+		return spec, nil
+	}
+	return "", fmt.Errorf("error: -compress must be auto, gzip or none, not %q", spec)
+}
+
+// gzipOutput compresses the results on their way to -o or stdout. close
+// ends the gzip member; run defers it, so that a scan stopped by a signal
+// or an error still leaves a complete stream on stdout rather than one cut
+// off mid-member. It is safe to call more than once.
+type gzipOutput struct {
+	zw     *gzip.Writer
+	closed bool
+}
+
+func newGzipOutput(w io.Writer) *gzipOutput {
+	return &gzipOutput{zw: gzip.NewWriter(w)}
+}
+
+// Write implements io.Writer.
+func (g *gzipOutput) Write(p []byte) (int, error) {
+	return g.zw.Write(p)
+}
+
+func (g *gzipOutput) close() error {
+	if g.closed {
+		return nil
+	}
+	g.closed = true
+	return g.zw.Close()
+}
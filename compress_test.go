@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompressionFor(t *testing.T) {
+	tests := []struct {
+		spec, out, want string
+		ok              bool
+	}{
+		{"auto", "report.csv.gz", "gzip", true},
+		{"auto", "REPORT.GZ", "gzip", true},
+		{"auto", "report.csv", "none", true},
+		{"auto", "", "none", true},
+		{"none", "report.csv.gz", "none", true},
+		{"gzip", "report.csv", "gzip", true},
+		{"zstd", "", "", false},
+	}
+	for _, tt := range tests {
+		got, err := compressionFor(tt.spec, tt.out)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("compressionFor(%q, %q) = %q, %v; want %q, ok %v", tt.spec, tt.out, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+// gunzip returns the decompressed contents of the file at path.
+func gunzip(t *testing.T, path string) []byte {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("%s is not gzip: %v", path, err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+	return data
+}
+
+func TestCompressedOutput(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"a/big":  strings.Repeat("x", 3000),
+		"b/file": strings.Repeat("x", 2000),
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+	outDir := t.TempDir()
+	plain := filepath.Join(outDir, "report.csv")
+	packed := filepath.Join(outDir, "report.csv.gz")
+
+	resetResults()
+	if out, err := runCaptured(t, "-format=csv", "-o", plain, tmpDir, "1K"); err != nil {
+		t.Fatalf("plain run: %v\n%s", err, out)
+	}
+	resetResults()
+	out, err := runCaptured(t, "-format=csv", "-o", packed, tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("compressed run: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "Output: gzip-compressed to "+packed) {
+		t.Errorf("banner does not note the compression:\n%s", out)
+	}
+	want, err := os.ReadFile(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := gunzip(t, packed); !bytes.Equal(got, want) {
+		t.Errorf("decompressed CSV differs:\n%s\nwant:\n%s", got, want)
+	}
+
+	// The text report is compressed from its table on, and -compress=none
+	// keeps a .gz name plain.
+	resetResults()
+	text := filepath.Join(outDir, "report.txt.gz")
+	if out, err := runCaptured(t, "-o", text, tmpDir, "1K"); err != nil {
+		t.Fatalf("text run: %v\n%s", err, out)
+	}
+	if got := gunzip(t, text); !bytes.Contains(got, []byte(filepath.Join(tmpDir, "a", "big"))) {
+		t.Errorf("compressed text report lacks the listing:\n%s", got)
+	}
+	resetResults()
+	if out, err := runCaptured(t, "-compress=none", "-format=csv", "-o", packed, tmpDir, "1K"); err != nil {
+		t.Fatalf("uncompressed run: %v\n%s", err, out)
+	}
+	if got, _ := os.ReadFile(packed); !bytes.Equal(got, want) {
+		t.Errorf("-compress=none wrote:\n%s", got)
+	}
+
+	if _, err := runCaptured(t, "-compress=gzip", tmpDir, "1K"); err == nil {
+		t.Error("-compress=gzip accepted for a text report to stdout")
+	}
+}
+
+func TestCompressedInterruptLeavesOutput(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"stop/f": strings.Repeat("x", 2000),
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+	packed := filepath.Join(t.TempDir(), "report.ndjson.gz")
+	if err := os.WriteFile(packed, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	interruptAt(t, "stop", os.Interrupt)
+	resetResults()
+	if _, err := runCaptured(t, "-format=ndjson", "-o", packed, tmpDir, "1K"); exitCode(err) != exitInterrupted {
+		t.Fatalf("err = %v, want an interrupted scan", err)
+	}
+	if got, _ := os.ReadFile(packed); string(got) != "old" {
+		t.Errorf("interrupted scan replaced the archive with %q", got)
+	}
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(packed), ".*tmp*"))
+	if len(matches) > 0 {
+		t.Errorf("temporary files left behind: %v", matches)
+	}
+}
+
+func TestCompressedStdoutInterrupted(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"big":    strings.Repeat("x", 2000),
+		"stop/f": strings.Repeat("x", 2000),
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+	dir := t.TempDir()
+	out, err := os.Create(filepath.Join(dir, "stdout.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	errOut, err := os.Create(filepath.Join(dir, "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer errOut.Close()
+
+	interruptAt(t, "stop", os.Interrupt)
+	resetResults()
+	oldStdout, oldStderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = out, errOut
+	runErr := run([]string{"spacehogs", "-format=ndjson", "-compress=gzip", tmpDir, "1K"})
+	resetWalkOptions()
+	os.Stdout, os.Stderr = oldStdout, oldStderr
+	setupOutput(os.Stdout, os.Stderr)
+	if exitCode(runErr) != exitInterrupted {
+		t.Fatalf("err = %v, want an interrupted scan", runErr)
+	}
+	// The stream is cut short, but the gzip member is whole.
+	if got := gunzip(t, out.Name()); !bytes.Contains(got, []byte(`"type":"summary"`)) {
+		t.Errorf("interrupted stream lacks its summary line:\n%s", got)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+// writeCSVResults writes the sorted results as CSV rows, memory-backed
+// entries after the disk entries as in the text output. header selects
+// whether the header row comes first; -no-header drops it for appending
+// to an existing file. The columns are csvColumns unless -columns chose
+// others; each annotator adds one after them.
+func writeCSVResults(w io.Writer, header bool, annotators []string, lists ...[]FileInfo) error {
+	cols := columnsFor(csvColumns)
+	cw := csv.NewWriter(w)
+	if header {
+		row := make([]string, 0, len(cols)+len(annotators))
+		for _, c := range cols {
+			row = append(row, c.field)
+		}
+		cw.Write(append(row, annotators...))
+	}
+	for _, list := range lists {
+		for _, res := range list {
+			row := make([]string, 0, len(cols)+len(res.Annotations))
+			for _, c := range cols {
+				row = append(row, c.value(res))
+			}
+			for _, a := range res.Annotations {
+				row = append(row, a.Value)
+			}
+			cw.Write(row)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRunCSVFormat(t *testing.T) {
+	odd := "a,b\"c.txt"
+	if runtime.GOOS == "windows" {
+		odd = "a,b c.txt"
+	}
+	tmpDir := createTestDir(t, map[string]string{
+		"dir/" + odd:   strings.Repeat("x", 300),
+		"dir/plain":    strings.Repeat("y", 200),
+		"ignored/tiny": "z",
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+
+	resetResults()
+	out, err := runCaptured(t, "-format=csv", tmpDir, "150B")
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	rows, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatalf("output is not valid CSV: %v\n%s", err, out)
+	}
+	want := [][]string{
+		{"type", "size_bytes", "size_human", "path"},
+		{"dir", "501", humanReadableSize(501), tmpDir},
+		{"dir", "500", humanReadableSize(500), filepath.Join(tmpDir, "dir")},
+		{"file", "300", humanReadableSize(300), filepath.Join(tmpDir, "dir", odd)},
+		{"file", "200", humanReadableSize(200), filepath.Join(tmpDir, "dir", "plain")},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %q\nwant   %q", rows, want)
+	}
+
+	resetResults()
+	out, err = runCaptured(t, "-format=csv", "-no-header", tmpDir, "150B")
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if strings.HasPrefix(out, "type,") {
+		t.Errorf("-no-header still wrote the header:\n%s", out)
+	}
+	if rows, _ := csv.NewReader(strings.NewReader(out)).ReadAll(); len(rows) != len(want)-1 {
+		t.Errorf("got %d rows without the header, want %d", len(rows), len(want)-1)
+	}
+}
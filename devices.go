@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// blockDevice is the storage behind a filesystem, as far as -show-device
+// can tell.
+type blockDevice struct {
+	// ID identifies the filesystem: "major:minor" on Linux, the raw
+	// device number on other Unix systems and the volume name on Windows.
+	ID string `json:"id"`
+	// Name is the block device the filesystem lives on, such as
+	// /dev/mapper/vg0-data. It is only known on Linux.
+	Name string `json:"name,omitempty"`
+	// Physical lists the devices below a device-mapper or md device, such
+	// as the physical volumes of an LVM logical volume or the members of a
+	// RAID array.
+	Physical []string `json:"physical,omitempty"`
+}
+
+// label is the device column's text: the name, or the ID when there is
+// none, followed by the physical devices.
+func (d blockDevice) label() string {
+	s := d.Name
+	if s == "" {
+		s = d.ID
+	}
+	if len(d.Physical) > 0 {
+		s += " (" + strings.Join(d.Physical, "+") + ")"
+	}
+	return s
+}
+
+// deviceResolver describes the filesystem with a given device number.
+// The real implementation reads the Linux mount table and sysfs; tests
+// substitute a fake.
+type deviceResolver interface {
+	resolve(dev uint64) blockDevice
+}
+
+// loadDeviceResolver returns the platform resolver. It is a variable so
+// tests can substitute a fake.
+var loadDeviceResolver = newDeviceResolver
+
+// deviceUsage is the file bytes the walk found on one device.
+type deviceUsage struct {
+	Files uint64 `json:"files"`
+	Bytes uint64 `json:"bytes"`
+}
+
+// deviceTally collects one directory's file usage by device, so that the
+// walk takes the index lock once per directory rather than per file.
+type deviceTally map[uint64]deviceUsage
+
+// add counts a file of the given size, unless its device is unknown.
+func (t *deviceTally) add(info fs.FileInfo, size uint64) {
+	dev, ok := infoDevice(info)
+	if !ok {
+		return
+	}
+	if *t == nil {
+		*t = make(deviceTally, 1)
+	}
+	u := (*t)[dev]
+	u.Files++
+	u.Bytes = addSize(u.Bytes, size)
+	(*t)[dev] = u
+}
+
+// deviceIndex resolves devices for -show-device, once per device number,
+// and sums the walk's usage by device. It is nil unless -show-device is
+// given.
+type deviceIndex struct {
+	resolver deviceResolver
+
+	mu    sync.Mutex
+	known map[uint64]blockDevice
+	usage map[uint64]deviceUsage
+}
+
+// devices is the active index, if any.
+var devices *deviceIndex
+
+func newDeviceIndex(r deviceResolver) *deviceIndex {
+	return &deviceIndex{resolver: r, known: make(map[uint64]blockDevice), usage: make(map[uint64]deviceUsage)}
+}
+
+// lookup returns the device with number dev, resolving it the first time.
+func (d *deviceIndex) lookup(dev uint64) blockDevice {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	bd, ok := d.known[dev]
+	if !ok {
+		bd = d.resolver.resolve(dev)
+		d.known[dev] = bd
+	}
+	return bd
+}
+
+// addUsage merges a directory's tally.
+func (d *deviceIndex) addUsage(t deviceTally) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for dev, u := range t {
+		sum := d.usage[dev]
+		sum.Files += u.Files
+		sum.Bytes = addSize(sum.Bytes, u.Bytes)
+		d.usage[dev] = sum
+	}
+}
+
+// annotate fills in the device of each listed entry. An entry that can
+// no longer be read is left blank; where the platform has no device
+// numbers, the entry gets its volume name.
+func (d *deviceIndex) annotate(list []FileInfo) {
+	for i := range list {
+		fi, err := os.Lstat(list[i].Path)
+		if err != nil {
+			continue
+		}
+		if dev, ok := infoDevice(fi); ok {
+			bd := d.lookup(dev)
+			list[i].Device = &bd
+		} else if vol := filepath.VolumeName(resolvedAbs(list[i].Path)); vol != "" {
+			list[i].Device = &blockDevice{ID: vol}
+		}
+	}
+}
+
+// deviceRollup is one row of the per-device summary.
+type deviceRollup struct {
+	blockDevice
+	deviceUsage
+}
+
+// rollup returns the walk's usage by device, largest first.
+func (d *deviceIndex) rollup() []deviceRollup {
+	d.mu.Lock()
+	rows := make([]deviceRollup, 0, len(d.usage))
+	devs := make([]uint64, 0, len(d.usage))
+	for dev, u := range d.usage {
+		rows = append(rows, deviceRollup{deviceUsage: u})
+		devs = append(devs, dev)
+	}
+	d.mu.Unlock()
+	for i, dev := range devs {
+		rows[i].blockDevice = d.lookup(dev)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Bytes != rows[j].Bytes {
+			return rows[i].Bytes > rows[j].Bytes
+		}
+		return rows[i].ID < rows[j].ID
+	})
+	return rows
+}
+
+// printDeviceSummary writes the per-device table.
+func printDeviceSummary(rows []deviceRollup) {
+	if len(rows) == 0 {
+		return
+	}
+	fmt.Fprintln(stdout, "\nDEVICE                                        FILES  FILE BYTES")
+	fmt.Fprintln(stdout, "---------------------------------------------------------------")
+	for _, r := range rows {
+		fmt.Fprintf(stdout, "%-40s  %9d  %s\n", r.label(), r.Files, humanReadableSize(r.Bytes))
+	}
+}
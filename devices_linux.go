@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// sysfsResolver names Linux block devices from the mount table and sysfs.
+type sysfsResolver struct {
+	mounts []mountInfo
+	// sys is rooted at /sys.
+	sys fs.FS
+}
+
+// newDeviceResolver returns the platform resolver. Without a mount table
+// devices are still named from sysfs.
+func newDeviceResolver() deviceResolver {
+	mounts, _ := loadMountTable()
+	return sysfsResolver{mounts: mounts, sys: os.DirFS("/sys")}
+}
+
+// deviceID formats a device number as mountinfo and sysfs do.
+func deviceID(dev uint64) string {
+	major := (dev>>8)&0xfff | (dev>>32)&^0xfff
+	minor := dev&0xff | (dev>>12)&^0xff
+	return strconv.FormatUint(major, 10) + ":" + strconv.FormatUint(minor, 10)
+}
+
+// resolve implements deviceResolver. The name comes from the mount table
+// when the filesystem was mounted from a device node, and from sysfs
+// otherwise. Filesystems such as btrfs have an anonymous device number
+// that sysfs does not know, so the mounted device is looked up by name.
+func (r sysfsResolver) resolve(dev uint64) blockDevice {
+	bd := blockDevice{ID: deviceID(dev)}
+	source := ""
+	for _, m := range r.mounts {
+		if m.Device == bd.ID {
+			source = m.Source
+			break
+		}
+	}
+	kernel := r.kernelName(bd.ID)
+	if kernel == "" && strings.HasPrefix(source, "/dev/") {
+		if _, err := fs.Stat(r.sys, "class/block/"+path.Base(source)); err == nil {
+			kernel = path.Base(source)
+		}
+	}
+	switch {
+	case strings.HasPrefix(source, "/dev/"):
+		bd.Name = source
+	case kernel == "":
+	case r.dmName(kernel) != "":
+		bd.Name = "/dev/mapper/" + r.dmName(kernel)
+	default:
+		bd.Name = "/dev/" + kernel
+	}
+	if kernel != "" {
+		bd.Physical = r.physical(kernel, 0)
+	}
+	return bd
+}
+
+// kernelName returns the kernel's name for the block device id, such as
+// dm-0, or "" when it is not a block device.
+func (r sysfsResolver) kernelName(id string) string {
+	data, err := fs.ReadFile(r.sys, "dev/block/"+id+"/uevent")
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if name, ok := strings.CutPrefix(line, "DEVNAME="); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// dmName returns the device-mapper name of a kernel device, such as
+// vg0-data for an LVM logical volume, or "".
+func (r sysfsResolver) dmName(kernel string) string {
+	data, err := fs.ReadFile(r.sys, "class/block/"+kernel+"/dm/name")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// maxStackDepth bounds how far physical follows stacked devices, such as
+// LVM on RAID on partitions.
+const maxStackDepth = 8
+
+// physical returns the devices at the bottom of the stack below kernel:
+// the physical volumes of a logical volume, the members of an md array,
+// or both for LVM on RAID. A device with nothing below it has none.
+func (r sysfsResolver) physical(kernel string, depth int) []string {
+	entries, err := fs.ReadDir(r.sys, "class/block/"+kernel+"/slaves")
+	if err != nil || len(entries) == 0 || depth == maxStackDepth {
+		if depth > 0 {
+			return []string{kernel}
+		}
+		return nil
+	}
+	var out []string
+	for _, e := range entries {
+		out = append(out, r.physical(e.Name(), depth+1)...)
+	}
+	return out
+}
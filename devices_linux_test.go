@@ -0,0 +1,48 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSysfsResolver(t *testing.T) {
+	sys := fstest.MapFS{
+		// An LVM volume over a partition and an md mirror of two disks.
+		"dev/block/253:0/uevent":       {Data: []byte("MAJOR=253\nMINOR=0\nDEVNAME=dm-0\nDEVTYPE=disk\n")},
+		"class/block/dm-0/dm/name":     {Data: []byte("vg0-data\n")},
+		"class/block/dm-0/slaves/sda2": {},
+		"class/block/dm-0/slaves/md0":  {},
+		"class/block/md0/slaves/sdb1":  {},
+		"class/block/md0/slaves/sdc1":  {},
+		"class/block/sda2/dev":         {Data: []byte("8:2\n")},
+		// A plain partition, and the one btrfs lives on.
+		"dev/block/8:1/uevent": {Data: []byte("DEVNAME=sda1\n")},
+		"class/block/sda3/dev": {Data: []byte("8:3\n")},
+	}
+	r := sysfsResolver{
+		mounts: []mountInfo{
+			{MountPoint: "/", Source: "/dev/sda1", Device: "8:1"},
+			{MountPoint: "/srv", Source: "/dev/sda3", Device: "0:42"},
+			{MountPoint: "/tmp", Source: "tmpfs", Device: "0:30"},
+		},
+		sys: sys,
+	}
+	tests := []struct {
+		dev  uint64
+		want blockDevice
+	}{
+		// With no mount, the name comes from device-mapper.
+		{253<<8 | 0, blockDevice{ID: "253:0", Name: "/dev/mapper/vg0-data", Physical: []string{"sdb1", "sdc1", "sda2"}}},
+		{8<<8 | 1, blockDevice{ID: "8:1", Name: "/dev/sda1"}},
+		{42, blockDevice{ID: "0:42", Name: "/dev/sda3"}},
+		{30, blockDevice{ID: "0:30"}},
+		// Minor numbers over 255 are split around the major.
+		{259<<8 | 1<<20 | 4, blockDevice{ID: "259:260"}},
+	}
+	for _, tt := range tests {
+		if got := r.resolve(tt.dev); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("resolve(%#x) = %+v, want %+v", tt.dev, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package main
+
+import "strconv"
+
+// numberResolver names a device by its number alone: without sysfs there
+// is no portable way to find the block device behind it.
+type numberResolver struct{}
+
+// newDeviceResolver returns the platform resolver.
+func newDeviceResolver() deviceResolver {
+	return numberResolver{}
+}
+
+// resolve implements deviceResolver.
+func (numberResolver) resolve(dev uint64) blockDevice {
+	return blockDevice{ID: "0x" + strconv.FormatUint(dev, 16)}
+}
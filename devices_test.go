@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeResolver names every device the same and counts its lookups.
+type fakeResolver struct {
+	calls map[uint64]int
+}
+
+func (r *fakeResolver) resolve(dev uint64) blockDevice {
+	r.calls[dev]++
+	return blockDevice{ID: "253:0", Name: "/dev/mapper/vg0-data", Physical: []string{"sda2", "sdb1"}}
+}
+
+func TestShowDevice(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows has no device numbers")
+	}
+	tmpDir := createTestDir(t, map[string]string{
+		"a/big":   strings.Repeat("x", 3000),
+		"a/small": strings.Repeat("x", 10),
+		"b":       strings.Repeat("x", 2000),
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+	fake := &fakeResolver{calls: make(map[uint64]int)}
+	old := loadDeviceResolver
+	loadDeviceResolver = func() deviceResolver { return fake }
+	defer func() { loadDeviceResolver = old }()
+
+	resetResults()
+	out, err := runCaptured(t, "-show-device", "-format=json", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	var rep jsonReport
+	if err := json.Unmarshal([]byte(out), &rep); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if len(rep.Entries) != 4 {
+		t.Fatalf("got %d entries, want 4:\n%s", len(rep.Entries), out)
+	}
+	for _, e := range rep.Entries {
+		if e.Device == nil || e.Device.Name != "/dev/mapper/vg0-data" || strings.Join(e.Device.Physical, ",") != "sda2,sdb1" {
+			t.Errorf("device of %s = %+v", e.Path, e.Device)
+		}
+	}
+	if len(rep.Devices) != 1 || rep.Devices[0].Files != 3 || rep.Devices[0].Bytes != 5010 {
+		t.Errorf("device rollup = %+v, want one device with 3 files and 5010 bytes", rep.Devices)
+	}
+	for dev, n := range fake.calls {
+		if n != 1 {
+			t.Errorf("device %d resolved %d times, want once", dev, n)
+		}
+	}
+
+	resetResults()
+	out, err = runCaptured(t, "-show-device", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("text run: %v\n%s", err, out)
+	}
+	row := "/dev/mapper/vg0-data (sda2+sdb1)  " + filepath.Join(tmpDir, "a", "big")
+	if !strings.Contains(out, row) || !strings.Contains(out, "\nDEVICE ") {
+		t.Errorf("text listing without the device column or rollup:\n%s", out)
+	}
+
+	if _, err := runCaptured(t, "-show-device", "-format=xml", tmpDir, "1K"); err == nil {
+		t.Error("-show-device accepted with -format=xml")
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// trackDirTimes enables the per-directory modification time rollup used
+	// by -dir-mtimes, -all-older-than, -sort=mtime, the mtime column and
+	// the JSON report.
+	trackDirTimes bool
+
+	// showDirTimes adds the time range to listed directories (-dir-mtimes).
+	showDirTimes bool
+
+	// dirTimes selects the time of a directory entry (-dir-times):
+	// "descendants" for that of the newest file below it, "self" for the
+	// directory's own modification time, or "both", which keeps the
+	// first as the entry's time and adds the second.
+	dirTimes = "descendants"
+)
+
+// trackSelfTimes reports whether the walk records each directory's own
+// modification time.
+func trackSelfTimes() bool {
+	return dirTimes != "descendants"
+}
+
+// addTime widens the time range to include t.
+func (s *subtreeStats) addTime(t time.Time) {
+	if s.Oldest.IsZero() || t.Before(s.Oldest) {
+		s.Oldest = t
+	}
+	if s.Newest.IsZero() || t.After(s.Newest) {
+		s.Newest = t
+	}
+}
+
+// parseAge parses a -all-older-than value: a Go duration such as "720h", or
+// a whole number of days such as "90d".
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q: want a number of days such as 90d", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid age %q: %v", s, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid age %q: must not be negative", s)
+	}
+	return d, nil
+}
+
+// keepAllOlderThan keeps only the directories whose newest file was
+// modified before cutoff. Directories without any files say nothing about
+// age and are dropped as well.
+func keepAllOlderThan(list []FileInfo, cutoff time.Time) []FileInfo {
+	kept := list[:0]
+	for _, res := range list {
+		if allOlder(res, cutoff) {
+			kept = append(kept, res)
+		}
+	}
+	return kept
+}
+
+// allOlder is the per-entry test of keepAllOlderThan.
+func allOlder(res FileInfo, cutoff time.Time) bool {
+	return res.IsDir && !res.NewestMTime.IsZero() && res.NewestMTime.Before(cutoff)
+}
+
+// sortByMTime orders results with directories first, then by modification
+// time, least recently modified first, for -sort=mtime. A directory's time
+// is that of its newest file, or its own with -dir-times=self; directories
+// without one come last.
+func sortByMTime(list []FileInfo) {
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].IsDir != list[j].IsDir {
+			return list[i].IsDir
+		}
+		ti, tj := entryTime(list[i]), entryTime(list[j])
+		if ti.IsZero() != tj.IsZero() {
+			return tj.IsZero()
+		}
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return list[i].Path < list[j].Path
+	})
+}
+
+// dirTimesSuffix renders the modification time range of a directory for
+// -dir-mtimes, and the directory's own time as -dir-times selects.
+func dirTimesSuffix(res FileInfo) string {
+	if !showDirTimes || !res.IsDir {
+		return ""
+	}
+	var parts []string
+	if dirTimes != "self" && !res.NewestMTime.IsZero() {
+		parts = append(parts, fmt.Sprintf("files %s .. %s", res.OldestMTime.Format("2006-01-02"), res.NewestMTime.Format("2006-01-02")))
+	}
+	if trackSelfTimes() && !res.DirMTime.IsZero() {
+		parts = append(parts, "modified "+res.DirMTime.Format("2006-01-02"))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "  (" + strings.Join(parts, ", ") + ")"
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDirTimeRollup(t *testing.T) {
+	resetResults()
+	tmpDir := createTestDir(t, map[string]string{
+		"old/a.txt":       "aa",
+		"old/deep/b.txt":  "bb",
+		"new/c.txt":       "cc",
+		"mixed/d.txt":     "dd",
+		"mixed/sub/e.txt": "ee",
+		"empty/":          "",
+	})
+	defer os.RemoveAll(tmpDir)
+
+	now := time.Now()
+	twoYears := now.AddDate(-2, 0, 0)
+	threeYears := now.AddDate(-3, 0, 0)
+	setMTime := func(rel string, mt time.Time) {
+		if err := os.Chtimes(filepath.Join(tmpDir, rel), mt, mt); err != nil {
+			t.Fatalf("chtimes %s: %v", rel, err)
+		}
+	}
+	setMTime("old/a.txt", twoYears)
+	setMTime("old/deep/b.txt", threeYears)
+	setMTime("new/c.txt", now)
+	setMTime("mixed/d.txt", threeYears)
+	setMTime("mixed/sub/e.txt", now)
+
+	trackDirTimes = true
+	defer func() { trackDirTimes = false }()
+	root, _ := walkDir(tmpDir, 0, map[string]struct{}{})
+
+	byPath := map[string]FileInfo{}
+	for _, res := range results {
+		byPath[res.Path] = res
+	}
+	sameDay := func(a, b time.Time) bool { return a.Sub(b).Abs() < time.Second }
+	old := byPath[filepath.Join(tmpDir, "old")]
+	if !sameDay(old.OldestMTime, threeYears) || !sameDay(old.NewestMTime, twoYears) {
+		t.Errorf("old: got %v .. %v, want %v .. %v", old.OldestMTime, old.NewestMTime, threeYears, twoYears)
+	}
+	mixed := byPath[filepath.Join(tmpDir, "mixed")]
+	if !sameDay(mixed.OldestMTime, threeYears) || !sameDay(mixed.NewestMTime, now) {
+		t.Errorf("mixed: got %v .. %v, want %v .. %v", mixed.OldestMTime, mixed.NewestMTime, threeYears, now)
+	}
+	if !sameDay(root.Oldest, threeYears) || !sameDay(root.Newest, now) {
+		t.Errorf("root: got %v .. %v", root.Oldest, root.Newest)
+	}
+	if e := byPath[filepath.Join(tmpDir, "empty")]; !e.NewestMTime.IsZero() {
+		t.Errorf("empty directory has a time range: %+v", e)
+	}
+
+	kept := keepAllOlderThan(results, now.AddDate(-1, 0, 0))
+	var paths []string
+	for _, res := range kept {
+		paths = append(paths, res.Path)
+	}
+	sort.Strings(paths)
+	want := []string{filepath.Join(tmpDir, "old"), filepath.Join(tmpDir, "old", "deep")}
+	if strings.Join(paths, ",") != strings.Join(want, ",") {
+		t.Errorf("kept %v, want %v", paths, want)
+	}
+}
+
+func TestSortByMTime(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"stale/a.bin":  strings.Repeat("x", 2000),
+		"fresh/b.bin":  strings.Repeat("x", 3000),
+		"fresh/c.bin":  strings.Repeat("x", 1500),
+		"fresh/d.bin":  strings.Repeat("x", 1500),
+		"stale/e.bin":  strings.Repeat("x", 1200),
+		"stale/sub/f":  "f",
+		"middle/g.bin": strings.Repeat("x", 4000),
+	})
+	defer os.RemoveAll(tmpDir)
+	for rel, year := range map[string]int{
+		"stale/a.bin": 2019, "stale/e.bin": 2018, "stale/sub/f": 2020,
+		"fresh/b.bin": 2024, "fresh/c.bin": 2025, "fresh/d.bin": 2021,
+		"middle/g.bin": 2022,
+	} {
+		mt := time.Date(year, 6, 1, 0, 0, 0, 0, time.UTC)
+		if err := os.Chtimes(filepath.Join(tmpDir, rel), mt, mt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fakeMounts(t, nil)
+	resetResults()
+	out, err := runCaptured(t, "-sort=mtime", "-no-summary", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	var order []string
+	for _, line := range strings.Split(out, "\n") {
+		if i := strings.Index(line, tmpDir); i >= 0 {
+			if rel := canonicalPath(tmpDir, strings.Fields(line[i:])[0]); rel != "." {
+				order = append(order, rel)
+			}
+		}
+	}
+	// stale's newest file is from 2020, fresh's from 2025.
+	want := []string{"stale", "middle", "fresh", "stale/e.bin", "stale/a.bin", "fresh/d.bin", "middle/g.bin", "fresh/b.bin", "fresh/c.bin"}
+	if strings.Join(order, ",") != strings.Join(want, ",") {
+		t.Errorf("order = %v, want %v\n%s", order, want, out)
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"90d", 90 * 24 * time.Hour, true},
+		{"720h", 720 * time.Hour, true},
+		{"1h30m", 90 * time.Minute, true},
+		{"xd", 0, false},
+		{"-5d", 0, false},
+		{"-1h", 0, false},
+		{"soon", 0, false},
+	}
+	for _, test := range tests {
+		got, err := parseAge(test.in)
+		if (err == nil) != test.ok || got != test.want {
+			t.Errorf("parseAge(%q) = %v, %v; want %v, ok=%v", test.in, got, err, test.want, test.ok)
+		}
+	}
+}
+
+func TestDirTimesSelectsTheDirectorysOwnTime(t *testing.T) {
+	// An upload directory that stopped getting new files long ago, with
+	// a file in it that was rewritten today.
+	tmpDir := createTestDir(t, map[string]string{"uploads/recent.bin": strings.Repeat("x", 2000)})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+	now := time.Now().Truncate(time.Second)
+	old := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	uploads := filepath.Join(tmpDir, "uploads")
+	if err := os.Chtimes(filepath.Join(uploads, "recent.bin"), now, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(uploads, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	entry := func(mode string) jsonEntry {
+		t.Helper()
+		resetResults()
+		out, err := runCaptured(t, "-format=json", "-dir-times="+mode, tmpDir, "1K")
+		if err != nil {
+			t.Fatalf("-dir-times=%s: %v\n%s", mode, err, out)
+		}
+		var rep jsonReport
+		if err := json.Unmarshal([]byte(out), &rep); err != nil {
+			t.Fatalf("-dir-times=%s: output is not a JSON document: %v\n%s", mode, err, out)
+		}
+		for _, e := range rep.Entries {
+			if e.Path == uploads {
+				return e
+			}
+		}
+		t.Fatalf("-dir-times=%s: %s not listed:\n%s", mode, uploads, out)
+		return jsonEntry{}
+	}
+	newStamp, oldStamp := now.Format(time.RFC3339), old.Local().Format(time.RFC3339)
+
+	if e := entry("descendants"); e.MTime != newStamp || e.NewestMTime != newStamp || e.DirMTime != "" {
+		t.Errorf("descendants: mtime %q, newest %q, dir_mtime %q; want %s and no dir_mtime", e.MTime, e.NewestMTime, e.DirMTime, newStamp)
+	}
+	if e := entry("self"); e.MTime != oldStamp || e.NewestMTime != "" || e.DirMTime != "" {
+		t.Errorf("self: mtime %q, newest %q, dir_mtime %q; want %s only", e.MTime, e.NewestMTime, e.DirMTime, oldStamp)
+	}
+	if e := entry("both"); e.MTime != newStamp || e.DirMTime != oldStamp {
+		t.Errorf("both: mtime %q, dir_mtime %q; want %s and %s", e.MTime, e.DirMTime, newStamp, oldStamp)
+	}
+
+	// The dir_mtime column implies the directory's own time.
+	resetResults()
+	out, err := runCaptured(t, "-columns=dir_mtime,mtime,path", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("-columns=dir_mtime: %v\n%s", err, out)
+	}
+	want := old.Local().Format("2006-01-02 15:04") + "  " + now.Format("2006-01-02 15:04") + "  " + uploads + "\n"
+	if !strings.Contains(out, want) {
+		t.Errorf("-columns=dir_mtime,mtime,path lacks %q:\n%s", want, out)
+	}
+
+	resetResults()
+	if _, err := runCaptured(t, "-dir-times=newest", tmpDir, "1K"); err == nil {
+		t.Error("-dir-times=newest accepted")
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// imageHeaderLimit bounds how much of a file -analyze-images reads: the
+// fixed headers are far smaller, and a VMDK text descriptor that does not
+// fit is not one worth trusting.
+const imageHeaderLimit = 64 << 10
+
+// imageInfo is what the header of a disk image says about it.
+type imageInfo struct {
+	Format string
+	// Virtual is the size of the disk the guest sees.
+	Virtual uint64
+	// Allocated is the host bytes the image file occupies, or -1 when the
+	// platform cannot tell.
+	Allocated int64
+}
+
+// errNotImage marks files that are not a recognized disk image.
+var errNotImage = errors.New("not a disk image")
+
+// Magic numbers of the formats recognized by content.
+var (
+	qcow2Magic = []byte("QFI\xfb")
+	vmdkMagic  = []byte("KDMV")
+	vdiMagic   = uint32(0xbeda107f)
+)
+
+// rawImageExts are the extensions of images with no header, whose virtual
+// size is the file's own.
+var rawImageExts = map[string]bool{".img": true, ".raw": true}
+
+// parseImageHeader identifies a disk image from its first bytes, at most
+// imageHeaderLimit of them. size is the file's length and name its path,
+// used for the extension of headerless raw images.
+func parseImageHeader(hdr []byte, size int64, name string) (imageInfo, error) {
+	switch {
+	case bytes.HasPrefix(hdr, qcow2Magic):
+		return parseQcow2(hdr)
+	case bytes.HasPrefix(hdr, vmdkMagic):
+		return parseVMDKSparse(hdr)
+	case bytes.HasPrefix(hdr, []byte("# Disk DescriptorFile")):
+		return parseVMDKDescriptor(hdr)
+	case len(hdr) >= 68 && binary.LittleEndian.Uint32(hdr[64:]) == vdiMagic:
+		return parseVDI(hdr)
+	case rawImageExts[strings.ToLower(filepath.Ext(name))]:
+		return imageInfo{Format: "raw", Virtual: uint64(size)}, nil
+	}
+	return imageInfo{}, errNotImage
+}
+
+// parseQcow2 reads a qcow2 header: version at 4, cluster bits at 20 and
+// the virtual size at 24, all big-endian.
+func parseQcow2(hdr []byte) (imageInfo, error) {
+	if len(hdr) < 72 {
+		return imageInfo{}, fmt.Errorf("corrupt qcow2 header: %d bytes, want at least 72", len(hdr))
+	}
+	if v := binary.BigEndian.Uint32(hdr[4:]); v != 2 && v != 3 {
+		return imageInfo{}, fmt.Errorf("corrupt qcow2 header: version %d", v)
+	}
+	if bits := binary.BigEndian.Uint32(hdr[20:]); bits < 9 || bits > 21 {
+		return imageInfo{}, fmt.Errorf("corrupt qcow2 header: cluster bits %d", bits)
+	}
+	return imageInfo{Format: "qcow2", Virtual: binary.BigEndian.Uint64(hdr[24:])}, nil
+}
+
+// parseVMDKSparse reads a hosted sparse extent header: version at 4 and
+// the capacity in 512-byte sectors at 12, little-endian.
+func parseVMDKSparse(hdr []byte) (imageInfo, error) {
+	if len(hdr) < 20 {
+		return imageInfo{}, fmt.Errorf("corrupt VMDK header: %d bytes, want at least 20", len(hdr))
+	}
+	if v := binary.LittleEndian.Uint32(hdr[4:]); v < 1 || v > 3 {
+		return imageInfo{}, fmt.Errorf("corrupt VMDK header: version %d", v)
+	}
+	sectors := binary.LittleEndian.Uint64(hdr[12:])
+	if sectors > 1<<55 {
+		return imageInfo{}, fmt.Errorf("corrupt VMDK header: capacity of %d sectors", sectors)
+	}
+	return imageInfo{Format: "vmdk", Virtual: sectors * 512}, nil
+}
+
+// parseVMDKDescriptor sums the extents of a VMDK text descriptor, lines
+// such as `RW 41943040 SPARSE "disk-s001.vmdk"` giving sectors.
+func parseVMDKDescriptor(hdr []byte) (imageInfo, error) {
+	info := imageInfo{Format: "vmdk"}
+	extents := 0
+	sc := bufio.NewScanner(bytes.NewReader(hdr))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 3 || fields[0] != "RW" && fields[0] != "RDONLY" && fields[0] != "NOACCESS" {
+			continue
+		}
+		sectors, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil || sectors > 1<<55 {
+			return imageInfo{}, fmt.Errorf("corrupt VMDK descriptor: extent size %q", fields[1])
+		}
+		info.Virtual = addSize(info.Virtual, sectors*512)
+		extents++
+	}
+	if extents == 0 {
+		return imageInfo{}, errors.New("corrupt VMDK descriptor: no extents")
+	}
+	return info, nil
+}
+
+// parseVDI reads a VirtualBox header: version at 68 and the disk size at
+// 368, little-endian.
+func parseVDI(hdr []byte) (imageInfo, error) {
+	if len(hdr) < 376 {
+		return imageInfo{}, fmt.Errorf("corrupt VDI header: %d bytes, want at least 376", len(hdr))
+	}
+	if major := binary.LittleEndian.Uint32(hdr[68:]) >> 16; major != 1 {
+		return imageInfo{}, fmt.Errorf("corrupt VDI header: version %d", major)
+	}
+	return imageInfo{Format: "vdi", Virtual: binary.LittleEndian.Uint64(hdr[368:])}, nil
+}
+
+// readImageInfo opens path read-only and parses its header.
+func readImageInfo(path string, size int64) (imageInfo, error) {
+	openFiles.acquire()
+	defer openFiles.release()
+	f, err := os.Open(path)
+	if err != nil {
+		return imageInfo{}, err
+	}
+	defer f.Close()
+	hdr, err := io.ReadAll(io.LimitReader(f, imageHeaderLimit))
+	if err != nil {
+		return imageInfo{}, err
+	}
+	info, err := parseImageHeader(hdr, size, path)
+	if err != nil {
+		return imageInfo{}, err
+	}
+	info.Allocated = -1
+	if n, err := probeAllocated(path); err == nil {
+		info.Allocated = n
+	}
+	return info, nil
+}
+
+// allocRatio is the share of the virtual disk the host has allocated,
+// in percent, or -1 when unknown.
+func (info imageInfo) allocRatio() float64 {
+	if info.Allocated < 0 || info.Virtual == 0 {
+		return -1
+	}
+	return float64(info.Allocated) / float64(info.Virtual) * 100
+}
+
+// imageAnalyzer parses each listed file's header once and serves it to
+// the image annotators, which run one after the other for an entry.
+type imageAnalyzer struct {
+	limit float64 // allocation percentage that flags an image
+
+	mu    sync.Mutex
+	cache map[string]imageResult
+}
+
+type imageResult struct {
+	info imageInfo
+	err  error
+}
+
+func newImageAnalyzer(limit float64) *imageAnalyzer {
+	return &imageAnalyzer{limit: limit, cache: make(map[string]imageResult)}
+}
+
+// lookup returns the image details of res; errNotImage for directories
+// and other files.
+func (a *imageAnalyzer) lookup(res FileInfo) (imageInfo, error) {
+	if res.IsDir {
+		return imageInfo{}, errNotImage
+	}
+	a.mu.Lock()
+	r, ok := a.cache[res.Path]
+	a.mu.Unlock()
+	if !ok {
+		r.info, r.err = readImageInfo(res.Path, int64(res.Size))
+		a.mu.Lock()
+		a.cache[res.Path] = r
+		a.mu.Unlock()
+	}
+	return r.info, r.err
+}
+
+// annotators returns the columns -analyze-images adds. Only the first
+// reports a corrupt header, so that one bad file gives one message.
+func (a *imageAnalyzer) annotators() []Annotator {
+	return []Annotator{
+		imageColumn{a, "image_format", true, func(info imageInfo) string { return info.Format }},
+		imageColumn{a, "image_virtual", false, func(info imageInfo) string { return humanReadableSize(info.Virtual) }},
+		imageColumn{a, "image_allocated", false, func(info imageInfo) string {
+			if info.Allocated < 0 {
+				return ""
+			}
+			return humanReadableSize(uint64(info.Allocated))
+		}},
+		imageColumn{a, "image_alloc_pct", false, func(info imageInfo) string {
+			r := info.allocRatio()
+			if r < 0 {
+				return ""
+			}
+			pct := fmt.Sprintf("%.0f%%", r)
+			if r > a.limit {
+				pct += " (over limit)"
+			}
+			return pct
+		}},
+	}
+}
+
+// imageColumn is one -analyze-images column.
+type imageColumn struct {
+	a         *imageAnalyzer
+	name      string
+	reportErr bool
+	value     func(imageInfo) string
+}
+
+func (c imageColumn) Name() string { return c.name }
+
+func (c imageColumn) Annotate(res FileInfo) (string, error) {
+	info, err := c.a.lookup(res)
+	if errors.Is(err, errNotImage) || err != nil && !c.reportErr {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return c.value(info), nil
+}
+
+// print lists the images whose allocation is over the limit.
+func (a *imageAnalyzer) print() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var images, over []string
+	for path, r := range a.cache {
+		if r.err != nil {
+			continue
+		}
+		images = append(images, path)
+		if r.info.allocRatio() > a.limit {
+			over = append(over, path)
+		}
+	}
+	sort.Strings(over)
+	fmt.Fprintf(stdout, "\nDisk images: %d listed, %d over %.0f%% of their virtual size allocated.\n", len(images), len(over), a.limit)
+	for _, path := range over {
+		info := a.cache[path].info
+		fmt.Fprintf(stdout, "  %s  %s of %s (%.0f%%), %s\n", displayPath(path),
+			humanReadableSize(uint64(info.Allocated)), humanReadableSize(info.Virtual), info.allocRatio(), info.Format)
+	}
+}
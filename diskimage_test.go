@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// qcow2Header returns a minimal qcow2 header.
+func qcow2Header(version, clusterBits uint32, virtual uint64) []byte {
+	h := make([]byte, 104)
+	copy(h, qcow2Magic)
+	binary.BigEndian.PutUint32(h[4:], version)
+	binary.BigEndian.PutUint32(h[20:], clusterBits)
+	binary.BigEndian.PutUint64(h[24:], virtual)
+	return h
+}
+
+// vmdkHeader returns a minimal hosted sparse extent header.
+func vmdkHeader(version uint32, sectors uint64) []byte {
+	h := make([]byte, 512)
+	copy(h, vmdkMagic)
+	binary.LittleEndian.PutUint32(h[4:], version)
+	binary.LittleEndian.PutUint64(h[12:], sectors)
+	return h
+}
+
+func TestParseImageHeader(t *testing.T) {
+	vdi := make([]byte, 512)
+	copy(vdi, "<<< Oracle VM VirtualBox Disk Image >>>\n")
+	binary.LittleEndian.PutUint32(vdi[64:], vdiMagic)
+	binary.LittleEndian.PutUint32(vdi[68:], 0x00010001)
+	binary.LittleEndian.PutUint64(vdi[368:], 8<<30)
+
+	descriptor := "# Disk DescriptorFile\nversion=1\ncreateType=\"twoGbMaxExtentSparse\"\n\n" +
+		"RW 4192256 SPARSE \"disk-s001.vmdk\"\nRW 2048 SPARSE \"disk-s002.vmdk\"\n"
+
+	for _, tc := range []struct {
+		name    string
+		hdr     []byte
+		format  string
+		virtual uint64
+	}{
+		{"disk.qcow2", qcow2Header(3, 16, 20<<30), "qcow2", 20 << 30},
+		{"old.qcow2", qcow2Header(2, 16, 1<<30), "qcow2", 1 << 30},
+		{"disk.vmdk", vmdkHeader(1, 2097152), "vmdk", 1 << 30},
+		{"disk.vmdk", []byte(descriptor), "vmdk", (4192256 + 2048) * 512},
+		{"disk.vdi", vdi, "vdi", 8 << 30},
+		// Content wins over the extension.
+		{"misnamed.bin", qcow2Header(3, 16, 5<<20), "qcow2", 5 << 20},
+		{"disk.IMG", []byte("anything"), "raw", 12345},
+	} {
+		info, err := parseImageHeader(tc.hdr, 12345, tc.name)
+		if err != nil || info.Format != tc.format || info.Virtual != tc.virtual {
+			t.Errorf("%s: got %+v, %v; want %s of %d bytes", tc.name, info, err, tc.format, tc.virtual)
+		}
+	}
+}
+
+func TestParseImageHeaderCorrupt(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		hdr  []byte
+		want string
+	}{
+		{"short.qcow2", qcow2Header(3, 16, 1)[:40], "corrupt qcow2 header: 40 bytes"},
+		{"v9.qcow2", qcow2Header(9, 16, 1), "corrupt qcow2 header: version 9"},
+		{"bits.qcow2", qcow2Header(3, 40, 1), "corrupt qcow2 header: cluster bits 40"},
+		{"v0.vmdk", vmdkHeader(0, 1), "corrupt VMDK header: version 0"},
+		{"huge.vmdk", vmdkHeader(1, 1<<60), "corrupt VMDK header: capacity"},
+		{"empty.vmdk", []byte("# Disk DescriptorFile\nversion=1\n"), "no extents"},
+		{"bad.vmdk", []byte("# Disk DescriptorFile\nRW lots SPARSE \"x\"\n"), `extent size "lots"`},
+	} {
+		_, err := parseImageHeader(tc.hdr, 0, tc.name)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: err = %v, want %q", tc.name, err, tc.want)
+		}
+	}
+	if _, err := parseImageHeader([]byte("plain text"), 10, "notes.txt"); err != errNotImage {
+		t.Errorf("plain file: err = %v, want errNotImage", err)
+	}
+}
+
+func TestRunAnalyzeImages(t *testing.T) {
+	// Random contents, so that a compressing filesystem still allocates
+	// all of the raw image.
+	raw := make([]byte, 8192)
+	rand.New(rand.NewSource(1)).Read(raw)
+	tmpDir := createTestDir(t, map[string]string{
+		"vm/disk.qcow2":   string(qcow2Header(3, 16, 1<<30)) + strings.Repeat("\x00", 2000),
+		"vm/broken.qcow2": string(qcow2Header(7, 16, 1<<30)) + strings.Repeat("\x00", 2000),
+		"vm/full.img":     string(raw),
+		"notes.txt":       strings.Repeat("n", 2000),
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+
+	resetResults()
+	out, err := runCaptured(t, "-no-hints", "-analyze-images", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	for _, want := range []string{
+		filepath.Join(tmpDir, "vm", "disk.qcow2") + "  image_format=qcow2  image_virtual=1.00 GiB",
+		"Error annotating " + filepath.Join(tmpDir, "vm", "broken.qcow2") + " with image_format: corrupt qcow2 header: version 7",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "notes.txt  image_") {
+		t.Errorf("a plain file got image columns:\n%s", out)
+	}
+	if strings.Count(out, "broken.qcow2 with image_") != 1 {
+		t.Errorf("a corrupt header was reported more than once:\n%s", out)
+	}
+	if runtime.GOOS != "windows" {
+		// A fully written raw image has all of its virtual size allocated.
+		if !strings.Contains(out, "over 80% of their virtual size allocated.\n  "+filepath.Join(tmpDir, "vm", "full.img")) {
+			t.Errorf("full raw image not flagged:\n%s", out)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// errProbeUnsupported is returned by platform probes that have no
+// implementation on the current OS.
+var errProbeUnsupported = errors.New("not supported on this platform")
+
+// slowReadDir is the listing latency above which doctor warns about scan speed.
+const slowReadDir = 50 * time.Millisecond
+
+// probeStatus is the outcome of one doctor probe.
+type probeStatus string
+
+const (
+	probeOK          probeStatus = "ok"
+	probeUnsupported probeStatus = "unsupported"
+	probeSkipped     probeStatus = "skipped"
+	probeFailed      probeStatus = "error"
+)
+
+// probeResult is one row of the capability matrix.
+type probeResult struct {
+	Name   string
+	Status probeStatus
+	Detail string
+	// Degrades says how spacehogs' results are affected, if at all.
+	Degrades string
+}
+
+// probeOps are the filesystem operations doctor uses. Tests replace
+// individual fields to inject failures.
+type probeOps struct {
+	readDir       func(name string) ([]os.DirEntry, error)
+	dirEntryTypes func(dir string) (bool, error)
+	statfs        func(path string) (string, error)
+	allocated     func(name string) (int64, error)
+	setxattr      func(path, attr string, value []byte) error
+	mkdirTemp     func(dir, pattern string) (string, error)
+	writeFile     func(name string, data []byte) error
+	truncate      func(name string, size int64) error
+	symlink       func(oldname, newname string) error
+	link          func(oldname, newname string) error
+	lstat         func(name string) (os.FileInfo, error)
+	remove        func(name string) error
+	removeAll     func(name string) error
+}
+
+// defaultProbeOps returns the real implementations.
+func defaultProbeOps() probeOps {
+	return probeOps{
+		readDir:       os.ReadDir,
+		dirEntryTypes: probeDirEntryTypes,
+		statfs:        probeStatfs,
+		allocated:     probeAllocated,
+		setxattr:      probeSetxattr,
+		mkdirTemp:     os.MkdirTemp,
+		writeFile:     func(name string, data []byte) error { return os.WriteFile(name, data, 0600) },
+		truncate:      os.Truncate,
+		symlink:       os.Symlink,
+		link:          os.Link,
+		lstat:         os.Lstat,
+		remove:        os.Remove,
+		removeAll:     os.RemoveAll,
+	}
+}
+
+// runDoctor implements "spacehogs doctor [PATH]".
+func runDoctor(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: spacehogs doctor [PATH]")
+	}
+	target := "."
+	if len(args) == 1 {
+		target = args[0]
+	}
+	fi, err := os.Stat(target)
+	if err != nil {
+		return fmt.Errorf("error accessing '%s': %v", target, err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("error: '%s' is not a directory", target)
+	}
+
+	fmt.Fprintf(stdout, "Probing filesystem at: %s\n\n", displayPath(target))
+	printProbeResults(runProbes(defaultProbeOps(), target))
+	return nil
+}
+
+// runProbes runs every probe against target. Write probes work in a scratch
+// directory inside target which is always removed; if it cannot be created
+// (read-only or not writable), they are skipped with a note.
+func runProbes(ops probeOps, target string) []probeResult {
+	results := []probeResult{
+		probeEntryTypes(ops, target),
+		probeStatfsSupport(ops, target),
+		probeReadDirLatency(ops, target),
+	}
+
+	writeProbes := []struct {
+		name string
+		run  func(probeOps, string) probeResult
+	}{
+		{"sparse files", probeSparse},
+		{"xattrs", probeXattr},
+		{"symlinks", probeSymlink},
+		{"hard links", probeHardlink},
+		{"case sensitivity", probeCase},
+		{"name length", probeNameLength},
+	}
+	scratch, err := ops.mkdirTemp(target, ".spacehogs-doctor-")
+	if err != nil {
+		for _, p := range writeProbes {
+			results = append(results, probeResult{
+				Name:   p.name,
+				Status: probeSkipped,
+				Detail: fmt.Sprintf("target not writable: %v", err),
+			})
+		}
+		return results
+	}
+	defer ops.removeAll(scratch)
+	for _, p := range writeProbes {
+		results = append(results, p.run(ops, scratch))
+	}
+	return results
+}
+
+// probeEntryTypes checks whether directory listings carry entry types, which
+// saves the walk a stat call per entry.
+func probeEntryTypes(ops probeOps, target string) probeResult {
+	r := probeResult{Name: "entry types"}
+	ok, err := ops.dirEntryTypes(target)
+	switch {
+	case errors.Is(err, errProbeUnsupported):
+		r.Status, r.Detail = probeUnsupported, "not probed on this platform"
+	case err != nil:
+		r.Status, r.Detail = probeFailed, err.Error()
+	case ok:
+		r.Status, r.Detail = probeOK, "listings report entry types"
+	default:
+		r.Status, r.Detail = probeUnsupported, "listings report DT_UNKNOWN"
+		r.Degrades = "the walk needs an extra stat per entry (slower scans)"
+	}
+	return r
+}
+
+// probeStatfsSupport checks that filesystem statistics are available.
+func probeStatfsSupport(ops probeOps, target string) probeResult {
+	r := probeResult{Name: "statfs"}
+	detail, err := ops.statfs(target)
+	switch {
+	case errors.Is(err, errProbeUnsupported):
+		r.Status, r.Detail = probeUnsupported, err.Error()
+	case err != nil:
+		r.Status, r.Detail = probeFailed, err.Error()
+		r.Degrades = "filesystem capacity and free space cannot be read"
+	default:
+		r.Status, r.Detail = probeOK, detail
+	}
+	return r
+}
+
+// probeReadDirLatency measures the median of a few listings of target.
+func probeReadDirLatency(ops probeOps, target string) probeResult {
+	r := probeResult{Name: "readdir latency"}
+	const samples = 5
+	times := make([]time.Duration, 0, samples)
+	for i := 0; i < samples; i++ {
+		start := time.Now()
+		if _, err := ops.readDir(target); err != nil {
+			r.Status, r.Detail = probeFailed, err.Error()
+			r.Degrades = "directories cannot be listed; scans will report errors"
+			return r
+		}
+		times = append(times, time.Since(start))
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	median := times[samples/2]
+	r.Status, r.Detail = probeOK, fmt.Sprintf("median %v per listing", median.Round(time.Microsecond))
+	if median >= slowReadDir {
+		r.Degrades = "listings are slow; large trees will take a long time to scan"
+	}
+	return r
+}
+
+// probeSparse creates a file with a hole and compares its allocation to its
+// apparent size.
+func probeSparse(ops probeOps, scratch string) probeResult {
+	r := probeResult{Name: "sparse files"}
+	name := filepath.Join(scratch, "sparse")
+	const size = 16 << 20
+	if err := ops.writeFile(name, nil); err != nil {
+		r.Status, r.Detail = probeFailed, err.Error()
+		return r
+	}
+	defer ops.remove(name)
+	if err := ops.truncate(name, size); err != nil {
+		r.Status, r.Detail = probeFailed, err.Error()
+		return r
+	}
+	alloc, err := ops.allocated(name)
+	switch {
+	case errors.Is(err, errProbeUnsupported):
+		r.Status, r.Detail = probeUnsupported, "allocation not reported on this platform"
+	case err != nil:
+		r.Status, r.Detail = probeFailed, err.Error()
+	case alloc < size:
+		r.Status, r.Detail = probeOK, fmt.Sprintf("16 MiB hole uses %s on disk", humanReadableSize(uint64(alloc)))
+		r.Degrades = "sparse files are listed at their apparent size, which can exceed their disk usage"
+	default:
+		r.Status, r.Detail = probeUnsupported, "holes are allocated"
+	}
+	return r
+}
+
+// probeXattr sets a user extended attribute on a scratch file.
+func probeXattr(ops probeOps, scratch string) probeResult {
+	r := probeResult{Name: "xattrs"}
+	name := filepath.Join(scratch, "xattr")
+	if err := ops.writeFile(name, nil); err != nil {
+		r.Status, r.Detail = probeFailed, err.Error()
+		return r
+	}
+	defer ops.remove(name)
+	err := ops.setxattr(name, "user.spacehogs_doctor", []byte("1"))
+	switch {
+	case errors.Is(err, errProbeUnsupported):
+		r.Status, r.Detail = probeUnsupported, err.Error()
+	case err != nil:
+		r.Status, r.Detail = probeUnsupported, err.Error()
+		r.Degrades = "-audit-labels finds no SELinux contexts or ACLs"
+	default:
+		r.Status, r.Detail = probeOK, "user attributes can be set"
+	}
+	return r
+}
+
+// probeSymlink creates a symbolic link.
+func probeSymlink(ops probeOps, scratch string) probeResult {
+	r := probeResult{Name: "symlinks"}
+	name := filepath.Join(scratch, "link")
+	if err := ops.symlink("target", name); err != nil {
+		r.Status, r.Detail = probeUnsupported, err.Error()
+		r.Degrades = "symbolic links cannot be created; link-related output never appears"
+		return r
+	}
+	defer ops.remove(name)
+	r.Status, r.Detail = probeOK, "symbolic links can be created"
+	return r
+}
+
+// probeHardlink creates a second hard link to a scratch file.
+func probeHardlink(ops probeOps, scratch string) probeResult {
+	r := probeResult{Name: "hard links"}
+	name := filepath.Join(scratch, "file")
+	if err := ops.writeFile(name, []byte("x")); err != nil {
+		r.Status, r.Detail = probeFailed, err.Error()
+		return r
+	}
+	defer ops.remove(name)
+	linked := filepath.Join(scratch, "hardlink")
+	if err := ops.link(name, linked); err != nil {
+		r.Status, r.Detail = probeUnsupported, err.Error()
+		return r
+	}
+	defer ops.remove(linked)
+	r.Status, r.Detail = probeOK, "hard links can be created"
+	r.Degrades = "hard-linked data is counted once per link, so totals can exceed disk usage"
+	return r
+}
+
+// probeCase checks whether names differing only in case refer to the same file.
+func probeCase(ops probeOps, scratch string) probeResult {
+	r := probeResult{Name: "case sensitivity"}
+	name := filepath.Join(scratch, "CaseProbe")
+	if err := ops.writeFile(name, nil); err != nil {
+		r.Status, r.Detail = probeFailed, err.Error()
+		return r
+	}
+	defer ops.remove(name)
+	if _, err := ops.lstat(filepath.Join(scratch, "caseprobe")); err == nil {
+		r.Status, r.Detail = probeOK, "case-insensitive"
+		r.Degrades = "-exclude matches names case-sensitively although the filesystem does not"
+	} else {
+		r.Status, r.Detail = probeOK, "case-sensitive"
+	}
+	return r
+}
+
+// probeNameLength finds the longest file name component that can be created.
+func probeNameLength(ops probeOps, scratch string) probeResult {
+	r := probeResult{Name: "name length"}
+	fits := func(n int) bool {
+		name := filepath.Join(scratch, strings.Repeat("n", n))
+		if err := ops.writeFile(name, nil); err != nil {
+			return false
+		}
+		ops.remove(name)
+		return true
+	}
+	if !fits(1) {
+		r.Status, r.Detail = probeFailed, "cannot create files"
+		return r
+	}
+	lo, hi := 1, 255
+	if fits(hi) {
+		lo = hi
+	}
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if fits(mid) {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	r.Status, r.Detail = probeOK, fmt.Sprintf("names up to %d bytes", lo)
+	if lo < 255 {
+		r.Degrades = fmt.Sprintf("names longer than %d bytes cannot be created here", lo)
+	}
+	return r
+}
+
+// printProbeResults writes the capability matrix and the degradation summary.
+func printProbeResults(results []probeResult) {
+	fmt.Fprintln(stdout, "CAPABILITY         STATUS       DETAIL")
+	fmt.Fprintln(stdout, "--------------------------------------------------------")
+	for _, r := range results {
+		fmt.Fprintf(stdout, "%-17s  %-11s  %s\n", r.Name, r.Status, r.Detail)
+	}
+
+	fmt.Fprintln(stdout, "\nEffects on spacehogs results:")
+	degraded := false
+	for _, r := range results {
+		if r.Degrades != "" {
+			fmt.Fprintf(stdout, "  %s: %s\n", r.Name, r.Degrades)
+			degraded = true
+		}
+	}
+	if !degraded {
+		fmt.Fprintln(stdout, "  none")
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// probeDirEntryTypes reads raw directory entries and reports whether the
+// filesystem fills in d_type.
+func probeDirEntryTypes(dir string) (bool, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	buf := make([]byte, 8192)
+	n, err := syscall.ReadDirent(int(f.Fd()), buf)
+	if err != nil {
+		return false, err
+	}
+	for off := 0; off < n; {
+		d := (*syscall.Dirent)(unsafe.Pointer(&buf[off]))
+		if d.Reclen == 0 {
+			break
+		}
+		if d.Type != syscall.DT_UNKNOWN {
+			return true, nil
+		}
+		off += int(d.Reclen)
+	}
+	return false, nil
+}
+
+// probeSetxattr sets an extended attribute.
+func probeSetxattr(path, attr string, value []byte) error {
+	return syscall.Setxattr(path, attr, value, 0)
+}
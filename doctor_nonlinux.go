@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+// probeDirEntryTypes is not implemented outside Linux.
+func probeDirEntryTypes(dir string) (bool, error) {
+	return false, errProbeUnsupported
+}
+
+// probeSetxattr is not implemented outside Linux.
+func probeSetxattr(path, attr string, value []byte) error {
+	return errProbeUnsupported
+}
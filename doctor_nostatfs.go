@@ -0,0 +1,23 @@
+//go:build !(linux || darwin || freebsd)
+
+package main
+
+// probeStatfs is not implemented on this platform.
+func probeStatfs(path string) (string, error) {
+	return "", errProbeUnsupported
+}
+
+// availableSpace is not implemented on this platform.
+func availableSpace(path string) (uint64, error) {
+	return 0, errProbeUnsupported
+}
+
+// probeAllocated is not implemented on this platform.
+func probeAllocated(name string) (int64, error) {
+	return 0, errProbeUnsupported
+}
+
+// filesystemSize is not implemented on this platform.
+func filesystemSize(path string) (uint64, error) {
+	return 0, errProbeUnsupported
+}
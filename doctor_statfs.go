@@ -0,0 +1,52 @@
+//go:build linux || darwin || freebsd
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// probeStatfs reads filesystem statistics for path.
+func probeStatfs(path string) (string, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return "", err
+	}
+	free := uint64(st.Bavail) * uint64(st.Bsize)
+	total := uint64(st.Blocks) * uint64(st.Bsize)
+	return fmt.Sprintf("%s free of %s, block size %d", humanReadableSize(free), humanReadableSize(total), st.Bsize), nil
+}
+
+// availableSpace returns the bytes available to unprivileged users on
+// the filesystem holding path.
+func availableSpace(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
+
+// filesystemSize returns the total bytes of the filesystem holding path.
+func filesystemSize(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Blocks) * uint64(st.Bsize), nil
+}
+
+// probeAllocated returns the bytes allocated on disk for name.
+func probeAllocated(name string) (int64, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return 0, err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, errProbeUnsupported
+	}
+	return int64(st.Blocks) * 512, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDoctorOnTempDir(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{"existing.txt": "x"})
+	defer os.RemoveAll(tmpDir)
+
+	output, err := runCaptured(t, "doctor", tmpDir)
+	if err != nil {
+		t.Fatalf("doctor error: %v", err)
+	}
+	for _, name := range []string{"entry types", "statfs", "readdir latency", "sparse files", "xattrs", "symlinks", "hard links", "case sensitivity", "name length"} {
+		if !strings.Contains(output, name) {
+			t.Errorf("capability %q missing from output:\n%s", name, output)
+		}
+	}
+	if runtime.GOOS == "linux" {
+		for _, want := range []string{
+			"symlinks           ok",
+			"hard links         ok",
+			"case sensitivity   ok           case-sensitive",
+			"statfs             ok",
+			"entry types        ok",
+		} {
+			if !strings.Contains(output, want) {
+				t.Errorf("expected %q on Linux:\n%s", want, output)
+			}
+		}
+	}
+
+	// Every probe cleans up after itself.
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "existing.txt" {
+		t.Errorf("doctor left files behind: %v", entries)
+	}
+}
+
+func TestDoctorRejectsFile(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{"file.txt": "x"})
+	defer os.RemoveAll(tmpDir)
+	if _, err := runCaptured(t, "doctor", tmpDir+"/file.txt"); err == nil || !strings.Contains(err.Error(), "is not a directory") {
+		t.Errorf("doctor on a file: error = %v", err)
+	}
+}
+
+// probeByName returns the named result, failing the test if it is missing.
+func probeByName(t *testing.T, results []probeResult, name string) probeResult {
+	t.Helper()
+	for _, r := range results {
+		if r.Name == name {
+			return r
+		}
+	}
+	t.Fatalf("probe %q missing from %+v", name, results)
+	return probeResult{}
+}
+
+func TestDoctorReadOnlyTargetSkipsWriteProbes(t *testing.T) {
+	tmpDir := createTestDir(t, nil)
+	defer os.RemoveAll(tmpDir)
+
+	ops := defaultProbeOps()
+	ops.mkdirTemp = func(dir, pattern string) (string, error) {
+		return "", &os.PathError{Op: "mkdir", Path: dir, Err: errors.New("read-only file system")}
+	}
+	results := runProbes(ops, tmpDir)
+	for _, name := range []string{"sparse files", "xattrs", "symlinks", "hard links", "case sensitivity", "name length"} {
+		if r := probeByName(t, results, name); r.Status != probeSkipped || !strings.Contains(r.Detail, "read-only") {
+			t.Errorf("%s: got %+v, want skipped with a note", name, r)
+		}
+	}
+	if r := probeByName(t, results, "readdir latency"); r.Status != probeOK {
+		t.Errorf("read probes should still run on a read-only target: %+v", r)
+	}
+}
+
+func TestDoctorProbeFailures(t *testing.T) {
+	tmpDir := createTestDir(t, nil)
+	defer os.RemoveAll(tmpDir)
+	failure := errors.New("operation not permitted")
+
+	tests := []struct {
+		name   string
+		inject func(*probeOps)
+		status probeStatus
+	}{
+		{"entry types", func(o *probeOps) { o.dirEntryTypes = func(string) (bool, error) { return false, nil } }, probeUnsupported},
+		{"statfs", func(o *probeOps) { o.statfs = func(string) (string, error) { return "", failure } }, probeFailed},
+		{"readdir latency", func(o *probeOps) { o.readDir = func(string) ([]os.DirEntry, error) { return nil, failure } }, probeFailed},
+		{"sparse files", func(o *probeOps) { o.allocated = func(string) (int64, error) { return 16 << 20, nil } }, probeUnsupported},
+		{"xattrs", func(o *probeOps) { o.setxattr = func(string, string, []byte) error { return failure } }, probeUnsupported},
+		{"symlinks", func(o *probeOps) { o.symlink = func(string, string) error { return failure } }, probeUnsupported},
+		{"hard links", func(o *probeOps) { o.link = func(string, string) error { return failure } }, probeUnsupported},
+		{"case sensitivity", func(o *probeOps) { o.lstat = func(string) (os.FileInfo, error) { return nil, nil } }, probeOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ops := defaultProbeOps()
+			test.inject(&ops)
+			r := probeByName(t, runProbes(ops, tmpDir), test.name)
+			if r.Status != test.status {
+				t.Errorf("status = %s, want %s (%+v)", r.Status, test.status, r)
+			}
+			if test.name == "case sensitivity" && r.Detail != "case-insensitive" {
+				t.Errorf("detail = %q, want case-insensitive", r.Detail)
+			}
+		})
+	}
+
+	t.Run("name length", func(t *testing.T) {
+		ops := defaultProbeOps()
+		realWrite := ops.writeFile
+		ops.writeFile = func(name string, data []byte) error {
+			if len(name)-len(tmpDir) > 150 {
+				return errors.New("file name too long")
+			}
+			return realWrite(name, data)
+		}
+		r := probeByName(t, runProbes(ops, tmpDir), "name length")
+		if r.Status != probeOK || r.Degrades == "" || !strings.HasPrefix(r.Detail, "names up to ") {
+			t.Errorf("got %+v, want a reduced limit with a degradation note", r)
+		}
+	})
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// printEntry is one child of a directory as its fingerprint sees it.
+type printEntry struct {
+	name  string
+	dir   bool
+	size  uint64
+	exact [sha256.Size]byte // a subdirectory's own fingerprint
+	names [sha256.Size]byte // a subdirectory's names-only fingerprint
+}
+
+// fingerprints returns the Merkle-style fingerprints of a directory from
+// its children: exact covers names, kinds and sizes, names only names and
+// kinds. Children are sorted so listing order does not matter.
+func fingerprints(entries []printEntry) (exact, names [sha256.Size]byte) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	he, hn := sha256.New(), sha256.New()
+	var size [8]byte
+	for _, e := range entries {
+		kind := []byte{'f'}
+		if e.dir {
+			kind[0] = 'd'
+		}
+		for _, h := range []io.Writer{he, hn} {
+			h.Write(kind)
+			h.Write([]byte(e.name))
+			h.Write([]byte{0})
+		}
+		binary.BigEndian.PutUint64(size[:], e.size)
+		he.Write(size[:])
+		if e.dir {
+			he.Write(e.exact[:])
+			hn.Write(e.names[:])
+		}
+	}
+	he.Sum(exact[:0])
+	hn.Sum(names[:0])
+	return exact, names
+}
+
+// dupeDir is a directory indexed by -dupe-dirs.
+type dupeDir struct {
+	Path  string
+	Size  uint64
+	Files uint64
+}
+
+// dupeGroup is a set of directories with the same fingerprint.
+type dupeGroup struct {
+	Dirs []dupeDir
+	// Fuzzy groups share names but not sizes: near copies.
+	Fuzzy bool
+	// Verified is set when -verify-content compared sampled files.
+	Verified bool
+}
+
+// savings is what deleting all but one copy would free, counting the
+// smallest copy for fuzzy groups.
+func (g dupeGroup) savings() uint64 {
+	least := g.Dirs[0].Size
+	for _, d := range g.Dirs {
+		least = min(least, d.Size)
+	}
+	return least * uint64(len(g.Dirs)-1)
+}
+
+// dupeDirIndex collects directory fingerprints during the walk. It is nil
+// unless -dupe-dirs is given.
+type dupeDirIndex struct {
+	threshold uint64
+
+	mu      sync.Mutex
+	byExact map[[sha256.Size]byte][]dupeDir
+	byNames map[[sha256.Size]byte][]dupeDir
+}
+
+// dupeDirs is the active index, if any.
+var dupeDirs *dupeDirIndex
+
+// newDupeDirIndex returns an empty index of directories of at least
+// threshold bytes.
+func newDupeDirIndex(threshold uint64) *dupeDirIndex {
+	return &dupeDirIndex{
+		threshold: threshold,
+		byExact:   make(map[[sha256.Size]byte][]dupeDir),
+		byNames:   make(map[[sha256.Size]byte][]dupeDir),
+	}
+}
+
+// finishDir fingerprints the finished directory n and hands the result to
+// its parent. A directory that was not read in full is not indexed, and
+// its fingerprint is made unique so no ancestor matches either.
+func (x *dupeDirIndex) finishDir(n *dirNode, sub subtreeStats) {
+	n.mu.Lock()
+	entries := n.prints
+	n.prints = nil
+	n.mu.Unlock()
+	exact, names := fingerprints(entries)
+	if sub.LowerBound {
+		exact, names = sha256.Sum256([]byte("partial\x00"+n.path)), sha256.Sum256([]byte("partial\x00"+n.path))
+	} else if sub.Size > 0 && sub.Size >= x.threshold {
+		d := dupeDir{Path: n.path, Size: sub.Size, Files: sub.Files}
+		x.mu.Lock()
+		x.byExact[exact] = append(x.byExact[exact], d)
+		x.byNames[names] = append(x.byNames[names], d)
+		x.mu.Unlock()
+	}
+	n.parent.addPrints(printEntry{name: filepath.Base(n.path), dir: true, size: sub.Size, exact: exact, names: names})
+}
+
+// groups returns the duplicate groups, largest savings first. Copies
+// nested inside copies are left out: two copied trees' subdirectories
+// match as well, and only the outermost pair is worth reporting. Fuzzy
+// groups are included when fuzzy is set.
+func (x *dupeDirIndex) groups(fuzzy bool) []dupeGroup {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	var groups []dupeGroup
+	inGroup := make(map[string]bool)
+	exactOf := make(map[string][sha256.Size]byte)
+	for sum, dirs := range x.byExact {
+		for _, d := range dirs {
+			exactOf[d.Path] = sum
+		}
+		if len(dirs) > 1 {
+			groups = append(groups, dupeGroup{Dirs: append([]dupeDir(nil), dirs...)})
+			for _, d := range dirs {
+				inGroup[d.Path] = true
+			}
+		}
+	}
+	if fuzzy {
+		for _, dirs := range x.byNames {
+			if len(dirs) < 2 {
+				continue
+			}
+			// Keep one directory per exact fingerprint: exact copies are
+			// reported on their own.
+			seen := make(map[[sha256.Size]byte]bool)
+			var near []dupeDir
+			for _, d := range dirs {
+				if !seen[exactOf[d.Path]] {
+					seen[exactOf[d.Path]] = true
+					near = append(near, d)
+				}
+			}
+			if len(near) > 1 {
+				groups = append(groups, dupeGroup{Dirs: near, Fuzzy: true})
+				for _, d := range near {
+					inGroup[d.Path] = true
+				}
+			}
+		}
+	}
+	outer := groups[:0]
+	for _, g := range groups {
+		nested := true
+		for _, d := range g.Dirs {
+			if !inGroup[filepath.Dir(d.Path)] {
+				nested = false
+				break
+			}
+		}
+		if !nested {
+			sort.Slice(g.Dirs, func(i, j int) bool { return g.Dirs[i].Path < g.Dirs[j].Path })
+			outer = append(outer, g)
+		}
+	}
+	sort.Slice(outer, func(i, j int) bool {
+		if si, sj := outer[i].savings(), outer[j].savings(); si != sj {
+			return si > sj
+		}
+		return outer[i].Dirs[0].Path < outer[j].Dirs[0].Path
+	})
+	return outer
+}
+
+// verifySample is how many files -verify-content reads from each copy.
+const verifySample = 8
+
+// verifyGroups content-hashes the same sampled files in every member of
+// each exact group, splitting groups whose members differ. Fuzzy groups
+// are left as they are, since their files are known to differ.
+func verifyGroups(groups []dupeGroup) []dupeGroup {
+	var out []dupeGroup
+	for _, g := range groups {
+		if g.Fuzzy {
+			out = append(out, g)
+			continue
+		}
+		sample := sampleFiles(g.Dirs[0].Path, verifySample)
+		split := make(map[[sha256.Size]byte][]dupeDir)
+		var order [][sha256.Size]byte
+		for _, d := range g.Dirs {
+			sum, err := hashSample(d.Path, sample)
+			if err != nil {
+				fmt.Fprintf(stderr, "Error verifying %s: %v\n", displayPath(d.Path), err)
+				sum = sha256.Sum256([]byte("unverified\x00" + d.Path))
+			}
+			if split[sum] == nil {
+				order = append(order, sum)
+			}
+			split[sum] = append(split[sum], d)
+		}
+		for _, sum := range order {
+			if dirs := split[sum]; len(dirs) > 1 {
+				out = append(out, dupeGroup{Dirs: dirs, Verified: true})
+			}
+		}
+	}
+	return out
+}
+
+// sampleFiles returns up to n file paths below dir, relative to it,
+// spread evenly over the tree in name order.
+func sampleFiles(dir string, n int) []string {
+	var all []string
+	filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			if rel, err := filepath.Rel(dir, p); err == nil {
+				all = append(all, rel)
+			}
+		}
+		return nil
+	})
+	if len(all) <= n {
+		return all
+	}
+	sample := make([]string, n)
+	for i := range sample {
+		sample[i] = all[i*len(all)/n]
+	}
+	return sample
+}
+
+// hashSample hashes the contents of the sampled files below dir.
+func hashSample(dir string, sample []string) ([sha256.Size]byte, error) {
+	h := sha256.New()
+	for _, rel := range sample {
+		openFiles.acquire()
+		f, err := os.Open(filepath.Join(dir, rel))
+		if err != nil {
+			openFiles.release()
+			return [sha256.Size]byte{}, err
+		}
+		h.Write([]byte(rel))
+		h.Write([]byte{0})
+		_, err = io.Copy(h, f)
+		f.Close()
+		openFiles.release()
+		if err != nil {
+			return [sha256.Size]byte{}, err
+		}
+	}
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum, nil
+}
+
+// printDupeDirs lists the duplicate groups.
+func printDupeDirs(groups []dupeGroup, verified bool) {
+	fmt.Fprintln(stdout, "\nDuplicate directory trees:")
+	if verified {
+		fmt.Fprintf(stdout, "(matched by names and sizes, and by the contents of up to %d sampled files per tree)\n", verifySample)
+	} else {
+		fmt.Fprintln(stdout, "(matched by names and sizes only; trees can match and still differ in content, -verify-content checks a sample)")
+	}
+	if len(groups) == 0 {
+		fmt.Fprintln(stdout, "  none found")
+		return
+	}
+	for _, g := range groups {
+		what := "copies"
+		if g.Fuzzy {
+			what = "near copies (same names, sizes differ)"
+		}
+		fmt.Fprintf(stdout, "  %d %s, %s reclaimable:\n", len(g.Dirs), what, humanReadableSize(g.savings()))
+		for _, d := range g.Dirs {
+			fmt.Fprintf(stdout, "    %-10s  %s\n", humanReadableSize(d.Size), displayPath(d.Path))
+		}
+	}
+}
+
+// addPrints records fingerprint entries for children of n.
+func (n *dirNode) addPrints(entries ...printEntry) {
+	n.mu.Lock()
+	n.prints = append(n.prints, entries...)
+	n.mu.Unlock()
+}
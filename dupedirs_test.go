@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFingerprintsIgnoreOrder(t *testing.T) {
+	a := []printEntry{{name: "x", size: 1}, {name: "y", size: 2}}
+	b := []printEntry{{name: "y", size: 2}, {name: "x", size: 1}}
+	ea, na := fingerprints(a)
+	eb, nb := fingerprints(b)
+	if ea != eb || na != nb {
+		t.Error("fingerprints depend on listing order")
+	}
+	ec, nc := fingerprints([]printEntry{{name: "x", size: 1}, {name: "y", size: 3}})
+	if ec == ea {
+		t.Error("a changed size did not change the exact fingerprint")
+	}
+	if nc != na {
+		t.Error("a changed size changed the names-only fingerprint")
+	}
+}
+
+func TestRunDupeDirs(t *testing.T) {
+	tree := map[string]string{
+		"photos/2023/a.jpg": strings.Repeat("a", 3000),
+		"photos/2023/b.jpg": strings.Repeat("b", 2000),
+		"photos/readme":     "r",
+		"other/big.bin":     strings.Repeat("z", 4000),
+	}
+	for name, data := range map[string]string{
+		"photos/2023/a.jpg": strings.Repeat("a", 3000),
+		"photos/2023/b.jpg": strings.Repeat("b", 2000),
+		"photos/readme":     "r",
+	} {
+		tree["backup/"+name] = data
+	}
+	// A near copy: same names, one file has grown.
+	tree["old/photos/2023/a.jpg"] = strings.Repeat("a", 3500)
+	tree["old/photos/2023/b.jpg"] = strings.Repeat("b", 2000)
+	tree["old/photos/readme"] = "r"
+	tmpDir := createTestDir(t, tree)
+	defer os.RemoveAll(tmpDir)
+
+	resetResults()
+	out, err := runCaptured(t, "-no-hints", "-dupe-dirs", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	want := "  2 copies, 4.88 KiB reclaimable:\n" +
+		"    4.88 KiB    " + filepath.Join(tmpDir, "backup", "photos") + "\n" +
+		"    4.88 KiB    " + filepath.Join(tmpDir, "photos") + "\n"
+	if !strings.Contains(out, want) {
+		t.Errorf("output lacks %q:\n%s", want, out)
+	}
+	if !strings.Contains(out, "matched by names and sizes only") {
+		t.Errorf("output does not state how trees were matched:\n%s", out)
+	}
+	_, dupes, _ := strings.Cut(out, "Duplicate directory trees:")
+	if strings.Contains(dupes, filepath.Join(tmpDir, "old")) || strings.Contains(dupes, "2023") {
+		t.Errorf("near copy or nested copy reported without -fuzzy:\n%s", out)
+	}
+
+	resetResults()
+	out, err = runCaptured(t, "-no-hints", "-dupe-dirs", "-fuzzy", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "near copies (same names, sizes differ)") || !strings.Contains(out, filepath.Join(tmpDir, "old", "photos")+"\n") {
+		t.Errorf("-fuzzy did not report the near copy:\n%s", out)
+	}
+}
+
+func TestRunDupeDirsVerifyContent(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"a/data": strings.Repeat("x", 2000),
+		"b/data": strings.Repeat("x", 2000),
+		"c/data": strings.Repeat("y", 2000),
+	})
+	defer os.RemoveAll(tmpDir)
+
+	resetResults()
+	out, err := runCaptured(t, "-no-hints", "-dupe-dirs", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "  3 copies, ") {
+		t.Errorf("same-size trees not grouped on names and sizes:\n%s", out)
+	}
+
+	resetResults()
+	out, err = runCaptured(t, "-no-hints", "-dupe-dirs", "-verify-content", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	_, dupes, _ := strings.Cut(out, "Duplicate directory trees:")
+	if !strings.Contains(dupes, "  2 copies, ") || strings.Contains(dupes, filepath.Join(tmpDir, "c")+"\n") {
+		t.Errorf("-verify-content kept a tree whose content differs:\n%s", out)
+	}
+}
+
+func TestRunDupeDirsFlagsNeedDupeDirs(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, flag := range []string{"-fuzzy", "-verify-content"} {
+		if _, err := runCaptured(t, flag, tmpDir, "1K"); err == nil {
+			t.Errorf("%s accepted without -dupe-dirs", flag)
+		}
+	}
+}
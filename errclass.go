@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// errorClass is a coarse category of filesystem error, as named in
+// -fatal-errors.
+type errorClass string
+
+const (
+	classPermission errorClass = "permission"
+	classIO         errorClass = "io"
+	classNotFound   errorClass = "notfound"
+	classTimeout    errorClass = "timeout"
+	classOther      errorClass = "other"
+)
+
+// errorClasses lists the classes in the order they are documented.
+var errorClasses = []errorClass{classPermission, classIO, classNotFound, classTimeout, classOther}
+
+// exitFatalError is the exit status when -fatal-errors aborts a scan, so
+// that cron wrappers can tell it from a usage or setup error.
+const exitFatalError = 3
+
+// exitRootExcluded is the exit status when -exclude names the scan root,
+// so that a misconfigured job is not mistaken for a clean scan.
+const exitRootExcluded = 4
+
+// exitBaselineViolation is the exit status when spacehogs check finds the
+// scan over its baseline, so that CI can tell bloat from a broken run.
+const exitBaselineViolation = 5
+
+// classifyError maps an error from the walk to its class. Errors are
+// unwrapped, so *fs.PathError and friends classify by their errno.
+func classifyError(err error) errorClass {
+	var timeout interface{ Timeout() bool }
+	switch {
+	case errors.Is(err, fs.ErrPermission):
+		return classPermission
+	case errors.Is(err, fs.ErrNotExist):
+		return classNotFound
+	case errors.Is(err, os.ErrDeadlineExceeded), errors.Is(err, syscall.ETIMEDOUT),
+		errors.As(err, &timeout) && timeout.Timeout():
+		return classTimeout
+	case errors.Is(err, syscall.EIO):
+		return classIO
+	}
+	return classOther
+}
+
+// parseErrorClasses parses a -fatal-errors value such as "io,timeout".
+func parseErrorClasses(s string) (map[errorClass]bool, error) {
+	classes := make(map[errorClass]bool)
+	for _, part := range strings.Split(s, ",") {
+		c := errorClass(strings.ToLower(strings.TrimSpace(part)))
+		valid := false
+		for _, known := range errorClasses {
+			valid = valid || c == known
+		}
+		if !valid {
+			return nil, fmt.Errorf("unknown error class %q (want one of permission, io, notfound, timeout, other)", part)
+		}
+		classes[c] = true
+	}
+	return classes, nil
+}
+
+// fatalClasses are the error classes that abort the scan (-fatal-errors).
+// It is nil when every error is only reported and skipped.
+var fatalClasses map[errorClass]bool
+
+// fatalError is returned by run when a scan was aborted by -fatal-errors.
+// It carries the first offending error.
+type fatalError struct {
+	Class errorClass
+	Path  string
+	Err   error
+}
+
+func (e *fatalError) Error() string {
+	return fmt.Sprintf("error: scan aborted on %s error at %s: %v", e.Class, displayPath(e.Path), e.Err)
+}
+
+func (e *fatalError) Unwrap() error { return e.Err }
+
+// exitCode returns the process exit status for an error from run.
+func exitCode(err error) int {
+	var fe *fatalError
+	if errors.As(err, &fe) {
+		return exitFatalError
+	}
+	var re *rootExcludedError
+	if errors.As(err, &re) {
+		return exitRootExcluded
+	}
+	var be *baselineError
+	if errors.As(err, &be) {
+		return exitBaselineViolation
+	}
+	var ie *interruptedError
+	if errors.As(err, &ie) {
+		return ie.exitStatus()
+	}
+	return 1
+}
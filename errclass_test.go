@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want errorClass
+	}{
+		{&os.PathError{Op: "open", Path: "/x", Err: syscall.EACCES}, classPermission},
+		{&os.PathError{Op: "open", Path: "/x", Err: syscall.EPERM}, classPermission},
+		{&os.PathError{Op: "lstat", Path: "/x", Err: syscall.ENOENT}, classNotFound},
+		{&os.PathError{Op: "readdirent", Path: "/x", Err: syscall.EIO}, classIO},
+		{&os.PathError{Op: "open", Path: "/x", Err: syscall.ETIMEDOUT}, classTimeout},
+		{os.ErrDeadlineExceeded, classTimeout},
+		{fmt.Errorf("listing: %w", fs.ErrPermission), classPermission},
+		{&os.PathError{Op: "open", Path: "/x", Err: syscall.ENAMETOOLONG}, classOther},
+		{errors.New("something else"), classOther},
+	}
+	for _, tt := range tests {
+		if got := classifyError(tt.err); got != tt.want {
+			t.Errorf("classifyError(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrorClasses(t *testing.T) {
+	got, err := parseErrorClasses("io, Timeout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || !got[classIO] || !got[classTimeout] {
+		t.Errorf("got %v, want io and timeout", got)
+	}
+	if _, err := parseErrorClasses("io,disk"); err == nil || !strings.Contains(err.Error(), `"disk"`) {
+		t.Errorf("error = %v, want it to name the unknown class", err)
+	}
+}
+
+func TestFatalErrorsAbortScan(t *testing.T) {
+	noRetrySleep(t)
+	tmpDir := createTestDir(t, map[string]string{
+		"locked/f":        "x",
+		"dying/f":         "x",
+		"fine/f":          strings.Repeat("x", 100),
+		"fine/deeper/f":   "x",
+		"another/more/ff": "x",
+	})
+	defer os.RemoveAll(tmpDir)
+
+	oldReadDir := readDir
+	defer func() { readDir = oldReadDir }()
+	inject := func(dirs map[string]syscall.Errno) {
+		readDir = func(name string) ([]fs.DirEntry, error) {
+			if errno, ok := dirs[filepath.Base(name)]; ok {
+				return nil, &os.PathError{Op: "open", Path: name, Err: errno}
+			}
+			return oldReadDir(name)
+		}
+	}
+
+	// Permission errors alone are reported and skipped as usual.
+	inject(map[string]syscall.Errno{"locked": syscall.EACCES})
+	resetResults()
+	out, err := runCaptured(t, "-fatal-errors=io", tmpDir, "1B")
+	if err != nil {
+		t.Fatalf("permission error aborted the scan: %v", err)
+	}
+	if !strings.Contains(out, "Error reading directory") {
+		t.Errorf("permission error was not reported:\n%s", out)
+	}
+
+	inject(map[string]syscall.Errno{"locked": syscall.EACCES, "dying": syscall.EIO})
+	resetResults()
+	out, err = runCaptured(t, "-fatal-errors=io", tmpDir, "1B")
+	var fe *fatalError
+	if !errors.As(err, &fe) {
+		t.Fatalf("err = %v, want a fatalError\n%s", err, out)
+	}
+	if fe.Class != classIO || fe.Path != filepath.Join(tmpDir, "dying") {
+		t.Errorf("fatal error = %s at %s, want io at %s", fe.Class, fe.Path, filepath.Join(tmpDir, "dying"))
+	}
+	if !errors.Is(err, syscall.EIO) {
+		t.Errorf("fatal error %v does not wrap EIO", err)
+	}
+	if got := exitCode(err); got != exitFatalError {
+		t.Errorf("exit code = %d, want %d", got, exitFatalError)
+	}
+	if strings.Contains(out, "[FILE]") || strings.Contains(out, "[DIR]") {
+		t.Errorf("aborted scan still printed results:\n%s", out)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	if got := exitCode(errors.New("usage")); got != 1 {
+		t.Errorf("exit code for an ordinary error = %d, want 1", got)
+	}
+	wrapped := fmt.Errorf("run: %w", &fatalError{Class: classIO, Path: "/x", Err: syscall.EIO})
+	if got := exitCode(wrapped); got != exitFatalError {
+		t.Errorf("exit code for a wrapped fatal error = %d, want %d", got, exitFatalError)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// excludeAnchored is set when the exclude set holds anchored entries,
+// so that the walk looks up full paths as well as names. Anchored
+// entries are keyed by absolute path, which no entry name can equal.
+var excludeAnchored bool
+
+// excludeWorkDir is the working directory a relative walk path is
+// joined to before it is looked up as an anchored entry.
+var excludeWorkDir string
+
+// excludePatterns are the anchored entries given with wildcards, as
+// absolute paths. They are also in the exclude set, which counts and
+// reports them like any other entry.
+var excludePatterns []string
+
+// isAnchoredExclude reports whether an -exclude entry is a path rather
+// than a name. A name matches entries of that name anywhere below the
+// root; a path matches the one entry it names.
+func isAnchoredExclude(s string) bool {
+	return strings.ContainsAny(s, "/"+string(filepath.Separator))
+}
+
+// fromWorkingDir reports whether an anchored exclude names a path from
+// the working directory: an absolute path, or one starting with ./ or
+// ../ as a shell completes it. Other relative paths are taken from the
+// scan root, so that -exclude=var/tmp means the same in every scan of /.
+func fromWorkingDir(s string) bool {
+	if filepath.IsAbs(s) || filepath.VolumeName(s) != "" {
+		return true
+	}
+	first, _, _ := strings.Cut(filepath.ToSlash(s), "/")
+	return first == "." || first == ".."
+}
+
+// hasWildcard reports whether an anchored exclude is a pattern.
+func hasWildcard(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// anchorExclude returns the anchored exclude p as an absolute path, the
+// form anchoredPath gives walk paths, so that the two compare equal.
+// Paths are taken from the working directory or the root, as
+// fromWorkingDir decides. ok is false when p is not root or below it.
+func anchorExclude(root, p string) (string, bool) {
+	if !fromWorkingDir(p) {
+		p = filepath.Join(root, p)
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", false
+	}
+	absP, err := filepath.Abs(p)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(absRoot, absP)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.Join(absRoot, rel), true
+}
+
+// anchoredPath returns a walk path as anchored entries are keyed. A
+// relative root such as . makes relative walk paths, which would
+// otherwise compare equal to bare entry names.
+func anchoredPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	if filepath.VolumeName(path) == "" && strings.HasPrefix(path, string(filepath.Separator)) {
+		// Rooted but without a drive, on Windows.
+		return filepath.VolumeName(excludeWorkDir) + path
+	}
+	return filepath.Join(excludeWorkDir, path)
+}
+
+// ownOutputs holds the files this run writes, by absolute directory and
+// base name. The walk leaves them and their atomicFile temporaries out,
+// so that a report written below the root is not counted in its own
+// scan. It is nil when the run writes no files.
+var ownOutputs map[string][]string
+
+// noteOwnOutput adds path to ownOutputs.
+func noteOwnOutput(path string) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return
+	}
+	if ownOutputs == nil {
+		ownOutputs = make(map[string][]string)
+	}
+	dir := filepath.Dir(abs)
+	ownOutputs[dir] = append(ownOutputs[dir], filepath.Base(abs))
+}
+
+// isOwnOutput reports whether name, an entry of a directory holding the
+// outputs listed in bases, is one of them or the temporary createAtomic
+// makes for one.
+func isOwnOutput(bases []string, name string) bool {
+	for _, base := range bases {
+		if name == base || strings.HasPrefix(name, "."+base+".tmp") {
+			return true
+		}
+	}
+	return false
+}
+
+// rootExcludedError is returned by run when an anchored -exclude names
+// the scan root itself and -force is not given.
+type rootExcludedError struct {
+	Path string
+}
+
+func (e *rootExcludedError) Error() string {
+	return fmt.Sprintf("Top-level directory '%s' is in the exclude list. Nothing to do (use -force to scan it anyway).", displayPath(e.Path))
+}
+
+// excludeHits counts, per exclude name, how many entries it matched during
+// the walk. It is nil unless -exclude-stats is set.
+var excludeHits map[string]*atomic.Int64
+
+// isExcluded reports whether an entry name, or for anchored entries its
+// path, is in the exclude set, counting the match. The walk calls it before doing anything else with an entry, so
+// an excluded entry costs one map lookup: it is never stat'ed, read or
+// given a goroutine.
+func isExcluded(excludeSet map[string]struct{}, name string) bool {
+	if _, ok := excludeSet[name]; !ok {
+		return false
+	}
+	if c := excludeHits[name]; c != nil {
+		c.Add(1)
+	}
+	return true
+}
+
+// matchesExcludePattern reports whether path matches one of the wildcard
+// entries, counting the match. Like a name, a wildcard such as * matches
+// within one path component.
+func matchesExcludePattern(path string) bool {
+	for _, p := range excludePatterns {
+		if ok, _ := filepath.Match(p, path); ok {
+			if c := excludeHits[p]; c != nil {
+				c.Add(1)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// newExcludeHits returns zeroed match counters for every exclude name.
+func newExcludeHits(excludeSet map[string]struct{}) map[string]*atomic.Int64 {
+	hits := make(map[string]*atomic.Int64, len(excludeSet))
+	for name := range excludeSet {
+		hits[name] = new(atomic.Int64)
+	}
+	return hits
+}
+
+// printExcludeStats lists, in the order given on the command line, how
+// many entries each exclude name matched, calling out unused ones.
+func printExcludeStats(names []string) {
+	fmt.Fprintln(stdout, "\nExclude patterns:")
+	unused := 0
+	for _, name := range names {
+		n := excludeHits[name].Load()
+		if n == 0 {
+			unused++
+			fmt.Fprintf(stdout, "  %-20s unused\n", name)
+			continue
+		}
+		fmt.Fprintf(stdout, "  %-20s %d matched\n", name, n)
+	}
+	if unused > 0 {
+		fmt.Fprintf(stdout, "%d of %d exclude patterns matched nothing.\n", unused, len(names))
+	}
+}
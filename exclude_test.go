@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestExcludedEntriesAreNeverScheduled(t *testing.T) {
+	resetResults()
+	tmpDir := createTestDir(t, map[string]string{
+		"a/node_modules/x/y.js":  "yyy",
+		"b/node_modules/z.js":    "zz",
+		"b/keep.txt":             "k",
+		"c/.cache/blob":          "bbbb",
+		"c/core":                 "cc", // a file matching an exclude name
+		"c/nested/more/deep.txt": "d",
+	})
+	defer os.RemoveAll(tmpDir)
+
+	var mu sync.Mutex
+	var touched []string
+	oldRead, oldInfo := readDir, entryInfo
+	defer func() { readDir, entryInfo = oldRead, oldInfo }()
+	readDir = func(p string) ([]fs.DirEntry, error) {
+		mu.Lock()
+		touched = append(touched, p)
+		mu.Unlock()
+		return oldRead(p)
+	}
+	entryInfo = func(e fs.DirEntry) (fs.FileInfo, error) {
+		mu.Lock()
+		touched = append(touched, e.Name())
+		mu.Unlock()
+		return e.Info()
+	}
+
+	excludeSet := map[string]struct{}{"node_modules": {}, ".cache": {}, "core": {}, "stale": {}}
+	excludeHits = newExcludeHits(excludeSet)
+	defer func() { excludeHits = nil }()
+	total := walkDirRecursive(tmpDir, 1, excludeSet)
+
+	for _, p := range touched {
+		for name := range excludeSet {
+			if strings.Contains(p, name) {
+				t.Errorf("excluded entry %s was read or stat'ed", p)
+			}
+		}
+	}
+	if total != 2 {
+		t.Errorf("total = %d, want 2 (keep.txt and deep.txt)", total)
+	}
+
+	want := map[string]int64{"node_modules": 2, ".cache": 1, "core": 1, "stale": 0}
+	for name, n := range want {
+		if got := excludeHits[name].Load(); got != n {
+			t.Errorf("%s matched %d entries, want %d", name, got, n)
+		}
+	}
+}
+
+func TestExcludeStatsReport(t *testing.T) {
+	resetResults()
+	tmpDir := createTestDir(t, map[string]string{
+		"node_modules/a.js": "aaaa",
+		"src/main.go":       "package main",
+	})
+	defer os.RemoveAll(tmpDir)
+
+	out, err := runCaptured(t, "-no-hints", "-exclude-stats", "-exclude=node_modules,bower_components", tmpDir, "1")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	for _, want := range []string{
+		"  node_modules         1 matched\n",
+		"  bower_components     unused\n",
+		"1 of 2 exclude patterns matched nothing.",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, filepath.Join(tmpDir, "node_modules")) {
+		t.Errorf("excluded directory listed:\n%s", out)
+	}
+}
+
+func TestExcludedRootExitCodeAndForce(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"dev/big.bin": strings.Repeat("x", 2048),
+	})
+	defer os.RemoveAll(tmpDir)
+	dev := filepath.Join(tmpDir, "dev")
+
+	resetResults()
+	out, err := runCaptured(t, "-exclude="+dev, dev, "1K")
+	if exitCode(err) != exitRootExcluded || !strings.Contains(fmt.Sprint(err), "exclude list") {
+		t.Fatalf("run = %v (exit %d), want the root-excluded error with exit %d", err, exitCode(err), exitRootExcluded)
+	}
+	if strings.Contains(out, "Nothing to do") {
+		t.Errorf("notice printed to the output as well as returned:\n%s", out)
+	}
+
+	resetResults()
+	out, err = runCaptured(t, "-force", "-exclude="+dev, dev, "1K")
+	if err != nil {
+		t.Fatalf("run -force: %v", err)
+	}
+	if !strings.Contains(out, "because of -force") || !strings.Contains(out, filepath.Join(dev, "big.bin")) {
+		t.Errorf("-force did not warn and scan:\n%s", out)
+	}
+
+	// A plain name matching the root's basename no longer stops the scan.
+	resetResults()
+	out, err = runCaptured(t, "-exclude=dev", dev, "1K")
+	if err != nil || !strings.Contains(out, filepath.Join(dev, "big.bin")) {
+		t.Errorf("run -exclude=dev = %v:\n%s", err, out)
+	}
+}
+
+func TestAnchoredExcludeMatchesOnePath(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"a/cache/x.bin": strings.Repeat("x", 2048),
+		"b/cache/y.bin": strings.Repeat("y", 2048),
+	})
+	defer os.RemoveAll(tmpDir)
+
+	resetResults()
+	out, err := runCaptured(t, "-no-hints", "-exclude="+filepath.Join(tmpDir, "a", "cache"), tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if strings.Contains(out, "x.bin") || !strings.Contains(out, "y.bin") {
+		t.Errorf("anchored exclude matched the wrong entries:\n%s", out)
+	}
+
+	resetResults()
+	out, err = runCaptured(t, "-no-hints", "-exclude=/elsewhere/cache", tmpDir, "1K")
+	if err != nil || !strings.Contains(out, "matches nothing") || !strings.Contains(out, "x.bin") {
+		t.Errorf("run with an exclude outside the root = %v:\n%s", err, out)
+	}
+}
+
+func TestRootRelativeExcludes(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"tmp/top.bin":                    strings.Repeat("x", 2048),
+		"a/tmp/nested.bin":               strings.Repeat("x", 2048),
+		"var/tmp/t.bin":                  strings.Repeat("x", 2048),
+		"b/var/tmp/u.bin":                strings.Repeat("x", 2048),
+		"home/alice/Downloads/d1.bin":    strings.Repeat("x", 2048),
+		"home/bob/Downloads/d2.bin":      strings.Repeat("x", 2048),
+		"home/alice/docs/Downloads/keep": strings.Repeat("x", 2048),
+		"x/cache/c.bin":                  strings.Repeat("x", 2048),
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+
+	// An anchored entry is taken from the root: tmp/ is the root's tmp,
+	// not every directory named tmp.
+	resetResults()
+	out, err := runCaptured(t, "-no-hints", "-exclude=tmp/", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	if strings.Contains(out, "top.bin") || !strings.Contains(out, "nested.bin") {
+		t.Errorf("-exclude=tmp/ matched the wrong entries:\n%s", out)
+	}
+
+	// Names, root-relative paths and wildcards mix in one value.
+	resetResults()
+	out, err = runCaptured(t, "-no-hints", "-exclude=cache,var/tmp,home/*/Downloads", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	for _, gone := range []string{"c.bin", "t.bin", "d1.bin", "d2.bin"} {
+		if strings.Contains(out, gone) {
+			t.Errorf("%s listed:\n%s", gone, out)
+		}
+	}
+	for _, kept := range []string{"u.bin", "top.bin", filepath.Join("docs", "Downloads", "keep")} {
+		if !strings.Contains(out, kept) {
+			t.Errorf("%s not listed:\n%s", kept, out)
+		}
+	}
+
+	if _, err := runCaptured(t, "-exclude=home/[a", tmpDir, "1K"); err == nil || !strings.Contains(err.Error(), "malformed pattern") {
+		t.Errorf("malformed pattern: err = %v", err)
+	}
+
+	// From a relative root the walk builds relative paths; the root's
+	// tmp must still not exclude a/tmp by name.
+	wd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	for _, arg := range []string{"-exclude=tmp/", "-exclude=./tmp"} {
+		resetResults()
+		out, err = runCaptured(t, "-no-hints", arg, ".", "1K")
+		if err != nil {
+			t.Fatalf("run %s: %v\n%s", arg, err, out)
+		}
+		if strings.Contains(out, "top.bin") || !strings.Contains(out, "nested.bin") {
+			t.Errorf("%s on . matched the wrong entries:\n%s", arg, out)
+		}
+	}
+}
+
+func TestOwnOutputsNotScanned(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"data.bin":             strings.Repeat("d", 2048),
+		"out/report.json":      strings.Repeat("r", 4096),
+		"out/.report.json.tmp": strings.Repeat("t", 4096),
+		"history.jsonl":        strings.Repeat("h", 4096),
+		"out/keep.json":        strings.Repeat("k", 1024),
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+
+	resetResults()
+	report := filepath.Join(tmpDir, "out", "report.json")
+	out, err := runCaptured(t, "-format=json", "-o", report, "-history="+filepath.Join(tmpDir, "history.jsonl"), tmpDir, "1B")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rep jsonReport
+	if err := json.Unmarshal(data, &rep); err != nil {
+		t.Fatalf("report is not a JSON document: %v\n%s", err, data)
+	}
+	if rep.Total != 2048+1024 {
+		t.Errorf("total = %d, want %d: the run counted its own outputs", rep.Total, 2048+1024)
+	}
+	for _, e := range rep.Entries {
+		if name := filepath.Base(e.Path); name == "report.json" || name == "history.jsonl" || strings.HasPrefix(name, ".report.json.tmp") {
+			t.Errorf("own output %s listed", e.Path)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import "sync"
+
+// fdHeadroom is the number of descriptors left free for stdio, output files
+// and the Go runtime when the budget is derived from the process limit.
+const fdHeadroom = 64
+
+// fdBudget bounds the number of file descriptors held open at once. Every
+// open in the walk goes through acquire/release so that wide trees cannot
+// exhaust the process limit.
+type fdBudget struct {
+	sem chan struct{}
+
+	mu   sync.Mutex
+	open int
+	peak int
+}
+
+// newFDBudget returns a budget allowing at most n concurrently open files.
+func newFDBudget(n int) *fdBudget {
+	if n < 1 {
+		n = 1
+	}
+	return &fdBudget{sem: make(chan struct{}, n)}
+}
+
+// acquire blocks until a descriptor is available. Every caller holds one
+// descriptor at a time: taking several one by one could deadlock callers
+// that each hold part of what they need.
+func (b *fdBudget) acquire() {
+	b.sem <- struct{}{}
+	b.mu.Lock()
+	b.open++
+	if b.open > b.peak {
+		b.peak = b.open
+	}
+	b.mu.Unlock()
+}
+
+// release returns a descriptor to the budget.
+func (b *fdBudget) release() {
+	b.mu.Lock()
+	b.open--
+	b.mu.Unlock()
+	<-b.sem
+}
+
+// limit returns the size of the budget.
+func (b *fdBudget) limit() int {
+	return cap(b.sem)
+}
+
+// peakOpen returns the highest number of descriptors held at once.
+func (b *fdBudget) peakOpen() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.peak
+}
+
+// inUse returns the number of descriptors currently held.
+func (b *fdBudget) inUse() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open
+}
+
+// openFiles is the process-wide descriptor budget used by the walk.
+var openFiles = newFDBudget(defaultMaxOpenFiles())
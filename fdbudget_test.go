@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestFDBudgetBoundsConcurrency(t *testing.T) {
+	b := newFDBudget(3)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.acquire()
+			b.release()
+		}()
+	}
+	wg.Wait()
+	if peak := b.peakOpen(); peak > 3 || peak < 1 {
+		t.Errorf("peak open = %d, want between 1 and 3", peak)
+	}
+}
+
+func TestWalkWithTinyFDBudget(t *testing.T) {
+	resetResults()
+	files := make(map[string]string)
+	for i := 0; i < 20; i++ {
+		for j := 0; j < 5; j++ {
+			files[fmt.Sprintf("d%02d/s%d/f.txt", i, j)] = "abcd" // 4 bytes
+		}
+	}
+	tmpDir := createTestDir(t, files)
+	defer os.RemoveAll(tmpDir)
+
+	oldBudget := openFiles
+	openFiles = newFDBudget(2)
+	defer func() { openFiles = oldBudget }()
+
+	total := walkDirRecursive(tmpDir, 1, map[string]struct{}{})
+
+	if total != 20*5*4 {
+		t.Errorf("total = %d, want %d", total, 20*5*4)
+	}
+	// 100 files, 100 leaf directories and 20 intermediate directories.
+	if len(results) != 220 {
+		t.Errorf("got %d results, want 220", len(results))
+	}
+	if peak := openFiles.peakOpen(); peak > 2 {
+		t.Errorf("peak concurrent opens = %d, exceeds budget of 2", peak)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+// defaultMaxOpenFiles returns a conservative descriptor budget on platforms
+// without RLIMIT_NOFILE.
+func defaultMaxOpenFiles() int {
+	return 512
+}
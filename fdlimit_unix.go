@@ -0,0 +1,27 @@
+//go:build unix
+
+package main
+
+import "syscall"
+
+// maxDerivedOpenFiles caps the derived budget when the soft limit is
+// unlimited or very large; beyond this, more concurrency does not help.
+const maxDerivedOpenFiles = 4096
+
+// defaultMaxOpenFiles derives the descriptor budget from RLIMIT_NOFILE,
+// leaving fdHeadroom descriptors for everything else.
+func defaultMaxOpenFiles() int {
+	var rl syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rl); err != nil {
+		return 256
+	}
+	cur := uint64(rl.Cur)
+	if cur > maxDerivedOpenFiles {
+		cur = maxDerivedOpenFiles
+	}
+	if cur <= 2*fdHeadroom {
+		// Tiny limits: keep at least half for the walk.
+		return int(cur/2) + 1
+	}
+	return int(cur) - fdHeadroom
+}
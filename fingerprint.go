@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// scanOptions are the options that decide what a scan's numbers mean, in
+// a normal form: lists are sorted and deduplicated, defaults are spelled
+// out and anchored excludes are relative to the root, so invocations that
+// mean the same thing record equal options. History records and baselines
+// carry them, and trend and check refuse to compare scans whose metric
+// options differ. The root is not among them: history records keep it
+// beside, and baselines are relative to it.
+type scanOptions struct {
+	// Metric options change what a size measures.
+	LogicalSize     bool `json:"logical_size"`
+	FollowJunctions bool `json:"follow_junctions"`
+
+	// Filter options change which entries are counted or listed.
+	Exclude      []string `json:"exclude"`
+	FSDeny       []string `json:"fs_deny"`
+	FSAllow      []string `json:"fs_allow"`
+	IncludeTmpfs bool     `json:"include_tmpfs"`
+	Threshold    uint64   `json:"threshold"`
+	MinFiles     int64    `json:"min_files"`
+	MaxFiles     int64    `json:"max_files"`
+	ExcludeEmpty bool     `json:"exclude_empty"`
+	AllOlderThan string   `json:"all_older_than"`
+	MinUnique    uint64   `json:"min_unique"`
+}
+
+// normalizeOptions returns opts in normal form for a scan of root. The
+// -exclude entries are the walk's, with anchored ones turned into "./"
+// paths below root; -fs-deny includes the default types unless
+// -include-fuse dropped them.
+func normalizeOptions(root string, opts scanOptions) scanOptions {
+	var exclude []string
+	for _, e := range opts.Exclude {
+		if isAnchoredExclude(e) {
+			e = "./" + canonicalPath(root, e)
+		}
+		exclude = append(exclude, e)
+	}
+	opts.Exclude = sortedSet(exclude)
+	opts.FSDeny = sortedSet(opts.FSDeny)
+	opts.FSAllow = sortedSet(opts.FSAllow)
+	if opts.MinFiles < 0 {
+		opts.MinFiles = -1
+	}
+	if opts.MaxFiles < 0 {
+		opts.MaxFiles = -1
+	}
+	return opts
+}
+
+// olderThanOption is the normal form of an -all-older-than age.
+func olderThanOption(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// sortedSet returns the distinct strings of list in order, never nil so
+// that an empty list and a missing one fingerprint alike.
+func sortedSet(list []string) []string {
+	set := slices.Clone(list)
+	slices.Sort(set)
+	return append([]string{}, slices.Compact(set)...)
+}
+
+// fingerprint is a short hash of the options, equal for equal options.
+func (o scanOptions) fingerprint() string {
+	data, _ := json.Marshal(o)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// compareOptions lists how cur differs from old, in flag terms such as
+// "-exclude: +node_modules". metric differences make the sizes of the two
+// scans incomparable; filter differences only change what was counted.
+func compareOptions(old, cur scanOptions) (metric, filter []string) {
+	flagDiff := func(list *[]string, name string, a, b any) {
+		if fmt.Sprint(a) != fmt.Sprint(b) {
+			*list = append(*list, fmt.Sprintf("-%s: %v -> %v", name, a, b))
+		}
+	}
+	setDiff := func(name string, a, b []string) {
+		var delta []string
+		for _, s := range b {
+			if !slices.Contains(a, s) {
+				delta = append(delta, "+"+s)
+			}
+		}
+		for _, s := range a {
+			if !slices.Contains(b, s) {
+				delta = append(delta, "-"+s)
+			}
+		}
+		if len(delta) > 0 {
+			filter = append(filter, fmt.Sprintf("-%s: %s", name, strings.Join(delta, " ")))
+		}
+	}
+	flagDiff(&metric, "logical-size", old.LogicalSize, cur.LogicalSize)
+	flagDiff(&metric, "follow-junctions", old.FollowJunctions, cur.FollowJunctions)
+	setDiff("exclude", old.Exclude, cur.Exclude)
+	setDiff("fs-deny", old.FSDeny, cur.FSDeny)
+	setDiff("fs-allow", old.FSAllow, cur.FSAllow)
+	flagDiff(&filter, "include-tmpfs", old.IncludeTmpfs, cur.IncludeTmpfs)
+	if old.Threshold != cur.Threshold {
+		filter = append(filter, fmt.Sprintf("min_size: %s -> %s", humanReadableSize(old.Threshold), humanReadableSize(cur.Threshold)))
+	}
+	flagDiff(&filter, "min-files", old.MinFiles, cur.MinFiles)
+	flagDiff(&filter, "max-files", old.MaxFiles, cur.MaxFiles)
+	flagDiff(&filter, "exclude-empty", old.ExcludeEmpty, cur.ExcludeEmpty)
+	flagDiff(&filter, "all-older-than", optionOrNone(old.AllOlderThan), optionOrNone(cur.AllOlderThan))
+	if old.MinUnique != cur.MinUnique {
+		filter = append(filter, fmt.Sprintf("-min-unique: %s -> %s", humanReadableSize(old.MinUnique), humanReadableSize(cur.MinUnique)))
+	}
+	return metric, filter
+}
+
+func optionOrNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+// incompatibleOptionsError is returned when two scans were measured in
+// different ways and -force-diff was not given.
+type incompatibleOptionsError struct {
+	What        string // what the scan is compared against
+	Differences []string
+}
+
+func (e *incompatibleOptionsError) Error() string {
+	return fmt.Sprintf("error: %s measured sizes differently (%s); use -force-diff to compare anyway",
+		e.What, strings.Join(e.Differences, ", "))
+}
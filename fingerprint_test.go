@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeOptionsReordered(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "data")
+	a := normalizeOptions(root, scanOptions{
+		Exclude:  []string{"node_modules", ".git", filepath.Join(root, "cache"), ".git"},
+		FSDeny:   []string{"9p", "fuse", "fuse.*", "nfs4"},
+		MinFiles: -1, MaxFiles: -1,
+	})
+	b := normalizeOptions(root, scanOptions{
+		Exclude:  []string{filepath.Join(root, "cache"), ".git", "node_modules"},
+		FSDeny:   []string{"nfs4", "fuse", "fuse.*", "9p", "nfs4"},
+		FSAllow:  []string{},
+		MinFiles: -1, MaxFiles: -1,
+	})
+	if a.fingerprint() != b.fingerprint() {
+		t.Errorf("reordered options fingerprint differently:\n%+v\n%+v", a, b)
+	}
+	if metric, filter := compareOptions(a, b); len(metric)+len(filter) > 0 {
+		t.Errorf("reordered options differ: %v %v", metric, filter)
+	}
+	if want := "./cache"; !strings.Contains(strings.Join(a.Exclude, ","), want) {
+		t.Errorf("anchored exclude not relative to the root: %v", a.Exclude)
+	}
+}
+
+func TestCompareOptions(t *testing.T) {
+	old := normalizeOptions("/r", scanOptions{Exclude: []string{"dev", "proc", "sys"}, Threshold: 1024})
+	cur := old
+	cur.LogicalSize = true
+	if metric, _ := compareOptions(old, cur); len(metric) != 1 || metric[0] != "-logical-size: false -> true" {
+		t.Errorf("metric differences = %v", metric)
+	}
+
+	cur = normalizeOptions("/r", scanOptions{Exclude: []string{"node_modules", "proc", "sys"}, Threshold: 1024})
+	metric, filter := compareOptions(old, cur)
+	if len(metric) != 0 || len(filter) != 1 || filter[0] != "-exclude: +node_modules -dev" {
+		t.Errorf("differences = %v %v, want just the exclude delta", metric, filter)
+	}
+}
+
+func TestCheckRefusesOtherMetric(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"big":          strings.Repeat("x", 3000),
+		"vendor/large": strings.Repeat("x", 3000),
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+	base := filepath.Join(t.TempDir(), "baseline.json")
+
+	resetResults()
+	if out, err := runCaptured(t, "check", "-baseline", base, "-update-baseline", tmpDir, "1K"); err != nil {
+		t.Fatalf("update-baseline: %v\n%s", err, out)
+	}
+	b, err := readBaseline(base)
+	if err != nil || b.Options == nil || b.Fingerprint == "" {
+		t.Fatalf("baseline without options: %+v, %v", b, err)
+	}
+
+	// The same options, spelled another way, are the same scan.
+	resetResults()
+	out, err := runCaptured(t, "check", "-baseline", base, "-exclude", "sys, proc,dev,proc", tmpDir, "1K")
+	if err != nil || strings.Contains(out, "Warning") {
+		t.Errorf("reordered excludes: %v\n%s", err, out)
+	}
+
+	resetResults()
+	out, err = runCaptured(t, "check", "-baseline", base, "-logical-size", tmpDir, "1K")
+	var ie *incompatibleOptionsError
+	if !errors.As(err, &ie) || !strings.Contains(err.Error(), "-logical-size: false -> true") {
+		t.Errorf("other metric: err = %v, want an incompatibleOptionsError\n%s", err, out)
+	}
+
+	resetResults()
+	out, err = runCaptured(t, "check", "-baseline", base, "-logical-size", "-force-diff", tmpDir, "1K")
+	if err != nil || !strings.Contains(out, "-logical-size: false -> true") {
+		t.Errorf("-force-diff: %v\n%s", err, out)
+	}
+
+	resetResults()
+	out, _ = runCaptured(t, "check", "-baseline", base, "-exclude", "proc,dev,sys,vendor", tmpDir, "1K")
+	if !strings.Contains(out, "Warning: -baseline "+base+" was written with other options: -exclude: +vendor\n") {
+		t.Errorf("other excludes not warned about:\n%s", out)
+	}
+}
+
+func TestTrendMarksOtherOptions(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"a/f": strings.Repeat("x", 3000),
+		"b/f": strings.Repeat("x", 3000),
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+	history := filepath.Join(t.TempDir(), "hogs.history")
+
+	for _, args := range [][]string{{"-exclude", "proc,dev,sys,b"}, {}} {
+		resetResults()
+		if out, err := runCaptured(t, append(append([]string{"-history", history}, args...), tmpDir, "1K")...); err != nil {
+			t.Fatalf("run %v: %v\n%s", args, err, out)
+		}
+	}
+	out, err := runCaptured(t, "trend", "-history", history)
+	if err != nil {
+		t.Fatalf("trend: %v", err)
+	}
+	if !strings.Contains(out, "  *\n") || !strings.Contains(out, "-exclude: +b\n") {
+		t.Errorf("run with other excludes not marked:\n%s", out)
+	}
+
+	resetResults()
+	if out, err := runCaptured(t, "-history", history, "-logical-size", tmpDir, "1K"); err != nil {
+		t.Fatalf("logical-size run: %v\n%s", err, out)
+	}
+	if _, err := runCaptured(t, "trend", "-history", history); err == nil || !strings.Contains(err.Error(), "-force-diff") {
+		t.Errorf("trend over another metric: err = %v", err)
+	}
+	if out, err := runCaptured(t, "trend", "-force-diff", "-history", history); err != nil || strings.Count(out, "  *\n") != 2 {
+		t.Errorf("trend -force-diff: %v\n%s", err, out)
+	}
+}
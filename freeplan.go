@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// freePlan is a batch of listed entries whose deletion would free at
+// least a target amount.
+type freePlan struct {
+	Target  uint64
+	Entries []FileInfo
+	// Bytes is the sum of the entries' unique bytes. Hard links between
+	// two picked entries are not credited, so it errs low.
+	Bytes uint64
+	// InUse counts the listed files left out because a process holds
+	// them open (-check-open).
+	InUse int
+}
+
+// planFree picks a small batch from list that frees at least target
+// bytes, counting each entry's unique bytes so that hard-linked data
+// still reachable elsewhere is not promised. An entry is never picked
+// together with one of its ancestors or descendants, and the scan root
+// is not offered. While no single entry covers what is left, the largest
+// is taken; once one does, the smallest such entry finishes the batch, so
+// the target is met in as few entries as this order allows without
+// overshooting more than needed. If the entries cannot reach target, the
+// plan holds everything that could be picked.
+//
+// A file in use frees nothing: deleting it leaves the space held until
+// the process lets go. Such files are never picked, and a directory
+// holding one is credited without it.
+func planFree(root string, target uint64, list []FileInfo) freePlan {
+	plan := freePlan{Target: target}
+	var inUse []FileInfo
+	for _, res := range list {
+		if len(res.OpenBy) > 0 {
+			inUse = append(inUse, res)
+		}
+	}
+	plan.InUse = len(inUse)
+	cands := make([]FileInfo, 0, len(list))
+	for _, res := range list {
+		if res.Path == root || len(res.OpenBy) > 0 {
+			continue
+		}
+		if res.IsDir {
+			for _, f := range inUse {
+				if pathWithin(f.Path, res.Path) {
+					res.Unique -= min(res.Unique, f.Unique)
+				}
+			}
+		}
+		if res.Unique > 0 {
+			cands = append(cands, res)
+		}
+	}
+	sort.Slice(cands, func(i, j int) bool {
+		if cands[i].Unique != cands[j].Unique {
+			return cands[i].Unique > cands[j].Unique
+		}
+		return cands[i].Path < cands[j].Path
+	})
+	overlaps := func(res FileInfo) bool {
+		for _, p := range plan.Entries {
+			if pathWithin(res.Path, p.Path) || pathWithin(p.Path, res.Path) {
+				return true
+			}
+		}
+		return false
+	}
+	for plan.Bytes < target {
+		need := target - plan.Bytes
+		pick := -1
+		for i, res := range cands {
+			if overlaps(res) {
+				continue
+			}
+			if res.Unique < need {
+				if pick < 0 {
+					pick = i
+				}
+				break
+			}
+			// Sorted largest first: keep looking for a smaller entry that
+			// still covers the rest.
+			pick = i
+		}
+		if pick < 0 {
+			break
+		}
+		plan.Entries = append(plan.Entries, cands[pick])
+		plan.Bytes = addSize(plan.Bytes, cands[pick].Unique)
+		cands = append(cands[:pick], cands[pick+1:]...)
+	}
+	return plan
+}
+
+// printFreePlan lists the batch with the free space it would leave on the
+// filesystem holding root.
+func printFreePlan(root string, plan freePlan) {
+	fmt.Fprintf(stdout, "\nTo free %s:\n", humanReadableSize(plan.Target))
+	if plan.InUse > 0 {
+		fmt.Fprintf(stdout, "  (leaving out %d listed files held open by a process)\n", plan.InUse)
+	}
+	if len(plan.Entries) == 0 {
+		fmt.Fprintln(stdout, "  no listed entry below the root frees anything")
+		return
+	}
+	for _, res := range plan.Entries {
+		fmt.Fprintf(stdout, "  %-10s  %s\n", humanReadableSize(res.Unique), displayPath(res.Path))
+	}
+	these := "this entry"
+	if n := len(plan.Entries); n > 1 {
+		these = fmt.Sprintf("these %d entries", n)
+	}
+	if plan.Bytes < plan.Target {
+		fmt.Fprintf(stdout, "All of %s free only %s; lower the threshold to consider more entries.\n", these, humanReadableSize(plan.Bytes))
+	} else {
+		fmt.Fprintf(stdout, "Deleting %s frees at least %s.\n", these, humanReadableSize(plan.Bytes))
+	}
+	if avail, err := availableSpace(root); err == nil {
+		fmt.Fprintf(stdout, "Free space on %s: %s now, about %s after.\n",
+			displayPath(root), humanReadableSize(avail), humanReadableSize(addSize(avail, plan.Bytes)))
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// planPaths returns the paths of a plan's entries.
+func planPaths(plan freePlan) string {
+	var paths []string
+	for _, res := range plan.Entries {
+		paths = append(paths, res.Path)
+	}
+	return strings.Join(paths, " ")
+}
+
+func TestPlanFree(t *testing.T) {
+	list := []FileInfo{
+		{Path: "/r", Size: 1000, Unique: 1000, IsDir: true},
+		{Path: "/r/a", Size: 600, Unique: 600, IsDir: true},
+		{Path: "/r/a/big", Size: 500, Unique: 500},
+		// Mostly hard links to data kept elsewhere.
+		{Path: "/r/links", Size: 900, Unique: 50, IsDir: true},
+		{Path: "/r/b", Size: 300, Unique: 300},
+		{Path: "/r/c", Size: 120, Unique: 120},
+		{Path: "/r/ab", Size: 100, Unique: 100},
+	}
+	for _, tc := range []struct {
+		target uint64
+		want   string
+		bytes  uint64
+	}{
+		// One entry covers it: the smallest that does, not the largest.
+		{250, "/r/b", 300},
+		// /r/a/big is inside /r/a and never joins it; /r/ab is not inside
+		// /r/a despite the shared prefix.
+		{800, "/r/a /r/b", 900},
+		{1000, "/r/a /r/b /r/ab", 1000},
+		// Everything that can be picked, past which nothing is left.
+		{5000, "/r/a /r/b /r/c /r/ab /r/links", 1170},
+	} {
+		plan := planFree("/r", tc.target, list)
+		if got := planPaths(plan); got != tc.want || plan.Bytes != tc.bytes {
+			t.Errorf("planFree(%d) = %q freeing %d, want %q freeing %d", tc.target, got, plan.Bytes, tc.want, tc.bytes)
+		}
+	}
+}
+
+func TestPlanFreeSkipsFilesInUse(t *testing.T) {
+	wal := []fileUser{{PID: 1234, Name: "postgres"}}
+	list := []FileInfo{
+		{Path: "/r", Size: 1000, Unique: 1000, IsDir: true},
+		{Path: "/r/db", Size: 900, Unique: 900, IsDir: true},
+		{Path: "/r/db/wal", Size: 800, Unique: 800, OpenBy: wal},
+		{Path: "/r/old", Size: 100, Unique: 100},
+	}
+	plan := planFree("/r", 500, list)
+	// The WAL is never offered, and /r/db frees only its other 100 bytes.
+	if got := planPaths(plan); got != "/r/db /r/old" || plan.Bytes != 200 || plan.InUse != 1 {
+		t.Errorf("planFree(500) = %q freeing %d with %d in use, want \"/r/db /r/old\" freeing 200 with 1", got, plan.Bytes, plan.InUse)
+	}
+	if plan.Entries[0].Unique != 100 {
+		t.Errorf("/r/db credited %d bytes, want 100", plan.Entries[0].Unique)
+	}
+}
+
+func TestRunFree(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"old/a": strings.Repeat("a", 3000),
+		"old/b": strings.Repeat("b", 3000),
+		"keep":  strings.Repeat("k", 2000),
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+
+	resetResults()
+	out, err := runCaptured(t, "-no-hints", "-free=5K", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	want := "\nTo free 5.00 KiB:\n  5.86 KiB    " + filepath.Join(tmpDir, "old") + "\nDeleting this entry frees at least 5.86 KiB.\n"
+	if !strings.Contains(out, want) {
+		t.Errorf("output lacks %q:\n%s", want, out)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// defaultDenyFSTypes are the filesystem types not descended into unless
+// -include-fuse is given: FUSE mounts (gvfs, rclone, s3fs, the document
+// portal under /run/user) and 9p shares, which are slow over a network or
+// synthesize entries without end.
+const defaultDenyFSTypes = "fuse,fuse.*,9p"
+
+// fsPolicy decides which mounted filesystem types the walk enters. Types
+// are matched as path.Match patterns; allow overrides deny.
+type fsPolicy struct {
+	deny, allow []string
+}
+
+// parseFSTypes splits a comma-separated list of filesystem type patterns.
+func parseFSTypes(s string) ([]string, error) {
+	var types []string
+	for _, t := range strings.Split(s, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if _, err := path.Match(t, ""); err != nil {
+			return nil, fmt.Errorf("bad filesystem type pattern %q", t)
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
+
+// matchFSType reports whether fstype matches any of the patterns.
+func matchFSType(patterns []string, fstype string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, fstype); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// denies reports whether mounts of fstype are skipped.
+func (p fsPolicy) denies(fstype string) bool {
+	return matchFSType(p.deny, fstype) && !matchFSType(p.allow, fstype)
+}
+
+var (
+	// deniedMounts maps the walk paths of mount points below the root
+	// that the policy skips to their mounts. It is nil when no mount is
+	// skipped or the mount table is unavailable.
+	deniedMounts map[string]mountInfo
+
+	// skippedMounts are the denied mount points the walk came across.
+	skippedMounts      []mountInfo
+	skippedMountsMutex sync.Mutex
+)
+
+// setupMountPolicy finds the mounts below root, whose absolute form for
+// mount matching is anchor, that policy keeps the walk out of. The root
+// itself is always scanned: naming it is asking for it.
+func setupMountPolicy(table []mountInfo, root, anchor string, policy fsPolicy) {
+	for p, m := range mountsUnder(table, root, anchor) {
+		if p == root || !policy.denies(m.FSType) {
+			continue
+		}
+		if deniedMounts == nil {
+			deniedMounts = make(map[string]mountInfo)
+		}
+		deniedMounts[p] = m
+	}
+}
+
+// resetMountPolicy clears the state of a previous scan.
+func resetMountPolicy() {
+	deniedMounts = nil
+	skippedMountsMutex.Lock()
+	skippedMounts = nil
+	skippedMountsMutex.Unlock()
+}
+
+// skipDeniedMount reports whether the directory at path is a denied mount
+// point, recording it if so. The walk asks before listing the directory.
+func skipDeniedMount(path string) bool {
+	m, ok := deniedMounts[path]
+	if !ok {
+		return false
+	}
+	skippedMountsMutex.Lock()
+	skippedMounts = append(skippedMounts, m)
+	skippedMountsMutex.Unlock()
+	return true
+}
+
+// skippedFilesystems returns the skipped mounts by mount point.
+func skippedFilesystems() []filesystemSummary {
+	skippedMountsMutex.Lock()
+	defer skippedMountsMutex.Unlock()
+	list := make([]filesystemSummary, len(skippedMounts))
+	for i, m := range skippedMounts {
+		list[i] = filesystemSummary{FSType: m.FSType, MountPoint: m.MountPoint, Device: m.Device}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].MountPoint < list[j].MountPoint })
+	return list
+}
+
+// printSkippedMounts lists the mounts the policy kept the walk out of.
+func printSkippedMounts() {
+	list := skippedFilesystems()
+	if len(list) == 0 {
+		return
+	}
+	fmt.Fprintf(stdout, "\nSkipped %d %s by filesystem type (see -include-fuse, -fs-allow):\n",
+		len(list), plural(len(list), "mount", "mounts"))
+	for _, fs := range list {
+		fmt.Fprintf(stdout, "  %-16s %s\n", fs.FSType, displayPath(fs.MountPoint))
+	}
+}
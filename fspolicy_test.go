@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFSPolicyDenies(t *testing.T) {
+	deny, _ := parseFSTypes(defaultDenyFSTypes + ",nfs*")
+	allow, _ := parseFSTypes("fuse.sshfs")
+	p := fsPolicy{deny: deny, allow: allow}
+	for fstype, want := range map[string]bool{
+		"fuse":            true,
+		"fuse.rclone":     true,
+		"fuse.gvfsd-fuse": true,
+		"fuse.portal":     true,
+		"9p":              true,
+		"nfs4":            true,
+		"fuse.sshfs":      false,
+		"fuseblk":         false,
+		"ext4":            false,
+		"overlay":         false,
+	} {
+		if got := p.denies(fstype); got != want {
+			t.Errorf("denies(%q) = %v, want %v", fstype, got, want)
+		}
+	}
+	if _, err := parseFSTypes("fuse.[x"); err == nil {
+		t.Error("parseFSTypes accepted a malformed pattern")
+	}
+}
+
+func TestFUSEMountsSkipped(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"local/big.bin":  strings.Repeat("l", 3000),
+		"gdrive/big.bin": strings.Repeat("g", 3000),
+		"share/big.bin":  strings.Repeat("s", 3000),
+	})
+	defer os.RemoveAll(tmpDir)
+	root := resolvedAbs(tmpDir)
+
+	fakeMounts(t, []mountInfo{
+		{MountPoint: "/", FSType: "ext4", Device: "8:1"},
+		{MountPoint: filepath.Join(root, "gdrive"), FSType: "fuse.rclone", Device: "0:70"},
+		{MountPoint: filepath.Join(root, "share"), FSType: "9p", Device: "0:71"},
+	})
+	listed := func(out, name string) bool {
+		return strings.Contains(out, filepath.Join(tmpDir, name, "big.bin"))
+	}
+
+	resetResults()
+	out, err := runCaptured(t, "-no-hints", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if !listed(out, "local") || listed(out, "gdrive") || listed(out, "share") {
+		t.Errorf("FUSE and 9p mounts were not skipped:\n%s", out)
+	}
+	for _, want := range []string{
+		"Skipped 2 mounts by filesystem type",
+		"  fuse.rclone      " + filepath.Join(root, "gdrive") + "\n",
+		"  9p               " + filepath.Join(root, "share") + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+
+	resetResults()
+	out, err = runCaptured(t, "-format=json", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	var rep jsonReport
+	if err := json.Unmarshal([]byte(out), &rep); err != nil {
+		t.Fatalf("bad JSON: %v\n%s", err, out)
+	}
+	wantSkipped := []filesystemSummary{
+		{FSType: "fuse.rclone", MountPoint: filepath.Join(root, "gdrive"), Device: "0:70"},
+		{FSType: "9p", MountPoint: filepath.Join(root, "share"), Device: "0:71"},
+	}
+	if !reflect.DeepEqual(rep.SkippedMounts, wantSkipped) {
+		t.Errorf("skipped_mounts = %+v, want %+v", rep.SkippedMounts, wantSkipped)
+	}
+
+	resetResults()
+	out, err = runCaptured(t, "-no-hints", "-include-fuse", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if !listed(out, "gdrive") || !listed(out, "share") || strings.Contains(out, "Skipped") {
+		t.Errorf("-include-fuse still skipped mounts:\n%s", out)
+	}
+
+	resetResults()
+	out, err = runCaptured(t, "-no-hints", "-fs-allow=fuse.rclone", "-fs-deny=ext4", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	// The root's own filesystem is never skipped, only mounts below it.
+	if !listed(out, "gdrive") || listed(out, "share") || !listed(out, "local") {
+		t.Errorf("-fs-allow/-fs-deny not applied:\n%s", out)
+	}
+}
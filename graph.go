@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Bar widths -graph keeps to, however wide or narrow the terminal.
+const (
+	minBarWidth = 10
+	maxBarWidth = 50
+)
+
+// barChart appends a proportional bar to each row of the text listing.
+// It is nil unless -graph is given.
+type barChart struct {
+	// total scales bars against the scan total; otherwise against the
+	// largest entry of each list.
+	total uint64
+	// columns is the terminal width the bars fit into.
+	columns int
+	ascii   bool
+}
+
+// bars is the active chart, if any.
+var bars *barChart
+
+// barCells is how many of width cells a bar for size fills, scaled so
+// that scale fills them all. A non-zero size always gets a cell, so that
+// it is not drawn as empty; a zero scale draws nothing.
+func barCells(size, scale uint64, width int) int {
+	if scale == 0 || size == 0 || width <= 0 {
+		return 0
+	}
+	if size >= scale {
+		return width
+	}
+	return max(int(float64(size)/float64(scale)*float64(width)+0.5), 1)
+}
+
+// renderBar draws a bar of cells filled cells out of width, in block
+// characters or, with ascii, in '#' and '.'.
+func renderBar(cells, width int, ascii bool) string {
+	full, empty := "█", "░"
+	if ascii {
+		full, empty = "#", "."
+	}
+	return strings.Repeat(full, cells) + strings.Repeat(empty, width-cells)
+}
+
+// barWidth is the width of the bars following rows of up to row visible
+// characters, filling what the terminal has left after a two-space gap.
+func (b *barChart) barWidth(row int) int {
+	return min(max(b.columns-row-2, minBarWidth), maxBarWidth)
+}
+
+// rows appends bars to the rows of list, padding the rows to a common
+// width so that the bars line up.
+func (b *barChart) rows(list []FileInfo, rows []string) []string {
+	scale := b.total
+	if scale == 0 {
+		for _, res := range list {
+			scale = max(scale, res.Size)
+		}
+	}
+	widest := 0
+	for _, row := range rows {
+		widest = max(widest, visibleWidth(row))
+	}
+	width := b.barWidth(widest)
+	out := make([]string, len(rows))
+	for i, row := range rows {
+		pad := strings.Repeat(" ", widest-visibleWidth(row)+2)
+		out[i] = row + pad + renderBar(barCells(list[i].Size, scale, width), width, b.ascii)
+	}
+	return out
+}
+
+// visibleWidth counts the runes of s a terminal shows, leaving out the
+// color sequences of the listing.
+func visibleWidth(s string) int {
+	n := 0
+	for len(s) > 0 {
+		if strings.HasPrefix(s, "\033[") {
+			if end := strings.IndexByte(s, 'm'); end >= 0 {
+				s = s[end+1:]
+				continue
+			}
+		}
+		_, size := utf8.DecodeRuneInString(s)
+		s = s[size:]
+		n++
+	}
+	return n
+}
+
+// graphColumns is the width to fit bars into: the terminal's, then
+// $COLUMNS, then 80.
+func graphColumns(f *os.File, env string) int {
+	if n := terminalColumns(f); n > 0 {
+		return n
+	}
+	if n, err := strconv.Atoi(env); err == nil && n > 0 {
+		return n
+	}
+	return 80
+}
+
+// utf8Locale reports whether the locale the environment names, the first
+// of LC_ALL, LC_CTYPE and LANG set, uses UTF-8. Without any, Windows
+// consoles are assumed to cope and others are not.
+func utf8Locale(getenv func(string) string) bool {
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if v := getenv(name); v != "" {
+			v = strings.ToLower(v)
+			return strings.Contains(v, "utf-8") || strings.Contains(v, "utf8")
+		}
+	}
+	return runtime.GOOS == "windows"
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBarCells(t *testing.T) {
+	tests := []struct {
+		size, scale uint64
+		width, want int
+	}{
+		{50, 100, 20, 10},
+		{100, 100, 20, 20}, // a single entry, or the largest, fills the bar
+		{0, 100, 20, 0},
+		{0, 0, 20, 0}, // an empty scan draws nothing
+		{1, 1 << 40, 20, 1},
+		{200, 100, 20, 20},
+		{74, 100, 10, 7},
+		{75, 100, 10, 8},
+		{50, 100, 0, 0},
+	}
+	for _, tc := range tests {
+		if got := barCells(tc.size, tc.scale, tc.width); got != tc.want {
+			t.Errorf("barCells(%d, %d, %d) = %d, want %d", tc.size, tc.scale, tc.width, got, tc.want)
+		}
+	}
+}
+
+func TestRenderBar(t *testing.T) {
+	if got := renderBar(3, 5, false); got != "███░░" {
+		t.Errorf("renderBar = %q", got)
+	}
+	if got := renderBar(3, 5, true); got != "###.." {
+		t.Errorf("ascii renderBar = %q", got)
+	}
+	b := &barChart{columns: 100}
+	if got := b.barWidth(60); got != 38 {
+		t.Errorf("barWidth(60) at 100 columns = %d, want 38", got)
+	}
+	if got := b.barWidth(95); got != minBarWidth {
+		t.Errorf("barWidth(95) at 100 columns = %d, want %d", got, minBarWidth)
+	}
+	b.columns = 300
+	if got := b.barWidth(60); got != maxBarWidth {
+		t.Errorf("barWidth(60) at 300 columns = %d, want %d", got, maxBarWidth)
+	}
+	if got := visibleWidth(sgrRed + "1.00 KiB" + sgrReset + "  ü"); got != 11 {
+		t.Errorf("visibleWidth = %d, want 11", got)
+	}
+}
+
+func TestUTF8Locale(t *testing.T) {
+	env := func(vars map[string]string) func(string) string {
+		return func(name string) string { return vars[name] }
+	}
+	if !utf8Locale(env(map[string]string{"LANG": "en_US.UTF-8"})) {
+		t.Error("en_US.UTF-8 is not UTF-8")
+	}
+	if utf8Locale(env(map[string]string{"LC_ALL": "C", "LANG": "en_US.UTF-8"})) {
+		t.Error("LC_ALL=C did not override LANG")
+	}
+	if !utf8Locale(env(map[string]string{"LC_CTYPE": "de_DE.utf8"})) {
+		t.Error("de_DE.utf8 is not UTF-8")
+	}
+}
+
+func TestGraphListing(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"a/big":   strings.Repeat("x", 4000),
+		"a/small": strings.Repeat("x", 1500),
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+	t.Setenv("COLUMNS", "120")
+
+	resetResults()
+	out, err := runCaptured(t, "-graph", "-ascii", "-graph-scale=total", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	var bars []string
+	col := -1
+	for _, line := range strings.Split(out, "\n") {
+		i := strings.LastIndex(line, "  ")
+		if i < 0 || !strings.ContainsAny(line[i:], "#.") || strings.Trim(line[i+2:], "#.") != "" {
+			continue
+		}
+		if col >= 0 && i != col {
+			t.Errorf("bars do not line up:\n%s", out)
+		}
+		col = i
+		bars = append(bars, line[i+2:])
+	}
+	if len(bars) != 4 {
+		t.Fatalf("got %d bars, want 4:\n%s", len(bars), out)
+	}
+	// Root and a hold it all; big and small share it.
+	width := len(bars[0])
+	want := []int{width, width, barCells(4000, 5500, width), barCells(1500, 5500, width)}
+	for i, bar := range bars {
+		if got := strings.Count(bar, "#"); got != want[i] {
+			t.Errorf("bar %d has %d cells filled, want %d:\n%s", i, got, want[i], out)
+		}
+	}
+
+	resetResults()
+	out, err = runCaptured(t, "-graph", "-format=csv", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("csv run: %v", err)
+	}
+	if strings.ContainsAny(out, "#█") {
+		t.Errorf("bars in CSV output:\n%s", out)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// digitSeparator groups the digits of the byte counts in the text listing
+// (-group-digits); 0 leaves them plain. The machine formats never group.
+var digitSeparator rune
+
+// groupDigits formats n with digitSeparator between groups of three
+// digits, or plainly when there is no separator.
+func groupDigits(n uint64) string {
+	s := strconv.FormatUint(n, 10)
+	if digitSeparator == 0 || len(s) <= 3 {
+		return s
+	}
+	var b strings.Builder
+	lead := len(s) % 3
+	if lead == 0 {
+		lead = 3
+	}
+	b.WriteString(s[:lead])
+	for i := lead; i < len(s); i += 3 {
+		b.WriteRune(digitSeparator)
+		b.WriteString(s[i : i+3])
+	}
+	return b.String()
+}
+
+// Languages whose locales group digits with a dot or a space; the rest
+// use a comma.
+var (
+	dotGroupingLanguages   = []string{"da", "de", "el", "es", "id", "it", "nl", "pt", "ro", "sl", "sr", "tr", "vi"}
+	spaceGroupingLanguages = []string{"bg", "cs", "et", "fi", "fr", "hu", "lt", "lv", "nb", "nn", "no", "pl", "ru", "sk", "sv", "uk"}
+)
+
+// localeSeparator returns the digit grouping separator of the locale in
+// the environment, as LC_ALL, LC_NUMERIC or LANG set it, with a comma for
+// the C locale and languages not listed above.
+func localeSeparator(getenv func(string) string) rune {
+	for _, name := range []string{"LC_ALL", "LC_NUMERIC", "LANG"} {
+		v := getenv(name)
+		if v == "" {
+			continue
+		}
+		lang, _, _ := strings.Cut(strings.ToLower(v), "_")
+		lang, _, _ = strings.Cut(lang, ".")
+		for _, l := range dotGroupingLanguages {
+			if lang == l {
+				return '.'
+			}
+		}
+		for _, l := range spaceGroupingLanguages {
+			if lang == l {
+				return ' '
+			}
+		}
+		return ','
+	}
+	return ','
+}
+
+// parseSeparator reads the -separator value: a comma, dot, underscore or
+// space, the last also spelled "space".
+func parseSeparator(s string) (rune, error) {
+	switch s {
+	case ",", ".", "_", " ":
+		return rune(s[0]), nil
+	case "space":
+		return ' ', nil
+	}
+	return 0, fmt.Errorf("-separator must be ',', '.', '_' or space, not %q", s)
+}
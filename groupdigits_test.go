@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGroupDigits(t *testing.T) {
+	defer func() { digitSeparator = 0 }()
+	tests := []struct {
+		sep  rune
+		n    uint64
+		want string
+	}{
+		{',', 0, "0"},
+		{',', 999, "999"},
+		{',', 1000, "1,000"},
+		{',', 999999, "999,999"},
+		{',', 1000000, "1,000,000"},
+		{',', 999999999999, "999,999,999,999"},
+		{',', 1000000000000, "1,000,000,000,000"},
+		{',', 483728193847, "483,728,193,847"},
+		{'.', 1234567890, "1.234.567.890"},
+		{'_', 123456, "123_456"},
+		{' ', 1000000, "1 000 000"},
+		{' ', 12345, "12 345"},
+		{' ', 1<<64 - 1, "18 446 744 073 709 551 615"},
+		{0, 1000000, "1000000"},
+	}
+	for _, tt := range tests {
+		digitSeparator = tt.sep
+		if got := groupDigits(tt.n); got != tt.want {
+			t.Errorf("groupDigits(%d) with %q = %q, want %q", tt.n, tt.sep, got, tt.want)
+		}
+	}
+}
+
+func TestLocaleSeparator(t *testing.T) {
+	tests := []struct {
+		env  map[string]string
+		want rune
+	}{
+		{nil, ','},
+		{map[string]string{"LANG": "C"}, ','},
+		{map[string]string{"LANG": "en_US.UTF-8"}, ','},
+		{map[string]string{"LANG": "de_DE.UTF-8"}, '.'},
+		{map[string]string{"LANG": "fr_FR.UTF-8"}, ' '},
+		// LC_NUMERIC is what governs numbers, and LC_ALL overrides it.
+		{map[string]string{"LANG": "en_US.UTF-8", "LC_NUMERIC": "pl_PL.UTF-8"}, ' '},
+		{map[string]string{"LC_ALL": "it_IT", "LC_NUMERIC": "pl_PL.UTF-8"}, '.'},
+	}
+	for _, tt := range tests {
+		if got := localeSeparator(func(k string) string { return tt.env[k] }); got != tt.want {
+			t.Errorf("localeSeparator(%v) = %q, want %q", tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestGroupDigitsFlag(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{"f": strings.Repeat("x", 123456)})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+	file := filepath.Join(tmpDir, "f")
+
+	resetResults()
+	out, err := runCaptured(t, "-bytes", "-separator=space", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, " 123 456  "+file+"\n") {
+		t.Errorf("byte count not grouped with spaces:\n%s", out)
+	}
+
+	// The machine formats never group.
+	for _, format := range []string{"csv", "json"} {
+		resetResults()
+		out, err := runCaptured(t, "-group-digits", "-separator=,", "-format="+format, tmpDir, "1K")
+		if err != nil {
+			t.Fatalf("%s run: %v\n%s", format, err, out)
+		}
+		if !strings.Contains(out, "123456") || strings.Contains(out, "123,456") {
+			t.Errorf("-format=%s grouped its byte counts:\n%s", format, out)
+		}
+	}
+
+	if _, err := runCaptured(t, "-separator=;", tmpDir, "1K"); err == nil {
+		t.Error("-separator=; accepted")
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultSizeBuckets = "1M,100M,1G,10G"
+	defaultAgeBuckets  = "30d,90d,365d,1095d"
+)
+
+// heatmap counts bytes and files by (age bucket, size bucket). Rows are
+// age buckets, youngest first; columns are size buckets, smallest first.
+// Each axis has one more bucket than it has edges. It is nil unless
+// -heatmap is given.
+type heatmap struct {
+	sizeEdges  []uint64
+	ageEdges   []time.Duration
+	sizeLabels []string
+	ageLabels  []string
+	now        time.Time
+
+	bytes []atomic.Uint64
+	files []atomic.Uint64
+}
+
+// heat is the active heatmap, if any.
+var heat *heatmap
+
+// parseSizeBuckets parses a -buckets value: ascending, comma-separated
+// sizes such as "1M,100M,1G".
+func parseSizeBuckets(s string) ([]uint64, []string, error) {
+	var edges []uint64
+	var names []string
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		size, err := parseSize(part)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(edges) > 0 && size <= edges[len(edges)-1] {
+			return nil, nil, fmt.Errorf("bucket edges must be ascending: %s does not exceed %s", part, names[len(names)-1])
+		}
+		edges = append(edges, size)
+		names = append(names, part)
+	}
+	return edges, names, nil
+}
+
+// parseAgeBuckets parses a -age-buckets value: ascending, comma-separated
+// ages in the -all-older-than syntax, such as "30d,365d".
+func parseAgeBuckets(s string) ([]time.Duration, []string, error) {
+	var edges []time.Duration
+	var names []string
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		age, err := parseAge(part)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(edges) > 0 && age <= edges[len(edges)-1] {
+			return nil, nil, fmt.Errorf("bucket edges must be ascending: %s does not exceed %s", part, names[len(names)-1])
+		}
+		edges = append(edges, age)
+		names = append(names, part)
+	}
+	return edges, names, nil
+}
+
+// bucketLabels names the buckets delimited by edges: "<a", "a-b", ">=z".
+func bucketLabels(edges []string) []string {
+	labels := make([]string, 0, len(edges)+1)
+	labels = append(labels, "<"+edges[0])
+	for i := 1; i < len(edges); i++ {
+		labels = append(labels, edges[i-1]+"-"+edges[i])
+	}
+	return append(labels, ">="+edges[len(edges)-1])
+}
+
+// newHeatmap returns an empty heatmap measuring ages relative to now.
+func newHeatmap(sizeSpec, ageSpec string, now time.Time) (*heatmap, error) {
+	sizeEdges, sizeNames, err := parseSizeBuckets(sizeSpec)
+	if err != nil {
+		return nil, fmt.Errorf("-buckets: %v", err)
+	}
+	ageEdges, ageNames, err := parseAgeBuckets(ageSpec)
+	if err != nil {
+		return nil, fmt.Errorf("-age-buckets: %v", err)
+	}
+	cells := (len(sizeEdges) + 1) * (len(ageEdges) + 1)
+	return &heatmap{
+		sizeEdges:  sizeEdges,
+		ageEdges:   ageEdges,
+		sizeLabels: bucketLabels(sizeNames),
+		ageLabels:  bucketLabels(ageNames),
+		now:        now,
+		bytes:      make([]atomic.Uint64, cells),
+		files:      make([]atomic.Uint64, cells),
+	}, nil
+}
+
+// add counts one file. It is called for every file in the walk, so it does
+// not allocate. Files modified in the future count as the youngest.
+func (h *heatmap) add(size uint64, modTime time.Time) {
+	col := 0
+	for col < len(h.sizeEdges) && size >= h.sizeEdges[col] {
+		col++
+	}
+	age := h.now.Sub(modTime)
+	row := 0
+	for row < len(h.ageEdges) && age >= h.ageEdges[row] {
+		row++
+	}
+	cell := row*(len(h.sizeEdges)+1) + col
+	h.bytes[cell].Add(size)
+	h.files[cell].Add(1)
+}
+
+// matrix returns the byte and file counts as [age][size] grids.
+func (h *heatmap) matrix() (bytes, files [][]uint64) {
+	cols := len(h.sizeLabels)
+	for row := range h.ageLabels {
+		b := make([]uint64, cols)
+		f := make([]uint64, cols)
+		for col := range b {
+			b[col] = h.bytes[row*cols+col].Load()
+			f[col] = h.files[row*cols+col].Load()
+		}
+		bytes = append(bytes, b)
+		files = append(files, f)
+	}
+	return bytes, files
+}
+
+// writeCSV writes the byte matrix with a header row of size buckets and
+// the age bucket leading each row.
+func (h *heatmap) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write(append([]string{"age\\size"}, h.sizeLabels...))
+	bytes, _ := h.matrix()
+	for row, cells := range bytes {
+		rec := []string{h.ageLabels[row]}
+		for _, b := range cells {
+			rec = append(rec, strconv.FormatUint(b, 10))
+		}
+		cw.Write(rec)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// heatmapJSON is the JSON form of the matrix.
+type heatmapJSON struct {
+	SizeBuckets []string   `json:"size_buckets"`
+	AgeBuckets  []string   `json:"age_buckets"`
+	Bytes       [][]uint64 `json:"bytes"`
+	Files       [][]uint64 `json:"files"`
+}
+
+// writeJSON writes the byte and file matrices with their bucket labels.
+func (h *heatmap) writeJSON(w io.Writer) error {
+	bytes, files := h.matrix()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(heatmapJSON{h.sizeLabels, h.ageLabels, bytes, files})
+}
+
+// export writes the matrix to path, as JSON when it ends in ".json" and as
+// CSV otherwise.
+func (h *heatmap) export(path string) error {
+	f, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = h.writeJSON(f)
+	} else {
+		err = h.writeCSV(f)
+	}
+	if err != nil {
+		f.abort()
+		return err
+	}
+	return f.commit()
+}
+
+// heatShades runs from an empty cell to the fullest one.
+const heatShades = " .:-=+*#%@"
+
+// print writes a shaded preview of the byte matrix, scaled to its fullest
+// cell, so the terminal shows where the bytes are before the export is
+// opened anywhere else.
+func (h *heatmap) print() {
+	bytes, _ := h.matrix()
+	var peak uint64
+	for _, cells := range bytes {
+		for _, b := range cells {
+			peak = max(peak, b)
+		}
+	}
+	rowWidth := 0
+	for _, l := range h.ageLabels {
+		rowWidth = max(rowWidth, len(l))
+	}
+	colWidth := 0
+	for _, l := range h.sizeLabels {
+		colWidth = max(colWidth, len(l))
+	}
+
+	fmt.Fprintln(stdout, "\nBytes by age (rows) and size (columns):")
+	fmt.Fprintf(stdout, "%-*s", rowWidth, "")
+	for _, l := range h.sizeLabels {
+		fmt.Fprintf(stdout, "  %*s", colWidth, l)
+	}
+	fmt.Fprintln(stdout)
+	for row, cells := range bytes {
+		fmt.Fprintf(stdout, "%-*s", rowWidth, h.ageLabels[row])
+		for _, b := range cells {
+			shade := heatShades[0]
+			if b > 0 {
+				// Any non-empty cell gets at least the lightest mark.
+				i := 1 + int(float64(b)/float64(peak)*float64(len(heatShades)-2)+0.5)
+				shade = heatShades[min(i, len(heatShades)-1)]
+			}
+			fmt.Fprintf(stdout, "  %*s", colWidth, strings.Repeat(string(shade), min(colWidth, 4)))
+		}
+		fmt.Fprintln(stdout)
+	}
+	if peak > 0 {
+		fmt.Fprintf(stdout, "Fullest cell: %s (%q)\n", humanReadableSize(peak), heatShades[len(heatShades)-1])
+	}
+}
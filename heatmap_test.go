@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHeatmapCells(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	tmpDir := createTestDir(t, map[string]string{
+		"new-small": strings.Repeat("a", 10),
+		"new-big":   strings.Repeat("b", 300),
+		"mid-mid":   strings.Repeat("c", 200),
+		"old-mid":   strings.Repeat("d", 150),
+		"old-mid2":  strings.Repeat("e", 250),
+		"future":    strings.Repeat("f", 5),
+	})
+	defer os.RemoveAll(tmpDir)
+	ages := map[string]time.Duration{
+		"new-small": 24 * time.Hour,
+		"new-big":   5 * 24 * time.Hour,
+		"mid-mid":   40 * 24 * time.Hour,
+		"old-mid":   400 * 24 * time.Hour,
+		"old-mid2":  500 * 24 * time.Hour,
+		"future":    -24 * time.Hour,
+	}
+	for name, age := range ages {
+		mt := now.Add(-age)
+		if err := os.Chtimes(filepath.Join(tmpDir, name), mt, mt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h, err := newHeatmap("100B,256B", "30d,365d", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	heat = h
+	defer func() { heat = nil }()
+	resetResults()
+	walkDirRecursive(tmpDir, 1<<40, map[string]struct{}{})
+
+	gotBytes, gotFiles := h.matrix()
+	wantBytes := [][]uint64{
+		{15, 0, 300}, // <30d
+		{0, 200, 0},  // 30d-365d
+		{0, 400, 0},  // >=365d
+	}
+	wantFiles := [][]uint64{
+		{2, 0, 1},
+		{0, 1, 0},
+		{0, 2, 0},
+	}
+	if !reflect.DeepEqual(gotBytes, wantBytes) {
+		t.Errorf("bytes = %v, want %v", gotBytes, wantBytes)
+	}
+	if !reflect.DeepEqual(gotFiles, wantFiles) {
+		t.Errorf("files = %v, want %v", gotFiles, wantFiles)
+	}
+
+	var csvOut bytes.Buffer
+	if err := h.writeCSV(&csvOut); err != nil {
+		t.Fatal(err)
+	}
+	wantCSV := "age\\size,<100B,100B-256B,>=256B\n" +
+		"<30d,15,0,300\n" +
+		"30d-365d,0,200,0\n" +
+		">=365d,0,400,0\n"
+	if csvOut.String() != wantCSV {
+		t.Errorf("CSV =\n%s\nwant\n%s", csvOut.String(), wantCSV)
+	}
+
+	var jsonOut bytes.Buffer
+	if err := h.writeJSON(&jsonOut); err != nil {
+		t.Fatal(err)
+	}
+	var decoded heatmapJSON
+	if err := json.Unmarshal(jsonOut.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.Bytes, wantBytes) || len(decoded.AgeBuckets) != 3 || len(decoded.SizeBuckets) != 3 {
+		t.Errorf("JSON = %s", jsonOut.String())
+	}
+}
+
+func TestHeatmapAddDoesNotAllocate(t *testing.T) {
+	h, err := newHeatmap(defaultSizeBuckets, defaultAgeBuckets, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mt := time.Now().Add(-100 * 24 * time.Hour)
+	if n := testing.AllocsPerRun(100, func() { h.add(5<<20, mt) }); n != 0 {
+		t.Errorf("add allocates %v times per call", n)
+	}
+}
+
+func TestParseBucketsRejectsUnordered(t *testing.T) {
+	if _, _, err := parseSizeBuckets("1G,100M"); err == nil {
+		t.Error("descending size edges were accepted")
+	}
+	if _, _, err := parseAgeBuckets("30d,30d"); err == nil {
+		t.Error("repeated age edges were accepted")
+	}
+	if _, _, err := parseSizeBuckets("1M,,1G"); err == nil {
+		t.Error("an empty size edge was accepted")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync/atomic"
+)
+
+const (
+	// hintManyResults is the result count above which a higher threshold
+	// is suggested.
+	hintManyResults = 1000
+	// hintTopN is the number of results the suggested higher threshold aims
+	// to show.
+	hintTopN = 100
+)
+
+// largestFileSeen is the size of the largest file visited, qualifying or not.
+var largestFileSeen atomic.Uint64
+
+// noteFileSize records a visited file's size for the threshold hints.
+func noteFileSize(size uint64) {
+	for {
+		cur := largestFileSeen.Load()
+		if size <= cur || largestFileSeen.CompareAndSwap(cur, size) {
+			return
+		}
+	}
+}
+
+// thresholdHint returns a one-line suggestion for a better threshold when
+// the result count is pathological, or "" when the threshold looks fine.
+func thresholdHint(list []FileInfo, threshold, largestFile uint64) string {
+	switch {
+	case len(list) == 0 && largestFile == 0:
+		return fmt.Sprintf("Nothing exceeded %s; no non-empty files were found.", humanReadableSize(threshold))
+	case len(list) == 0:
+		return fmt.Sprintf("Nothing exceeded %s; the largest file was %s — try %s.",
+			humanReadableSize(threshold), humanReadableSize(largestFile), formatThreshold(niceFloor(largestFile)))
+	case len(list) > hintManyResults:
+		sizes := make([]uint64, len(list))
+		for i, res := range list {
+			sizes[i] = res.Size
+		}
+		sort.Slice(sizes, func(i, j int) bool { return sizes[i] > sizes[j] })
+		return fmt.Sprintf("%d results; a threshold of %s would show the top %d.",
+			len(list), formatThreshold(sizes[hintTopN-1]), hintTopN)
+	}
+	return ""
+}
+
+// niceFloor rounds size down to 1, 2 or 5 times a power of ten in its
+// unit (e.g. 3.2 GiB becomes 2 GiB).
+func niceFloor(size uint64) uint64 {
+	unit := uint64(1)
+	for size/unit >= sizeUnit() {
+		unit *= sizeUnit()
+	}
+	n := size / unit
+	nice := uint64(1)
+	for _, step := range []uint64{1, 2, 5, 10, 20, 50, 100, 200, 500} {
+		if step <= n {
+			nice = step
+		}
+	}
+	return nice * unit
+}
+
+// formatThreshold renders a size in the positional min_size syntax
+// understood by parseSize, e.g. "2.4G". The value is rounded down to one
+// decimal place so the suggested threshold still admits the entry it was
+// computed from.
+func formatThreshold(size uint64) string {
+	const units = "BKMGTP"
+	unit, exp := uint64(1), 0
+	for size/unit >= sizeUnit() && exp < len(units)-1 {
+		unit *= sizeUnit()
+		exp++
+	}
+	if exp == 0 {
+		return strconv.FormatUint(size, 10)
+	}
+	tenths := math.Floor(float64(size) * 10 / float64(unit))
+	return strconv.FormatFloat(tenths/10, 'f', -1, 64) + string(units[exp])
+}
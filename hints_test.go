@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFormatThresholdRoundTrips(t *testing.T) {
+	for _, size := range []uint64{0, 999, 1024, 1536, 2576980377, 3435973836, 5 * 1024 * 1024 * 1024} {
+		formatted := formatThreshold(size)
+		parsed, err := parseSize(formatted)
+		if err != nil {
+			t.Errorf("formatThreshold(%d) = %q, which parseSize rejects: %v", size, formatted, err)
+			continue
+		}
+		if parsed > size {
+			t.Errorf("formatThreshold(%d) = %q parses to %d, which would exclude the entry", size, formatted, parsed)
+		}
+	}
+}
+
+func TestThresholdHintNothingExceeded(t *testing.T) {
+	resetResults()
+	tmpDir := createTestDir(t, map[string]string{
+		"a.bin":     strings.Repeat("a", 3*1024+200), // largest file, 3.2 KiB
+		"sub/b.bin": strings.Repeat("b", 1024),
+	})
+	defer os.RemoveAll(tmpDir)
+
+	output, err := runCaptured(t, tmpDir, "10K")
+	if err != nil {
+		t.Fatalf("run() error: %v", err)
+	}
+	want := "Hint: Nothing exceeded 10.00 KiB; the largest file was 3.20 KiB — try 2K."
+	if !strings.Contains(output, want) {
+		t.Errorf("output does not contain %q:\n%s", want, output)
+	}
+
+	resetResults()
+	output, _ = runCaptured(t, "-no-hints", tmpDir, "10K")
+	if strings.Contains(output, "Hint:") {
+		t.Errorf("-no-hints should suppress the hint:\n%s", output)
+	}
+}
+
+func TestThresholdHintTooManyResults(t *testing.T) {
+	resetResults()
+	files := make(map[string]string)
+	// Sizes 1..1100 bytes. With the root directory ranked first, the 100th
+	// largest result is the 1002-byte file.
+	for i := 1; i <= 1100; i++ {
+		files[fmt.Sprintf("f%04d", i)] = strings.Repeat("x", i)
+	}
+	tmpDir := createTestDir(t, files)
+	defer os.RemoveAll(tmpDir)
+
+	output, err := runCaptured(t, tmpDir, "1")
+	if err != nil {
+		t.Fatalf("run() error: %v", err)
+	}
+	// 1100 files plus the root directory.
+	want := "Hint: 1101 results; a threshold of 1002 would show the top 100."
+	if !strings.Contains(output, want) {
+		t.Errorf("output does not contain %q", want)
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// historyTopN is how many listed entries each history line keeps.
+const historyTopN = 10
+
+// sparkLevels are the ASCII glyphs of a trend line, lowest to highest.
+const sparkLevels = "_.-=+*#"
+
+// historyRecord is one line of a -history file.
+type historyRecord struct {
+	Time  time.Time      `json:"time"`
+	Root  string         `json:"root"`
+	Total uint64         `json:"total"`
+	Top   []historyEntry `json:"top"`
+
+	// CanonicalPaths records that Top paths are relative to Root with
+	// forward slashes (-canonical-paths).
+	CanonicalPaths bool `json:"canonical_paths,omitempty"`
+
+	// Options are the scan's options in normal form, and Fingerprint
+	// their hash, for telling runs measured alike. Runs recorded before
+	// they were kept have neither.
+	Options     *scanOptions `json:"options,omitempty"`
+	Fingerprint string       `json:"fingerprint,omitempty"`
+}
+
+// historyEntry is one of the largest listed entries of a run.
+type historyEntry struct {
+	Path  string `json:"path"`
+	Size  uint64 `json:"size"`
+	IsDir bool   `json:"dir,omitempty"`
+}
+
+// newHistoryRecord summarizes a run: the root total and the first
+// historyTopN entries of the sorted listing other than the root itself.
+func newHistoryRecord(now time.Time, root string, total uint64, list []FileInfo) historyRecord {
+	rec := historyRecord{Time: now.UTC().Truncate(time.Second), Root: root, Total: total}
+	for _, res := range list {
+		if len(rec.Top) == historyTopN {
+			break
+		}
+		if res.Path == root {
+			continue
+		}
+		rec.Top = append(rec.Top, historyEntry{Path: res.Path, Size: res.Size, IsDir: res.IsDir})
+	}
+	return rec
+}
+
+// canonicalize rewrites the entry paths of rec in canonical form.
+func (rec *historyRecord) canonicalize() {
+	for i := range rec.Top {
+		rec.Top[i].Path = canonicalPath(rec.Root, rec.Top[i].Path)
+	}
+	rec.CanonicalPaths = true
+}
+
+// trendKey is the path under which e of rec is compared across runs. Once
+// any run recorded canonical paths, all runs are compared in that form.
+func (rec historyRecord) trendKey(e historyEntry, canonical bool) string {
+	if canonical && !rec.CanonicalPaths {
+		return canonicalPath(rec.Root, e.Path)
+	}
+	return e.Path
+}
+
+// appendHistory adds rec to the history file. With keep > 0 the file is
+// pruned to its last keep lines; pruning rewrites the file through a
+// temporary file and a rename so that readers never see a partial file.
+func appendHistory(path string, rec historyRecord, keep int) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	existing, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	lines := splitHistoryLines(existing)
+	if keep > 0 && len(lines)+1 > keep {
+		var buf bytes.Buffer
+		for _, l := range lines[len(lines)-(keep-1):] {
+			buf.Write(l)
+			buf.WriteByte('\n')
+		}
+		buf.Write(line)
+		return replaceFile(path, buf.Bytes())
+	}
+
+	// A crash mid-append can leave a last line without its newline; start
+	// on a fresh line so the new record is not glued to it.
+	if len(existing) > 0 && existing[len(existing)-1] != '\n' {
+		line = append([]byte{'\n'}, line...)
+	}
+	return appendRecord(path, line)
+}
+
+// splitHistoryLines returns the non-empty lines of data.
+func splitHistoryLines(data []byte) [][]byte {
+	var lines [][]byte
+	for _, l := range bytes.Split(data, []byte{'\n'}) {
+		if len(bytes.TrimSpace(l)) > 0 {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+// readHistory parses a history file, skipping lines that do not decode
+// (typically a final line cut short by a crash) and counting them.
+func readHistory(r io.Reader) ([]historyRecord, int, error) {
+	var recs []historyRecord
+	bad := 0
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var rec historyRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			bad++
+			continue
+		}
+		recs = append(recs, rec)
+	}
+	return recs, bad, sc.Err()
+}
+
+// runTrend implements "spacehogs trend -history=FILE".
+func runTrend(args []string) error {
+	fs := flag.NewFlagSet("trend", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var historyFile string
+	var forceDiff bool
+	fs.StringVar(&historyFile, "history", "", "History file written by -history")
+	fs.BoolVar(&forceDiff, "force-diff", false, "Show runs whose sizes were measured with other options than the last run's, such as -logical-size, instead of refusing")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if historyFile == "" || fs.NArg() != 0 {
+		return fmt.Errorf("usage: spacehogs trend [-force-diff] -history=FILE")
+	}
+	f, err := os.Open(historyFile)
+	if err != nil {
+		return fmt.Errorf("error: %v", err)
+	}
+	defer f.Close()
+	recs, bad, err := readHistory(f)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", historyFile, err)
+	}
+	return printTrend(recs, bad, forceDiff)
+}
+
+// trendDifferences lists, for each run, how its options differ from
+// those of the last run, which recs ends with. A run that measured sizes
+// differently is an error unless force is set.
+func trendDifferences(recs []historyRecord, force bool) ([][]string, error) {
+	diffs := make([][]string, len(recs))
+	last := recs[len(recs)-1]
+	if last.Options == nil {
+		return diffs, nil
+	}
+	for i, rec := range recs[:len(recs)-1] {
+		if rec.Options == nil || rec.Fingerprint == last.Fingerprint {
+			continue
+		}
+		metric, filter := compareOptions(*last.Options, *rec.Options)
+		if len(metric) > 0 && !force {
+			return nil, &incompatibleOptionsError{
+				What:        fmt.Sprintf("the run of %s and the last run", rec.Time.Local().Format("2006-01-02 15:04")),
+				Differences: metric,
+			}
+		}
+		diffs[i] = append(metric, filter...)
+	}
+	return diffs, nil
+}
+
+// printTrend writes the root totals over time and a trend line for each
+// path that appears in more than one run. Runs scanned with other options
+// than the last are marked, with what differed listed below the totals.
+func printTrend(recs []historyRecord, bad int, force bool) error {
+	if bad > 0 {
+		fmt.Fprintf(stdout, "Skipped %d unreadable history lines.\n", bad)
+	}
+	if len(recs) == 0 {
+		fmt.Fprintln(stdout, "No runs recorded.")
+		return nil
+	}
+	sort.SliceStable(recs, func(i, j int) bool { return recs[i].Time.Before(recs[j].Time) })
+	diffs, err := trendDifferences(recs, force)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "%-16s  %-12s  %s\n", "DATE", "TOTAL", "ROOT")
+	marked := false
+	for i, rec := range recs {
+		mark := ""
+		if len(diffs[i]) > 0 {
+			mark, marked = "  *", true
+		}
+		fmt.Fprintf(stdout, "%-16s  %-12s  %s%s\n", rec.Time.Local().Format("2006-01-02 15:04"), humanReadableSize(rec.Total), displayPath(rec.Root), mark)
+	}
+	if marked {
+		fmt.Fprintln(stdout, "\n* scanned with other options than the last run:")
+		for i, rec := range recs {
+			if len(diffs[i]) > 0 {
+				fmt.Fprintf(stdout, "  %s  %s\n", rec.Time.Local().Format("2006-01-02 15:04"), strings.Join(diffs[i], "; "))
+			}
+		}
+	}
+
+	canonical := false
+	for _, rec := range recs {
+		canonical = canonical || rec.CanonicalPaths
+	}
+	// Sizes per path, one slot per run; absent runs stay nil.
+	series := make(map[string][]*uint64)
+	for i, rec := range recs {
+		for _, e := range rec.Top {
+			key := rec.trendKey(e, canonical)
+			if series[key] == nil {
+				series[key] = make([]*uint64, len(recs))
+			}
+			size := e.Size
+			series[key][i] = &size
+		}
+	}
+	var paths []string
+	for p, s := range series {
+		seen := 0
+		for _, v := range s {
+			if v != nil {
+				seen++
+			}
+		}
+		if seen > 1 {
+			paths = append(paths, p)
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	sort.Strings(paths)
+	width := max(len(recs), len("TREND"))
+	fmt.Fprintln(stdout, "\nEntries seen in more than one run:")
+	fmt.Fprintf(stdout, "%-*s  %-12s  %-12s  %s\n", width, "TREND", "FIRST", "LAST", "PATH")
+	for _, p := range paths {
+		first, last := firstLast(series[p])
+		fmt.Fprintf(stdout, "%-*s  %-12s  %-12s  %s\n", width, sparkline(series[p]), humanReadableSize(first), humanReadableSize(last), displayPath(p))
+	}
+	return nil
+}
+
+// firstLast returns the first and last recorded values of a series.
+func firstLast(s []*uint64) (first, last uint64) {
+	found := false
+	for _, v := range s {
+		if v == nil {
+			continue
+		}
+		if !found {
+			first, found = *v, true
+		}
+		last = *v
+	}
+	return first, last
+}
+
+// sparkline renders a series as ASCII levels scaled between its minimum
+// and maximum; runs where the path was not among the top entries show as
+// a space.
+func sparkline(s []*uint64) string {
+	lo, hi := ^uint64(0), uint64(0)
+	for _, v := range s {
+		if v != nil {
+			lo, hi = min(lo, *v), max(hi, *v)
+		}
+	}
+	var b strings.Builder
+	top := len(sparkLevels) - 1
+	for _, v := range s {
+		switch {
+		case v == nil:
+			b.WriteByte(' ')
+		case hi == lo:
+			b.WriteByte(sparkLevels[top/2])
+		default:
+			b.WriteByte(sparkLevels[int(float64(*v-lo)/float64(hi-lo)*float64(top)+0.5)])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistoryAppendPruneAndTrend(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "hogs.history")
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 5; i++ {
+		rec := historyRecord{
+			Time:  start.Add(time.Duration(i) * 24 * time.Hour),
+			Root:  "/data",
+			Total: uint64(1000 * (i + 1)),
+			Top: []historyEntry{
+				{Path: "/data/logs", Size: uint64(500 * (i + 1)), IsDir: true},
+				{Path: "/data/once.iso", Size: 400},
+			},
+		}
+		if i != 2 {
+			rec.Top = rec.Top[:1] // once.iso only shows up in one run
+		}
+		if err := appendHistory(file, rec, 4); err != nil {
+			t.Fatalf("append %d: %v", i, err)
+		}
+	}
+	data, _ := os.ReadFile(file)
+	if lines := splitHistoryLines(data); len(lines) != 4 {
+		t.Fatalf("history has %d lines after pruning, want 4:\n%s", len(lines), data)
+	}
+
+	// Simulate a crash in the middle of an append.
+	f, _ := os.OpenFile(file, os.O_WRONLY|os.O_APPEND, 0)
+	f.WriteString(`{"time":"2026-03-06T12:00:00Z","root":"/da`)
+	f.Close()
+
+	out, err := runCaptured(t, "trend", "-history", file)
+	if err != nil {
+		t.Fatalf("trend: %v", err)
+	}
+	for _, want := range []string{
+		"Skipped 1 unreadable history lines.",
+		"1.95 KiB      /data", // 2000, the first run left after pruning
+		"4.88 KiB      /data", // 5000
+		"\n_-+#   1000 B        2.44 KiB      /data/logs\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("trend output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "once.iso") {
+		t.Errorf("entry seen in a single run listed as a trend:\n%s", out)
+	}
+
+	// A further append must start on its own line after the torn one.
+	if err := appendHistory(file, historyRecord{Time: start.AddDate(0, 0, 6), Root: "/data", Total: 6000}, 0); err != nil {
+		t.Fatalf("append after torn line: %v", err)
+	}
+	f, _ = os.Open(file)
+	recs, bad, err := readHistory(f)
+	f.Close()
+	if err != nil || len(recs) != 5 || bad != 1 || recs[4].Total != 6000 {
+		t.Errorf("after append: %d records, %d bad, err %v", len(recs), bad, err)
+	}
+}
+
+func TestNewHistoryRecordSkipsRoot(t *testing.T) {
+	list := []FileInfo{{Path: "/r", Size: 100, IsDir: true}}
+	for i := 0; i < 15; i++ {
+		list = append(list, FileInfo{Path: "/r/" + string(rune('a'+i)), Size: uint64(50 - i)})
+	}
+	rec := newHistoryRecord(time.Now(), "/r", 100, list)
+	if len(rec.Top) != historyTopN || rec.Top[0].Path != "/r/a" {
+		t.Errorf("top = %+v, want %d entries starting at /r/a", rec.Top, historyTopN)
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	v := func(n uint64) *uint64 { return &n }
+	if got := sparkline([]*uint64{v(0), nil, v(30), v(60)}); got != "_ =#" {
+		t.Errorf("sparkline = %q", got)
+	}
+	if got := sparkline([]*uint64{v(5), v(5)}); got != "==" {
+		t.Errorf("flat sparkline = %q", got)
+	}
+}
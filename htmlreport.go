@@ -0,0 +1,93 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// reportTemplateText is the page written by -format=html. It carries its
+// own styles and script, so the file works offline.
+//
+//go:embed report.html.tmpl
+var reportTemplateText string
+
+var reportTemplate = template.Must(template.New("report").Parse(reportTemplateText))
+
+// htmlReport is the data the report template renders.
+type htmlReport struct {
+	Root                       string
+	Total, Threshold           uint64
+	HumanTotal, HumanThreshold string
+	Rows                       []htmlRow
+	Bars                       []htmlBar
+}
+
+// htmlRow is one listed entry.
+type htmlRow struct {
+	Path      string
+	Size      uint64
+	HumanSize string
+	Type      string
+	Percent   string
+}
+
+// htmlBar is a listed directory directly below the root, for the chart.
+// Width is its size as a percentage of the largest bar.
+type htmlBar struct {
+	Name      string
+	Size      uint64
+	HumanSize string
+	Width     float64
+}
+
+// newHTMLReport builds the report from the sorted results, memory-backed
+// entries after the disk entries as in the text output.
+func newHTMLReport(root string, threshold, total uint64, lists ...[]FileInfo) htmlReport {
+	rep := htmlReport{
+		Root:           root,
+		Total:          total,
+		Threshold:      threshold,
+		HumanTotal:     humanReadableSize(total),
+		HumanThreshold: humanReadableSize(threshold),
+	}
+	for _, list := range lists {
+		for _, res := range list {
+			typ := "file"
+			if res.IsDir {
+				typ = "dir"
+			}
+			pct := 0.0
+			if total > 0 {
+				pct = float64(res.Size) * 100 / float64(total)
+			}
+			rep.Rows = append(rep.Rows, htmlRow{
+				Path:      res.Path,
+				Size:      res.Size,
+				HumanSize: humanReadableSize(res.Size),
+				Type:      typ,
+				Percent:   fmt.Sprintf("%.1f", pct),
+			})
+			if rel, err := filepath.Rel(root, res.Path); err == nil && rel != "." && !strings.ContainsRune(rel, filepath.Separator) && res.IsDir {
+				rep.Bars = append(rep.Bars, htmlBar{Name: rel, Size: res.Size, HumanSize: humanReadableSize(res.Size)})
+			}
+		}
+	}
+	sort.SliceStable(rep.Bars, func(i, j int) bool { return rep.Bars[i].Size > rep.Bars[j].Size })
+	if len(rep.Bars) > 0 && rep.Bars[0].Size > 0 {
+		for i := range rep.Bars {
+			rep.Bars[i].Width = math.Round(float64(rep.Bars[i].Size)*1000/float64(rep.Bars[0].Size)) / 10
+		}
+	}
+	return rep
+}
+
+// writeHTMLReport renders rep as a complete HTML page.
+func writeHTMLReport(w io.Writer, rep htmlReport) error {
+	return reportTemplate.Execute(w, rep)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteHTMLReportEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeHTMLReport(&buf, newHTMLReport("/data", 1024, 0)); err != nil {
+		t.Fatalf("writeHTMLReport: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "No entries at or above the threshold.") || strings.Contains(out, "<table") {
+		t.Errorf("empty report:\n%s", out)
+	}
+}
+
+func TestWriteHTMLReportEscapesPaths(t *testing.T) {
+	root := filepath.FromSlash("/data")
+	evil := filepath.Join(root, `<img src=x onerror="alert(1)"> & co`)
+	results := []FileInfo{
+		{Path: root, Size: 4000, IsDir: true},
+		{Path: evil, Size: 3000, IsDir: true},
+		{Path: filepath.Join(root, "other"), Size: 1000, IsDir: true},
+		{Path: filepath.Join(evil, "big.bin"), Size: 3000},
+	}
+	var buf bytes.Buffer
+	if err := writeHTMLReport(&buf, newHTMLReport(root, 1000, 4000, results)); err != nil {
+		t.Fatalf("writeHTMLReport: %v", err)
+	}
+	out := buf.String()
+	if strings.Contains(out, `<img`) {
+		t.Errorf("path was not escaped:\n%s", out)
+	}
+	for _, want := range []string{
+		`&lt;img src=x onerror=&#34;alert(1)&#34;&gt; &amp; co`,
+		`data-value="3000" title="3000 bytes">` + humanReadableSize(3000) + `<`,
+		`data-value="75.0">75.0%`,
+		`style="width: 100%"`,
+		`style="width: 33.3%"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "http://") || strings.Contains(out, "https://") {
+		t.Errorf("report refers to external resources")
+	}
+}
+
+func TestRunHTMLFormat(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"dir/big.bin": strings.Repeat("x", 200),
+	})
+	defer os.RemoveAll(tmpDir)
+
+	fakeMounts(t, nil)
+	resetResults()
+	out, err := runCaptured(t, "-format=html", "-exclude=nothing", tmpDir, "100B")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	if !strings.HasPrefix(out, "<!DOCTYPE html>") || !strings.Contains(out, "big.bin") || strings.Contains(out, "Total size") {
+		t.Errorf("output is not just the HTML page:\n%s", out)
+	}
+}
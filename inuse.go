@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// procRoot is where process information is read from; tests may point it
+// at a fake tree.
+var procRoot = "/proc"
+
+// fileUser is a process holding a file open or mapped.
+type fileUser struct {
+	PID  int    `json:"pid"`
+	Name string `json:"name"`
+}
+
+// String renders the user as "name[pid]".
+func (u fileUser) String() string {
+	return fmt.Sprintf("%s[%d]", u.Name, u.PID)
+}
+
+// annotateOpenFiles marks listed files that some process holds open or has
+// mapped. Only the listed entries are looked for, so the cost is one pass
+// over /proc regardless of the size of the scan.
+func annotateOpenFiles(list []FileInfo) {
+	wanted := make(map[string][]int)
+	for i := range list {
+		if list[i].IsDir {
+			continue
+		}
+		abs := resolvedAbs(list[i].Path)
+		wanted[abs] = append(wanted[abs], i)
+	}
+	if len(wanted) == 0 {
+		return
+	}
+	for abs, users := range findFileUsers(procRoot, wanted) {
+		for _, i := range wanted[abs] {
+			list[i].OpenBy = users
+		}
+	}
+}
+
+// findFileUsers scans every process's fd table and memory maps for the
+// given absolute paths, or for every file when wanted is nil. Processes
+// that disappear or cannot be inspected (other users' processes without
+// privileges) are silently skipped.
+func findFileUsers(root string, wanted map[string][]int) map[string][]fileUser {
+	found := make(map[string][]fileUser)
+	seen := make(map[string]map[int]bool)
+	add := func(path string, u fileUser) {
+		if seen[path] == nil {
+			seen[path] = make(map[int]bool)
+		}
+		if !seen[path][u.PID] {
+			seen[path][u.PID] = true
+			found[path] = append(found[path], u)
+		}
+	}
+
+	isWanted := func(path string) bool {
+		if wanted == nil {
+			return true
+		}
+		_, ok := wanted[path]
+		return ok
+	}
+
+	procs, err := readProcDir(root)
+	if err != nil {
+		return found
+	}
+	for _, p := range procs {
+		pid, err := strconv.Atoi(p.Name())
+		if err != nil {
+			continue
+		}
+		dir := filepath.Join(root, p.Name())
+		var user *fileUser
+		lookupUser := func() fileUser {
+			if user == nil {
+				comm, _ := readProcFile(filepath.Join(dir, "comm"))
+				user = &fileUser{PID: pid, Name: strings.TrimSpace(string(comm))}
+			}
+			return *user
+		}
+
+		if fds, err := readProcDir(filepath.Join(dir, "fd")); err == nil {
+			for _, fd := range fds {
+				target, err := os.Readlink(filepath.Join(dir, "fd", fd.Name()))
+				if err != nil {
+					continue
+				}
+				if isWanted(target) {
+					add(target, lookupUser())
+				}
+			}
+		}
+		for _, target := range mappedFiles(filepath.Join(dir, "maps")) {
+			if isWanted(target) {
+				add(target, lookupUser())
+			}
+		}
+	}
+	for _, users := range found {
+		sort.Slice(users, func(i, j int) bool { return users[i].PID < users[j].PID })
+	}
+	return found
+}
+
+// readProcDir and readProcFile read from /proc within the descriptor
+// budget, which the walk may still be using.
+func readProcDir(name string) ([]os.DirEntry, error) {
+	openFiles.acquire()
+	defer openFiles.release()
+	return os.ReadDir(name)
+}
+
+func readProcFile(name string) ([]byte, error) {
+	openFiles.acquire()
+	defer openFiles.release()
+	return os.ReadFile(name)
+}
+
+// mappedFiles returns the file paths listed in a /proc/PID/maps file.
+func mappedFiles(name string) []string {
+	openFiles.acquire()
+	defer openFiles.release()
+	f, err := os.Open(name)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var paths []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// address perms offset dev inode pathname
+		fields := strings.SplitN(scanner.Text(), " ", 6)
+		if len(fields) < 6 {
+			continue
+		}
+		path := strings.TrimSpace(fields[5])
+		if strings.HasPrefix(path, "/") {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// inUseSuffix renders the processes holding an entry open, if any.
+func inUseSuffix(res FileInfo) string {
+	if len(res.OpenBy) == 0 || hasColumn("open_by") {
+		return ""
+	}
+	names := make([]string, len(res.OpenBy))
+	for i, u := range res.OpenBy {
+		names[i] = u.String()
+	}
+	return "  (in use by " + strings.Join(names, ", ") + ")"
+}
+
+// openByText joins the processes holding an entry open for a column.
+func openByText(res FileInfo) string {
+	names := make([]string, len(res.OpenBy))
+	for i, u := range res.OpenBy {
+		names[i] = u.String()
+	}
+	return strings.Join(names, " ")
+}
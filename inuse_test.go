@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCheckOpenFlagsOwnProcess(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("-check-open relies on /proc")
+	}
+	tmpDir := createTestDir(t, map[string]string{
+		"wal.log":  strings.Repeat("w", 2048),
+		"idle.bin": strings.Repeat("i", 2048),
+	})
+	defer os.RemoveAll(tmpDir)
+
+	f, err := os.OpenFile(filepath.Join(tmpDir, "wal.log"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	resetResults()
+	output, err := runCaptured(t, "-check-open", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run() error: %v", err)
+	}
+
+	pid := strconv.Itoa(os.Getpid())
+	var walLine, idleLine string
+	for _, line := range strings.Split(output, "\n") {
+		switch {
+		case strings.Contains(line, "wal.log"):
+			walLine = line
+		case strings.Contains(line, "idle.bin"):
+			idleLine = line
+		}
+	}
+	if !strings.Contains(walLine, "(in use by ") || !strings.Contains(walLine, "["+pid+"]") {
+		t.Errorf("open file not flagged with our PID %s: %q", pid, walLine)
+	}
+	if strings.Contains(idleLine, "in use by") {
+		t.Errorf("closed file flagged as in use: %q", idleLine)
+	}
+}
+
+func TestMappedFiles(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"maps": "7f00-7f01 r--p 00000000 fd:00 123   /usr/lib/libc.so.6\n" +
+			"7f02-7f03 rw-p 00000000 00:00 0 \n" +
+			"7ffd-7ffe rw-p 00000000 00:00 0     [stack]\n" +
+			"5600-5601 r--p 00000000 fd:00 456   /data/with space.db\n",
+	})
+	defer os.RemoveAll(tmpDir)
+
+	got := mappedFiles(filepath.Join(tmpDir, "maps"))
+	want := []string{"/usr/lib/libc.so.6", "/data/with space.db"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("mappedFiles() = %q, want %q", got, want)
+	}
+}
+
+func TestCheckOpenInMachineOutput(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("-check-open relies on /proc")
+	}
+	tmpDir := createTestDir(t, map[string]string{"wal.log": strings.Repeat("w", 2048)})
+	defer os.RemoveAll(tmpDir)
+	wal := filepath.Join(tmpDir, "wal.log")
+	f, err := os.Open(wal)
+	if err != nil {
+		t.Fatalf("failed to open fixture: %v", err)
+	}
+	defer f.Close()
+	pid := os.Getpid()
+	holds := func(users []fileUser) bool {
+		for _, u := range users {
+			if u.PID == pid {
+				return true
+			}
+		}
+		return false
+	}
+
+	resetResults()
+	out, err := runCaptured(t, "-check-open", "-format=json", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	var rep jsonReport
+	if err := json.Unmarshal([]byte(out), &rep); err != nil {
+		t.Fatalf("output is not a JSON document: %v\n%s", err, out)
+	}
+	found := false
+	for _, e := range rep.Entries {
+		if e.Path == wal {
+			found = holds(e.OpenBy)
+		}
+	}
+	if !found {
+		t.Errorf("JSON entry for %s lacks our PID %d:\n%s", wal, pid, out)
+	}
+
+	resetResults()
+	out, err = runCaptured(t, "-check-open", "-format=ndjson", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	found = false
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		var e ndjsonEntry
+		if json.Unmarshal([]byte(line), &e) == nil && e.Path == wal {
+			found = holds(e.OpenBy)
+		}
+	}
+	if !found {
+		t.Errorf("ndjson entry for %s lacks our PID %d:\n%s", wal, pid, out)
+	}
+
+	resetResults()
+	out, err = runCaptured(t, "-check-open", "-format=csv", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	if !strings.HasPrefix(out, "type,size_bytes,size_human,open_by,path\n") || !strings.Contains(out, "["+strconv.Itoa(pid)+"]") {
+		t.Errorf("CSV output lacks the open_by column:\n%s", out)
+	}
+}
+
+func TestFindFileUsersStaysWithinBudget(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("-check-open relies on /proc")
+	}
+	old := openFiles
+	openFiles = newFDBudget(1)
+	defer func() { openFiles = old }()
+
+	findFileUsers(procRoot, nil)
+	if peak, held := openFiles.peakOpen(), openFiles.inUse(); peak != 1 || held != 0 {
+		t.Errorf("peak %d and %d still held, want 1 and 0", peak, held)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+)
+
+// jsonEntry is one listed file or directory in -format=json output.
+type jsonEntry struct {
+	Path         string `json:"path"`
+	Size         uint64 `json:"size"`
+	HumanSize    string `json:"human_size"`
+	IsDir        bool   `json:"is_dir"`
+	MemoryBacked bool   `json:"memory_backed,omitempty"`
+	LowerBound   bool   `json:"lower_bound,omitempty"`
+	// Context marks an unlisted ancestor added by -show-ancestors.
+	Context bool `json:"context,omitempty"`
+	// Peek lists a directory's largest immediate children (-peek).
+	Peek []peekChild `json:"peek,omitempty"`
+	// Device is the storage holding the entry (-show-device).
+	Device *blockDevice `json:"device,omitempty"`
+	// LinkTarget is where a listed symlink points. Its size is the
+	// link's own.
+	LinkTarget string `json:"link_target,omitempty"`
+	// Owner is the entry's user and group (-show-owner).
+	Owner *entryOwner `json:"owner,omitempty"`
+	// SELinuxContext and HasACL are the entry's security labels
+	// (-audit-labels).
+	SELinuxContext string `json:"selinux_context,omitempty"`
+	HasACL         bool   `json:"has_acl,omitempty"`
+	// UniqueSize and SharedSize split Size into the bytes deleting the
+	// entry would free and those kept through hard links elsewhere
+	// (-link-stats).
+	UniqueSize *uint64 `json:"unique_size,omitempty"`
+	SharedSize *uint64 `json:"shared_size,omitempty"`
+	// OpenBy lists the processes holding a file open (-check-open).
+	OpenBy []fileUser `json:"open_by,omitempty"`
+	// CachedBytes is the estimated part of a file in the page cache
+	// (-peek-cache).
+	CachedBytes *uint64 `json:"cached_bytes,omitempty"`
+	// FileCount is the number of files below a directory; files have
+	// none.
+	FileCount *uint64 `json:"file_count,omitempty"`
+	// MTime is the entry's modification time in RFC 3339, for a directory
+	// that of the newest file below it. It is absent for directories
+	// without files.
+	MTime string `json:"mtime,omitempty"`
+	// OldestMTime and NewestMTime bound the modification times of the
+	// files below a directory. Files and empty directories have neither.
+	OldestMTime string `json:"oldest_mtime,omitempty"`
+	NewestMTime string `json:"newest_mtime,omitempty"`
+	// DirMTime is a directory's own modification time, next to the
+	// descendant times above (-dir-times=both). With -dir-times=self it
+	// is MTime instead.
+	DirMTime string `json:"dir_mtime,omitempty"`
+
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Violations  []pathViolation   `json:"path_violations,omitempty"`
+}
+
+// jsonReport is the single document written by -format=json.
+type jsonReport struct {
+	// SchemaVersion is jsonSchemaVersion.
+	SchemaVersion string `json:"schema_version"`
+
+	Root      string      `json:"root"`
+	Threshold uint64      `json:"threshold"`
+	Exclude   []string    `json:"exclude"`
+	Total     uint64      `json:"total"`
+	Entries   []jsonEntry `json:"entries"`
+	// Errors lists the entries the walk could not read, below which sizes
+	// are lower bounds.
+	Errors []scanError `json:"errors"`
+
+	// Filesystems lists the filesystems the walk traversed, when the
+	// mount table is known.
+	Filesystems    []filesystemSummary `json:"filesystems,omitempty"`
+	MountCrossings int                 `json:"mount_crossings"`
+	// SkippedMounts lists the mounts left out by filesystem type.
+	SkippedMounts []filesystemSummary `json:"skipped_mounts,omitempty"`
+	// Devices is the walk's file usage by device (-show-device).
+	Devices []deviceRollup `json:"devices,omitempty"`
+	// OldestFile and NewestFile are the qualifying files with the earliest
+	// and latest modification times (-oldest-newest).
+	OldestFile *jsonDatedFile `json:"oldest_file,omitempty"`
+	NewestFile *jsonDatedFile `json:"newest_file,omitempty"`
+
+	// CanonicalPaths records that entry paths are relative to Root with
+	// forward slashes (-canonical-paths).
+	CanonicalPaths bool `json:"canonical_paths,omitempty"`
+
+	// Summary is the footer of the text listing, unless -no-summary.
+	Summary *scanSummary `json:"summary,omitempty"`
+	// Truncated marks a report cut short, by Reason, as in the ndjson
+	// summary: the entries were found, but the scan did not finish and
+	// Total is partial.
+	Truncated bool   `json:"truncated,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	// Labels totals the listed entries by security label (-audit-labels).
+	Labels *jsonLabelSummary `json:"labels,omitempty"`
+	// SelfStats is the scan's own resource usage (-self-stats).
+	SelfStats *jsonSelfStats `json:"self_stats,omitempty"`
+}
+
+// jsonDatedFile is a datedFile in the report.
+type jsonDatedFile struct {
+	Path  string `json:"path"`
+	Size  uint64 `json:"size"`
+	MTime string `json:"mtime"`
+}
+
+// newJSONDatedFile converts f, naming it by path.
+func newJSONDatedFile(f *datedFile, path string) *jsonDatedFile {
+	return &jsonDatedFile{Path: path, Size: f.Size, MTime: f.ModTime.Format(time.RFC3339)}
+}
+
+// newJSONReport builds the document from the sorted results. Memory-backed
+// entries follow the disk entries, as they do in the text output.
+func newJSONReport(root string, threshold uint64, exclude []string, total uint64, lists ...[]FileInfo) jsonReport {
+	rep := jsonReport{
+		Root:      root,
+		Threshold: threshold,
+		Exclude:   append([]string{}, exclude...),
+		Total:     total,
+		Entries:   []jsonEntry{},
+		Errors:    []scanError{},
+
+		SchemaVersion: jsonSchemaVersion,
+	}
+	for _, list := range lists {
+		for _, res := range list {
+			oldest, newest := jsonDirTimes(res)
+			unique, shared := linkSizes(res)
+			var cached *uint64
+			if res.CacheProbed {
+				cached = &res.Cached
+			}
+			rep.Entries = append(rep.Entries, jsonEntry{
+				Path:         res.Path,
+				Size:         res.Size,
+				HumanSize:    humanReadableSize(res.Size),
+				IsDir:        res.IsDir,
+				MemoryBacked: res.MemoryBacked,
+				LowerBound:   res.LowerBound,
+				Context:      res.Context,
+				Peek:         res.Peek,
+				Device:       res.Device,
+				LinkTarget:   res.LinkTarget,
+				Owner:        res.Owner,
+				FileCount:    jsonFileCount(res),
+				MTime:        jsonTime(res),
+				OldestMTime:  oldest,
+				NewestMTime:  newest,
+				Annotations:  annotationMap(res),
+				Violations:   res.PathViolations,
+
+				SELinuxContext: res.SELinuxContext,
+				HasACL:         res.HasACL,
+				UniqueSize:     unique,
+				SharedSize:     shared,
+				OpenBy:         res.OpenBy,
+				CachedBytes:    cached,
+				DirMTime:       jsonDirMTime(res),
+			})
+		}
+	}
+	return rep
+}
+
+// jsonFileCount returns a directory's file count for the report, or nil
+// for a file.
+func jsonFileCount(res FileInfo) *uint64 {
+	if !res.IsDir {
+		return nil
+	}
+	n := res.FileCount
+	return &n
+}
+
+// jsonTime formats the entry's modification time for the report, or
+// returns "" when it is not known.
+func jsonTime(res FileInfo) string {
+	t := entryTime(res)
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// jsonDirTimes formats the time range of the files below a directory, or
+// returns "" for both when the entry is a file or holds none, or the
+// directory's own time replaces it (-dir-times=self).
+func jsonDirTimes(res FileInfo) (oldest, newest string) {
+	if !res.IsDir || res.NewestMTime.IsZero() || dirTimes == "self" {
+		return "", ""
+	}
+	return res.OldestMTime.Format(time.RFC3339), res.NewestMTime.Format(time.RFC3339)
+}
+
+// jsonDirMTime formats a directory's own time for -dir-times=both, or
+// returns "" when it is not shown separately.
+func jsonDirMTime(res FileInfo) string {
+	if !res.IsDir || dirTimes != "both" || res.DirMTime.IsZero() {
+		return ""
+	}
+	return res.DirMTime.Format(time.RFC3339)
+}
+
+// writeTruncatedJSON writes the report of a scan that failed with err,
+// holding the entries found until then, so that a consumer sees the cut
+// rather than no document at all. canonical is -canonical-paths, which
+// list already follows.
+func writeTruncatedJSON(w io.Writer, root string, threshold uint64, exclude []string, total uint64, list []FileInfo, canonical bool, err error) {
+	sortResults(list)
+	rep := newJSONReport(root, threshold, exclude, total, list)
+	rep.Errors = scanErrors.report(root, canonical)
+	rep.CanonicalPaths = canonical
+	rep.Truncated, rep.Reason = true, strings.TrimPrefix(err.Error(), "error: ")
+	// The scan's error is the one to report.
+	_ = writeJSONReport(w, rep)
+}
+
+// writeJSONReport writes rep as indented JSON followed by a newline.
+func writeJSONReport(w io.Writer, rep jsonReport) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rep)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunJSONFormat(t *testing.T) {
+	files := map[string]string{
+		"dir/plain.bin": strings.Repeat("x", 200),
+		"small":         "x",
+	}
+	odd := "quote\"and\nnewline"
+	if runtime.GOOS != "windows" {
+		files["dir/"+odd] = strings.Repeat("y", 150)
+	}
+	tmpDir := createTestDir(t, files)
+	defer os.RemoveAll(tmpDir)
+	// Each entry carries its mtime, a directory the newest below it and
+	// the range of its files.
+	mtimes := map[string]time.Time{
+		"dir/plain.bin": time.Unix(1577836800, 0), // 2020
+		"dir/" + odd:    time.Unix(1609459200, 0), // 2021
+		"small":         time.Unix(1640995200, 0), // 2022
+	}
+	for rel, mt := range mtimes {
+		if _, ok := files[rel]; !ok {
+			continue
+		}
+		if err := os.Chtimes(filepath.Join(tmpDir, rel), mt, mt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stamp := func(rel string) string { return mtimes[rel].Format(time.RFC3339) }
+
+	fakeMounts(t, nil)
+	resetResults()
+	out, err := runCaptured(t, "-format=json", "-exclude=nothing", "-oldest-newest", tmpDir, "100B")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+
+	var got jsonReport
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("output is not a JSON document: %v\n%s", err, out)
+	}
+
+	var entries []jsonEntry
+	dirSize, dirTime, dirFiles := uint64(200), stamp("dir/plain.bin"), uint64(1)
+	if runtime.GOOS != "windows" {
+		dirSize, dirTime, dirFiles = dirSize+150, stamp("dir/"+odd), dirFiles+1
+	}
+	rootFiles := dirFiles + 1
+	entries = append(entries,
+		jsonEntry{Path: tmpDir, Size: dirSize + 1, HumanSize: humanReadableSize(dirSize + 1), IsDir: true, FileCount: &rootFiles, MTime: stamp("small"),
+			OldestMTime: stamp("dir/plain.bin"), NewestMTime: stamp("small")},
+		jsonEntry{Path: filepath.Join(tmpDir, "dir"), Size: dirSize, HumanSize: humanReadableSize(dirSize), IsDir: true, FileCount: &dirFiles, MTime: dirTime,
+			OldestMTime: stamp("dir/plain.bin"), NewestMTime: dirTime},
+		jsonEntry{Path: filepath.Join(tmpDir, "dir", "plain.bin"), Size: 200, HumanSize: humanReadableSize(200), MTime: stamp("dir/plain.bin")},
+	)
+	if runtime.GOOS != "windows" {
+		entries = append(entries, jsonEntry{Path: filepath.Join(tmpDir, "dir", odd), Size: 150, HumanSize: humanReadableSize(150), MTime: stamp("dir/" + odd)})
+	}
+	newest := jsonDatedFile{Path: filepath.Join(tmpDir, "dir", "plain.bin"), Size: 200, MTime: stamp("dir/plain.bin")}
+	if runtime.GOOS != "windows" {
+		newest = jsonDatedFile{Path: filepath.Join(tmpDir, "dir", odd), Size: 150, MTime: stamp("dir/" + odd)}
+	}
+	wantFiles := uint64(len(entries) - 1)
+	if got.Summary == nil || got.Summary.Files != wantFiles || got.Summary.Dirs != 2 || got.Summary.Shown != len(entries) || got.Summary.Errors != 0 {
+		t.Errorf("summary = %+v, want %d files, 2 dirs and %d entries shown", got.Summary, wantFiles, len(entries))
+	}
+	got.Summary = nil
+	want := jsonReport{
+		SchemaVersion: jsonSchemaVersion,
+		Errors:        []scanError{},
+
+		Root:      tmpDir,
+		Threshold: 100,
+		Exclude:   []string{"nothing"},
+		Total:     dirSize + 1,
+		Entries:   entries,
+
+		OldestFile: &jsonDatedFile{Path: filepath.Join(tmpDir, "dir", "plain.bin"), Size: 200, MTime: stamp("dir/plain.bin")},
+		NewestFile: &newest,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("report = %+v\nwant     %+v", got, want)
+	}
+}
+
+func TestRunRejectsUnknownFormat(t *testing.T) {
+	if _, err := runCaptured(t, "-format=yaml", ".", "1G"); err == nil || !strings.Contains(err.Error(), "-format") {
+		t.Errorf("error = %v, want a -format error", err)
+	}
+}
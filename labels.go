@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// labelReader reads the security labels of a path. The real implementation
+// uses extended attributes; tests substitute a fake.
+type labelReader interface {
+	// SELinuxContext returns the path's SELinux context, or "" if it has none.
+	SELinuxContext(path string) (string, error)
+	// HasACL reports whether the path carries a POSIX access ACL.
+	HasACL(path string) (bool, error)
+}
+
+// loadLabelReader returns the label reader for -audit-labels. Tests
+// replace it to serve labels without xattr support.
+var loadLabelReader = newLabelReader
+
+// errLabelsUnsupported is returned when the platform has no xattr support.
+var errLabelsUnsupported = errors.New("security label auditing is only supported on Linux")
+
+// annotateLabels fills in the label fields of the listed entries. Labels are
+// read only for entries that made it into the results, which bounds the
+// number of extra syscalls to the size of the report.
+func annotateLabels(list []FileInfo, reader labelReader) {
+	for i := range list {
+		ctx, err := reader.SELinuxContext(list[i].Path)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error reading security context of %s: %v\n", displayPath(list[i].Path), err)
+		}
+		list[i].SELinuxContext = ctx
+		hasACL, err := reader.HasACL(list[i].Path)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error checking ACL of %s: %v\n", displayPath(list[i].Path), err)
+		}
+		list[i].HasACL = hasACL
+	}
+}
+
+// labelSuffix renders the security labels of an entry, if any were read.
+func labelSuffix(res FileInfo) string {
+	suffix := ""
+	if res.SELinuxContext != "" && !hasColumn("context") {
+		suffix += "  [" + res.SELinuxContext + "]"
+	}
+	if res.HasACL && !hasColumn("acl") {
+		suffix += "  +acl"
+	}
+	return suffix
+}
+
+// labelSummary aggregates the listed entries by security label.
+type labelSummary struct {
+	// contexts maps each SELinux context to its entry count and file bytes.
+	contexts map[string]*labelTotal
+	aclCount int
+	aclBytes uint64
+}
+
+// labelTotal is one row of the per-context aggregate.
+type labelTotal struct {
+	Entries   int
+	FileBytes uint64
+}
+
+// summarizeLabels aggregates annotated entries. Only file sizes are summed,
+// because a directory's size already includes those of its listed files.
+func summarizeLabels(list []FileInfo) labelSummary {
+	sum := labelSummary{contexts: make(map[string]*labelTotal)}
+	for _, res := range list {
+		ctx := res.SELinuxContext
+		if ctx == "" {
+			ctx = "(none)"
+		}
+		t := sum.contexts[ctx]
+		if t == nil {
+			t = &labelTotal{}
+			sum.contexts[ctx] = t
+		}
+		t.Entries++
+		if !res.IsDir {
+			t.FileBytes += res.Size
+		}
+		if res.HasACL {
+			sum.aclCount++
+			if !res.IsDir {
+				sum.aclBytes += res.Size
+			}
+		}
+	}
+	return sum
+}
+
+// sortedContexts returns the contexts by file bytes, largest first.
+func (sum labelSummary) sortedContexts() []string {
+	contexts := make([]string, 0, len(sum.contexts))
+	for ctx := range sum.contexts {
+		contexts = append(contexts, ctx)
+	}
+	sort.Slice(contexts, func(i, j int) bool {
+		a, b := sum.contexts[contexts[i]], sum.contexts[contexts[j]]
+		if a.FileBytes != b.FileBytes {
+			return a.FileBytes > b.FileBytes
+		}
+		return contexts[i] < contexts[j]
+	})
+	return contexts
+}
+
+// jsonLabelSummary is labelSummary in the JSON report.
+type jsonLabelSummary struct {
+	Contexts     []jsonLabelTotal `json:"contexts"`
+	ACLEntries   int              `json:"acl_entries"`
+	ACLFileBytes uint64           `json:"acl_file_bytes"`
+}
+
+// jsonLabelTotal is one context's row of jsonLabelSummary.
+type jsonLabelTotal struct {
+	Context   string `json:"context"`
+	Entries   int    `json:"entries"`
+	FileBytes uint64 `json:"file_bytes"`
+}
+
+// report converts sum for the JSON report, in the order of the text table.
+func (sum labelSummary) report() *jsonLabelSummary {
+	r := &jsonLabelSummary{Contexts: []jsonLabelTotal{}, ACLEntries: sum.aclCount, ACLFileBytes: sum.aclBytes}
+	for _, ctx := range sum.sortedContexts() {
+		t := sum.contexts[ctx]
+		r.Contexts = append(r.Contexts, jsonLabelTotal{Context: ctx, Entries: t.Entries, FileBytes: t.FileBytes})
+	}
+	return r
+}
+
+// printLabelSummary writes the per-context table and the ACL count.
+func printLabelSummary(sum labelSummary) {
+	contexts := sum.sortedContexts()
+
+	fmt.Fprintln(stdout, "\nSECURITY CONTEXT                          ENTRIES  FILE BYTES")
+	fmt.Fprintln(stdout, "--------------------------------------------------------------")
+	for _, ctx := range contexts {
+		t := sum.contexts[ctx]
+		fmt.Fprintf(stdout, "%-40s  %7d  %s\n", ctx, t.Entries, humanReadableSize(t.FileBytes))
+	}
+	fmt.Fprintf(stdout, "Entries with POSIX ACLs: %d (%s in files)\n", sum.aclCount, humanReadableSize(sum.aclBytes))
+}
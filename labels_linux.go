@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// xattrLabelReader reads labels from extended attributes.
+type xattrLabelReader struct {
+	contextAttr string
+	aclAttr     string
+}
+
+// newLabelReader returns the platform label reader.
+func newLabelReader() (labelReader, error) {
+	return xattrLabelReader{contextAttr: "security.selinux", aclAttr: "system.posix_acl_access"}, nil
+}
+
+// SELinuxContext implements labelReader.
+func (r xattrLabelReader) SELinuxContext(path string) (string, error) {
+	value, err := getxattr(path, r.contextAttr)
+	if isNoAttr(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(value), "\x00"), nil
+}
+
+// HasACL implements labelReader.
+func (r xattrLabelReader) HasACL(path string) (bool, error) {
+	_, err := getxattr(path, r.aclAttr)
+	if isNoAttr(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// getxattr reads an extended attribute of path itself: a symlink's own
+// label, not its target's.
+func getxattr(path, attr string) ([]byte, error) {
+	size, err := lgetxattr(path, attr, nil)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	n, err := lgetxattr(path, attr, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// lgetxattr is the lgetxattr system call, which the syscall package
+// does not wrap. An empty dest asks for the size of the value.
+func lgetxattr(path, attr string, dest []byte) (int, error) {
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	a, err := syscall.BytePtrFromString(attr)
+	if err != nil {
+		return 0, err
+	}
+	var buf unsafe.Pointer
+	if len(dest) > 0 {
+		buf = unsafe.Pointer(&dest[0])
+	}
+	n, _, errno := syscall.Syscall6(syscall.SYS_LGETXATTR, uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(a)), uintptr(buf), uintptr(len(dest)), 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(n), nil
+}
+
+// isNoAttr reports whether err means the attribute is simply absent or
+// unsupported by the filesystem.
+func isNoAttr(err error) bool {
+	return errors.Is(err, syscall.ENODATA) || errors.Is(err, syscall.ENOTSUP)
+}
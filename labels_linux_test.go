@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestXattrLabelReader(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{"labelled.txt": "x", "plain.txt": "y"})
+	defer os.RemoveAll(tmpDir)
+	labelled := filepath.Join(tmpDir, "labelled.txt")
+
+	// Unprivileged tests cannot set security.* attributes, so a user
+	// attribute stands in for both the context and the ACL marker.
+	if err := syscall.Setxattr(labelled, "user.spacehogs_test", []byte("test_u:object_r:test_t:s0\x00"), 0); err != nil {
+		t.Skipf("filesystem does not support user xattrs: %v", err)
+	}
+	reader := xattrLabelReader{contextAttr: "user.spacehogs_test", aclAttr: "user.spacehogs_test"}
+
+	ctx, err := reader.SELinuxContext(labelled)
+	if err != nil || ctx != "test_u:object_r:test_t:s0" {
+		t.Errorf("SELinuxContext() = %q, %v", ctx, err)
+	}
+	if has, err := reader.HasACL(labelled); err != nil || !has {
+		t.Errorf("HasACL() = %v, %v; want true", has, err)
+	}
+
+	plain := filepath.Join(tmpDir, "plain.txt")
+	if ctx, err := reader.SELinuxContext(plain); err != nil || ctx != "" {
+		t.Errorf("SELinuxContext() on unlabelled file = %q, %v", ctx, err)
+	}
+	if has, err := reader.HasACL(plain); err != nil || has {
+		t.Errorf("HasACL() on unlabelled file = %v, %v; want false", has, err)
+	}
+
+	// A symlink has its own label; the target's is not reported for it.
+	link := filepath.Join(tmpDir, "link")
+	if err := os.Symlink(labelled, link); err != nil {
+		t.Fatal(err)
+	}
+	if ctx, err := reader.SELinuxContext(link); err != nil || ctx != "" {
+		t.Errorf("SELinuxContext() on a symlink = %q, %v; want the link's own, none", ctx, err)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// newLabelReader reports that label auditing is unavailable.
+func newLabelReader() (labelReader, error) {
+	return nil, errLabelsUnsupported
+}
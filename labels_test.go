@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeLabelReader serves labels from maps keyed by path.
+type fakeLabelReader struct {
+	contexts map[string]string
+	acls     map[string]bool
+	failing  map[string]bool
+}
+
+func (f fakeLabelReader) SELinuxContext(path string) (string, error) {
+	if f.failing[path] {
+		return "", errors.New("permission denied")
+	}
+	return f.contexts[path], nil
+}
+
+func (f fakeLabelReader) HasACL(path string) (bool, error) {
+	return f.acls[path], nil
+}
+
+func TestLabelAnnotationAndSummary(t *testing.T) {
+	list := []FileInfo{
+		{Path: "/srv", Size: 600, IsDir: true},
+		{Path: "/srv/a", Size: 100},
+		{Path: "/srv/b", Size: 200},
+		{Path: "/srv/c", Size: 300},
+		{Path: "/srv/d", Size: 50},
+	}
+	reader := fakeLabelReader{
+		contexts: map[string]string{
+			"/srv":   "system_u:object_r:var_t:s0",
+			"/srv/a": "system_u:object_r:var_t:s0",
+			"/srv/b": "unconfined_u:object_r:user_home_t:s0",
+			"/srv/c": "unconfined_u:object_r:user_home_t:s0",
+		},
+		acls:    map[string]bool{"/srv/b": true, "/srv": true},
+		failing: map[string]bool{"/srv/d": true},
+	}
+
+	oldStderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	setupOutput(os.Stdout, os.Stderr)
+	annotateLabels(list, reader)
+	os.Stderr.Close()
+	os.Stderr = oldStderr
+	setupOutput(os.Stdout, os.Stderr)
+
+	if list[1].SELinuxContext != "system_u:object_r:var_t:s0" || list[1].HasACL {
+		t.Errorf("unexpected labels on %s: %+v", list[1].Path, list[1])
+	}
+	if !list[2].HasACL {
+		t.Errorf("expected ACL on %s", list[2].Path)
+	}
+	if got := labelSuffix(list[2]); got != "  [unconfined_u:object_r:user_home_t:s0]  +acl" {
+		t.Errorf("labelSuffix() = %q", got)
+	}
+
+	sum := summarizeLabels(list)
+	if got := sum.contexts["unconfined_u:object_r:user_home_t:s0"]; got == nil || got.Entries != 2 || got.FileBytes != 500 {
+		t.Errorf("user_home_t totals = %+v, want 2 entries / 500 bytes", got)
+	}
+	// The directory is counted as an entry but its bytes are not added again.
+	if got := sum.contexts["system_u:object_r:var_t:s0"]; got == nil || got.Entries != 2 || got.FileBytes != 100 {
+		t.Errorf("var_t totals = %+v, want 2 entries / 100 bytes", got)
+	}
+	// A failed read leaves the entry unlabelled rather than aborting.
+	if got := sum.contexts["(none)"]; got == nil || got.Entries != 1 || got.FileBytes != 50 {
+		t.Errorf("unlabelled totals = %+v, want 1 entry / 50 bytes", got)
+	}
+	if sum.aclCount != 2 || sum.aclBytes != 200 {
+		t.Errorf("ACL totals = %d entries / %d bytes, want 2 / 200", sum.aclCount, sum.aclBytes)
+	}
+
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	setupOutput(os.Stdout, os.Stderr)
+	printLabelSummary(sum)
+	w.Close()
+	os.Stdout = oldStdout
+	setupOutput(os.Stdout, os.Stderr)
+	buf := make([]byte, 4096)
+	n, _ := r.Read(buf)
+	if out := string(buf[:n]); !strings.Contains(out, "Entries with POSIX ACLs: 2 (200 B in files)") {
+		t.Errorf("summary output missing ACL line:\n%s", out)
+	}
+}
+
+func TestLabelsInMachineOutput(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{"a": strings.Repeat("a", 2048)})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+	file := filepath.Join(tmpDir, "a")
+	reader := fakeLabelReader{
+		contexts: map[string]string{file: "system_u:object_r:var_t:s0"},
+		acls:     map[string]bool{file: true},
+	}
+	old := loadLabelReader
+	loadLabelReader = func() (labelReader, error) { return reader, nil }
+	defer func() { loadLabelReader = old }()
+
+	resetResults()
+	out, err := runCaptured(t, "-audit-labels", "-format=json", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	var rep jsonReport
+	if err := json.Unmarshal([]byte(out), &rep); err != nil {
+		t.Fatalf("output is not a JSON document: %v\n%s", err, out)
+	}
+	found := false
+	for _, e := range rep.Entries {
+		if e.Path == file {
+			found = true
+			if e.SELinuxContext != "system_u:object_r:var_t:s0" || !e.HasACL {
+				t.Errorf("entry %s labels = %q, %v", e.Path, e.SELinuxContext, e.HasACL)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("%s not listed:\n%s", file, out)
+	}
+	if rep.Labels == nil || rep.Labels.ACLEntries != 1 || rep.Labels.ACLFileBytes != 2048 || len(rep.Labels.Contexts) != 2 ||
+		rep.Labels.Contexts[0] != (jsonLabelTotal{Context: "system_u:object_r:var_t:s0", Entries: 1, FileBytes: 2048}) {
+		t.Errorf("labels = %+v", rep.Labels)
+	}
+
+	// CSV gets the labels as columns, and a column implies the flag.
+	resetResults()
+	out, err = runCaptured(t, "-audit-labels", "-format=csv", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	if !strings.HasPrefix(out, "type,size_bytes,size_human,selinux_context,has_acl,path\n") || !strings.Contains(out, ",system_u:object_r:var_t:s0,true,") {
+		t.Errorf("CSV output lacks the label columns:\n%s", out)
+	}
+	resetResults()
+	out, err = runCaptured(t, "-columns=context,acl,path", tmpDir, "1K")
+	if err != nil || !strings.Contains(out, "+acl") || !strings.Contains(out, "system_u:object_r:var_t:s0") {
+		t.Errorf("-columns=context,acl: %v\n%s", err, out)
+	}
+
+	if _, err := runCaptured(t, "-audit-labels", "-format=print0", tmpDir, "1K"); err == nil {
+		t.Error("-audit-labels accepted with -format=print0")
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Exit statuses of a run stopped by a signal, the shell's 128+N, so that
+// a wrapper can tell an interrupted scan from a finished or failed one.
+const (
+	exitInterrupted = 130 // SIGINT
+	exitTerminated  = 143 // SIGTERM
+)
+
+// runCtx is cancelled, with an *interruptedError as its cause, when the
+// run gets SIGINT or SIGTERM. The walk stops at the next directory.
+var runCtx = context.Background()
+
+// cancelRun cancels runCtx; it does nothing outside watchSignals.
+var cancelRun context.CancelCauseFunc = func(error) {}
+
+// interruptedError is returned by run when a signal stopped the scan.
+// Nothing partial is left behind: -o keeps its old file, -history and
+// baselines are not written, an ndjson stream ends in a truncated
+// summary and a JSON report is marked truncated.
+type interruptedError struct {
+	Signal os.Signal
+}
+
+func (e *interruptedError) Error() string {
+	return fmt.Sprintf("error: scan interrupted by %v", e.Signal)
+}
+
+// exitStatus is the exit status for the signal.
+func (e *interruptedError) exitStatus() int {
+	if e.Signal == os.Interrupt {
+		return exitInterrupted
+	}
+	return exitTerminated
+}
+
+// watchSignals makes SIGINT and SIGTERM cancel runCtx until the returned
+// stop is called. After the first signal the default handling is
+// restored, so a second one kills a run that is slow to wind down.
+func watchSignals() (stop func()) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	runCtx, cancelRun = ctx, cancel
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-sigs:
+			signal.Stop(sigs)
+			cancel(&interruptedError{Signal: sig})
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+		cancel(nil)
+		runCtx, cancelRun = context.Background(), func(error) {}
+	}
+}
+
+// interrupt stops the run as if it had received sig.
+func interrupt(sig os.Signal) {
+	cancelRun(&interruptedError{Signal: sig})
+}
+
+// interruption returns the *interruptedError that stopped the run, or nil.
+func interruption() error {
+	if err, ok := context.Cause(runCtx).(*interruptedError); ok {
+		return err
+	}
+	return nil
+}
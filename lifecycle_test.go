@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// interruptAt makes the walk receive sig when it lists the directory
+// named dir.
+func interruptAt(t *testing.T, dir string, sig os.Signal) {
+	t.Helper()
+	old := readDir
+	readDir = func(name string) ([]fs.DirEntry, error) {
+		if filepath.Base(name) == dir {
+			interrupt(sig)
+		}
+		return old(name)
+	}
+	t.Cleanup(func() { readDir = old })
+}
+
+func TestInterruptExitStatus(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"stop/f":  strings.Repeat("x", 2000),
+		"other/f": strings.Repeat("x", 2000),
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+
+	for _, tc := range []struct {
+		sig  os.Signal
+		want int
+	}{
+		{os.Interrupt, exitInterrupted},
+		{syscall.SIGTERM, exitTerminated},
+	} {
+		interruptAt(t, "stop", tc.sig)
+		resetResults()
+		out, err := runCaptured(t, tmpDir, "1K")
+		var ie *interruptedError
+		if !errors.As(err, &ie) || ie.Signal != tc.sig {
+			t.Fatalf("%v: err = %v, want an interruptedError\n%s", tc.sig, err, out)
+		}
+		if got := exitCode(err); got != tc.want {
+			t.Errorf("%v: exit status %d, want %d", tc.sig, got, tc.want)
+		}
+		if strings.Contains(out, "Total size") {
+			t.Errorf("%v: interrupted scan printed a report:\n%s", tc.sig, out)
+		}
+	}
+}
+
+func TestInterruptLeavesFilesAlone(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"stop/f": strings.Repeat("x", 2000),
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+	outDir := t.TempDir()
+	dest := filepath.Join(outDir, "report.json")
+	history := filepath.Join(outDir, "hogs.history")
+	if err := os.WriteFile(dest, []byte("previous\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	interruptAt(t, "stop", syscall.SIGTERM)
+	resetResults()
+	if _, err := runCaptured(t, "-format=json", "-o", dest, "-history", history, tmpDir, "1K"); exitCode(err) != exitTerminated {
+		t.Fatalf("err = %v, want exit status %d", err, exitTerminated)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "previous\n" {
+		t.Errorf("-o destination was changed to %q", data)
+	}
+	if _, err := os.Stat(history); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("history was written by an interrupted run: %v", err)
+	}
+	left, _ := os.ReadDir(outDir)
+	if len(left) != 1 {
+		t.Errorf("interrupted run left %d files in the output directory, want 1", len(left))
+	}
+}
+
+func TestNDJSONTruncatedSummary(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"big":    strings.Repeat("x", 2000),
+		"stop/f": strings.Repeat("x", 2000),
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+
+	for _, tc := range []struct {
+		name   string
+		args   []string
+		inject func()
+		reason string
+		status int
+	}{
+		{
+			name:   "signal",
+			inject: func() { interruptAt(t, "stop", os.Interrupt) },
+			reason: "scan interrupted by interrupt",
+			status: exitInterrupted,
+		},
+		{
+			name: "fatal error",
+			args: []string{"-fatal-errors=io"},
+			inject: func() {
+				old := readDir
+				readDir = func(name string) ([]fs.DirEntry, error) {
+					if filepath.Base(name) == "stop" {
+						return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EIO}
+					}
+					return old(name)
+				}
+				t.Cleanup(func() { readDir = old })
+			},
+			reason: "scan aborted on io error",
+			status: exitFatalError,
+		},
+	} {
+		tc.inject()
+		resetResults()
+		noRetrySleep(t)
+		out, err := runCaptured(t, append(append([]string{"-format=ndjson"}, tc.args...), tmpDir, "1K")...)
+		if got := exitCode(err); got != tc.status {
+			t.Fatalf("%s: exit status %d (%v), want %d", tc.name, got, err, tc.status)
+		}
+		var last ndjsonSummary
+		for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+			if !strings.HasPrefix(line, "{") {
+				continue // the error report on the shared pipe
+			}
+			if err := json.Unmarshal([]byte(line), &last); err != nil {
+				t.Fatalf("%s: invalid line %q: %v", tc.name, line, err)
+			}
+		}
+		if last.Type != "summary" || !last.Truncated || !strings.HasPrefix(last.Reason, tc.reason) {
+			t.Errorf("%s: stream ends with %+v, want a truncated summary for %q\n%s", tc.name, last, tc.reason, out)
+		}
+	}
+}
+
+func TestJSONTruncatedReport(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"big":    strings.Repeat("x", 2000),
+		"stop/f": strings.Repeat("x", 2000),
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+	interruptAt(t, "stop", os.Interrupt)
+
+	resetResults()
+	out, err := runCaptured(t, "-format=json", tmpDir, "1K")
+	if got := exitCode(err); got != exitInterrupted {
+		t.Fatalf("exit status %d (%v), want %d", got, err, exitInterrupted)
+	}
+	start := strings.Index(out, "{\n")
+	if start < 0 {
+		t.Fatalf("no JSON document written:\n%s", out)
+	}
+	var rep jsonReport
+	if err := json.NewDecoder(strings.NewReader(out[start:])).Decode(&rep); err != nil {
+		t.Fatalf("invalid JSON document: %v\n%s", err, out)
+	}
+	if !rep.Truncated || !strings.HasPrefix(rep.Reason, "scan interrupted by interrupt") {
+		t.Errorf("truncated = %v, reason = %q, want a truncated report", rep.Truncated, rep.Reason)
+	}
+	found := false
+	for _, e := range rep.Entries {
+		found = found || e.Path == filepath.Join(tmpDir, "big")
+	}
+	if !found {
+		t.Errorf("entries = %+v, want the file found before the interrupt", rep.Entries)
+	}
+
+	// Under -canonical-paths the errors are relative like the entries.
+	old := readDir
+	readDir = func(name string) ([]fs.DirEntry, error) {
+		if filepath.Base(name) == "stop" {
+			return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EIO}
+		}
+		return old(name)
+	}
+	defer func() { readDir = old }()
+	resetResults()
+	noRetrySleep(t)
+	out, err = runCaptured(t, "-format=json", "-canonical-paths", "-fatal-errors=io", tmpDir, "1K")
+	if got := exitCode(err); got != exitFatalError {
+		t.Fatalf("exit status %d (%v), want %d", got, err, exitFatalError)
+	}
+	start = strings.Index(out, "{\n")
+	if start < 0 {
+		t.Fatalf("no JSON document written:\n%s", out)
+	}
+	rep = jsonReport{}
+	if err := json.NewDecoder(strings.NewReader(out[start:])).Decode(&rep); err != nil {
+		t.Fatalf("invalid JSON document: %v\n%s", err, out)
+	}
+	if !rep.Truncated || !rep.CanonicalPaths || len(rep.Errors) != 1 || rep.Errors[0].Path != "stop" {
+		t.Errorf("truncated = %v, canonical = %v, errors = %+v, want one error at stop", rep.Truncated, rep.CanonicalPaths, rep.Errors)
+	}
+	for _, e := range rep.Entries {
+		if filepath.IsAbs(e.Path) {
+			t.Errorf("entry path %s is not canonical", e.Path)
+		}
+	}
+}
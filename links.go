@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+)
+
+// trackLinks splits directory sizes into unique and shared bytes, for
+// -sort=unique, -min-unique and -link-stats.
+var trackLinks bool
+
+// fileID identifies an inode across the scan.
+type fileID struct{ dev, ino uint64 }
+
+// linkedFile is a multiply-linked file of which only some links have been
+// seen in a subtree so far.
+type linkedFile struct {
+	nlink, seen, size uint64
+}
+
+// addFileLinks accounts for one file in the unique/shared split. A file
+// with a single link is unique; one with several stays shared until all
+// of its links have been seen inside the subtree.
+func (s *subtreeStats) addFileLinks(info fs.FileInfo, size uint64) {
+	id, nlink, ok := fileLinks(info)
+	if !ok || nlink <= 1 {
+		s.Unique = addSize(s.Unique, size)
+		return
+	}
+	s.addLinked(id, linkedFile{nlink: nlink, seen: 1, size: size})
+}
+
+// addLinked merges sightings of a multiply-linked file. Once all links are
+// inside the subtree, deleting it would free the file, so its bytes move
+// from shared to unique.
+func (s *subtreeStats) addLinked(id fileID, lf linkedFile) {
+	if s.linked == nil {
+		s.linked = make(map[fileID]*linkedFile)
+	}
+	cur := s.linked[id]
+	if cur == nil {
+		cur = &lf
+		s.linked[id] = cur
+		s.Shared = addSize(s.Shared, lf.size)
+	} else {
+		cur.seen += lf.seen
+	}
+	if cur.seen >= cur.nlink {
+		delete(s.linked, id)
+		s.Shared -= cur.size
+		s.Unique = addSize(s.Unique, cur.size)
+	}
+}
+
+// mergeLinks folds a finished child's link state into s.
+func (s *subtreeStats) mergeLinks(child subtreeStats) {
+	s.Unique = addSize(s.Unique, child.Unique)
+	if len(child.linked) == 0 {
+		return
+	}
+	if len(s.linked) == 0 {
+		// Nothing to match against: adopt the child's files as they are.
+		// The child is finished and no longer uses them.
+		s.linked, s.Shared = child.linked, addSize(s.Shared, child.Shared)
+		return
+	}
+	for id, lf := range child.linked {
+		s.addLinked(id, *lf)
+	}
+}
+
+// sortByUnique orders results with directories first, then by unique
+// bytes descending, for -sort=unique.
+func sortByUnique(list []FileInfo) {
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].IsDir != list[j].IsDir {
+			return list[i].IsDir
+		}
+		if list[i].Unique != list[j].Unique {
+			return list[i].Unique > list[j].Unique
+		}
+		return list[i].Path < list[j].Path
+	})
+}
+
+// keepMinUnique drops the entries that would free less than min bytes.
+func keepMinUnique(list []FileInfo, min uint64) []FileInfo {
+	kept := list[:0]
+	for _, res := range list {
+		if res.Unique >= min {
+			kept = append(kept, res)
+		}
+	}
+	return kept
+}
+
+// linkSuffix renders the unique/shared split of an entry, unless the
+// unique and shared columns show it.
+func linkSuffix(res FileInfo) string {
+	if !trackLinks || hasColumn("unique") || hasColumn("shared") {
+		return ""
+	}
+	return fmt.Sprintf("  (unique %s, shared %s)", humanReadableSize(res.Unique), humanReadableSize(res.Shared))
+}
+
+// linkSizes returns the unique/shared split of an entry for the JSON
+// formats, or nils when it was not tracked.
+func linkSizes(res FileInfo) (unique, shared *uint64) {
+	if !trackLinks {
+		return nil, nil
+	}
+	u, s := res.Unique, res.Shared
+	return &u, &s
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package main
+
+import "io/fs"
+
+// fileLinks reports no link information; every file counts as unique.
+func fileLinks(fs.FileInfo) (fileID, uint64, bool) {
+	return fileID{}, 0, false
+}
+
+// infoDevice reports no device: there are no device numbers here.
+func infoDevice(fs.FileInfo) (uint64, bool) {
+	return 0, false
+}
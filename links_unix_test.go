@@ -0,0 +1,170 @@
+//go:build unix
+
+package main
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// linkFixture builds a snapshot-style tree: snap1 and snap2 share one file
+// through a hard link, and both holds two links to the same file.
+func linkFixture(t *testing.T) string {
+	t.Helper()
+	tmpDir := createTestDir(t, map[string]string{
+		"snap1/a":   strings.Repeat("a", 100),
+		"snap1/h":   strings.Repeat("h", 200),
+		"snap2/b":   strings.Repeat("b", 50),
+		"both/x":    strings.Repeat("x", 300),
+		"plain/big": strings.Repeat("p", 400),
+	})
+	for _, l := range [][2]string{{"snap1/h", "snap2/h"}, {"both/x", "both/y"}} {
+		if err := os.Link(filepath.Join(tmpDir, l[0]), filepath.Join(tmpDir, l[1])); err != nil {
+			t.Skipf("hard links unsupported here: %v", err)
+		}
+	}
+	return tmpDir
+}
+
+// inodeBytes sums the sizes of the distinct inodes below root.
+func inodeBytes(t *testing.T, root string) uint64 {
+	t.Helper()
+	seen := make(map[uint64]bool)
+	var total uint64
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		ino := info.Sys().(*syscall.Stat_t).Ino
+		if !seen[uint64(ino)] {
+			seen[uint64(ino)] = true
+			total += uint64(info.Size())
+		}
+		return nil
+	})
+	return total
+}
+
+func TestUniqueAndSharedBytes(t *testing.T) {
+	tmpDir := linkFixture(t)
+	defer os.RemoveAll(tmpDir)
+
+	trackLinks = true
+	defer func() { trackLinks = false }()
+	resetResults()
+	walkDirRecursive(tmpDir, 1, map[string]struct{}{})
+
+	want := map[string][2]uint64{
+		"snap1":   {100, 200},
+		"snap2":   {50, 200},
+		"both":    {300, 0},
+		"plain":   {400, 0},
+		"snap1/h": {0, 200},
+		"both/x":  {0, 300},
+	}
+	got := make(map[string][2]uint64)
+	for _, res := range results {
+		rel, _ := filepath.Rel(tmpDir, res.Path)
+		got[filepath.ToSlash(rel)] = [2]uint64{res.Unique, res.Shared}
+	}
+	for path, w := range want {
+		if got[path] != w {
+			t.Errorf("%s: unique/shared = %v, want %v", path, got[path], w)
+		}
+	}
+
+	// Deleting each directory frees exactly its unique bytes.
+	for _, dir := range []string{"snap1", "snap2", "both", "plain"} {
+		sim := linkFixture(t)
+		before := inodeBytes(t, sim)
+		os.RemoveAll(filepath.Join(sim, dir))
+		freed := before - inodeBytes(t, sim)
+		os.RemoveAll(sim)
+		if freed != want[dir][0] {
+			t.Errorf("deleting %s freed %d bytes, but its unique figure is %d", dir, freed, want[dir][0])
+		}
+	}
+}
+
+func TestRunSortByUnique(t *testing.T) {
+	tmpDir := linkFixture(t)
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+	defer func() { trackLinks = false }()
+
+	resetResults()
+	out, err := runCaptured(t, "-sort=unique", "-min-unique=60B", tmpDir, "1B")
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	var order []string
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "[DIR]") {
+			path := strings.Fields(line)[3]
+			rel, _ := filepath.Rel(tmpDir, path)
+			order = append(order, rel)
+		}
+	}
+	// snap2 frees only 50 bytes and is filtered out.
+	if got := strings.Join(order, " "); got != ". plain both snap1" {
+		t.Errorf("directory order = %q, want \". plain both snap1\"\n%s", got, out)
+	}
+	if !strings.Contains(out, "(unique 100 B, shared 200 B)") {
+		t.Errorf("unique/shared columns missing:\n%s", out)
+	}
+}
+
+func TestLinkStatsInMachineOutput(t *testing.T) {
+	tmpDir := linkFixture(t)
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+	defer func() { trackLinks = false }()
+	snap1 := filepath.Join(tmpDir, "snap1")
+
+	resetResults()
+	out, err := runCaptured(t, "-link-stats", "-format=json", tmpDir, "1B")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	var rep jsonReport
+	if err := json.Unmarshal([]byte(out), &rep); err != nil {
+		t.Fatalf("output is not a JSON document: %v\n%s", err, out)
+	}
+	found := false
+	for _, e := range rep.Entries {
+		if e.Path == snap1 {
+			found = true
+			if e.UniqueSize == nil || *e.UniqueSize != 100 || e.SharedSize == nil || *e.SharedSize != 200 {
+				t.Errorf("snap1 unique/shared = %v, %v", e.UniqueSize, e.SharedSize)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("%s not listed:\n%s", snap1, out)
+	}
+
+	resetResults()
+	out, err = runCaptured(t, "-link-stats", "-format=csv", tmpDir, "1B")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	if !strings.HasPrefix(out, "type,size_bytes,size_human,unique_size,shared_size,path\n") || !strings.Contains(out, ",100,200,"+snap1+"\n") {
+		t.Errorf("CSV output lacks the link columns:\n%s", out)
+	}
+
+	// A column implies -link-stats and replaces the suffix.
+	resetResults()
+	out, err = runCaptured(t, "-columns=unique,shared,path", tmpDir, "1B")
+	if err != nil || !strings.Contains(out, "100 B") || strings.Contains(out, "(unique ") {
+		t.Errorf("-columns=unique,shared: %v\n%s", err, out)
+	}
+}
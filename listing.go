@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// listingStats counts what an imported listing contained.
+type listingStats struct {
+	Files     int
+	Malformed int
+	FirstBad  int // line number of the first malformed line
+	Outside   int // entries outside the scan root
+	Excluded  int
+	Unstatted int // plain paths that could not be stat'ed
+}
+
+// statListed is how plain listed paths are sized. Tests replace it.
+var statListed = os.Lstat
+
+// importListing builds the results from a file listing instead of walking
+// the filesystem. Each line is either "size<TAB>path", as written by
+// find -printf '%s\t%p\n', or a plain path as written by plocate, which is
+// then stat'ed for its size. Directories are never sized from the listing:
+// like the walk, their size is the sum of the files below them, so listed
+// directory entries (a plain path that stats as a directory, an entry
+// ending in a separator, or any path that is the parent of another entry)
+// only contribute structure.
+func importListing(r io.Reader, root string, threshold uint64, excludeSet map[string]struct{}) (subtreeStats, listingStats, error) {
+	type listed struct {
+		path    string
+		size    uint64
+		modTime time.Time
+		isDir   bool
+	}
+	var entries []listed
+	parents := make(map[string]bool)
+	var st listingStats
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		malformed := func() {
+			st.Malformed++
+			if st.FirstBad == 0 {
+				st.FirstBad = lineNo
+			}
+		}
+
+		var e listed
+		if sizeStr, p, ok := strings.Cut(line, "\t"); ok {
+			size, err := strconv.ParseUint(sizeStr, 10, 64)
+			if err != nil || p == "" {
+				malformed()
+				continue
+			}
+			e.size, e.isDir = size, strings.HasSuffix(p, "/") || strings.HasSuffix(p, string(filepath.Separator))
+			e.path = filepath.Clean(p)
+		} else {
+			e.path = filepath.Clean(line)
+			fi, err := statListed(e.path)
+			if err != nil {
+				st.Unstatted++
+				continue
+			}
+			e.isDir = fi.IsDir()
+			if !e.isDir && fi.Size() >= 0 {
+				e.size, e.modTime = uint64(fi.Size()), fi.ModTime()
+			}
+		}
+
+		if e.path == root {
+			continue
+		}
+		if !pathWithin(e.path, root) {
+			st.Outside++
+			continue
+		}
+		if listedExcluded(root, e.path, excludeSet) {
+			st.Excluded++
+			continue
+		}
+		entries = append(entries, e)
+		for dir := filepath.Dir(e.path); dir != root && pathWithin(dir, root); dir = filepath.Dir(dir) {
+			if parents[dir] {
+				break
+			}
+			parents[dir] = true
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return subtreeStats{}, st, err
+	}
+
+	dirs := make(map[string]*subtreeStats)
+	for d := range parents {
+		dirs[d] = &subtreeStats{}
+	}
+	var total subtreeStats
+	for _, e := range entries {
+		if e.isDir || parents[e.path] {
+			if dirs[e.path] == nil {
+				dirs[e.path] = &subtreeStats{}
+			}
+			continue
+		}
+		st.Files++
+		var unique uint64
+		if trackLinks {
+			// A listing has no link counts, so every file counts as unique.
+			unique = e.size
+		}
+		noteFileSize(e.size)
+		if allowances != nil {
+			allowances.add(e.path, e.size)
+		}
+		if heat != nil && !e.modTime.IsZero() {
+			heat.add(e.size, e.modTime)
+		}
+		if e.size >= threshold {
+			if e.modTime.IsZero() {
+				resultsMutex.Lock()
+				appendResult(FileInfo{Path: e.path, Size: e.size, Unique: unique})
+				resultsMutex.Unlock()
+			} else {
+				addFileResult(FileInfo{Path: e.path, Size: e.size, Unique: unique}, e.modTime)
+			}
+		}
+		file := subtreeStats{Size: e.size, Files: 1, Unique: unique}
+		if trackDirTimes && !e.modTime.IsZero() {
+			file.addTime(e.modTime)
+		}
+		total.merge(file)
+		for dir := filepath.Dir(e.path); dir != root; dir = filepath.Dir(dir) {
+			dirs[dir].merge(file)
+		}
+	}
+	total.Dirs = uint64(len(dirs)) + 1
+	if parentSizes != nil {
+		parentSizes.record(root, total.Size)
+	}
+	for path, sub := range dirs {
+		if parentSizes != nil {
+			parentSizes.record(path, sub.Size)
+		}
+		if sub.Size >= threshold {
+			addDirResult(path, *sub)
+		}
+	}
+	return total, st, nil
+}
+
+// listedExcluded applies the exclude set to every component of path
+// below root, as the walk would have by never descending.
+func listedExcluded(root, path string, excludeSet map[string]struct{}) bool {
+	for p := path; p != root && pathWithin(p, root); p = filepath.Dir(p) {
+		if _, ok := excludeSet[filepath.Base(p)]; ok {
+			return true
+		}
+		if !excludeAnchored {
+			continue
+		}
+		if _, ok := excludeSet[anchoredPath(p)]; ok {
+			return true
+		}
+		for _, pat := range excludePatterns {
+			if ok, _ := filepath.Match(pat, anchoredPath(p)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// printListingStats reports what was imported and what was skipped.
+func printListingStats(st listingStats) {
+	fmt.Fprintf(stdout, "\nImported %d files from the listing.\n", st.Files)
+	if st.Malformed > 0 {
+		fmt.Fprintf(stdout, "Skipped %d malformed lines (first at line %d).\n", st.Malformed, st.FirstBad)
+	}
+	if st.Unstatted > 0 {
+		fmt.Fprintf(stdout, "Skipped %d listed paths that could not be stat'ed.\n", st.Unstatted)
+	}
+	if st.Outside > 0 {
+		fmt.Fprintf(stdout, "Ignored %d entries outside the scan root.\n", st.Outside)
+	}
+}
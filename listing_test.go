@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestImportListingMatchesWalk(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"a/big.bin":     strings.Repeat("x", 300),
+		"a/b/small.txt": "abc",
+		"a/b/c/mid.log": strings.Repeat("y", 120),
+		"top.dat":       strings.Repeat("z", 150),
+		"skip/huge":     strings.Repeat("q", 500),
+	})
+	defer os.RemoveAll(tmpDir)
+	exclude := map[string]struct{}{"skip": {}}
+
+	resetResults()
+	walked, _ := walkDir(tmpDir, 100, exclude)
+	want := append([]FileInfo(nil), results...)
+	sortResults(want)
+
+	var listing strings.Builder
+	filepath.Walk(tmpDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			fmt.Fprintf(&listing, "%d\t%s\n", info.Size(), path)
+		}
+		return nil
+	})
+	listing.WriteString("not a listing line\tbecause\n")
+	listing.WriteString("12\t/somewhere/else\n")
+
+	resetResults()
+	got, st, err := importListing(strings.NewReader(listing.String()), tmpDir, 100, exclude)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sortResults(results)
+
+	if got.Size != walked.Size || got.Files != walked.Files {
+		t.Errorf("imported total %d bytes in %d files, walk found %d in %d", got.Size, got.Files, walked.Size, walked.Files)
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("imported results differ from the walk\n got: %v\nwant: %v", results, want)
+	}
+	if st.Files != 4 || st.Malformed != 1 || st.FirstBad != 6 || st.Outside != 1 || st.Excluded != 1 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestImportListingPlainPaths(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"d/f1": strings.Repeat("x", 10),
+		"d/f2": strings.Repeat("x", 20),
+	})
+	defer os.RemoveAll(tmpDir)
+
+	lines := []string{
+		tmpDir,
+		filepath.Join(tmpDir, "d"),
+		filepath.Join(tmpDir, "d", "f1"),
+		filepath.Join(tmpDir, "d", "f2"),
+		filepath.Join(tmpDir, "d", "gone"),
+	}
+	resetResults()
+	got, st, err := importListing(strings.NewReader(strings.Join(lines, "\n")), tmpDir, 15, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Size != 30 || got.Files != 2 {
+		t.Errorf("total = %d bytes in %d files, want 30 in 2", got.Size, got.Files)
+	}
+	if st.Unstatted != 1 {
+		t.Errorf("unstatted = %d, want 1", st.Unstatted)
+	}
+	sortResults(results)
+	want := []FileInfo{
+		{Path: filepath.Join(tmpDir, "d"), Size: 30, IsDir: true},
+		{Path: filepath.Join(tmpDir, "d", "f2"), Size: 20},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("results = %v, want %v", results, want)
+	}
+}
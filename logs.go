@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+	"unicode/utf8"
+)
+
+// logSampleSize is how much of a file's head is inspected for text.
+const logSampleSize = 4096
+
+// logGrowthInterval is the wait between the two size checks of -find-logs.
+const logGrowthInterval = 3 * time.Second
+
+// readHead, statSize and logSleep are the operations -find-logs uses to
+// sample candidates. Tests replace them to simulate growing files.
+var (
+	readHead = func(path string) ([]byte, error) {
+		openFiles.acquire()
+		defer openFiles.release()
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		buf := make([]byte, logSampleSize)
+		n, err := io.ReadFull(f, buf)
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			err = nil
+		}
+		return buf[:n], err
+	}
+	statSize = func(path string) (int64, error) {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return 0, err
+		}
+		return fi.Size(), nil
+	}
+	logSleep = time.Sleep
+)
+
+var (
+	// logNamePattern matches common log file names: a .log/.out/.err
+	// extension (optionally rotated, as in app.log.1), a trailing date, or
+	// the well-known names used by daemontools and syslog.
+	logNamePattern = regexp.MustCompile(`(?i)(\.(log|out|err)(\.\d+)?$|[-_.]\d{4}-?\d{2}-?\d{2}(\.log)?$|^(current|messages|syslog)$)`)
+)
+
+// logVerdict is the classification of one candidate file.
+type logVerdict struct {
+	IsLog    bool
+	NameHint bool
+	Text     bool
+	// Growth is the observed growth in bytes per second; zero for files
+	// that did not grow between the two checks.
+	Growth float64
+}
+
+// classifyLog decides whether a file looks like a log from its name, a
+// sample of its first block and its size change over interval. A log must
+// be text, and either be named like one or be growing by appends.
+func classifyLog(name string, head []byte, delta int64, interval time.Duration) logVerdict {
+	v := logVerdict{
+		NameHint: logNamePattern.MatchString(name),
+		Text:     looksLikeText(head),
+	}
+	if delta > 0 && interval > 0 {
+		v.Growth = float64(delta) / interval.Seconds()
+	}
+	v.IsLog = v.Text && (v.NameHint || v.Growth > 0)
+	return v
+}
+
+// looksLikeText reports whether sample is plausibly text: no NUL bytes,
+// valid UTF-8 apart from a rune cut off at the end, and almost no control
+// characters other than whitespace.
+func looksLikeText(sample []byte) bool {
+	if len(sample) == 0 {
+		return false
+	}
+	control := 0
+	for i := 0; i < len(sample); {
+		r, size := utf8.DecodeRune(sample[i:])
+		if r == utf8.RuneError && size <= 1 {
+			if len(sample)-i < utf8.UTFMax && !utf8.FullRune(sample[i:]) {
+				break
+			}
+			return false
+		}
+		switch {
+		case r == 0:
+			return false
+		case r < 0x20 && r != '\n' && r != '\r' && r != '\t' && r != 0x1b:
+			control++
+		}
+		i += size
+	}
+	return control*100 <= len(sample)
+}
+
+// logFile is a listed file that -find-logs considers a log.
+type logFile struct {
+	FileInfo
+	Verdict logVerdict
+}
+
+// findLogs classifies the listed files, checking each candidate's size
+// twice interval apart to detect growth.
+func findLogs(list []FileInfo, interval time.Duration) []logFile {
+	type candidate struct {
+		res  FileInfo
+		head []byte
+		size int64
+	}
+	var cands []candidate
+	for _, res := range list {
+		if res.IsDir {
+			continue
+		}
+		head, err := readHead(res.Path)
+		if err != nil || !looksLikeText(head) {
+			continue
+		}
+		size, err := statSize(res.Path)
+		if err != nil {
+			continue
+		}
+		cands = append(cands, candidate{res, head, size})
+	}
+	if len(cands) == 0 {
+		return nil
+	}
+
+	logSleep(interval)
+	var logs []logFile
+	for _, c := range cands {
+		var delta int64
+		if size, err := statSize(c.res.Path); err == nil {
+			delta = size - c.size
+		}
+		v := classifyLog(filepath.Base(c.res.Path), c.head, delta, interval)
+		if v.IsLog {
+			logs = append(logs, logFile{c.res, v})
+		}
+	}
+	return logs
+}
+
+// printLogs writes the -find-logs section.
+func printLogs(logs []logFile) {
+	if len(logs) == 0 {
+		fmt.Fprintln(stdout, "\nNo listed file looks like a log.")
+		return
+	}
+	fmt.Fprintln(stdout, "\nLikely log files:")
+	growing := false
+	for _, l := range logs {
+		state := "not growing"
+		if l.Verdict.Growth > 0 {
+			growing = true
+			state = "growing " + humanReadableSize(uint64(l.Verdict.Growth)) + "/s"
+		}
+		fmt.Fprintf(stdout, "  %-10s  %s  (%s)%s\n", humanReadableSize(l.Size), displayPath(l.Path), state, inUseSuffix(l.FileInfo))
+	}
+	hint := "Hint: rotate these with logrotate, e.g. \"size 100M\", \"rotate 5\" and \"compress\""
+	if growing {
+		hint += "; use \"copytruncate\" for writers that keep the file open"
+	}
+	fmt.Fprintln(stdout, hint+".")
+}
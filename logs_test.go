@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClassifyLog(t *testing.T) {
+	text := []byte("2024-05-01T10:00:00Z INFO started\n2024-05-01T10:00:01Z WARN slow\n")
+	binary := []byte{0x7f, 'E', 'L', 'F', 2, 1, 1, 0, 0, 0}
+	tests := []struct {
+		name  string
+		head  []byte
+		delta int64
+		want  bool
+	}{
+		{"app.log", text, 0, true},
+		{"app.log.3", text, 0, true},
+		{"access-2024-05-01", text, 0, true},
+		{"current", text, 0, true},
+		{"notes.txt", text, 0, false},
+		{"notes.txt", text, 4096, true}, // unnamed, but appended to
+		{"core.log", binary, 4096, false},
+		{"blob.bin", binary, 0, false},
+		{"empty.log", nil, 0, false},
+	}
+	for _, test := range tests {
+		v := classifyLog(test.name, test.head, test.delta, 2*time.Second)
+		if v.IsLog != test.want {
+			t.Errorf("classifyLog(%q, delta=%d) = %+v, want IsLog=%v", test.name, test.delta, v, test.want)
+		}
+	}
+	if v := classifyLog("app.log", text, 4096, 2*time.Second); v.Growth != 2048 {
+		t.Errorf("growth = %v, want 2048 bytes/s", v.Growth)
+	}
+}
+
+func TestLooksLikeTextCutRune(t *testing.T) {
+	// A sample that ends in the middle of a multi-byte rune is still text.
+	sample := append([]byte("grüße "), "ü"[0])
+	if !looksLikeText(sample) {
+		t.Error("sample cut inside a rune rejected as binary")
+	}
+	if looksLikeText([]byte("ok\xffok")) {
+		t.Error("invalid UTF-8 in the middle accepted as text")
+	}
+}
+
+func TestFindLogs(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"app.log":   strings.Repeat("GET /index.html 200\n", 100),
+		"static.db": "SQLite format 3\x00" + strings.Repeat("\x00", 100),
+		"fake.log":  "\x1f\x8b\x08\x00" + strings.Repeat("\x00", 100),
+	})
+	defer os.RemoveAll(tmpDir)
+	appLog := filepath.Join(tmpDir, "app.log")
+
+	oldStat, oldSleep := statSize, logSleep
+	defer func() { statSize, logSleep = oldStat, oldSleep }()
+	slept := false
+	logSleep = func(time.Duration) { slept = true }
+	statSize = func(path string) (int64, error) {
+		size, err := oldStat(path)
+		if path == appLog && slept {
+			size += 3000 // the writer appended while we waited
+		}
+		return size, err
+	}
+
+	var list []FileInfo
+	for _, name := range []string{"app.log", "static.db", "fake.log"} {
+		list = append(list, FileInfo{Path: filepath.Join(tmpDir, name), Size: 100})
+	}
+	list = append(list, FileInfo{Path: tmpDir, Size: 300, IsDir: true})
+
+	logs := findLogs(list, 3*time.Second)
+	if len(logs) != 1 || logs[0].Path != appLog {
+		t.Fatalf("findLogs = %+v, want only app.log", logs)
+	}
+	if logs[0].Verdict.Growth != 1000 {
+		t.Errorf("growth = %v, want 1000 bytes/s", logs[0].Verdict.Growth)
+	}
+}
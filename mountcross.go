@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// filesystemSummary is one distinct filesystem the walk traversed.
+type filesystemSummary struct {
+	FSType     string `json:"fstype"`
+	MountPoint string `json:"mount_point"`
+	Device     string `json:"device,omitempty"`
+}
+
+var (
+	// mountPoints maps the walk paths of mount points below the scan root
+	// to their mounts. It is nil when the mount table is unavailable, and
+	// the crossing summary is then skipped.
+	mountPoints map[string]mountInfo
+
+	// rootMount is the mount holding the scan root.
+	rootMount      mountInfo
+	rootMountKnown bool
+
+	// crossedMounts are the mount points the walk actually entered.
+	crossedMounts []mountInfo
+	crossedMutex  sync.Mutex
+)
+
+// setupMountCrossings prepares the crossing summary for a scan of root,
+// whose absolute form for mount matching is anchor.
+func setupMountCrossings(table []mountInfo, root, anchor string) {
+	mountPoints = mountsUnder(table, root, anchor)
+	// The root's own mount point is where the walk starts, not a crossing.
+	delete(mountPoints, root)
+	rootMount, rootMountKnown = enclosingMount(table, anchor)
+}
+
+// resetMountCrossings clears the state of a previous scan.
+func resetMountCrossings() {
+	mountPoints, rootMountKnown = nil, false
+	crossedMutex.Lock()
+	crossedMounts = nil
+	crossedMutex.Unlock()
+}
+
+// recordCrossing notes that the walk entered path, if it is a mount point.
+func recordCrossing(path string) {
+	m, ok := mountPoints[path]
+	if !ok {
+		return
+	}
+	crossedMutex.Lock()
+	crossedMounts = append(crossedMounts, m)
+	crossedMutex.Unlock()
+}
+
+// traversedFilesystems returns the filesystems the walk touched, the
+// root's first and the rest by mount point. Mounts of the same device,
+// such as bind mounts, count once.
+func traversedFilesystems() []filesystemSummary {
+	if !rootMountKnown {
+		return nil
+	}
+	crossedMutex.Lock()
+	crossed := append([]mountInfo(nil), crossedMounts...)
+	crossedMutex.Unlock()
+	sort.Slice(crossed, func(i, j int) bool { return crossed[i].MountPoint < crossed[j].MountPoint })
+
+	seen := make(map[string]bool)
+	var list []filesystemSummary
+	for _, m := range append([]mountInfo{rootMount}, crossed...) {
+		key := m.Device
+		if key == "" {
+			key = m.MountPoint
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		list = append(list, filesystemSummary{FSType: m.FSType, MountPoint: m.MountPoint, Device: m.Device})
+	}
+	return list
+}
+
+// mountCrossings returns how many mount points the walk entered.
+func mountCrossings() int {
+	crossedMutex.Lock()
+	defer crossedMutex.Unlock()
+	return len(crossedMounts)
+}
+
+// printMountSummary states which filesystems the scan spanned. A scan that
+// stayed on one filesystem prints nothing.
+func printMountSummary() {
+	crossings := mountCrossings()
+	if crossings == 0 {
+		return
+	}
+	fss := traversedFilesystems()
+	names := make([]string, len(fss))
+	for i, fs := range fss {
+		names[i] = fs.FSType + " " + displayPath(fs.MountPoint)
+	}
+	fmt.Fprintf(stdout, "\nTraversed %d %s (%s); crossed %d mount %s.\n",
+		len(fss), plural(len(fss), "filesystem", "filesystems"), strings.Join(names, ", "),
+		crossings, plural(crossings, "point", "points"))
+}
+
+// plural returns one or many according to n.
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
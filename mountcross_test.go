@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMountCrossingSummary(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"local/f":         "x",
+		"data/f":          "x",
+		"data/remote/f":   "x",
+		"mirror/f":        "x",
+		"excluded/deep/f": "x",
+	})
+	defer os.RemoveAll(tmpDir)
+	root := resolvedAbs(tmpDir)
+
+	fakeMounts(t, []mountInfo{
+		{MountPoint: "/", FSType: "ext4", Device: "8:1"},
+		{MountPoint: filepath.Join(root, "data"), FSType: "xfs", Device: "8:16"},
+		{MountPoint: filepath.Join(root, "data", "remote"), FSType: "nfs4", Device: "0:50"},
+		// A bind mount of the xfs filesystem is a crossing but not a new
+		// filesystem.
+		{MountPoint: filepath.Join(root, "mirror"), FSType: "xfs", Device: "8:16"},
+		// Never visited, so neither crossed nor traversed.
+		{MountPoint: filepath.Join(root, "excluded", "deep"), FSType: "btrfs", Device: "0:60"},
+	})
+
+	resetResults()
+	out, err := runCaptured(t, "-exclude=excluded", tmpDir, "1G")
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	want := "Traversed 3 filesystems (ext4 /, xfs " + filepath.Join(tmpDir, "data") +
+		", nfs4 " + filepath.Join(tmpDir, "data", "remote") + "); crossed 3 mount points.\n"
+	if !strings.Contains(out, want) {
+		t.Errorf("output lacks %q:\n%s", want, out)
+	}
+
+	resetResults()
+	out, err = runCaptured(t, "-format=json", "-exclude=excluded", tmpDir, "1G")
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	var rep jsonReport
+	if err := json.Unmarshal([]byte(out), &rep); err != nil {
+		t.Fatalf("bad JSON: %v\n%s", err, out)
+	}
+	wantFS := []filesystemSummary{
+		{FSType: "ext4", MountPoint: "/", Device: "8:1"},
+		{FSType: "xfs", MountPoint: filepath.Join(root, "data"), Device: "8:16"},
+		{FSType: "nfs4", MountPoint: filepath.Join(root, "data", "remote"), Device: "0:50"},
+	}
+	if !reflect.DeepEqual(rep.Filesystems, wantFS) || rep.MountCrossings != 3 {
+		t.Errorf("filesystems = %+v, crossings = %d; want %+v and 3", rep.Filesystems, rep.MountCrossings, wantFS)
+	}
+}
+
+func TestMountSummarySilentOnOneFilesystem(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{"a/f": "x"})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, []mountInfo{{MountPoint: "/", FSType: "ext4"}})
+
+	resetResults()
+	out, err := runCaptured(t, tmpDir, "1G")
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if strings.Contains(out, "Traversed") {
+		t.Errorf("single-filesystem scan printed a mount summary:\n%s", out)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// mountInfo describes one entry of the system mount table.
+type mountInfo struct {
+	MountPoint string
+	FSType     string
+	Source     string
+	Device     string // "major:minor" where the platform reports it
+}
+
+// loadMountTable returns the system mount table. It is a variable so tests
+// can substitute a fake table.
+var loadMountTable = readMountTable
+
+// memoryFSTypes are filesystem types whose contents live in RAM.
+var memoryFSTypes = map[string]bool{
+	"tmpfs":    true,
+	"ramfs":    true,
+	"devtmpfs": true,
+}
+
+var (
+	// memoryMounts maps the walk paths of memory-backed mount points below
+	// the scan root to their filesystem type. It is nil when tmpfs
+	// separation is disabled.
+	memoryMounts map[string]string
+
+	// memoryRoots and memoryBytes record the memory-backed subtrees the walk
+	// actually visited and their combined size.
+	memoryRoots []string
+	memoryBytes uint64
+	memoryMutex sync.Mutex
+)
+
+// parseMountInfo parses the Linux /proc/self/mountinfo format.
+func parseMountInfo(r io.Reader) ([]mountInfo, error) {
+	var mounts []mountInfo
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// id parent major:minor root mountpoint options [optional...] - fstype source superopts
+		sep := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				sep = i
+				break
+			}
+		}
+		if len(fields) < 5 || sep < 0 || sep+2 >= len(fields) {
+			return nil, fmt.Errorf("malformed mountinfo line: %q", scanner.Text())
+		}
+		mounts = append(mounts, mountInfo{
+			MountPoint: unescapeMountField(fields[4]),
+			FSType:     fields[sep+1],
+			Source:     unescapeMountField(fields[sep+2]),
+			Device:     fields[2],
+		})
+	}
+	return mounts, scanner.Err()
+}
+
+// unescapeMountField decodes the octal escapes (\040 for space and so on)
+// the kernel uses in mount table fields.
+func unescapeMountField(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// resolvedAbs returns the absolute, symlink-free form of path, falling back
+// to the plain absolute path if resolution fails.
+func resolvedAbs(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		return real
+	}
+	return abs
+}
+
+// pathWithin reports whether path is dir or lies beneath it. A dir of .
+// holds every relative path that does not climb out of it, as the walk
+// of a relative root builds them.
+func pathWithin(path, dir string) bool {
+	if path == dir {
+		return true
+	}
+	if dir == "." {
+		sep := string(filepath.Separator)
+		return !filepath.IsAbs(path) && filepath.VolumeName(path) == "" && !strings.HasPrefix(path, sep) &&
+			path != ".." && !strings.HasPrefix(path, ".."+sep)
+	}
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+	return strings.HasPrefix(path, dir)
+}
+
+// enclosingMount returns the mount with the longest mount point containing
+// the absolute path abs. For stacked mounts the last, visible one wins.
+func enclosingMount(table []mountInfo, abs string) (mountInfo, bool) {
+	var best mountInfo
+	found := false
+	for _, m := range table {
+		if pathWithin(abs, m.MountPoint) && (!found || len(m.MountPoint) >= len(best.MountPoint)) {
+			best, found = m, true
+		}
+	}
+	return best, found
+}
+
+// mountsUnder maps the mount points at or below anchor, the absolute form of
+// the walk root, to the paths the walk will use for them, so they can be
+// recognised with a map lookup.
+func mountsUnder(table []mountInfo, root, anchor string) map[string]mountInfo {
+	under := make(map[string]mountInfo)
+	for _, m := range table {
+		if !pathWithin(m.MountPoint, anchor) {
+			continue
+		}
+		rel, err := filepath.Rel(anchor, m.MountPoint)
+		if err != nil {
+			continue
+		}
+		under[filepath.Join(root, rel)] = m
+	}
+	return under
+}
+
+// setupMemoryMounts prepares tmpfs separation for a scan of root, whose
+// absolute form for mount matching is anchor. It returns true if root
+// itself sits on a memory-backed filesystem.
+func setupMemoryMounts(table []mountInfo, root, anchor string) bool {
+	memoryMounts = make(map[string]string)
+	for path, m := range mountsUnder(table, root, anchor) {
+		if memoryFSTypes[m.FSType] {
+			memoryMounts[path] = m.FSType
+		}
+	}
+	m, ok := enclosingMount(table, anchor)
+	return ok && memoryFSTypes[m.FSType]
+}
+
+// recordMemoryMount notes a visited memory-backed subtree and its size.
+func recordMemoryMount(path string, size uint64) {
+	memoryMutex.Lock()
+	memoryRoots = append(memoryRoots, path)
+	memoryBytes = addSize(memoryBytes, size)
+	memoryMutex.Unlock()
+}
+
+// isMemoryBacked reports whether path lies in a visited memory-backed subtree.
+func isMemoryBacked(path string) bool {
+	for _, root := range memoryRoots {
+		if pathWithin(path, root) {
+			return true
+		}
+	}
+	return false
+}
+
+// readMountTableFile parses a mountinfo-format file.
+func readMountTableFile(name string) ([]mountInfo, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseMountInfo(f)
+}
@@ -0,0 +1,6 @@
+package main
+
+// readMountTable reads the mount table of the current process.
+func readMountTable() ([]mountInfo, error) {
+	return readMountTableFile("/proc/self/mountinfo")
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+// readMountTable returns an empty table on platforms without mountinfo;
+// features that depend on mount data degrade to treating the tree as a
+// single filesystem.
+func readMountTable() ([]mountInfo, error) {
+	return nil, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseMountInfo(t *testing.T) {
+	input := `28 1 254:0 / / rw,relatime - ext4 /dev/vda rw
+26 25 0:24 / /dev/shm rw,relatime shared:3 - tmpfs tmpfs rw,size=6158152k
+40 28 0:30 / /mnt/with\040space rw - nfs4 server:/export rw
+`
+	mounts, err := parseMountInfo(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseMountInfo() error: %v", err)
+	}
+	expected := []mountInfo{
+		{MountPoint: "/", FSType: "ext4", Source: "/dev/vda", Device: "254:0"},
+		{MountPoint: "/dev/shm", FSType: "tmpfs", Source: "tmpfs", Device: "0:24"},
+		{MountPoint: "/mnt/with space", FSType: "nfs4", Source: "server:/export", Device: "0:30"},
+	}
+	if len(mounts) != len(expected) {
+		t.Fatalf("got %d mounts, want %d", len(mounts), len(expected))
+	}
+	for i := range expected {
+		if mounts[i] != expected[i] {
+			t.Errorf("mount %d = %+v, want %+v", i, mounts[i], expected[i])
+		}
+	}
+
+	if _, err := parseMountInfo(strings.NewReader("garbage line\n")); err == nil {
+		t.Error("expected an error for a malformed line")
+	}
+}
+
+// fakeMounts replaces the mount table for the duration of a test.
+func fakeMounts(t *testing.T, mounts []mountInfo) {
+	t.Helper()
+	old := loadMountTable
+	loadMountTable = func() ([]mountInfo, error) { return mounts, nil }
+	t.Cleanup(func() { loadMountTable = old })
+}
+
+func TestTmpfsSeparation(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"data/big.bin": strings.Repeat("d", 3000),
+		"shm/ram.bin":  strings.Repeat("r", 5000),
+		"shm/sub/x":    strings.Repeat("x", 1000),
+	})
+	defer os.RemoveAll(tmpDir)
+	root := resolvedAbs(tmpDir)
+
+	fakeMounts(t, []mountInfo{
+		{MountPoint: "/", FSType: "ext4"},
+		{MountPoint: filepath.Join(root, "shm"), FSType: "tmpfs"},
+	})
+
+	resetResults()
+	output, err := runCaptured(t, tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run() error: %v", err)
+	}
+
+	disk, memory, found := strings.Cut(output, "Memory-backed (tmpfs/ramfs)")
+	if !found {
+		t.Fatalf("no memory-backed section in output:\n%s", output)
+	}
+	// The root only counts the 3000 bytes on disk.
+	if !strings.Contains(disk, "2.93 KiB    "+tmpDir+"\n") {
+		t.Errorf("root total should exclude tmpfs contents:\n%s", disk)
+	}
+	if strings.Contains(disk, filepath.Join(tmpDir, "shm")) {
+		t.Errorf("tmpfs entries leaked into the disk section:\n%s", disk)
+	}
+	if !strings.Contains(memory, filepath.Join(tmpDir, "shm", "ram.bin")) {
+		t.Errorf("tmpfs file missing from memory section:\n%s", memory)
+	}
+	if !strings.Contains(memory, "Memory-backed subtotal: 5.86 KiB") {
+		t.Errorf("wrong memory subtotal:\n%s", memory)
+	}
+
+	resetResults()
+	output, err = runCaptured(t, "-include-tmpfs", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run() error: %v", err)
+	}
+	if strings.Contains(output, "Memory-backed") {
+		t.Errorf("-include-tmpfs should disable the memory section:\n%s", output)
+	}
+	if !strings.Contains(output, "8.79 KiB    "+tmpDir+"\n") {
+		t.Errorf("-include-tmpfs root total should include tmpfs contents:\n%s", output)
+	}
+}
+
+func TestSymlinkedRoot(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"pool/data/big.bin":     strings.Repeat("b", 2048),
+		"pool/data/skipme/x":    strings.Repeat("x", 4096),
+		"pool/data/shm/ram.bin": strings.Repeat("r", 3072),
+	})
+	defer os.RemoveAll(tmpDir)
+	target := resolvedAbs(filepath.Join(tmpDir, "pool", "data"))
+	link := filepath.Join(tmpDir, "data")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("cannot create symlink: %v", err)
+	}
+	fakeMounts(t, []mountInfo{
+		{MountPoint: "/", FSType: "ext4"},
+		{MountPoint: filepath.Join(target, "shm"), FSType: "tmpfs"},
+	})
+
+	resetResults()
+	output, err := runCaptured(t, "-exclude=skipme", link, "1K")
+	if err != nil {
+		t.Fatalf("run() error: %v", err)
+	}
+	if !strings.Contains(output, "Scanning directory: "+target+" via symlink "+link+"\n") {
+		t.Errorf("missing symlink note:\n%s", output)
+	}
+	if !strings.Contains(output, filepath.Join(link, "big.bin")) || strings.Contains(output, filepath.Join(target, "big.bin")) {
+		t.Errorf("result paths should use the typed root:\n%s", output)
+	}
+	if strings.Contains(output, filepath.Join(link, "skipme")) {
+		t.Errorf("excluded directory listed:\n%s", output)
+	}
+	// Mount checks see the real location, so the tmpfs below the target is
+	// recognised even though the walk goes through the link.
+	if !strings.Contains(output, "Memory-backed subtotal: 3.00 KiB") {
+		t.Errorf("tmpfs below the link target was not separated:\n%s", output)
+	}
+
+	resetResults()
+	output, err = runCaptured(t, "-no-resolve-root", link, "1K")
+	if err != nil {
+		t.Fatalf("run() error: %v", err)
+	}
+	if strings.Contains(output, "via symlink") || strings.Contains(output, "Memory-backed") {
+		t.Errorf("-no-resolve-root should take the root literally:\n%s", output)
+	}
+}
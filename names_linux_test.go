@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWalkInvalidUTF8Names(t *testing.T) {
+	resetResults()
+	tmpDir := createTestDir(t, map[string]string{
+		"dir/sibling.txt": "12345",
+	})
+	defer os.RemoveAll(tmpDir)
+
+	badName := filepath.Join(tmpDir, "dir", "bad\xff\xfe.bin")
+	if err := os.WriteFile(badName, []byte("abc"), 0644); err != nil {
+		t.Skipf("filesystem rejects invalid UTF-8 names: %v", err)
+	}
+
+	total := walkDirRecursive(tmpDir, 1, map[string]struct{}{})
+	if total != 8 {
+		t.Errorf("total = %d, want 8", total)
+	}
+	if len(skippedEntries) != 0 {
+		t.Errorf("unexpected skips: %v", skippedEntries)
+	}
+
+	found := false
+	for _, res := range results {
+		if res.Path == badName {
+			found = true
+			if got := displayPath(res.Path); !strings.HasSuffix(got, `bad\xff\xfe.bin`) {
+				t.Errorf("displayPath(%q) = %q, want escaped bytes", res.Path, got)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("raw name %q missing from results %v", badName, results)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestDisplayPath(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"/data/plain.txt", "/data/plain.txt"},
+		{"/data/with space.txt", "/data/with space.txt"},
+		{"/data/ünïcödé/日本.txt", "/data/ünïcödé/日本.txt"},
+		{"/data/bad\xff\xfename", `/data/bad\xff\xfename`},
+		{"/data/new\nline", `/data/new\nline`},
+		{"/data/esc\x1b[31mred", `/data/esc\x1b[31mred`},
+		{"/data/tab\there", `/data/tab\there`},
+	}
+
+	for _, test := range tests {
+		result := displayPath(test.input)
+		if result != test.expected {
+			t.Errorf("For input %q, expected %q, got %q", test.input, test.expected, result)
+		}
+		if !utf8.ValidString(result) {
+			t.Errorf("For input %q, output %q is not valid UTF-8", test.input, result)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWalkReservedWindowsNames(t *testing.T) {
+	resetResults()
+	tmpDir := createTestDir(t, map[string]string{
+		"dir/sibling.txt": "12345",
+	})
+	defer os.RemoveAll(tmpDir)
+
+	// Names with trailing dots or spaces can only be created through the
+	// \\?\ prefix, which bypasses Win32 path normalisation.
+	for _, name := range []string{"trailing.", "trailing "} {
+		long := `\\?\` + filepath.Join(tmpDir, "dir", name)
+		if err := os.WriteFile(long, []byte("abc"), 0644); err != nil {
+			t.Skipf("cannot create reserved name %q: %v", name, err)
+		}
+	}
+
+	oldStderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	setupOutput(os.Stdout, os.Stderr)
+	total := walkDirRecursive(tmpDir, 1, map[string]struct{}{})
+	os.Stderr.Close()
+	os.Stderr = oldStderr
+	setupOutput(os.Stdout, os.Stderr)
+
+	// The sibling must be counted whatever happens to the odd names, and
+	// any name that cannot be stat'ed must be attributed to its parent.
+	dir := filepath.Join(tmpDir, "dir")
+	if total < 5 {
+		t.Errorf("total = %d, want at least the sibling's 5 bytes", total)
+	}
+	if total+uint64(3*skippedEntries[dir]) != 11 {
+		t.Errorf("total %d with %d skips does not account for every entry", total, skippedEntries[dir])
+	}
+	for d := range skippedEntries {
+		if d != dir {
+			t.Errorf("skip attributed to %s, want %s", d, dir)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ncdu collects the whole tree for -format=ncdu. Unlike the other formats
+// it holds every entry, not just those above the threshold, since ncdu
+// browses the full hierarchy. It is nil unless that format is chosen.
+var ncdu *ncduTree
+
+// ncduTree is the scanned hierarchy, filled in by the walk from many
+// goroutines and written out once it is done.
+type ncduTree struct {
+	root string
+
+	mu   sync.Mutex
+	dirs map[string]*ncduDir
+}
+
+// ncduDir is one directory of the tree.
+type ncduDir struct {
+	name      string
+	readError bool
+	files     []ncduItem
+	dirs      []*ncduDir
+}
+
+// ncduItem is the info object of an entry in ncdu's export format. Sizes
+// are the apparent sizes spacehogs counts, so dsize equals asize.
+type ncduItem struct {
+	Name     string `json:"name"`
+	ASize    uint64 `json:"asize,omitempty"`
+	DSize    uint64 `json:"dsize,omitempty"`
+	ReadErr  bool   `json:"read_error,omitempty"`
+	Excluded string `json:"excluded,omitempty"`
+}
+
+// ncduMeta is the header object of an export.
+type ncduMeta struct {
+	Progname  string `json:"progname"`
+	Progver   string `json:"progver"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// newNcduTree returns an empty tree for a scan of root.
+func newNcduTree(root string) *ncduTree {
+	return &ncduTree{root: root, dirs: map[string]*ncduDir{root: {name: root}}}
+}
+
+// addDir records a directory as its parent schedules it, so the parent
+// is always known.
+func (t *ncduTree) addDir(path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d := &ncduDir{name: filepath.Base(path)}
+	t.dirs[path] = d
+	if parent := t.dirs[filepath.Dir(path)]; parent != nil {
+		parent.dirs = append(parent.dirs, d)
+	}
+}
+
+// addFile records a file in the directory dir.
+func (t *ncduTree) addFile(dir, name string, size uint64) {
+	t.addItem(dir, ncduItem{Name: name, ASize: size, DSize: size})
+}
+
+// addExcluded records an entry of dir kept out of the scan, for reason
+// "pattern" (-exclude) or "otherfs" (a skipped mount).
+func (t *ncduTree) addExcluded(dir, name, reason string) {
+	t.addItem(dir, ncduItem{Name: name, Excluded: reason})
+}
+
+func (t *ncduTree) addItem(dir string, it ncduItem) {
+	t.mu.Lock()
+	if d := t.dirs[dir]; d != nil {
+		d.files = append(d.files, it)
+	}
+	t.mu.Unlock()
+}
+
+// markError flags a directory that could not be read in full.
+func (t *ncduTree) markError(path string) {
+	t.mu.Lock()
+	if d := t.dirs[path]; d != nil {
+		d.readError = true
+	}
+	t.mu.Unlock()
+}
+
+// write emits the tree in ncdu's JSON export format, version 1.0:
+// [1, 0, meta, dir], where a directory is an array of its info object
+// followed by its entries. Entries are sorted by name. The caller must not
+// call it before the walk is over.
+func (t *ncduTree) write(w io.Writer, now time.Time) error {
+	bw := bufio.NewWriter(w)
+	meta, err := json.Marshal(ncduMeta{Progname: "spacehogs", Progver: "1.0", Timestamp: now.Unix()})
+	if err != nil {
+		return err
+	}
+	bw.WriteString("[1,0,")
+	bw.Write(meta)
+	bw.WriteString(",\n")
+	if err := t.writeDir(bw, t.dirs[t.root]); err != nil {
+		return err
+	}
+	bw.WriteString("]\n")
+	return bw.Flush()
+}
+
+func (t *ncduTree) writeDir(bw *bufio.Writer, d *ncduDir) error {
+	info, err := json.Marshal(ncduItem{Name: d.name, ReadErr: d.readError})
+	if err != nil {
+		return err
+	}
+	bw.WriteByte('[')
+	bw.Write(info)
+	sort.Slice(d.files, func(i, j int) bool { return d.files[i].Name < d.files[j].Name })
+	for _, f := range d.files {
+		line, err := json.Marshal(f)
+		if err != nil {
+			return err
+		}
+		bw.WriteString(",\n")
+		bw.Write(line)
+	}
+	sort.Slice(d.dirs, func(i, j int) bool { return d.dirs[i].name < d.dirs[j].name })
+	for _, sub := range d.dirs {
+		bw.WriteString(",\n")
+		if err := t.writeDir(bw, sub); err != nil {
+			return err
+		}
+	}
+	bw.WriteByte(']')
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// ncduEntries checks that raw is a directory in ncdu's export format and
+// returns its entries as "path size" lines, directories ending in a slash.
+func ncduEntries(t *testing.T, raw json.RawMessage, prefix string) []string {
+	t.Helper()
+	var dir []json.RawMessage
+	if err := json.Unmarshal(raw, &dir); err != nil || len(dir) == 0 {
+		t.Fatalf("%s: not a directory array: %s", prefix, raw)
+	}
+	var info ncduItem
+	if err := json.Unmarshal(dir[0], &info); err != nil || info.Name == "" {
+		t.Fatalf("%s: bad directory info %s", prefix, dir[0])
+	}
+	name := prefix + info.Name + "/"
+	lines := []string{name}
+	for _, e := range dir[1:] {
+		if strings.HasPrefix(string(e), "[") {
+			lines = append(lines, ncduEntries(t, e, name)...)
+			continue
+		}
+		var it ncduItem
+		if err := json.Unmarshal(e, &it); err != nil || it.Name == "" {
+			t.Fatalf("%s: bad entry %s", name, e)
+		}
+		if it.Excluded != "" {
+			lines = append(lines, fmt.Sprintf("%s%s excluded", name, it.Name))
+			continue
+		}
+		if it.ASize != it.DSize {
+			t.Errorf("%s%s: asize %d, dsize %d", name, it.Name, it.ASize, it.DSize)
+		}
+		lines = append(lines, fmt.Sprintf("%s%s %d", name, it.Name, it.ASize))
+	}
+	return lines
+}
+
+func TestRunNcduFormat(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"a/big.bin":       strings.Repeat("x", 2000),
+		"a/b/small":       "xy",
+		"empty.txt":       "",
+		"skip/hidden.bin": strings.Repeat("x", 5000),
+	})
+	defer os.RemoveAll(tmpDir)
+
+	fakeMounts(t, nil)
+	resetResults()
+	out, err := runCaptured(t, "-format=ncdu", "-exclude=skip", tmpDir, "1G")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+
+	var top []json.RawMessage
+	if err := json.Unmarshal([]byte(out), &top); err != nil {
+		t.Fatalf("output is not a JSON array: %v\n%s", err, out)
+	}
+	if len(top) != 4 || string(top[0]) != "1" || string(top[1]) != "0" {
+		t.Fatalf("header = %.40s, want [1,0,meta,tree]", out)
+	}
+	var meta ncduMeta
+	if err := json.Unmarshal(top[2], &meta); err != nil || meta.Progname != "spacehogs" || meta.Timestamp == 0 {
+		t.Errorf("meta = %s", top[2])
+	}
+
+	got := ncduEntries(t, top[3], "")
+	root := tmpDir + "/"
+	want := []string{
+		root,
+		root + "empty.txt 0",
+		root + "skip excluded",
+		root + "a/",
+		root + "a/big.bin 2000",
+		root + "a/b/",
+		root + "a/b/small 2",
+	}
+	sort.Strings(got)
+	sort.Strings(want)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("tree:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestNcduRejectsListing(t *testing.T) {
+	if _, err := runCaptured(t, "-format=ncdu", "-from-listing=x.lst", ".", "1G"); err == nil || !strings.Contains(err.Error(), "-from-listing") {
+		t.Errorf("error = %v, want a -from-listing error", err)
+	}
+}
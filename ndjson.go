@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// resultStream receives each result as soon as it is found, instead of the
+// results slice, when -format=ndjson is given. It is guarded by
+// resultsMutex, like the slice it replaces.
+var resultStream *ndjsonStream
+
+// ndjsonEntry is one result line of -format=ndjson output.
+type ndjsonEntry struct {
+	Type         string `json:"type"`
+	Path         string `json:"path"`
+	Size         uint64 `json:"size"`
+	IsDir        bool   `json:"is_dir"`
+	MemoryBacked bool   `json:"memory_backed,omitempty"`
+	LinkTarget   string `json:"link_target,omitempty"`
+	// UniqueSize and SharedSize are as in jsonEntry (-link-stats).
+	UniqueSize *uint64 `json:"unique_size,omitempty"`
+	SharedSize *uint64 `json:"shared_size,omitempty"`
+	// OpenBy is as in jsonEntry (-check-open).
+	OpenBy []fileUser `json:"open_by,omitempty"`
+	Time   string     `json:"time"`
+}
+
+// ndjsonError is a line of -format=ndjson output for an entry the walk
+// could not read, written as the walk meets it.
+type ndjsonError struct {
+	Type string `json:"type"`
+	scanError
+	Time string `json:"time"`
+}
+
+// ndjsonSummary is the line that closes a -format=ndjson stream.
+type ndjsonSummary struct {
+	Type    string `json:"type"`
+	Root    string `json:"root"`
+	Total   uint64 `json:"total"`
+	Entries int    `json:"entries"`
+	Time    string `json:"time"`
+	// SchemaVersion is jsonSchemaVersion. ErrorCount is the number of
+	// error lines before the summary; sizes below those paths are lower
+	// bounds.
+	SchemaVersion string `json:"schema_version"`
+	ErrorCount    int    `json:"error_count"`
+
+	CanonicalPaths bool `json:"canonical_paths,omitempty"`
+	// Truncated marks a stream cut short, by Reason: the entries before
+	// it were found, but the scan did not finish and Total is partial.
+	Truncated bool   `json:"truncated,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// ndjsonStream writes results as newline-delimited JSON. Each line goes
+// out in a single Write, so it cannot interleave with other output.
+type ndjsonStream struct {
+	w io.Writer
+	// keep applies the per-entry filters that would otherwise run over
+	// the finished result list.
+	keep func(FileInfo) bool
+	// rootInMemory marks every entry memory-backed.
+	rootInMemory bool
+	// canonicalRoot, when set, makes entry paths relative to it with
+	// forward slashes (-canonical-paths).
+	canonicalRoot string
+	// openBy maps absolute paths to the processes holding them open
+	// (-check-open).
+	openBy map[string][]fileUser
+	now    func() time.Time
+
+	entries, errors int
+	err             error
+}
+
+// newNDJSONStream returns a stream writing to w.
+func newNDJSONStream(w io.Writer, keep func(FileInfo) bool) *ndjsonStream {
+	return &ndjsonStream{w: w, keep: keep, now: time.Now}
+}
+
+// emit writes one result. The caller holds resultsMutex.
+func (s *ndjsonStream) emit(res FileInfo) {
+	if s.keep != nil && !s.keep(res) {
+		return
+	}
+	s.entries++
+	path := res.Path
+	if s.canonicalRoot != "" {
+		path = canonicalPath(s.canonicalRoot, path)
+	}
+	unique, shared := linkSizes(res)
+	var openBy []fileUser
+	if s.openBy != nil && !res.IsDir {
+		openBy = s.openBy[resolvedAbs(res.Path)]
+	}
+	s.writeLine(ndjsonEntry{
+		Type:         "entry",
+		Path:         path,
+		Size:         res.Size,
+		IsDir:        res.IsDir,
+		MemoryBacked: s.rootInMemory || underMemoryMount(res.Path),
+		LinkTarget:   res.LinkTarget,
+		UniqueSize:   unique,
+		SharedSize:   shared,
+		OpenBy:       openBy,
+		Time:         s.now().UTC().Format(time.RFC3339Nano),
+	})
+}
+
+// emitError writes one read error. The caller holds resultsMutex.
+func (s *ndjsonStream) emitError(e scanError) {
+	s.errors++
+	if s.canonicalRoot != "" {
+		e.Path = canonicalPath(s.canonicalRoot, e.Path)
+	}
+	s.writeLine(ndjsonError{Type: "error", scanError: e, Time: s.now().UTC().Format(time.RFC3339Nano)})
+}
+
+// finish closes the stream with the summary line and reports the first
+// write error, if any.
+func (s *ndjsonStream) finish(root string, total uint64) error {
+	resultsMutex.Lock()
+	defer resultsMutex.Unlock()
+	s.writeLine(s.summary(root, total))
+	return s.err
+}
+
+// abort closes a stream whose scan failed with err, so that a consumer
+// reading to the summary line sees the cut rather than a stream that
+// just stops.
+func (s *ndjsonStream) abort(root string, total uint64, err error) {
+	resultsMutex.Lock()
+	defer resultsMutex.Unlock()
+	sum := s.summary(root, total)
+	sum.Truncated, sum.Reason = true, strings.TrimPrefix(err.Error(), "error: ")
+	s.writeLine(sum)
+}
+
+func (s *ndjsonStream) summary(root string, total uint64) ndjsonSummary {
+	return ndjsonSummary{
+		Type:    "summary",
+		Root:    root,
+		Total:   total,
+		Entries: s.entries,
+		Time:    s.now().UTC().Format(time.RFC3339Nano),
+
+		SchemaVersion: jsonSchemaVersion,
+		ErrorCount:    s.errors,
+
+		CanonicalPaths: s.canonicalRoot != "",
+	}
+}
+
+// writeLine encodes v as one line. After the first error nothing more is
+// written.
+func (s *ndjsonStream) writeLine(v any) {
+	if s.err != nil {
+		return
+	}
+	line, err := json.Marshal(v)
+	if err != nil {
+		s.err = err
+		return
+	}
+	if _, err := s.w.Write(append(line, '\n')); err != nil {
+		s.err = fmt.Errorf("writing results: %v", err)
+	}
+}
+
+// underMemoryMount reports whether path lies in one of the memory-backed
+// mounts below the scan root. Unlike isMemoryBacked it does not need the
+// walk to have finished those subtrees, so streamed entries can be marked
+// as they are found.
+func underMemoryMount(path string) bool {
+	for mount := range memoryMounts {
+		if pathWithin(path, mount) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestRunNDJSONStreamsEveryResult(t *testing.T) {
+	files := make(map[string]string)
+	for i := 0; i < 30; i++ {
+		for j := 0; j < 10; j++ {
+			files[fmt.Sprintf("d%02d/f%d", i, j)] = strings.Repeat("x", 10+j)
+		}
+	}
+	tmpDir := createTestDir(t, files)
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+
+	resetResults()
+	out, err := runCaptured(t, "-format=json", tmpDir, "15B")
+	if err != nil {
+		t.Fatalf("json run failed: %v", err)
+	}
+	var doc jsonReport
+	if err := json.Unmarshal([]byte(out), &doc); err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, e := range doc.Entries {
+		want = append(want, fmt.Sprintf("%s %d %v", e.Path, e.Size, e.IsDir))
+	}
+	sort.Strings(want)
+
+	resetResults()
+	out, err = runCaptured(t, "-format=ndjson", tmpDir, "15B")
+	if err != nil {
+		t.Fatalf("ndjson run failed: %v", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("%d results were collected in ndjson mode", len(results))
+	}
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	var got []string
+	for i, line := range lines[:len(lines)-1] {
+		var e ndjsonEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil || e.Type != "entry" || e.Time == "" {
+			t.Fatalf("line %d is not a complete entry (%v): %q", i+1, err, line)
+		}
+		got = append(got, fmt.Sprintf("%s %d %v", e.Path, e.Size, e.IsDir))
+	}
+	sort.Strings(got)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("streamed entries differ from -format=json:\n got %v\nwant %v", got, want)
+	}
+
+	var sum ndjsonSummary
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &sum); err != nil || sum.Type != "summary" {
+		t.Fatalf("last line is not a summary (%v): %q", err, lines[len(lines)-1])
+	}
+	if sum.Entries != len(got) || sum.Total != doc.Total || sum.Root != tmpDir {
+		t.Errorf("summary = %+v, want %d entries and total %d", sum, len(got), doc.Total)
+	}
+}
+
+func TestNDJSONAppliesEntryFilters(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"busy/a": "x", "busy/b": "x", "busy/c": "x",
+		"lone/a": "x",
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+
+	resetResults()
+	out, err := runCaptured(t, "-format=ndjson", "-min-files=2", tmpDir, "1B")
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if strings.Contains(out, `lone"`) {
+		t.Errorf("directory below -min-files was streamed:\n%s", out)
+	}
+	if !strings.Contains(out, `busy"`) {
+		t.Errorf("directory meeting -min-files is missing:\n%s", out)
+	}
+}
+
+func TestNDJSONRejectsListFlags(t *testing.T) {
+	_, err := runCaptured(t, "-format=ndjson", "-find-logs", ".", "1G")
+	if err == nil || !strings.Contains(err.Error(), "-find-logs needs the full result list") {
+		t.Errorf("error = %v, want -find-logs to be rejected", err)
+	}
+}
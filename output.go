@@ -0,0 +1,138 @@
+package main
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// stdout and stderr are the destinations all output goes through. Each
+// serializes its writes, so lines written from concurrent walk goroutines
+// never interleave mid-line.
+var (
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
+)
+
+// clearLine returns the cursor to the start of the line and erases it.
+const clearLine = "\r\033[K"
+
+// outputSink is one underlying destination. Writers to the same file share
+// a sink and therefore its lock.
+type outputSink struct {
+	mu sync.Mutex
+
+	// status is the transient line (the -progress display) currently shown
+	// at the bottom of a terminal, drawn on statusW. Other writes clear it
+	// first and redraw it after, so it never merges with real output.
+	status  string
+	statusW io.Writer
+	tty     bool
+}
+
+// lockedWriter serializes writes to w through its sink.
+type lockedWriter struct {
+	sink *outputSink
+	w    io.Writer
+	tty  bool // w is a terminal
+}
+
+// Write implements io.Writer.
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	s := l.sink
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status != "" {
+		io.WriteString(s.statusW, clearLine)
+	}
+	n, err := l.w.Write(p)
+	if s.status != "" && len(p) > 0 && p[len(p)-1] == '\n' {
+		io.WriteString(s.statusW, s.status)
+	}
+	return n, err
+}
+
+// statusSink is the sink of stderr, where transient status is drawn.
+var statusSink = &outputSink{statusW: os.Stderr}
+
+// newOutputs wraps out and errOut in locked writers. If shared is set, both
+// use one sink, as needed when they refer to the same underlying file.
+func newOutputs(out, errOut io.Writer, shared bool) (io.Writer, io.Writer) {
+	outSink := &outputSink{statusW: errOut}
+	errSink := outSink
+	if !shared {
+		errSink = &outputSink{statusW: errOut}
+	}
+	statusSink = errSink
+	return &lockedWriter{sink: outSink, w: out}, &lockedWriter{sink: errSink, w: errOut}
+}
+
+// setupOutput installs synchronized writers for the given files, detecting
+// when they are the same file (e.g. "2>&1" redirections) so that writes to
+// either go through a single lock.
+func setupOutput(out, errOut *os.File) {
+	stdout, stderr = newOutputs(out, errOut, sameFile(out, errOut))
+	stdout.(*lockedWriter).tty = isTerminal(out)
+	statusSink.tty = isTerminal(errOut)
+}
+
+// writerIsTerminal reports whether w writes to a terminal.
+func writerIsTerminal(w io.Writer) bool {
+	lw, ok := w.(*lockedWriter)
+	return ok && lw.tty
+}
+
+// stdoutIsTerminal reports whether stdout is a terminal, which decides
+// whether -q is implied. It is a variable so that tests, whose output is
+// a pipe, can still see the full report.
+var stdoutIsTerminal = func() bool { return writerIsTerminal(stdout) }
+
+// setStatus shows text as the transient status line. On a terminal it
+// replaces the previous status in place; elsewhere, where control
+// characters would end up in a file, it is written as an ordinary line.
+func setStatus(text string) {
+	s := statusSink
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.tty {
+		io.WriteString(s.statusW, text+"\n")
+		return
+	}
+	io.WriteString(s.statusW, clearLine+text)
+	s.status = text
+}
+
+// clearStatus removes the transient status line.
+func clearStatus() {
+	s := statusSink
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status != "" {
+		io.WriteString(s.statusW, clearLine)
+		s.status = ""
+	}
+}
+
+// isTerminal reports whether f is a character device such as a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// sameFile reports whether a and b refer to the same file. os.SameFile
+// compares device and inode on Unix and volume serial and file index on
+// Windows.
+func sameFile(a, b *os.File) bool {
+	if a == b {
+		return true
+	}
+	ai, err := a.Stat()
+	if err != nil {
+		return false
+	}
+	bi, err := b.Stat()
+	if err != nil {
+		return false
+	}
+	return os.SameFile(ai, bi)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSameFile(t *testing.T) {
+	r1, w1, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	defer r1.Close()
+	defer w1.Close()
+	r2, w2, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	defer r2.Close()
+	defer w2.Close()
+
+	if !sameFile(w1, w1) {
+		t.Error("a pipe is not the same file as itself")
+	}
+	if sameFile(w1, w2) {
+		t.Error("two distinct pipes reported as the same file")
+	}
+}
+
+// TestSharedOutputLinesIntact drives many concurrent walk goroutines that all
+// report errors into one shared buffer for stdout and stderr, and checks that
+// no line is torn or interleaved with another.
+func TestIsTerminalPipe(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	if isTerminal(r) || isTerminal(w) {
+		t.Error("pipe reported as a terminal")
+	}
+	f, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if isTerminal(f) {
+		t.Error("regular file reported as a terminal")
+	}
+
+	setupOutput(w, w)
+	defer setupOutput(os.Stdout, os.Stderr)
+	if stdoutIsTerminal() {
+		t.Error("stdout on a pipe reported as a terminal")
+	}
+}
+
+func TestSharedOutputLinesIntact(t *testing.T) {
+	resetResults()
+	files := map[string]string{}
+	for i := 0; i < 40; i++ {
+		for j := 0; j < 25; j++ {
+			files[fmt.Sprintf("d%02d/f%02d.txt", i, j)] = "x"
+		}
+	}
+	tmpDir := createTestDir(t, files)
+	defer os.RemoveAll(tmpDir)
+
+	oldInfo := entryInfo
+	entryInfo = func(e fs.DirEntry) (fs.FileInfo, error) {
+		if !e.IsDir() {
+			return nil, errors.New("injected failure")
+		}
+		return e.Info()
+	}
+	defer func() { entryInfo = oldInfo }()
+
+	var buf bytes.Buffer
+	stdout, stderr = newOutputs(&buf, &buf, true)
+	defer setupOutput(os.Stdout, os.Stderr)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				fmt.Fprintf(stdout, "%s %-10s  %s\n", "FILE", "1 B", "progress")
+			}
+		}
+	}()
+	walkDirRecursive(tmpDir, 1, map[string]struct{}{})
+	close(stop)
+	<-done
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	var errLines int
+	for _, line := range lines {
+		switch {
+		case line == "FILE 1 B         progress":
+		case strings.HasPrefix(line, "Error getting info for "+tmpDir+string(filepath.Separator)) &&
+			strings.HasSuffix(line, ".txt: injected failure") &&
+			strings.Count(line, "Error") == 1:
+			errLines++
+		default:
+			t.Fatalf("torn or interleaved output line: %q", line)
+		}
+	}
+	if errLines != 1000 {
+		t.Errorf("got %d error lines, want 1000", errLines)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeFileInfo is an fs.FileInfo with a fabricated size.
+type fakeFileInfo struct {
+	name string
+	size int64
+}
+
+func (f fakeFileInfo) Name() string       { return f.name }
+func (f fakeFileInfo) Size() int64        { return f.size }
+func (f fakeFileInfo) Mode() fs.FileMode  { return 0644 }
+func (f fakeFileInfo) ModTime() time.Time { return time.Unix(0, 0) }
+func (f fakeFileInfo) IsDir() bool        { return false }
+func (f fakeFileInfo) Sys() any           { return nil }
+
+func TestAddSize(t *testing.T) {
+	tests := []struct {
+		a, b     uint64
+		expected uint64
+		overflow bool
+	}{
+		{0, 0, 0, false},
+		{1, 2, 3, false},
+		{math.MaxUint64 - 1, 1, math.MaxUint64, false},
+		{math.MaxUint64, 1, math.MaxUint64, true},
+		{math.MaxUint64 / 2, math.MaxUint64/2 + 2, math.MaxUint64, true},
+	}
+	for _, test := range tests {
+		sizeOverflowed.Store(false)
+		if got := addSize(test.a, test.b); got != test.expected {
+			t.Errorf("addSize(%d, %d) = %d, want %d", test.a, test.b, got, test.expected)
+		}
+		if sizeOverflowed.Load() != test.overflow {
+			t.Errorf("addSize(%d, %d) overflow = %v, want %v", test.a, test.b, sizeOverflowed.Load(), test.overflow)
+		}
+	}
+	sizeOverflowed.Store(false)
+}
+
+func TestHumanReadableSizeNearLimit(t *testing.T) {
+	if got := humanReadableSize(math.MaxUint64); got != "16.00 EiB" {
+		t.Errorf("humanReadableSize(MaxUint64) = %q, want %q", got, "16.00 EiB")
+	}
+	if got := humanReadableSize(1 << 62); got != "4.00 EiB" {
+		t.Errorf("humanReadableSize(2^62) = %q, want %q", got, "4.00 EiB")
+	}
+}
+
+func TestParseSizeRejectsOutOfRange(t *testing.T) {
+	if _, err := parseSize("20000000T"); err == nil {
+		t.Error("expected an error for a size beyond 16 EiB")
+	}
+}
+
+// withFabricatedSizes makes every file in the walk report the given size.
+func withFabricatedSizes(t *testing.T, size int64) {
+	t.Helper()
+	old := entryInfo
+	entryInfo = func(e fs.DirEntry) (fs.FileInfo, error) {
+		return fakeFileInfo{name: e.Name(), size: size}, nil
+	}
+	t.Cleanup(func() { entryInfo = old })
+}
+
+func TestWalkSizesNearUint64Max(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{"a": "", "sub/b": ""})
+	defer os.RemoveAll(tmpDir)
+	withFabricatedSizes(t, math.MaxInt64)
+
+	resetResults()
+	sizeOverflowed.Store(false)
+	total := walkDirRecursive(tmpDir, 1, map[string]struct{}{})
+	if total != 2*math.MaxInt64 || sizeOverflowed.Load() {
+		t.Errorf("two maximal files: total = %d, overflow = %v", total, sizeOverflowed.Load())
+	}
+}
+
+func TestRunReportsNegativeSize(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{"a": ""})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+	withFabricatedSizes(t, -1)
+
+	report := filepath.Join(t.TempDir(), "report.json")
+
+	resetResults()
+	if out, err := runCaptured(t, "-format=json", "-o", report, tmpDir, "1"); err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rep jsonReport
+	if err := json.Unmarshal(data, &rep); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, data)
+	}
+	if len(rep.Errors) != 1 || rep.Errors[0].Path != filepath.Join(tmpDir, "a") || rep.Errors[0].Op != "stat" {
+		t.Errorf("errors = %+v, want the negative size of a", rep.Errors)
+	}
+
+	// It is an error of class other, which -fatal-errors can stop on.
+	resetResults()
+	if _, err := runCaptured(t, "-fatal-errors=other", tmpDir, "1"); exitCode(err) != exitFatalError {
+		t.Errorf("-fatal-errors=other: exit code %d (%v), want %d", exitCode(err), err, exitFatalError)
+	}
+}
+
+func TestRunReportsSizeOverflow(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{"a": "", "b": "", "sub/c": ""})
+	defer os.RemoveAll(tmpDir)
+	withFabricatedSizes(t, math.MaxInt64)
+
+	resetResults()
+	_, err := runCaptured(t, tmpDir, "1")
+	if !errors.Is(err, errSizeOverflow) {
+		t.Errorf("run() error = %v, want %v", err, errSizeOverflow)
+	}
+}
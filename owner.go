@@ -0,0 +1,106 @@
+package main
+
+import "os/user"
+
+// entryOwner is the user and group owning an entry, for -show-owner and
+// the owner and group columns.
+type entryOwner struct {
+	// UID and GID are the numeric ids: decimal on Unix, SIDs on Windows.
+	UID string `json:"uid"`
+	GID string `json:"gid"`
+	// User and Group are the names the ids resolve to, empty when the
+	// lookup fails.
+	User  string `json:"user,omitempty"`
+	Group string `json:"group,omitempty"`
+}
+
+// userLabel is the owner column's text: the user name, or the uid when
+// it has none.
+func (o *entryOwner) userLabel() string {
+	if o.User != "" {
+		return o.User
+	}
+	return o.UID
+}
+
+// groupLabel is the group column's text, falling back to the gid.
+func (o *entryOwner) groupLabel() string {
+	if o.Group != "" {
+		return o.Group
+	}
+	return o.GID
+}
+
+// ownerResolver maps numeric owner ids to names. The real implementation
+// asks the system user database through os/user; tests substitute a fake.
+type ownerResolver interface {
+	userName(uid string) (string, error)
+	groupName(gid string) (string, error)
+}
+
+// userDatabase is the os/user resolver.
+type userDatabase struct{}
+
+func (userDatabase) userName(uid string) (string, error) {
+	u, err := user.LookupId(uid)
+	if err != nil {
+		return "", err
+	}
+	return u.Username, nil
+}
+
+func (userDatabase) groupName(gid string) (string, error) {
+	g, err := user.LookupGroupId(gid)
+	if err != nil {
+		return "", err
+	}
+	return g.Name, nil
+}
+
+// loadOwnerResolver returns the resolver to use. It is a variable so
+// tests can substitute a fake.
+var loadOwnerResolver = func() ownerResolver { return userDatabase{} }
+
+// ownerIndex fills in the owners of listed entries, looking each id up
+// once: a listing of thousands of entries owned by a handful of users
+// should not ask NSS thousands of times. It is nil unless -show-owner or
+// an owner or group column is given, and is used from one goroutine.
+type ownerIndex struct {
+	resolver      ownerResolver
+	users, groups map[string]string
+}
+
+// owners is the active index, if any.
+var owners *ownerIndex
+
+func newOwnerIndex(r ownerResolver) *ownerIndex {
+	return &ownerIndex{resolver: r, users: make(map[string]string), groups: make(map[string]string)}
+}
+
+// cachedName returns the name of id from cache, looking it up the first
+// time. A failed lookup is cached as "".
+func cachedName(cache map[string]string, id string, lookup func(string) (string, error)) string {
+	name, ok := cache[id]
+	if !ok {
+		name, _ = lookup(id)
+		cache[id] = name
+	}
+	return name
+}
+
+// annotate fills in the owner of each listed entry. Entries that can no
+// longer be read, or whose platform has no owner ids, are left blank.
+func (o *ownerIndex) annotate(list []FileInfo) {
+	for i := range list {
+		uid, gid, err := fileOwnerIDs(list[i].Path)
+		if err != nil {
+			continue
+		}
+		list[i].Owner = &entryOwner{
+			UID:   uid,
+			GID:   gid,
+			User:  cachedName(o.users, uid, o.resolver.userName),
+			Group: cachedName(o.groups, gid, o.resolver.groupName),
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix && !windows
+
+package main
+
+import "errors"
+
+// fileOwnerIDs reports no owner: the platform has no owner ids.
+func fileOwnerIDs(path string) (uid, gid string, err error) {
+	return "", "", errors.New("owner ids are not supported on this platform")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeOwners names every uid "user-<uid>", knows no groups and counts its
+// lookups.
+type fakeOwners struct {
+	calls map[string]int
+}
+
+func (r *fakeOwners) userName(uid string) (string, error) {
+	r.calls["u"+uid]++
+	return "user-" + uid, nil
+}
+
+func (r *fakeOwners) groupName(gid string) (string, error) {
+	r.calls["g"+gid]++
+	return "", errors.New("unknown group")
+}
+
+func TestShowOwner(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"a/big":   strings.Repeat("x", 3000),
+		"a/small": strings.Repeat("x", 10),
+		"b":       strings.Repeat("x", 2000),
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+	fake := &fakeOwners{calls: make(map[string]int)}
+	old := loadOwnerResolver
+	loadOwnerResolver = func() ownerResolver { return fake }
+	defer func() { loadOwnerResolver = old }()
+
+	resetResults()
+	out, err := runCaptured(t, "-show-owner", "-format=json", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	var rep jsonReport
+	if err := json.Unmarshal([]byte(out), &rep); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if len(rep.Entries) != 4 {
+		t.Fatalf("got %d entries, want 4:\n%s", len(rep.Entries), out)
+	}
+	var own *entryOwner
+	for _, e := range rep.Entries {
+		if o := e.Owner; o == nil || o.UID == "" || o.GID == "" || o.User != "user-"+o.UID || o.Group != "" {
+			t.Errorf("owner of %s = %+v", e.Path, e.Owner)
+		}
+		own = e.Owner
+	}
+	for id, n := range fake.calls {
+		if n != 1 {
+			t.Errorf("id %s looked up %d times, want once", id, n)
+		}
+	}
+	if own == nil {
+		return
+	}
+
+	// The group has no name, so the column falls back to the gid.
+	resetResults()
+	out, err = runCaptured(t, "-columns=owner,group,path", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("text run: %v\n%s", err, out)
+	}
+	row := own.userLabel()
+	row += strings.Repeat(" ", max(10-len(row), 0)+2) + own.GID
+	if !strings.Contains(out, row) || !strings.Contains(out, filepath.Join(tmpDir, "a", "big")) {
+		t.Errorf("listing without owner %q and gid %q:\n%s", own.userLabel(), own.GID, out)
+	}
+
+	if _, err := runCaptured(t, "-show-owner", "-format=xml", tmpDir, "1K"); err == nil {
+		t.Error("-show-owner accepted with -format=xml")
+	}
+}
@@ -0,0 +1,42 @@
+//go:build windows
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var procGetNamedSecurityInfoW = syscall.NewLazyDLL("advapi32.dll").NewProc("GetNamedSecurityInfoW")
+
+// Arguments of GetNamedSecurityInfoW.
+const (
+	seFileObject             = 1
+	ownerSecurityInformation = 0x1
+	groupSecurityInformation = 0x2
+)
+
+// fileOwnerIDs returns the SIDs of the owner and primary group in path's
+// security descriptor.
+func fileOwnerIDs(path string) (uid, gid string, err error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return "", "", err
+	}
+	var owner, group *syscall.SID
+	var sd syscall.Handle
+	r, _, _ := procGetNamedSecurityInfoW.Call(uintptr(unsafe.Pointer(p)), seFileObject,
+		ownerSecurityInformation|groupSecurityInformation,
+		uintptr(unsafe.Pointer(&owner)), uintptr(unsafe.Pointer(&group)), 0, 0, uintptr(unsafe.Pointer(&sd)))
+	if r != 0 {
+		return "", "", syscall.Errno(r)
+	}
+	defer syscall.LocalFree(sd)
+	if uid, err = owner.String(); err != nil {
+		return "", "", err
+	}
+	if gid, err = group.String(); err != nil {
+		return "", "", err
+	}
+	return uid, gid, nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// memSample is the part of /proc/meminfo a scan moves, in bytes: the page
+// cache, and the buffers and reclaimable slab that hold the filesystem
+// metadata a walk reads.
+type memSample struct {
+	Cached, Buffers, SReclaimable uint64
+}
+
+// parseMeminfo reads the fields of memSample from the /proc/meminfo
+// format. It fails when Cached is missing, as it is in no meminfo.
+func parseMeminfo(r io.Reader) (memSample, error) {
+	var m memSample
+	fields := map[string]*uint64{"Cached": &m.Cached, "Buffers": &m.Buffers, "SReclaimable": &m.SReclaimable}
+	seen := false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		name, rest, ok := strings.Cut(scanner.Text(), ":")
+		dst := fields[name]
+		if !ok || dst == nil {
+			continue
+		}
+		value := strings.Fields(rest)
+		if len(value) == 0 {
+			continue
+		}
+		n, err := strconv.ParseUint(value[0], 10, 64)
+		if err != nil {
+			return memSample{}, fmt.Errorf("meminfo %s: %v", name, err)
+		}
+		if len(value) > 1 && value[1] == "kB" {
+			n *= 1024
+		}
+		*dst = n
+		seen = seen || name == "Cached"
+	}
+	if err := scanner.Err(); err != nil {
+		return memSample{}, err
+	}
+	if !seen {
+		return memSample{}, errors.New("meminfo has no Cached line")
+	}
+	return m, nil
+}
+
+// cacheProber reads the state of the page cache. The real implementation
+// uses /proc/meminfo and mincore; tests substitute a fake.
+type cacheProber interface {
+	// sampleMemory returns the system-wide cache figures.
+	sampleMemory() (memSample, error)
+	// residentBytes estimates how much of the file at path, of the given
+	// size, is in the page cache. It only reads.
+	residentBytes(path string, size uint64) (uint64, error)
+}
+
+// errCacheUnsupported is returned when the platform has no page cache
+// figures to read.
+var errCacheUnsupported = errors.New("page cache reporting is only supported on Linux")
+
+// loadCacheProber returns the platform prober. It is a variable so tests
+// can substitute a fake.
+var loadCacheProber = newCacheProber
+
+// maxCacheProbes bounds the number of files -peek-cache looks at.
+const maxCacheProbes = 10000
+
+// Bytes of metadata cache growth per walked entry below which a scan is
+// rated warm, and at or above which it is rated cold. A dentry and an
+// inode take several hundred bytes of slab, so a cold walk adds them for
+// nearly every entry.
+const (
+	warmMetadataPerEntry = 64
+	coldMetadataPerEntry = 512
+)
+
+// cacheReport measures the page cache around a scan (-cache-report) and,
+// with -peek-cache, how much of the listed files it already held.
+type cacheReport struct {
+	prober        cacheProber
+	before, after memSample
+	err           error // why a sample could not be taken
+	entries       uint64
+
+	// files, probed and warm sum the probed files, their sizes and their
+	// estimated cached bytes.
+	files        int
+	probed, warm uint64
+	peek         bool
+}
+
+// startCacheReport samples the cache before the walk.
+func startCacheReport(p cacheProber, peek bool) *cacheReport {
+	c := &cacheReport{prober: p, peek: peek}
+	c.before, c.err = p.sampleMemory()
+	return c
+}
+
+// finish samples the cache after a walk of st.
+func (c *cacheReport) finish(st subtreeStats) {
+	c.entries = st.Files + st.Dirs
+	if c.err == nil {
+		c.after, c.err = c.prober.sampleMemory()
+	}
+}
+
+// probe estimates the cached bytes of each listed file, up to
+// maxCacheProbes of them. Directories are not probed.
+func (c *cacheReport) probe(list []FileInfo) {
+	for i := range list {
+		if list[i].IsDir || c.files >= maxCacheProbes {
+			continue
+		}
+		warm, err := c.prober.residentBytes(list[i].Path, list[i].Size)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error probing page cache of %s: %v\n", displayPath(list[i].Path), err)
+			continue
+		}
+		list[i].Cached, list[i].CacheProbed = min(warm, list[i].Size), true
+		c.files++
+		c.probed += list[i].Size
+		c.warm += list[i].Cached
+	}
+}
+
+// metadataRating rates the walk cold, warm or mixed by how much the
+// metadata caches grew per entry. Caches that shrank mean the kernel
+// reclaimed memory during the scan, and then there is no telling.
+func metadataRating(before, after memSample, entries uint64) string {
+	if after.Buffers < before.Buffers || after.SReclaimable < before.SReclaimable {
+		return "unknown, the kernel reclaimed cache during the scan"
+	}
+	if entries == 0 {
+		return "unknown, nothing was walked"
+	}
+	perEntry := (after.Buffers - before.Buffers + after.SReclaimable - before.SReclaimable) / entries
+	switch {
+	case perEntry < warmMetadataPerEntry:
+		return "warm"
+	case perEntry >= coldMetadataPerEntry:
+		return "cold"
+	}
+	return "mixed"
+}
+
+// sizeChange formats the move from before to after, with its sign.
+func sizeChange(before, after uint64) string {
+	if after < before {
+		return "-" + humanReadableSize(before-after)
+	}
+	return "+" + humanReadableSize(after-before)
+}
+
+// print writes the page cache section.
+func (c *cacheReport) print() {
+	fmt.Fprintln(stdout, "\nPage cache (estimate):")
+	if c.err != nil {
+		fmt.Fprintf(stdout, "  not sampled: %v\n", c.err)
+	} else {
+		b, a := c.before, c.after
+		fmt.Fprintf(stdout, "  cached: %s before the scan, %s after (%s)\n",
+			humanReadableSize(b.Cached), humanReadableSize(a.Cached), sizeChange(b.Cached, a.Cached))
+		fmt.Fprintf(stdout, "  metadata: buffers %s, reclaimable slab %s over %d entries: %s\n",
+			sizeChange(b.Buffers, a.Buffers), sizeChange(b.SReclaimable, a.SReclaimable), c.entries,
+			metadataRating(b, a, c.entries))
+	}
+	if !c.peek {
+		return
+	}
+	if c.probed == 0 {
+		fmt.Fprintf(stdout, "  listed files: %d probed\n", c.files)
+		return
+	}
+	fmt.Fprintf(stdout, "  listed files: %s of %s estimated warm (%.1f%%) in %d %s\n",
+		humanReadableSize(c.warm), humanReadableSize(c.probed), float64(c.warm)/float64(c.probed)*100,
+		c.files, plural(c.files, "file", "files"))
+}
+
+// cacheSuffix renders a probed file's cached share for the listing.
+func cacheSuffix(res FileInfo) string {
+	if !res.CacheProbed {
+		return ""
+	}
+	pct := 100.0
+	if res.Size > 0 {
+		pct = float64(res.Cached) / float64(res.Size) * 100
+	}
+	return fmt.Sprintf("  [%.0f%% cached]", pct)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// procCacheProber reads /proc/meminfo and asks the kernel which pages of
+// a file are cached.
+type procCacheProber struct {
+	meminfo string
+}
+
+// newCacheProber returns the platform prober.
+func newCacheProber() (cacheProber, error) {
+	return procCacheProber{meminfo: "/proc/meminfo"}, nil
+}
+
+// sampleMemory implements cacheProber.
+func (p procCacheProber) sampleMemory() (memSample, error) {
+	f, err := os.Open(p.meminfo)
+	if err != nil {
+		return memSample{}, err
+	}
+	defer f.Close()
+	return parseMeminfo(f)
+}
+
+// residentBytes implements cacheProber. cachestat answers in one call
+// where the kernel and architecture have it; otherwise mincore is asked
+// about a bounded sample of the file.
+func (p procCacheProber) residentBytes(path string, size uint64) (uint64, error) {
+	openFiles.acquire()
+	defer openFiles.release()
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if pages, err := cachestat(f); err == nil {
+		return pages * uint64(os.Getpagesize()), nil
+	}
+	return mincoreResident(f, size)
+}
+
+// A file is mapped for mincore a window at a time, and files of more than
+// maxProbeWindows windows are sampled at evenly spaced windows.
+const (
+	probeWindow     = 64 << 20
+	maxProbeWindows = 64
+)
+
+// mincoreResident maps f read-only, window by window, and counts the
+// resident pages mincore reports, scaling a sample up to the whole size.
+func mincoreResident(f *os.File, size uint64) (uint64, error) {
+	if size == 0 {
+		return 0, nil
+	}
+	page := uint64(os.Getpagesize())
+	windows := (size + probeWindow - 1) / probeWindow
+	step := (windows + maxProbeWindows - 1) / maxProbeWindows
+	vec := make([]byte, probeWindow/page)
+	var resident, sampled uint64
+	for w := uint64(0); w < windows; w += step {
+		off := w * probeWindow
+		n := min(probeWindow, size-off)
+		data, err := syscall.Mmap(int(f.Fd()), int64(off), int(n), syscall.PROT_READ, syscall.MAP_SHARED)
+		if err != nil {
+			return 0, err
+		}
+		_, _, errno := syscall.Syscall(syscall.SYS_MINCORE, uintptr(unsafe.Pointer(&data[0])), uintptr(n), uintptr(unsafe.Pointer(&vec[0])))
+		syscall.Munmap(data)
+		if errno != 0 {
+			return 0, errno
+		}
+		pages := (n + page - 1) / page
+		for _, b := range vec[:pages] {
+			if b&1 != 0 {
+				resident += page
+			}
+		}
+		sampled += n
+	}
+	if sampled == size {
+		return min(resident, size), nil
+	}
+	return uint64(float64(min(resident, sampled)) / float64(sampled) * float64(size)), nil
+}
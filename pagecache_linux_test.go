@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResidentBytesOfFreshFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fresh")
+	// Just written, so in the page cache.
+	data := make([]byte, 1<<20)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := newCacheProber()
+	if err != nil {
+		t.Fatal(err)
+	}
+	warm, err := p.residentBytes(path, uint64(len(data)))
+	if err != nil {
+		t.Fatalf("residentBytes: %v", err)
+	}
+	if warm < uint64(len(data))*9/10 {
+		t.Errorf("fresh file %d of %d bytes cached, want nearly all", warm, len(data))
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if warm, err := mincoreResident(f, uint64(len(data))); err != nil || warm < uint64(len(data))*9/10 {
+		t.Errorf("mincore found %d of %d bytes cached, %v; want nearly all", warm, len(data), err)
+	}
+	if _, err := p.sampleMemory(); err != nil {
+		t.Errorf("sampleMemory: %v", err)
+	}
+}
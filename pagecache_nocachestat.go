@@ -0,0 +1,14 @@
+//go:build linux && !(amd64 || arm64 || riscv64 || loong64)
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// cachestat is not wired up on this architecture, whose system call
+// numbers differ; residentBytes falls back to mincore.
+func cachestat(*os.File) (uint64, error) {
+	return 0, syscall.ENOSYS
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// newCacheProber reports that page cache figures are unavailable.
+func newCacheProber() (cacheProber, error) {
+	return nil, errCacheUnsupported
+}
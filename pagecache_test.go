@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeProber returns canned samples, in turn, and a cached share per file
+// name.
+type fakeProber struct {
+	samples []memSample
+	cached  map[string]float64
+}
+
+func (p *fakeProber) sampleMemory() (memSample, error) {
+	s := p.samples[0]
+	p.samples = p.samples[1:]
+	return s, nil
+}
+
+func (p *fakeProber) residentBytes(path string, size uint64) (uint64, error) {
+	return uint64(p.cached[filepath.Base(path)] * float64(size)), nil
+}
+
+func TestParseMeminfo(t *testing.T) {
+	in := "MemTotal:       16318412 kB\nBuffers:          204800 kB\nCached:          4194304 kB\nSwapCached:            0 kB\nSReclaimable:     524288 kB\n"
+	m, err := parseMeminfo(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (memSample{Cached: 4 << 30, Buffers: 200 << 20, SReclaimable: 512 << 20}); m != want {
+		t.Errorf("parseMeminfo = %+v, want %+v", m, want)
+	}
+	if _, err := parseMeminfo(strings.NewReader("MemTotal: 1 kB\n")); err == nil {
+		t.Error("meminfo without Cached accepted")
+	}
+}
+
+func TestMetadataRating(t *testing.T) {
+	before := memSample{Buffers: 1 << 20, SReclaimable: 10 << 20}
+	tests := []struct {
+		after   memSample
+		entries uint64
+		want    string
+	}{
+		{memSample{Buffers: 1 << 20, SReclaimable: 10<<20 + 10*1000}, 1000, "warm"},
+		{memSample{Buffers: 1<<20 + 100*1000, SReclaimable: 10<<20 + 100*1000}, 1000, "mixed"},
+		{memSample{Buffers: 1 << 20, SReclaimable: 10<<20 + 900*1000}, 1000, "cold"},
+		{memSample{Buffers: 1 << 20, SReclaimable: 9 << 20}, 1000, "unknown, the kernel reclaimed cache during the scan"},
+	}
+	for _, tt := range tests {
+		if got := metadataRating(before, tt.after, tt.entries); got != tt.want {
+			t.Errorf("rating of %+v over %d entries = %q, want %q", tt.after, tt.entries, got, tt.want)
+		}
+	}
+}
+
+func TestCacheReport(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"warm": strings.Repeat("x", 4000),
+		"half": strings.Repeat("x", 2000),
+		"cold": strings.Repeat("x", 2000),
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+	fake := &fakeProber{
+		samples: []memSample{{Cached: 1 << 30, SReclaimable: 1 << 20}, {Cached: 1<<30 + 1<<20, SReclaimable: 1<<20 + 4096}},
+		cached:  map[string]float64{"warm": 1, "half": 0.5},
+	}
+	old := loadCacheProber
+	loadCacheProber = func() (cacheProber, error) { return fake, nil }
+	defer func() { loadCacheProber = old }()
+
+	resetResults()
+	out, err := runCaptured(t, "-peek-cache", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	for _, want := range []string{
+		filepath.Join(tmpDir, "warm") + "  [100% cached]\n",
+		filepath.Join(tmpDir, "half") + "  [50% cached]\n",
+		filepath.Join(tmpDir, "cold") + "  [0% cached]\n",
+		"  cached: 1.00 GiB before the scan, 1.00 GiB after (+1.00 MiB)\n",
+		// 4 KiB of slab over three files and the root is 1 KiB each.
+		"  metadata: buffers +0 B, reclaimable slab +4.00 KiB over 4 entries: cold\n",
+		"  listed files: 4.88 KiB of 7.81 KiB estimated warm (62.5%) in 3 files\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+
+	if _, err := runCaptured(t, "-cache-report", "-format=json", tmpDir, "1K"); err == nil {
+		t.Error("-cache-report accepted with -format=json")
+	}
+	if _, err := runCaptured(t, "-peek-cache", "-format=csv", tmpDir, "1K"); err == nil {
+		t.Error("-peek-cache accepted with -format=csv")
+	}
+
+	// JSON carries the estimate per file, without the text report.
+	fake.samples = []memSample{{Cached: 1 << 30}, {Cached: 1 << 30}}
+	resetResults()
+	out, err = runCaptured(t, "-peek-cache", "-format=json", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	var rep jsonReport
+	if err := json.Unmarshal([]byte(out), &rep); err != nil {
+		t.Fatalf("output is not a JSON document: %v\n%s", err, out)
+	}
+	want := map[string]uint64{"warm": 4000, "half": 1000, "cold": 0}
+	for _, e := range rep.Entries {
+		if e.IsDir {
+			if e.CachedBytes != nil {
+				t.Errorf("directory %s has cached_bytes", e.Path)
+			}
+			continue
+		}
+		if e.CachedBytes == nil || *e.CachedBytes != want[filepath.Base(e.Path)] {
+			t.Errorf("%s cached_bytes = %v, want %d", e.Path, e.CachedBytes, want[filepath.Base(e.Path)])
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// dirListTimeout is the soft budget for listing one directory
+	// (-dir-list-timeout); zero lists every directory in full.
+	dirListTimeout time.Duration
+
+	// finishPartials makes the walk come back to partially listed
+	// directories once everything else is queued (-finish-partials).
+	finishPartials bool
+
+	// partialDirs counts, per directory left partially listed, the
+	// entries that were read. Those directories and their ancestors have
+	// lower-bound sizes.
+	partialDirs  map[string]int
+	partialMutex sync.Mutex
+
+	// finishedPartials counts directories completed in a second pass. It
+	// is guarded by partialMutex.
+	finishedPartials int
+)
+
+// dirLister reads a directory in chunks, as *os.File does.
+type dirLister interface {
+	ReadDir(n int) ([]fs.DirEntry, error)
+	Close() error
+}
+
+// openDir opens a directory for chunked listing. Tests replace it with a
+// slow fake.
+var openDir = func(path string) (dirLister, error) { return os.Open(path) }
+
+// listChunk is how many entries are read between deadline checks.
+const listChunk = 1024
+
+// listChunked lists path until it is exhausted or, if budget is positive,
+// until budget has elapsed; partial reports the latter. Entries named in
+// skip, which a previous pass already counted, are left out.
+func listChunked(path string, budget time.Duration, skip map[string]bool) (entries []fs.DirEntry, partial bool, err error) {
+	d, err := openDir(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer d.Close()
+	start := time.Now()
+	for {
+		chunk, err := d.ReadDir(listChunk)
+		for _, e := range chunk {
+			if !skip[e.Name()] {
+				entries = append(entries, e)
+			}
+		}
+		if errors.Is(err, io.EOF) || (err == nil && len(chunk) == 0) {
+			return entries, false, nil
+		}
+		if err != nil {
+			return entries, false, err
+		}
+		if budget > 0 && time.Since(start) >= budget {
+			return entries, true, nil
+		}
+	}
+}
+
+// recordPartial notes that only listed entries of path were read.
+func recordPartial(path string, listed int) {
+	partialMutex.Lock()
+	if partialDirs == nil {
+		partialDirs = make(map[string]int)
+	}
+	partialDirs[path] += listed
+	partialMutex.Unlock()
+}
+
+// noteFinishedPartial counts a directory completed in a second pass.
+func noteFinishedPartial() {
+	partialMutex.Lock()
+	finishedPartials++
+	partialMutex.Unlock()
+}
+
+// partialSuffix marks entries whose size is a lower bound because they are,
+// or contain, a partially listed directory.
+func partialSuffix(res FileInfo) string {
+	if !res.LowerBound {
+		return ""
+	}
+	partialMutex.Lock()
+	listed, own := partialDirs[res.Path]
+	partialMutex.Unlock()
+	if own {
+		return fmt.Sprintf("  (partially listed: %d of unknown entries, size is a lower bound)", listed)
+	}
+	return "  (incomplete, size is a lower bound)"
+}
+
+// printPartials lists the directories the listing budget cut short.
+func printPartials() {
+	partialMutex.Lock()
+	dirs := make([]string, 0, len(partialDirs))
+	for dir := range partialDirs {
+		dirs = append(dirs, dir)
+	}
+	partialMutex.Unlock()
+	sort.Strings(dirs)
+	fmt.Fprintf(stdout, "\nPartially listed %d directories within -dir-list-timeout; their sizes and those of their ancestors are lower bounds:\n", len(dirs))
+	for _, dir := range dirs {
+		fmt.Fprintf(stdout, "  %s (%d entries listed)\n", displayPath(dir), partialDirs[dir])
+	}
+}
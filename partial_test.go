@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowLister hands out a directory a few entries at a time, sleeping
+// before each chunk, like a huge directory on a slow NFS server.
+type slowLister struct {
+	f     *os.File
+	delay time.Duration
+}
+
+func (s slowLister) ReadDir(int) ([]fs.DirEntry, error) {
+	time.Sleep(s.delay)
+	return s.f.ReadDir(4)
+}
+
+func (s slowLister) Close() error { return s.f.Close() }
+
+// slowDir makes listings of directories named name slow.
+func slowDir(t *testing.T, name string, delay time.Duration) {
+	t.Helper()
+	old := openDir
+	openDir = func(path string) (dirLister, error) {
+		f, err := os.Open(path)
+		if err != nil || filepath.Base(path) != name {
+			return f, err
+		}
+		return slowLister{f: f, delay: delay}, nil
+	}
+	t.Cleanup(func() { openDir = old })
+}
+
+func partialFixture(t *testing.T) string {
+	t.Helper()
+	files := map[string]string{"other/f": strings.Repeat("o", 10)}
+	for i := 0; i < 60; i++ {
+		files[fmt.Sprintf("huge/f%02d", i)] = strings.Repeat("x", 100)
+	}
+	return createTestDir(t, files)
+}
+
+func TestDirListTimeoutMarksPartial(t *testing.T) {
+	tmpDir := partialFixture(t)
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+	slowDir(t, "huge", 10*time.Millisecond)
+
+	resetResults()
+	out, err := runCaptured(t, "-dir-list-timeout=25ms", "-format=json", tmpDir, "1B")
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	partialMutex.Lock()
+	listed := partialDirs[filepath.Join(tmpDir, "huge")]
+	partialMutex.Unlock()
+	if listed == 0 || listed >= 60 {
+		t.Fatalf("listed %d of 60 entries, want a partial listing\n%s", listed, out)
+	}
+
+	sizes := map[string]uint64{}
+	lower := map[string]bool{}
+	for _, res := range results {
+		sizes[res.Path] = res.Size
+		lower[res.Path] = res.LowerBound
+	}
+	huge := filepath.Join(tmpDir, "huge")
+	if sizes[huge] != uint64(listed)*100 {
+		t.Errorf("huge = %d bytes, want the lower bound %d from %d listed files", sizes[huge], listed*100, listed)
+	}
+	if !lower[huge] || !lower[tmpDir] || lower[filepath.Join(tmpDir, "other")] {
+		t.Errorf("lower-bound marks = %v, want huge and the root only", lower)
+	}
+	if !strings.Contains(out, `"lower_bound": true`) {
+		t.Errorf("JSON lacks the lower-bound mark:\n%s", out)
+	}
+}
+
+func TestDirListTimeoutText(t *testing.T) {
+	tmpDir := partialFixture(t)
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+	slowDir(t, "huge", 10*time.Millisecond)
+
+	resetResults()
+	out, err := runCaptured(t, "-dir-list-timeout=25ms", tmpDir, "1B")
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	for _, want := range []string{
+		filepath.Join(tmpDir, "huge") + "  (partially listed: ",
+		tmpDir + "  (incomplete, size is a lower bound)\n",
+		"Partially listed 1 directories",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestFinishPartials(t *testing.T) {
+	tmpDir := partialFixture(t)
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+	slowDir(t, "huge", 10*time.Millisecond)
+
+	resetResults()
+	out, err := runCaptured(t, "-dir-list-timeout=25ms", "-finish-partials", tmpDir, "1B")
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	for _, res := range results {
+		if res.LowerBound {
+			t.Errorf("%s is still a lower bound after the second pass", res.Path)
+		}
+		if res.Path == filepath.Join(tmpDir, "huge") && res.Size != 6000 {
+			t.Errorf("huge = %d bytes after the second pass, want 6000", res.Size)
+		}
+		if res.Path == tmpDir && res.Size != 6010 {
+			t.Errorf("root = %d bytes after the second pass, want 6010", res.Size)
+		}
+	}
+	if !strings.Contains(out, "Finished 1 partially listed directories in a second pass.") {
+		t.Errorf("second pass not reported:\n%s", out)
+	}
+	if n := strings.Count(out, "[FILE]"); n != 61 {
+		t.Errorf("listed %d files, want 61 with none counted twice", n)
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// pathProfile describes what a destination accepts in a path. Paths are
+// checked relative to the scan root, as they would land at the top of the
+// destination. Zero limits and empty sets are not checked.
+type pathProfile struct {
+	Name string
+	// MaxPath is the longest accepted path in characters, MaxComponent
+	// the longest name in bytes and MaxDepth the deepest nesting.
+	MaxPath, MaxComponent, MaxDepth int
+	// Forbidden characters may not appear in a name; control characters
+	// are always forbidden when Forbidden is set. If Allowed is set, it
+	// is the only characters a name may use.
+	Forbidden, Allowed string
+	// Reserved names are refused whatever their case or extension.
+	Reserved []string
+	// Trailing characters may not end a name.
+	Trailing string
+}
+
+// windowsReserved are the device names Windows refuses as file names.
+var windowsReserved = []string{
+	"CON", "PRN", "AUX", "NUL",
+	"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+	"LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9",
+}
+
+// pathProfiles are the built-in -path-audit profiles.
+var pathProfiles = map[string]pathProfile{
+	"windows": {
+		Name: "windows", MaxPath: 260, MaxComponent: 255,
+		Forbidden: `<>:"\|?*`, Reserved: windowsReserved, Trailing: " .",
+	},
+	"onedrive": {
+		Name: "onedrive", MaxPath: 400, MaxComponent: 255,
+		Forbidden: `<>:"\|?*`, Reserved: append([]string{".lock", "desktop.ini"}, windowsReserved...), Trailing: " .",
+	},
+	// Plain ISO 9660 level 2, without Joliet or Rock Ridge.
+	"iso9660": {
+		Name: "iso9660", MaxPath: 255, MaxComponent: 31, MaxDepth: 8,
+		Allowed: "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_.",
+	},
+}
+
+// Rules a path can break.
+const (
+	rulePathLength      = "path-length"
+	ruleComponentLength = "component-length"
+	ruleDepth           = "depth"
+	ruleForbiddenChar   = "forbidden-char"
+	ruleReservedName    = "reserved-name"
+	ruleTrailingChar    = "trailing-char"
+)
+
+// pathViolation is one rule a path breaks, with what broke it.
+type pathViolation struct {
+	Rule   string `json:"rule"`
+	Detail string `json:"detail"`
+}
+
+// parsePathProfile returns the named profile, or a custom one from a spec
+// such as "custom:path=200,component=100,depth=10,chars=<>".
+func parsePathProfile(spec string) (pathProfile, error) {
+	if p, ok := pathProfiles[spec]; ok {
+		return p, nil
+	}
+	rest, ok := strings.CutPrefix(spec, "custom:")
+	if !ok {
+		return pathProfile{}, fmt.Errorf("unknown profile %q; use windows, onedrive, iso9660 or custom:path=N,component=N,depth=N,chars=...", spec)
+	}
+	p := pathProfile{Name: "custom"}
+	for _, kv := range strings.Split(rest, ",") {
+		key, val, ok := strings.Cut(kv, "=")
+		if !ok {
+			return pathProfile{}, fmt.Errorf("custom profile: %q is not key=value", kv)
+		}
+		if key == "chars" {
+			p.Forbidden = val
+			continue
+		}
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 {
+			return pathProfile{}, fmt.Errorf("custom profile: %s must be a non-negative number, not %q", key, val)
+		}
+		switch key {
+		case "path":
+			p.MaxPath = n
+		case "component":
+			p.MaxComponent = n
+		case "depth":
+			p.MaxDepth = n
+		default:
+			return pathProfile{}, fmt.Errorf("custom profile: unknown key %q", key)
+		}
+	}
+	return p, nil
+}
+
+// check returns the rules rel breaks. rel is relative to the scan root
+// with forward slashes, as canonicalPath gives it.
+func (p pathProfile) check(rel string) []pathViolation {
+	return p.checkNames(rel, false)
+}
+
+// checkEntry is check for the walk, which sees every ancestor of rel
+// before rel itself: only the last name is checked, so one bad directory
+// name is not reported again for everything below it.
+func (p pathProfile) checkEntry(rel string) []pathViolation {
+	return p.checkNames(rel, true)
+}
+
+func (p pathProfile) checkNames(rel string, lastOnly bool) []pathViolation {
+	if rel == "." || rel == "" {
+		return nil
+	}
+	var vs []pathViolation
+	if n := utf8.RuneCountInString(rel); p.MaxPath > 0 && n > p.MaxPath {
+		vs = append(vs, pathViolation{rulePathLength, fmt.Sprintf("%d characters, limit %d", n, p.MaxPath)})
+	}
+	names := strings.Split(rel, "/")
+	if p.MaxDepth > 0 && len(names) > p.MaxDepth {
+		vs = append(vs, pathViolation{ruleDepth, fmt.Sprintf("%d levels, limit %d", len(names), p.MaxDepth)})
+	}
+	if lastOnly {
+		names = names[len(names)-1:]
+	}
+	for _, name := range names {
+		vs = append(vs, p.checkName(name)...)
+	}
+	return vs
+}
+
+// checkName returns the rules a single name breaks.
+func (p pathProfile) checkName(name string) []pathViolation {
+	var vs []pathViolation
+	if p.MaxComponent > 0 && len(name) > p.MaxComponent {
+		vs = append(vs, pathViolation{ruleComponentLength, fmt.Sprintf("%q is %d bytes, limit %d", name, len(name), p.MaxComponent)})
+	}
+	for _, r := range name {
+		bad := p.Forbidden != "" && (r < 0x20 || strings.ContainsRune(p.Forbidden, r)) ||
+			p.Allowed != "" && !strings.ContainsRune(p.Allowed, r)
+		if bad {
+			vs = append(vs, pathViolation{ruleForbiddenChar, fmt.Sprintf("%q in %q", r, name)})
+			break
+		}
+	}
+	base, _, _ := strings.Cut(name, ".")
+	for _, res := range p.Reserved {
+		if strings.EqualFold(name, res) || strings.EqualFold(base, res) && base != "" {
+			vs = append(vs, pathViolation{ruleReservedName, fmt.Sprintf("%q", name)})
+			break
+		}
+	}
+	if p.Trailing != "" && name != "" && strings.ContainsRune(p.Trailing, rune(name[len(name)-1])) {
+		vs = append(vs, pathViolation{ruleTrailingChar, fmt.Sprintf("%q ends in %q", name, name[len(name)-1])})
+	}
+	return vs
+}
+
+// pathAuditTop is how many offenders the worst-offenders section lists.
+const pathAuditTop = 10
+
+// pathOffender is an entry that breaks at least one rule.
+type pathOffender struct {
+	Rel        string
+	Depth      int
+	Violations []pathViolation
+}
+
+// worse orders offenders deepest first, then longest.
+func (o pathOffender) worse(than pathOffender) bool {
+	if o.Depth != than.Depth {
+		return o.Depth > than.Depth
+	}
+	if len(o.Rel) != len(than.Rel) {
+		return len(o.Rel) > len(than.Rel)
+	}
+	return o.Rel < than.Rel
+}
+
+// pathAuditor checks every entry the walk sees against a profile,
+// whatever its size. It is nil unless -path-audit is given.
+type pathAuditor struct {
+	root    string
+	profile pathProfile
+
+	mu        sync.Mutex
+	offending int
+	rules     map[string]int
+	worst     []pathOffender
+}
+
+// pathAudit is the active auditor, if any.
+var pathAudit *pathAuditor
+
+// newPathAuditor returns an auditor for a scan of root.
+func newPathAuditor(root string, profile pathProfile) *pathAuditor {
+	return &pathAuditor{root: root, profile: profile, rules: make(map[string]int)}
+}
+
+// record checks the entry at path.
+func (a *pathAuditor) record(path string) {
+	rel := canonicalPath(a.root, path)
+	vs := a.profile.checkEntry(rel)
+	if len(vs) == 0 {
+		return
+	}
+	o := pathOffender{Rel: rel, Depth: strings.Count(rel, "/") + 1, Violations: vs}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.offending++
+	for _, v := range vs {
+		a.rules[v.Rule]++
+	}
+	a.worst = append(a.worst, o)
+	// Trim now and then rather than on every entry.
+	if len(a.worst) >= 2*pathAuditTop {
+		a.trim()
+	}
+}
+
+// trim keeps the worst pathAuditTop offenders. The caller holds a.mu.
+func (a *pathAuditor) trim() {
+	sort.Slice(a.worst, func(i, j int) bool { return a.worst[i].worse(a.worst[j]) })
+	if len(a.worst) > pathAuditTop {
+		a.worst = a.worst[:pathAuditTop]
+	}
+}
+
+// annotate fills in the violations of the listed entries.
+func (a *pathAuditor) annotate(list []FileInfo) {
+	for i := range list {
+		list[i].PathViolations = a.profile.check(canonicalPath(a.root, list[i].Path))
+	}
+}
+
+// print writes the summary counts and the worst offenders.
+func (a *pathAuditor) print() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.offending == 0 {
+		fmt.Fprintf(stdout, "\nPath audit (%s): no entries break the profile's limits.\n", a.profile.Name)
+		return
+	}
+	rules := make([]string, 0, len(a.rules))
+	for r := range a.rules {
+		rules = append(rules, r)
+	}
+	sort.Strings(rules)
+	counts := make([]string, len(rules))
+	for i, r := range rules {
+		counts[i] = fmt.Sprintf("%d %s", a.rules[r], r)
+	}
+	fmt.Fprintf(stdout, "\nPath audit (%s): %d %s break the profile's limits (%s).\n",
+		a.profile.Name, a.offending, plural(a.offending, "entry", "entries"), strings.Join(counts, ", "))
+	a.trim()
+	fmt.Fprintln(stdout, "Worst offenders, deepest and longest first:")
+	for _, o := range a.worst {
+		fmt.Fprintf(stdout, "  %s%s\n", o.Rel, violationList(o.Violations))
+	}
+}
+
+// violationList renders violations as "  [rule: detail; ...]".
+func violationList(vs []pathViolation) string {
+	if len(vs) == 0 {
+		return ""
+	}
+	parts := make([]string, len(vs))
+	for i, v := range vs {
+		parts[i] = v.Rule + ": " + v.Detail
+	}
+	return "  [" + strings.Join(parts, "; ") + "]"
+}
+
+// pathAuditSuffix is the text-listing note for a listed entry's violations.
+func pathAuditSuffix(res FileInfo) string {
+	return violationList(res.PathViolations)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func rulesOf(vs []pathViolation) []string {
+	var rules []string
+	for _, v := range vs {
+		rules = append(rules, v.Rule)
+	}
+	return rules
+}
+
+func TestPathProfileCheck(t *testing.T) {
+	win := pathProfiles["windows"]
+	long := strings.Repeat("a", 256)
+	tests := []struct {
+		profile pathProfile
+		rel     string
+		want    []string
+	}{
+		{win, "docs/report.txt", nil},
+		{pathProfiles["onedrive"], "docs/" + long, []string{ruleComponentLength}},
+		{win, "docs/trailing ", []string{ruleTrailingChar}},
+		{win, "docs/dot.", []string{ruleTrailingChar}},
+		{win, "CON", []string{ruleReservedName}},
+		{win, "x/con.txt", []string{ruleReservedName}},
+		{win, "x/console", nil},
+		{win, "what?.txt", []string{ruleForbiddenChar}},
+		{win, "tab\there", []string{ruleForbiddenChar}},
+		{win, strings.Repeat("abcdefghi/", 27), []string{rulePathLength}},
+		{pathProfiles["onedrive"], "a/desktop.ini", []string{ruleReservedName}},
+		{pathProfiles["iso9660"], "A/B/C/D/E/F/G/H/I.TXT", []string{ruleDepth}},
+		{pathProfiles["iso9660"], "lower.txt", []string{ruleForbiddenChar}},
+		{pathProfiles["iso9660"], "A_VERY_LONG_FILE_NAME_FOR_ISO_9660.TXT", []string{ruleComponentLength}},
+		// Several rules at once are all reported.
+		{win, "AUX/" + long + " ", []string{rulePathLength, ruleReservedName, ruleComponentLength, ruleTrailingChar}},
+	}
+	for _, tt := range tests {
+		if got := rulesOf(tt.profile.check(tt.rel)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s check(%.40q) = %v, want %v", tt.profile.Name, tt.rel, got, tt.want)
+		}
+	}
+
+	// The walk sees ancestors first and only checks the last name.
+	if got := rulesOf(win.checkEntry("CON/file.txt")); got != nil {
+		t.Errorf("checkEntry reported an ancestor's name: %v", got)
+	}
+}
+
+func TestParsePathProfile(t *testing.T) {
+	p, err := parsePathProfile("custom:path=20,component=8,depth=2,chars=#%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := pathProfile{Name: "custom", MaxPath: 20, MaxComponent: 8, MaxDepth: 2, Forbidden: "#%"}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("custom profile = %+v, want %+v", p, want)
+	}
+	if got := rulesOf(p.check("a/b/c#")); !reflect.DeepEqual(got, []string{ruleDepth, ruleForbiddenChar}) {
+		t.Errorf("custom check = %v", got)
+	}
+	for _, bad := range []string{"macos", "custom:path", "custom:path=-1", "custom:size=3"} {
+		if _, err := parsePathProfile(bad); err == nil {
+			t.Errorf("parsePathProfile(%q) accepted", bad)
+		}
+	}
+}
+
+func TestRunPathAudit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the offending names cannot be created on Windows")
+	}
+	// The longest name Linux allows is exactly at the 255-byte limit.
+	long := strings.Repeat("n", 255)
+	tmpDir := createTestDir(t, map[string]string{
+		"big/CON":          strings.Repeat("x", 2000),
+		"big/trailing ":    "x",
+		"deep/a/b/c/d/e/f": "x",
+		"ok/" + long:       "x",
+	})
+	defer os.RemoveAll(tmpDir)
+
+	resetResults()
+	out, err := runCaptured(t, "-no-hints", "-path-audit=windows", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	for _, want := range []string{
+		filepath.Join(tmpDir, "big", "CON") + `  [reserved-name: "CON"]`,
+		"Path audit (windows): 2 entries break the profile's limits (1 reserved-name, 1 trailing-char).",
+		// Listed as an offender although it is far below the threshold.
+		`  big/trailing   [trailing-char: "trailing " ends in ' ']`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+
+	resetResults()
+	out, err = runCaptured(t, "-no-hints", "-path-audit=custom:depth=4", tmpDir, "1G")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "Worst offenders, deepest and longest first:\n  deep/a/b/c/d/e/f  [depth: 7 levels, limit 4]\n  deep/a/b/c/d/e  [depth: 6 levels") {
+		t.Errorf("offenders not ordered by depth:\n%s", out)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// peekChild is one of the largest immediate children of a listed
+// directory, shown by -peek.
+type peekChild struct {
+	Name  string `json:"name"`
+	Size  uint64 `json:"size"`
+	IsDir bool   `json:"dir,omitempty"`
+}
+
+// peekBefore orders children largest first, then by name.
+func peekBefore(a, b peekChild) bool {
+	if a.Size != b.Size {
+		return a.Size > b.Size
+	}
+	return a.Name < b.Name
+}
+
+// childHeap keeps the largest children offered to it, smallest on top so
+// that a larger newcomer replaces it.
+type childHeap []peekChild
+
+func (h childHeap) Len() int           { return len(h) }
+func (h childHeap) Less(i, j int) bool { return peekBefore(h[j], h[i]) }
+func (h childHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *childHeap) Push(x any)        { *h = append(*h, x.(peekChild)) }
+func (h *childHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// offer adds c if the heap holds fewer than n children or c beats the
+// smallest of them.
+func (h *childHeap) offer(c peekChild, n int) {
+	switch {
+	case h.Len() < n:
+		heap.Push(h, c)
+	case n > 0 && peekBefore(c, (*h)[0]):
+		(*h)[0] = c
+		heap.Fix(h, 0)
+	}
+}
+
+// sorted returns the children largest first.
+func (h childHeap) sorted() []peekChild {
+	list := append([]peekChild{}, h...)
+	sort.Slice(list, func(i, j int) bool { return peekBefore(list[i], list[j]) })
+	return list
+}
+
+// peekIndex tracks the largest immediate children of each directory in
+// flight and keeps them for the directories that are listed. It is nil
+// unless -peek is given.
+type peekIndex struct {
+	n int // children kept per directory
+
+	// live counts the heaps of directories in flight, peak its high-water
+	// mark: a directory's heap is dropped once it finishes.
+	live, peak atomic.Int64
+
+	mu       sync.Mutex
+	children map[string][]peekChild
+}
+
+// peeks is the active index, if any.
+var peeks *peekIndex
+
+func newPeekIndex(n int) *peekIndex {
+	return &peekIndex{n: n, children: make(map[string][]peekChild)}
+}
+
+// addPeek offers the children in cs to n's heap, starting one if n has
+// none yet.
+func (x *peekIndex) addPeek(n *dirNode, cs ...peekChild) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.peek == nil && len(cs) > 0 {
+		n.peek = make(childHeap, 0, x.n)
+		live := x.live.Add(1)
+		for {
+			peak := x.peak.Load()
+			if live <= peak || x.peak.CompareAndSwap(peak, live) {
+				break
+			}
+		}
+	}
+	for _, c := range cs {
+		n.peek.offer(c, x.n)
+	}
+}
+
+// finishDir drops the heap of a finished directory, first keeping its
+// children when the directory is listed.
+func (x *peekIndex) finishDir(n *dirNode, listed bool) {
+	n.mu.Lock()
+	h := n.peek
+	n.peek = nil
+	n.mu.Unlock()
+	if h == nil {
+		return
+	}
+	x.live.Add(-1)
+	if listed {
+		x.mu.Lock()
+		x.children[n.path] = h.sorted()
+		x.mu.Unlock()
+	}
+}
+
+// fill sets the Peek of the listed directories of list.
+func (x *peekIndex) fill(list []FileInfo) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for i := range list {
+		if list[i].IsDir {
+			list[i].Peek = x.children[list[i].Path]
+		}
+	}
+}
+
+// peekLines formats the children of res as context lines under its row,
+// each starting with indent and a '>' marker.
+func peekLines(indent string, res FileInfo) string {
+	var b strings.Builder
+	for _, c := range res.Peek {
+		name := c.Name
+		if c.IsDir {
+			name += "/"
+		}
+		fmt.Fprintf(&b, "%s> %-10s  %s\n", indent, humanReadableSize(c.Size), name)
+	}
+	return b.String()
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChildHeap(t *testing.T) {
+	var h childHeap
+	for i, size := range []uint64{5, 1, 9, 3, 9, 7} {
+		h.offer(peekChild{Name: fmt.Sprintf("c%d", i), Size: size}, 3)
+	}
+	want := []peekChild{{Name: "c2", Size: 9}, {Name: "c4", Size: 9}, {Name: "c5", Size: 7}}
+	if got := h.sorted(); !reflect.DeepEqual(got, want) {
+		t.Errorf("sorted = %+v, want %+v", got, want)
+	}
+}
+
+func TestPeekListing(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"a/big":       strings.Repeat("x", 3000),
+		"a/mid":       strings.Repeat("x", 2000),
+		"a/small":     strings.Repeat("x", 10),
+		"a/sub/inner": strings.Repeat("x", 2500),
+		"top":         strings.Repeat("x", 100),
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+
+	resetResults()
+	out, err := runCaptured(t, "-peek=2", "-format=json", tmpDir, "4K")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	var rep jsonReport
+	if err := json.Unmarshal([]byte(out), &rep); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	want := map[string][]peekChild{
+		tmpDir:                     {{Name: "a", Size: 7510, IsDir: true}, {Name: "top", Size: 100}},
+		filepath.Join(tmpDir, "a"): {{Name: "big", Size: 3000}, {Name: "sub", Size: 2500, IsDir: true}},
+	}
+	if len(rep.Entries) != len(want) {
+		t.Fatalf("got %d entries, want %d:\n%s", len(rep.Entries), len(want), out)
+	}
+	for _, e := range rep.Entries {
+		if !reflect.DeepEqual(e.Peek, want[e.Path]) {
+			t.Errorf("peek of %s = %+v, want %+v", e.Path, e.Peek, want[e.Path])
+		}
+	}
+
+	resetResults()
+	out, err = runCaptured(t, "-peek=1", "-tree", tmpDir, "4K")
+	if err != nil {
+		t.Fatalf("tree run: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "\n  7.33 KiB    a/\n    > 2.93 KiB    big\n") {
+		t.Errorf("tree without peek lines:\n%s", out)
+	}
+
+	if _, err := runCaptured(t, "-peek=2", "-format=csv", tmpDir, "4K"); err == nil {
+		t.Error("-peek accepted with -format=csv")
+	}
+}
+
+func TestPeekDropsFinishedHeaps(t *testing.T) {
+	files := make(map[string]string)
+	for i := 0; i < 40; i++ {
+		files[fmt.Sprintf("d%02d/f", i)] = "x"
+	}
+	tmpDir := createTestDir(t, files)
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+	oldWorkers := walkWorkers
+	walkWorkers = 1
+	peeks = newPeekIndex(3)
+	t.Cleanup(func() { walkWorkers, peeks = oldWorkers, nil })
+
+	resetResults()
+	if _, err := walkDir(tmpDir, 0, map[string]struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	// One worker has the root and the directory it is listing in flight.
+	if live, peak := peeks.live.Load(), peeks.peak.Load(); live != 0 || peak > 2 {
+		t.Errorf("%d heaps live after the walk, high-water mark %d; want 0 and at most 2", live, peak)
+	}
+	if got := len(peeks.children); got != 41 {
+		t.Errorf("kept the children of %d directories, want 41", got)
+	}
+}
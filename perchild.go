@@ -0,0 +1,148 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// childTops keeps, for each immediate child of the root, its total and its
+// largest descendants (-per-child-top). Files directly under the root form
+// the rootGroup group. It is nil unless the flag is given.
+type childTops struct {
+	root string
+	n    int
+
+	mu     sync.Mutex
+	groups map[string]*childGroup
+}
+
+// childGroup is one top-level subtree.
+type childGroup struct {
+	Name  string
+	Total uint64
+	top   sizeHeap
+}
+
+// perChild is the active report, if any.
+var perChild *childTops
+
+// newChildTops returns an empty report keeping n entries per group.
+func newChildTops(root string, n int) *childTops {
+	return &childTops{root: root, n: n, groups: make(map[string]*childGroup)}
+}
+
+// group returns the group for name. The caller must hold c.mu.
+func (c *childTops) group(name string) *childGroup {
+	g := c.groups[name]
+	if g == nil {
+		g = &childGroup{Name: name}
+		c.groups[name] = g
+	}
+	return g
+}
+
+// record offers an entry of the walk. Entries directly under the root set
+// their group's total; everything else competes for its group's top list.
+// Files directly under the root are both the total and the members of
+// rootGroup.
+func (c *childTops) record(path string, size uint64, isDir bool) {
+	name := topLevelName(c.root, path)
+	if name == rootGroup {
+		return
+	}
+	direct := filepath.Dir(path) == c.root
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if direct && !isDir {
+		g := c.group(rootGroup)
+		g.Total = addSize(g.Total, size)
+		g.top.offer(FileInfo{Path: path, Size: size}, c.n)
+		return
+	}
+	g := c.group(name)
+	if direct {
+		g.Total = size
+		return
+	}
+	g.top.offer(FileInfo{Path: path, Size: size, IsDir: isDir}, c.n)
+}
+
+// sorted returns the groups by total, largest first, each with its top
+// entries largest first.
+func (c *childTops) sorted() []childGroup {
+	c.mu.Lock()
+	list := make([]childGroup, 0, len(c.groups))
+	for _, g := range c.groups {
+		cp := *g
+		cp.top = append(sizeHeap(nil), g.top...)
+		list = append(list, cp)
+	}
+	c.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Total != list[j].Total {
+			return list[i].Total > list[j].Total
+		}
+		return list[i].Name < list[j].Name
+	})
+	for _, g := range list {
+		sort.Slice(g.top, func(i, j int) bool { return g.top.Less(j, i) })
+	}
+	return list
+}
+
+// print writes one section per top-level subtree.
+func (c *childTops) print() {
+	fmt.Fprintf(stdout, "\nLargest %d entries per top-level directory:\n", c.n)
+	for _, g := range c.sorted() {
+		fmt.Fprintf(stdout, "\n%s  (%s)\n", displayPath(g.Name), humanReadableSize(g.Total))
+		if len(g.top) == 0 {
+			fmt.Fprintln(stdout, "  (no entries below it)")
+		}
+		printResultsIndented(g.top)
+	}
+}
+
+// printResultsIndented writes result rows indented by two spaces.
+func printResultsIndented(list []FileInfo) {
+	for i, row := range resultRows(list) {
+		fmt.Fprintf(stdout, "  %s\n%s", row, peekLines("         ", list[i]))
+	}
+}
+
+// sizeHeap is a min-heap of entries by size, used to keep the n largest.
+type sizeHeap []FileInfo
+
+func (h sizeHeap) Len() int           { return len(h) }
+func (h sizeHeap) Less(i, j int) bool { return smallerEntry(h[i], h[j]) }
+func (h sizeHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *sizeHeap) Push(x any)        { *h = append(*h, x.(FileInfo)) }
+func (h *sizeHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// smallerEntry orders entries by size, breaking ties by path so that the
+// kept set does not depend on walk order.
+func smallerEntry(a, b FileInfo) bool {
+	if a.Size != b.Size {
+		return a.Size < b.Size
+	}
+	return a.Path > b.Path
+}
+
+// offer adds res if it is among the n largest seen so far.
+func (h *sizeHeap) offer(res FileInfo, n int) {
+	if h.Len() < n {
+		heap.Push(h, res)
+		return
+	}
+	if n > 0 && smallerEntry((*h)[0], res) {
+		(*h)[0] = res
+		heap.Fix(h, 0)
+	}
+}
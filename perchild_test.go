@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPerChildTop(t *testing.T) {
+	resetResults()
+	tmpDir := createTestDir(t, map[string]string{
+		"sales/q1.xlsx":          strings.Repeat("a", 50),
+		"sales/archive/2019.zip": strings.Repeat("b", 300),
+		"sales/archive/2020.zip": strings.Repeat("c", 200),
+		"sales/tiny.txt":         "d",
+		"eng/build/out.bin":      strings.Repeat("e", 90),
+		"eng/README":             strings.Repeat("f", 10),
+		"loose.iso":              strings.Repeat("g", 40),
+		"loose.txt":              "h",
+		"empty/":                 "",
+	})
+	defer os.RemoveAll(tmpDir)
+
+	perChild = newChildTops(tmpDir, 3)
+	defer func() { perChild = nil }()
+	walkDirRecursive(tmpDir, 1<<30, map[string]struct{}{})
+
+	groups := perChild.sorted()
+	var names []string
+	for _, g := range groups {
+		names = append(names, g.Name)
+	}
+	if got := strings.Join(names, ","); got != "sales,eng,(root),empty" {
+		t.Fatalf("groups = %s, want sales,eng,(root),empty (by total)", got)
+	}
+
+	members := func(g childGroup) string {
+		var out []string
+		for _, e := range g.top {
+			rel, _ := filepath.Rel(tmpDir, e.Path)
+			out = append(out, filepath.ToSlash(rel))
+		}
+		return strings.Join(out, ",")
+	}
+	want := map[string]struct {
+		total   uint64
+		members string
+	}{
+		"sales":  {551, "sales/archive,sales/archive/2019.zip,sales/archive/2020.zip"},
+		"eng":    {100, "eng/build,eng/build/out.bin,eng/README"},
+		"(root)": {41, "loose.iso,loose.txt"},
+		"empty":  {0, ""},
+	}
+	for _, g := range groups {
+		w := want[g.Name]
+		if g.Total != w.total || members(g) != w.members {
+			t.Errorf("%s: total %d, members %s; want %d, %s", g.Name, g.Total, members(g), w.total, w.members)
+		}
+	}
+}
+
+func TestSizeHeapKeepsLargest(t *testing.T) {
+	var h sizeHeap
+	for i, size := range []uint64{5, 1, 9, 3, 9, 7} {
+		h.offer(FileInfo{Path: string(rune('a' + i)), Size: size}, 3)
+	}
+	sizes := map[uint64]int{}
+	for _, e := range h {
+		sizes[e.Size]++
+	}
+	if len(h) != 3 || sizes[9] != 2 || sizes[7] != 1 {
+		t.Errorf("heap = %+v, want the two 9s and the 7", h)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rootGroup names the pseudo-subtree for entries directly under the root.
+const rootGroup = "(root)"
+
+// subtreePerf accumulates the cost of walking one top-level subtree.
+type subtreePerf struct {
+	Name     string
+	Wall     time.Duration
+	ReadDirs int
+	Entries  int
+	Errors   int
+}
+
+// perfReport attributes walk cost to the immediate children of the root.
+// It is nil unless -perf-report is given, so the walk takes no timestamps
+// otherwise.
+type perfReport struct {
+	root string
+
+	mu       sync.Mutex
+	subtrees map[string]*subtreePerf
+}
+
+// perf is the active report, if any.
+var perf *perfReport
+
+// newPerfReport returns an empty report for a scan of root.
+func newPerfReport(root string) *perfReport {
+	return &perfReport{root: root, subtrees: make(map[string]*subtreePerf)}
+}
+
+// topLevel returns the name of path's ancestor directly under the root.
+func (p *perfReport) topLevel(path string) string {
+	return topLevelName(p.root, path)
+}
+
+// topLevelName returns the name of path's ancestor directly under root, or
+// rootGroup for root itself.
+func topLevelName(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return rootGroup
+	}
+	first, _, _ := strings.Cut(rel, string(filepath.Separator))
+	return first
+}
+
+// subtree returns the accumulator for name. The caller must hold p.mu.
+func (p *perfReport) subtree(name string) *subtreePerf {
+	s := p.subtrees[name]
+	if s == nil {
+		s = &subtreePerf{Name: name}
+		p.subtrees[name] = s
+	}
+	return s
+}
+
+// recordReadDir counts one directory listing of path.
+func (p *perfReport) recordReadDir(path string, entries int, failed bool) {
+	name := p.topLevel(path)
+	p.mu.Lock()
+	s := p.subtree(name)
+	s.ReadDirs++
+	s.Entries += entries
+	if failed {
+		s.Errors++
+	}
+	p.mu.Unlock()
+}
+
+// recordError counts a failed entry lookup in path's subtree.
+func (p *perfReport) recordError(path string) {
+	name := p.topLevel(path)
+	p.mu.Lock()
+	p.subtree(name).Errors++
+	p.mu.Unlock()
+}
+
+// recordWall adds the wall time spent walking the subtree at path.
+func (p *perfReport) recordWall(path string, d time.Duration) {
+	name := p.topLevel(path)
+	p.mu.Lock()
+	p.subtree(name).Wall += d
+	p.mu.Unlock()
+}
+
+// sorted returns the subtrees ordered by wall time, slowest first.
+func (p *perfReport) sorted() []subtreePerf {
+	p.mu.Lock()
+	list := make([]subtreePerf, 0, len(p.subtrees))
+	for _, s := range p.subtrees {
+		list = append(list, *s)
+	}
+	p.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Wall != list[j].Wall {
+			return list[i].Wall > list[j].Wall
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// print writes the performance table.
+func (p *perfReport) print() {
+	fmt.Fprintln(stdout, "\nTIME        READDIRS   ENTRIES  ERRORS  SUBTREE")
+	fmt.Fprintln(stdout, "------------------------------------------------")
+	for _, s := range p.sorted() {
+		fmt.Fprintf(stdout, "%-10s  %8d  %8d  %6d  %s\n",
+			s.Wall.Round(time.Millisecond), s.ReadDirs, s.Entries, s.Errors, displayPath(s.Name))
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPerfReportAttributesSlowSubtree(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"fast/a.txt":       "a",
+		"fast/deep/b.txt":  "b",
+		"slow/c.txt":       "c",
+		"slow/x/y/d.txt":   "d",
+		"top.txt":          "t",
+		"other/e/f/g/h.go": "h",
+	})
+	defer os.RemoveAll(tmpDir)
+
+	slowRoot := filepath.Join(tmpDir, "slow")
+	oldReadDir := readDir
+	readDir = func(name string) ([]os.DirEntry, error) {
+		if pathWithin(name, slowRoot) {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return oldReadDir(name)
+	}
+	defer func() { readDir = oldReadDir }()
+
+	resetResults()
+	perf = newPerfReport(tmpDir)
+	defer func() { perf = nil }()
+	walkDirRecursive(tmpDir, 1, map[string]struct{}{})
+
+	list := perf.sorted()
+	if len(list) == 0 || list[0].Name != "slow" {
+		t.Fatalf("expected the slow subtree to top the table, got %+v", list)
+	}
+	if list[0].Wall < 60*time.Millisecond {
+		t.Errorf("slow subtree wall time %v does not include its three delayed reads", list[0].Wall)
+	}
+
+	byName := make(map[string]subtreePerf)
+	for _, s := range list {
+		byName[s.Name] = s
+	}
+	// slow, slow/x and slow/x/y, holding c.txt, x, y and d.txt.
+	if s := byName["slow"]; s.ReadDirs != 3 || s.Entries != 4 {
+		t.Errorf("slow: %d readdirs / %d entries, want 3 / 4", s.ReadDirs, s.Entries)
+	}
+	if s := byName["other"]; s.ReadDirs != 4 || s.Entries != 4 {
+		t.Errorf("other: %d readdirs / %d entries, want 4 / 4", s.ReadDirs, s.Entries)
+	}
+	if s := byName[rootGroup]; s.ReadDirs != 1 || s.Entries != 4 {
+		t.Errorf("root listing: %d readdirs / %d entries, want 1 / 4", s.ReadDirs, s.Entries)
+	}
+}
+
+func TestPerfReportOffTakesNoMeasurements(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{"a/b.txt": "b"})
+	defer os.RemoveAll(tmpDir)
+
+	resetResults()
+	output, err := runCaptured(t, tmpDir, "1")
+	if err != nil {
+		t.Fatalf("run() error: %v", err)
+	}
+	if perf != nil || strings.Contains(output, "READDIRS") {
+		t.Errorf("performance report produced without -perf-report:\n%s", output)
+	}
+
+	resetResults()
+	output, err = runCaptured(t, "-perf-report", tmpDir, "1")
+	if err != nil {
+		t.Fatalf("run() error: %v", err)
+	}
+	if !strings.Contains(output, "READDIRS") || !strings.Contains(output, "  a\n") {
+		t.Errorf("missing performance table:\n%s", output)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// writePrint0 writes the path of each result followed by a NUL byte, for
+// xargs -0 and similar, and nothing else. A relative path starting with a
+// dash is written as ./-name so that the command it is handed to does
+// not take it for an option.
+func writePrint0(w io.Writer, lists ...[]FileInfo) error {
+	bw := bufio.NewWriter(w)
+	for _, list := range lists {
+		for _, res := range list {
+			p := res.Path
+			if strings.HasPrefix(p, "-") {
+				p = "." + string(filepath.Separator) + p
+			}
+			bw.WriteString(p)
+			bw.WriteByte(0)
+		}
+	}
+	return bw.Flush()
+}
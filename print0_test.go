@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestPrint0(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows file names cannot contain newlines")
+	}
+	tmpDir := createTestDir(t, map[string]string{
+		"two\nlines": strings.Repeat("x", 3000),
+		"-rf/big":    strings.Repeat("x", 2000),
+		"with space": strings.Repeat("x", 1500),
+		"small":      "x",
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+
+	resetResults()
+	out, err := runCaptured(t, "-print0", "-no-summary", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run: %v\n%q", err, out)
+	}
+	want := []string{
+		tmpDir,
+		filepath.Join(tmpDir, "-rf"),
+		filepath.Join(tmpDir, "two\nlines"),
+		filepath.Join(tmpDir, "-rf", "big"),
+		filepath.Join(tmpDir, "with space"),
+	}
+	if out != strings.Join(want, "\x00")+"\x00" {
+		t.Errorf("-print0 output = %q, want %q", out, want)
+	}
+
+	// A relative path starting with a dash is not passed on as an option.
+	wd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	resetResults()
+	out, err = runCaptured(t, "-print0", "-no-summary", "--", "-rf", "1K")
+	if err != nil {
+		t.Fatalf("run on -rf: %v\n%q", err, out)
+	}
+	if want := "./-rf\x00./-rf/big\x00"; out != want {
+		t.Errorf("relative paths written as %q, want %q", out, want)
+	}
+
+	if _, err := runCaptured(t, "-print0", "-format=json", tmpDir, "1K"); err == nil {
+		t.Error("-print0 accepted with -format=json")
+	}
+}
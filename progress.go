@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// showProgress enables the live progress display (-progress).
+var showProgress bool
+
+// Progress is redrawn often on a terminal; written to a file it becomes a
+// log line, so it is emitted much less often there.
+var (
+	progressInterval     = 200 * time.Millisecond
+	progressFileInterval = 5 * time.Second
+)
+
+// startProgress draws the walk's progress on stderr until the returned
+// function is called, which also removes the display.
+func (w *walker) startProgress() func() {
+	interval := progressInterval
+	if !statusSink.tty {
+		interval = progressFileInterval
+	}
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				setStatus(w.progressText())
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-stopped
+		clearStatus()
+	}
+}
+
+// progressText describes how far the walk has got.
+func (w *walker) progressText() string {
+	w.mu.Lock()
+	queued := len(w.queue)
+	w.mu.Unlock()
+	return fmt.Sprintf("Scanning: %d dirs, %d files, %s so far, %d dirs queued",
+		w.finished.Load(), w.files.Load(), humanReadableSize(uint64(w.bytes.Load())), queued)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// renderTerminal replays a byte stream the way a terminal would display
+// it, handling only the controls the status line uses, and returns the
+// completed lines.
+func renderTerminal(stream string) []string {
+	var lines []string
+	var cur strings.Builder
+	for len(stream) > 0 {
+		switch {
+		case strings.HasPrefix(stream, clearLine):
+			cur.Reset()
+			stream = stream[len(clearLine):]
+		case stream[0] == '\n':
+			lines = append(lines, cur.String())
+			cur.Reset()
+			stream = stream[1:]
+		default:
+			cur.WriteByte(stream[0])
+			stream = stream[1:]
+		}
+	}
+	return lines
+}
+
+// interleave writes result and error lines while the status line is being
+// updated from another goroutine, and returns the lines it wrote.
+func interleave(t *testing.T) []string {
+	t.Helper()
+	var want []string
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 300; i++ {
+			setStatus(fmt.Sprintf("Scanning: %d dirs", i))
+		}
+	}()
+	for i := 0; i < 300; i++ {
+		line := fmt.Sprintf("[FILE] %-10s  /data/file%03d", "1.20 GiB", i)
+		want = append(want, line)
+		if i%3 == 0 {
+			fmt.Fprintf(stderr, "%s\n", line)
+		} else {
+			fmt.Fprintf(stdout, "%s\n", line)
+		}
+	}
+	wg.Wait()
+	clearStatus()
+	return want
+}
+
+func TestStatusLineOnTerminal(t *testing.T) {
+	var buf bytes.Buffer
+	stdout, stderr = newOutputs(&buf, &buf, true)
+	statusSink.tty = true
+	defer setupOutput(os.Stdout, os.Stderr)
+
+	want := interleave(t)
+
+	got := renderTerminal(buf.String())
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("rendered screen differs from the written lines:\ngot  %q\nwant %q", got[:min(5, len(got))], want[:5])
+	}
+	if screen := renderTerminal(buf.String() + "\n"); screen[len(screen)-1] != "" {
+		t.Errorf("status line left on screen after clearStatus: %q", screen[len(screen)-1])
+	}
+}
+
+func TestStatusLineNotTerminal(t *testing.T) {
+	var buf bytes.Buffer
+	stdout, stderr = newOutputs(&buf, &buf, true)
+	statusSink.tty = false
+	defer setupOutput(os.Stdout, os.Stderr)
+
+	want := interleave(t)
+
+	out := buf.String()
+	if strings.ContainsAny(out, "\r\033") {
+		t.Fatalf("control characters written to a non-terminal: %q", out[:min(200, len(out))])
+	}
+	i := 0
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		if strings.HasPrefix(line, "Scanning: ") {
+			continue
+		}
+		if i >= len(want) || line != want[i] {
+			t.Fatalf("unexpected line %q", line)
+		}
+		i++
+	}
+	if i != len(want) {
+		t.Errorf("got %d result lines, want %d", i, len(want))
+	}
+}
+
+func TestProgressDuringWalk(t *testing.T) {
+	resetResults()
+	files := map[string]string{}
+	for i := 0; i < 50; i++ {
+		files[fmt.Sprintf("d%02d/f", i)] = "x"
+	}
+	tmpDir := createTestDir(t, files)
+	defer os.RemoveAll(tmpDir)
+
+	oldRead := readDir
+	readDir = func(p string) ([]fs.DirEntry, error) {
+		time.Sleep(time.Millisecond)
+		return oldRead(p)
+	}
+	defer func() { readDir = oldRead }()
+
+	var buf bytes.Buffer
+	stdout, stderr = newOutputs(&buf, &buf, true)
+	statusSink.tty = true
+	oldInterval := progressInterval
+	progressInterval = 1
+	showProgress = true
+	defer func() {
+		showProgress = false
+		progressInterval = oldInterval
+		setupOutput(os.Stdout, os.Stderr)
+	}()
+
+	if total := walkDirRecursive(tmpDir, 1, map[string]struct{}{}); total != 50 {
+		t.Errorf("total = %d, want 50", total)
+	}
+	if !strings.Contains(buf.String(), "Scanning: ") {
+		t.Error("no progress was drawn")
+	}
+	if lines := renderTerminal(buf.String() + "\n"); len(lines) != 1 || lines[0] != "" {
+		t.Errorf("progress left visible output: %q", lines)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Windows file attribute bits and reparse tags used to classify reparse
+// points. They are defined here rather than taken from syscall so that the
+// classification can be tested on every platform.
+const (
+	fileAttributeReparsePoint       = 0x00000400
+	fileAttributeOffline            = 0x00001000
+	fileAttributeRecallOnOpen       = 0x00040000
+	fileAttributeRecallOnDataAccess = 0x00400000
+
+	ioReparseTagMountPoint = 0xA0000003
+	ioReparseTagSymlink    = 0xA000000C
+	// Cloud files (OneDrive and other sync engines) use 0x9000x01A, with
+	// the x nibble selecting a sub-type.
+	ioReparseTagCloud     = 0x9000001A
+	ioReparseTagCloudMask = 0xFFFF0FFF
+)
+
+// reparseKind classifies a Windows reparse point.
+type reparseKind int
+
+const (
+	reparseNone reparseKind = iota
+	reparseJunction
+	reparseSymlink
+	reparsePlaceholder
+)
+
+func (k reparseKind) String() string {
+	switch k {
+	case reparseJunction:
+		return "junction"
+	case reparseSymlink:
+		return "symlink"
+	case reparsePlaceholder:
+		return "cloud placeholder"
+	}
+	return "regular"
+}
+
+// classifyReparse classifies an entry from its file attributes and, for
+// reparse points, its reparse tag. Files with recall-on-access attributes
+// count as placeholders even without a cloud tag: reading them would
+// download their content.
+func classifyReparse(attrs, tag uint32) reparseKind {
+	if attrs&fileAttributeReparsePoint != 0 {
+		switch {
+		case tag == ioReparseTagMountPoint:
+			return reparseJunction
+		case tag == ioReparseTagSymlink:
+			return reparseSymlink
+		case tag&ioReparseTagCloudMask == ioReparseTagCloud:
+			return reparsePlaceholder
+		}
+	}
+	if attrs&(fileAttributeRecallOnDataAccess|fileAttributeRecallOnOpen|fileAttributeOffline) != 0 {
+		return reparsePlaceholder
+	}
+	return reparseNone
+}
+
+// entryReparse classifies a directory entry; it always reports
+// reparseNone outside Windows. Tests replace it to fake reparse points.
+var entryReparse = platformReparse
+
+var (
+	// followJunctions makes the walk descend into junctions, with cycle
+	// protection (-follow-junctions).
+	followJunctions bool
+
+	// logicalSize counts cloud placeholders at their logical size rather
+	// than as zero (-logical-size).
+	logicalSize bool
+)
+
+// reparseNote records how the walk treated one reparse point.
+type reparseNote struct {
+	Path   string
+	Kind   reparseKind
+	Action string
+}
+
+var (
+	reparseNotes []reparseNote
+	reparseMutex sync.Mutex
+)
+
+// noteReparse records a reparse point for the output section.
+func noteReparse(path string, kind reparseKind, action string) {
+	reparseMutex.Lock()
+	reparseNotes = append(reparseNotes, reparseNote{Path: path, Kind: kind, Action: action})
+	reparseMutex.Unlock()
+}
+
+// enterJunction reports whether the walk may descend into the junction at
+// path. Junctions that resolve to an ancestor of themselves, or to a
+// target already entered through another junction, would count data twice
+// or loop forever and are refused.
+func (w *walker) enterJunction(path string) (bool, string) {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false, fmt.Sprintf("not followed: %v", err)
+	}
+	parent, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err == nil && pathWithin(parent, target) {
+		return false, "not followed: points to an ancestor (cycle)"
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.junctionTargets == nil {
+		w.junctionTargets = make(map[string]bool)
+	}
+	if w.junctionTargets[target] {
+		return false, "not followed: target already scanned through another junction"
+	}
+	w.junctionTargets[target] = true
+	return true, "followed to " + displayPath(target)
+}
+
+// maxReparseNotes bounds the reparse point listing.
+const maxReparseNotes = 50
+
+// printReparseNotes writes the reparse point section.
+func printReparseNotes() {
+	notes := append([]reparseNote(nil), reparseNotes...)
+	sort.Slice(notes, func(i, j int) bool { return notes[i].Path < notes[j].Path })
+	counts := make(map[reparseKind]int)
+	for _, n := range notes {
+		counts[n.Kind]++
+	}
+	fmt.Fprintf(stdout, "\nReparse points: %d junctions, %d symlinks, %d cloud placeholders\n",
+		counts[reparseJunction], counts[reparseSymlink], counts[reparsePlaceholder])
+	for i, n := range notes {
+		if i == maxReparseNotes {
+			fmt.Fprintf(stdout, "  ... and %d more\n", len(notes)-i)
+			break
+		}
+		fmt.Fprintf(stdout, "  %-17s  %s  (%s)\n", n.Kind, displayPath(n.Path), n.Action)
+	}
+}
+
+// reparseKindOf is entryReparse with errors treated as "not a reparse
+// point", so that an unreadable attribute never hides an entry.
+func reparseKindOf(path string, e fs.DirEntry) reparseKind {
+	kind, err := entryReparse(path, e)
+	if err != nil {
+		return reparseNone
+	}
+	return kind
+}
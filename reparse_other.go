@@ -0,0 +1,10 @@
+//go:build !windows
+
+package main
+
+import "io/fs"
+
+// platformReparse reports no reparse points: they only exist on Windows.
+func platformReparse(path string, e fs.DirEntry) (reparseKind, error) {
+	return reparseNone, nil
+}
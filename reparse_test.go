@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestClassifyReparse(t *testing.T) {
+	tests := []struct {
+		attrs, tag uint32
+		want       reparseKind
+	}{
+		{0x20, 0, reparseNone}, // FILE_ATTRIBUTE_ARCHIVE
+		{fileAttributeReparsePoint | 0x10, ioReparseTagMountPoint, reparseJunction},
+		{fileAttributeReparsePoint, ioReparseTagSymlink, reparseSymlink},
+		{fileAttributeReparsePoint, ioReparseTagCloud, reparsePlaceholder},
+		{fileAttributeReparsePoint, 0x9000601A, reparsePlaceholder}, // IO_REPARSE_TAG_CLOUD_6
+		{fileAttributeRecallOnDataAccess, 0, reparsePlaceholder},
+		{fileAttributeOffline, 0, reparsePlaceholder},
+		{fileAttributeReparsePoint, 0x80000013, reparseNone}, // IO_REPARSE_TAG_DEDUP
+		{0, ioReparseTagMountPoint, reparseNone},             // tag without the attribute
+	}
+	for _, test := range tests {
+		if got := classifyReparse(test.attrs, test.tag); got != test.want {
+			t.Errorf("classifyReparse(%#x, %#x) = %v, want %v", test.attrs, test.tag, got, test.want)
+		}
+	}
+}
+
+// fakeReparse makes entryReparse report the given kinds by entry name.
+func fakeReparse(t *testing.T, kinds map[string]reparseKind) {
+	t.Helper()
+	old := entryReparse
+	entryReparse = func(path string, e fs.DirEntry) (reparseKind, error) {
+		return kinds[e.Name()], nil
+	}
+	t.Cleanup(func() {
+		entryReparse = old
+		followJunctions, logicalSize = false, false
+		reparseNotes = nil
+	})
+}
+
+func TestWalkReparsePoints(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"root/data/a.bin":   "aaaa",
+		"root/cloud.docx":   "1234567890",
+		"elsewhere/big.bin": "bbbbbbbb",
+	})
+	defer os.RemoveAll(tmpDir)
+	root := filepath.Join(tmpDir, "root")
+	// Stand-ins for junctions: a loop back to the root, and two links to
+	// the same directory outside the tree.
+	for name, target := range map[string]string{
+		"loop": root,
+		"ext1": filepath.Join(tmpDir, "elsewhere"),
+		"ext2": filepath.Join(tmpDir, "elsewhere"),
+	} {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skipf("cannot create symlinks: %v", err)
+		}
+	}
+	fakeReparse(t, map[string]reparseKind{
+		"loop": reparseJunction, "ext1": reparseJunction, "ext2": reparseJunction,
+		"cloud.docx": reparsePlaceholder,
+	})
+
+	resetResults()
+	if total := walkDirRecursive(root, 1, map[string]struct{}{}); total != 4 {
+		t.Errorf("default: total = %d, want 4 (junctions skipped, placeholder as 0)", total)
+	}
+	if len(reparseNotes) != 4 {
+		t.Errorf("default: got %d notes, want 4: %+v", len(reparseNotes), reparseNotes)
+	}
+
+	resetResults()
+	reparseNotes = nil
+	followJunctions, logicalSize = true, true
+	if total := walkDirRecursive(root, 1, map[string]struct{}{}); total != 4+10+8 {
+		t.Errorf("following: total = %d, want 22 (one junction to elsewhere, logical placeholder)", total)
+	}
+	actions := map[string]string{}
+	for _, n := range reparseNotes {
+		actions[filepath.Base(n.Path)] = n.Action
+	}
+	if !strings.Contains(actions["loop"], "cycle") {
+		t.Errorf("loop junction action = %q, want a cycle refusal", actions["loop"])
+	}
+	followed := 0
+	for _, name := range []string{"ext1", "ext2"} {
+		if strings.HasPrefix(actions[name], "followed") {
+			followed++
+		} else if !strings.Contains(actions[name], "already scanned") {
+			t.Errorf("%s action = %q", name, actions[name])
+		}
+	}
+	if followed != 1 {
+		t.Errorf("followed %d junctions to the same target, want 1", followed)
+	}
+	if !strings.Contains(actions["cloud.docx"], "logical size 10 B") {
+		t.Errorf("placeholder action = %q", actions["cloud.docx"])
+	}
+}
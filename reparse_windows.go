@@ -0,0 +1,37 @@
+//go:build windows
+
+package main
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// platformReparse reads the attributes of e and, for reparse points, the
+// reparse tag reported by FindFirstFile.
+func platformReparse(path string, e fs.DirEntry) (reparseKind, error) {
+	info, err := e.Info()
+	if err != nil {
+		return reparseNone, err
+	}
+	data, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return reparseNone, nil
+	}
+	attrs := data.FileAttributes
+	if attrs&fileAttributeReparsePoint == 0 {
+		return classifyReparse(attrs, 0), nil
+	}
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return reparseNone, err
+	}
+	var fd syscall.Win32finddata
+	h, err := syscall.FindFirstFile(p, &fd)
+	if err != nil {
+		return reparseNone, err
+	}
+	syscall.FindClose(h)
+	// For reparse points, dwReserved0 holds the reparse tag.
+	return classifyReparse(fd.FileAttributes, fd.Reserved0), nil
+}
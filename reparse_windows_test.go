@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestWalkSkipsRealJunction(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"root/file.txt":     "12345",
+		"target/inside.bin": "abcdefgh",
+	})
+	defer os.RemoveAll(tmpDir)
+	junction := filepath.Join(tmpDir, "root", "link")
+	out, err := exec.Command("cmd", "/c", "mklink", "/J", junction, filepath.Join(tmpDir, "target")).CombinedOutput()
+	if err != nil {
+		t.Skipf("mklink /J failed: %v: %s", err, out)
+	}
+	defer func() {
+		reparseNotes = nil
+		followJunctions = false
+	}()
+
+	resetResults()
+	reparseNotes = nil
+	if total := walkDirRecursive(filepath.Join(tmpDir, "root"), 1, map[string]struct{}{}); total != 5 {
+		t.Errorf("total = %d, want 5 with the junction skipped", total)
+	}
+	if len(reparseNotes) != 1 || reparseNotes[0].Kind != reparseJunction {
+		t.Errorf("notes = %+v, want one junction", reparseNotes)
+	}
+
+	resetResults()
+	reparseNotes = nil
+	followJunctions = true
+	if total := walkDirRecursive(filepath.Join(tmpDir, "root"), 1, map[string]struct{}{}); total != 13 {
+		t.Errorf("following: total = %d, want 13", total)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"math/rand/v2"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// transientErrnos are the errors worth retrying; flaky NFS mounts and USB
+// disks produce them sporadically and a second attempt usually succeeds.
+// Permanent conditions such as EACCES or ENOENT are never retried.
+var transientErrnos = []syscall.Errno{syscall.EIO, syscall.ESTALE, syscall.EINTR, syscall.EAGAIN}
+
+var (
+	// maxRetries and retryDelay configure retries of directory reads and
+	// entry stats; they are set from -retries and -retry-delay.
+	maxRetries = 2
+	retryDelay = 10 * time.Millisecond
+
+	// retrySleep is time.Sleep, replaceable in tests.
+	retrySleep = time.Sleep
+
+	// retryCount is the number of retries performed during the scan.
+	retryCount atomic.Int64
+)
+
+// isTransient reports whether err is on the retry whitelist.
+func isTransient(err error) bool {
+	for _, errno := range transientErrnos {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// withRetry calls op, retrying transient failures up to maxRetries times with
+// exponential, jittered backoff. The last result is returned either way.
+func withRetry[T any](op func() (T, error)) (T, error) {
+	v, err := op()
+	for attempt := 0; err != nil && attempt < maxRetries && isTransient(err); attempt++ {
+		retryCount.Add(1)
+		retrySleep(backoff(attempt))
+		v, err = op()
+	}
+	return v, err
+}
+
+// backoff returns the delay before retry number attempt: retryDelay doubled
+// per attempt, with ±50% jitter so parallel walkers do not retry in lockstep.
+func backoff(attempt int) time.Duration {
+	d := retryDelay << attempt
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// noRetrySleep disables backoff delays for the duration of a test.
+func noRetrySleep(t *testing.T) {
+	t.Helper()
+	old := retrySleep
+	retrySleep = func(time.Duration) {}
+	t.Cleanup(func() { retrySleep = old })
+}
+
+func TestWithRetry(t *testing.T) {
+	noRetrySleep(t)
+	eio := &os.PathError{Op: "readdirent", Path: "/x", Err: syscall.EIO}
+	eacces := &os.PathError{Op: "open", Path: "/x", Err: syscall.EACCES}
+
+	tests := []struct {
+		name     string
+		errs     []error // error returned by each successive attempt
+		calls    int
+		retries  int64
+		succeeds bool
+	}{
+		{"success first time", []error{nil}, 1, 0, true},
+		{"transient then success", []error{eio, nil}, 2, 1, true},
+		{"two transients then success", []error{eio, syscall.ESTALE, nil}, 3, 2, true},
+		{"retries exhausted", []error{eio, eio, eio, nil}, 3, 2, false},
+		{"permanent error not retried", []error{eacces, nil}, 1, 0, false},
+		{"not found not retried", []error{fs.ErrNotExist, nil}, 1, 0, false},
+		{"transient then permanent", []error{syscall.EINTR, eacces, nil}, 2, 1, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			retryCount.Store(0)
+			calls := 0
+			v, err := withRetry(func() (int, error) {
+				err := test.errs[calls]
+				calls++
+				return calls, err
+			})
+			if calls != test.calls {
+				t.Errorf("op called %d times, want %d", calls, test.calls)
+			}
+			if (err == nil) != test.succeeds {
+				t.Errorf("err = %v, want success %v", err, test.succeeds)
+			}
+			if v != calls {
+				t.Errorf("returned value %d is not from the last attempt %d", v, calls)
+			}
+			if got := retryCount.Load(); got != test.retries {
+				t.Errorf("retry count = %d, want %d", got, test.retries)
+			}
+		})
+	}
+}
+
+func TestBackoffIsBoundedAndGrows(t *testing.T) {
+	for attempt := 0; attempt < 3; attempt++ {
+		base := retryDelay << attempt
+		for i := 0; i < 100; i++ {
+			if d := backoff(attempt); d < base/2 || d >= base*3/2 {
+				t.Fatalf("backoff(%d) = %v, want within [%v, %v)", attempt, d, base/2, base*3/2)
+			}
+		}
+	}
+}
+
+func TestWalkRetriesTransientReadDir(t *testing.T) {
+	noRetrySleep(t)
+	tmpDir := createTestDir(t, map[string]string{
+		"flaky/a.bin": strings.Repeat("a", 100),
+		"flaky/b.bin": strings.Repeat("b", 50),
+		"steady.bin":  strings.Repeat("s", 10),
+	})
+	defer os.RemoveAll(tmpDir)
+
+	flaky := filepath.Join(tmpDir, "flaky")
+	failed := false
+	oldReadDir := readDir
+	readDir = func(name string) ([]os.DirEntry, error) {
+		if name == flaky && !failed {
+			failed = true
+			return nil, &os.PathError{Op: "readdirent", Path: name, Err: syscall.EIO}
+		}
+		return oldReadDir(name)
+	}
+	defer func() { readDir = oldReadDir }()
+
+	resetResults()
+	retryCount.Store(0)
+	total := walkDirRecursive(tmpDir, 1, map[string]struct{}{})
+	if total != 160 {
+		t.Errorf("total = %d, want 160: the flaky directory must be counted after the retry", total)
+	}
+	if retryCount.Load() != 1 {
+		t.Errorf("retry count = %d, want 1", retryCount.Load())
+	}
+	if len(skippedEntries) != 0 {
+		t.Errorf("a recovered error should not mark entries as skipped: %v", skippedEntries)
+	}
+}
+
+func TestWalkDoesNotRetryPermissionDenied(t *testing.T) {
+	noRetrySleep(t)
+	tmpDir := createTestDir(t, map[string]string{"locked/a.bin": "a"})
+	defer os.RemoveAll(tmpDir)
+
+	locked := filepath.Join(tmpDir, "locked")
+	calls := 0
+	oldReadDir := readDir
+	readDir = func(name string) ([]os.DirEntry, error) {
+		if name == locked {
+			calls++
+			return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EACCES}
+		}
+		return oldReadDir(name)
+	}
+	defer func() { readDir = oldReadDir }()
+
+	resetResults()
+	oldStderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	setupOutput(os.Stdout, os.Stderr)
+	walkDirRecursive(tmpDir, 1, map[string]struct{}{})
+	os.Stderr.Close()
+	os.Stderr = oldStderr
+	setupOutput(os.Stdout, os.Stderr)
+
+	if calls != 1 {
+		t.Errorf("permission denied was attempted %d times, want 1", calls)
+	}
+	if skippedEntries[locked] != 1 {
+		t.Errorf("locked directory should be recorded as skipped: %v", skippedEntries)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"sort"
+	"sync"
+	"syscall"
+)
+
+// jsonSchemaVersion is the version of the -format=json and -format=ndjson
+// documents, as major.minor. Adding a field bumps the minor version;
+// renaming or removing one, or changing what it means, bumps the major.
+// Every field of a major version stays in place until the next.
+const jsonSchemaVersion = "1.0"
+
+// scanError is an entry the walk could not read, as the JSON formats
+// report it.
+type scanError struct {
+	Path string `json:"path"`
+	// Op is what failed: "read directory" or "stat".
+	Op    string     `json:"op"`
+	Class errorClass `json:"class"`
+	// Errno is the system error number, where there is one.
+	Errno   int    `json:"errno,omitempty"`
+	Message string `json:"message"`
+}
+
+// newScanError describes err, met doing op on path. The message leaves
+// out the path, which the error has a field for.
+func newScanError(path, op string, err error) scanError {
+	e := scanError{Path: path, Op: op, Class: classifyError(err), Message: err.Error()}
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		e.Errno = int(errno)
+	}
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		e.Message = pe.Err.Error()
+	}
+	return e
+}
+
+// errNegativeSize is the error of an entry whose filesystem reports a
+// negative size.
+var errNegativeSize = errors.New("filesystem reports a negative size")
+
+// scanErrorLog collects the walk's read errors for -format=json. It is
+// nil for the other formats; -format=ndjson streams them instead.
+type scanErrorLog struct {
+	mu   sync.Mutex
+	list []scanError
+}
+
+// scanErrors is the active log, if any.
+var scanErrors *scanErrorLog
+
+// add records one error.
+func (l *scanErrorLog) add(e scanError) {
+	l.mu.Lock()
+	l.list = append(l.list, e)
+	l.mu.Unlock()
+}
+
+// sorted returns the errors in path order, never nil.
+func (l *scanErrorLog) sorted() []scanError {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	list := append([]scanError{}, l.list...)
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	return list
+}
+
+// report returns the errors for a JSON report, sorted, with paths made
+// relative to root when canonical is set, as the entries' are.
+func (l *scanErrorLog) report(root string, canonical bool) []scanError {
+	if l == nil {
+		return []scanError{}
+	}
+	list := l.sorted()
+	if canonical {
+		for i := range list {
+			list[i].Path = canonicalPath(root, list[i].Path)
+		}
+	}
+	return list
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// failWalk makes listing the directory named dir and stat'ing the file
+// named file fail with EACCES.
+func failWalk(t *testing.T, dir, file string) {
+	t.Helper()
+	oldRead, oldInfo := readDir, entryInfo
+	readDir = func(name string) ([]fs.DirEntry, error) {
+		if filepath.Base(name) == dir {
+			return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EACCES}
+		}
+		return oldRead(name)
+	}
+	entryInfo = func(e fs.DirEntry) (fs.FileInfo, error) {
+		if e.Name() == file {
+			return nil, &os.PathError{Op: "lstat", Path: e.Name(), Err: syscall.EACCES}
+		}
+		return oldInfo(e)
+	}
+	t.Cleanup(func() { readDir, entryInfo = oldRead, oldInfo })
+}
+
+func TestJSONScanErrors(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"locked/f": strings.Repeat("x", 2000),
+		"open/bad": strings.Repeat("x", 2000),
+		"open/ok":  strings.Repeat("x", 2000),
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+	failWalk(t, "locked", "bad")
+	noRetrySleep(t)
+	report := filepath.Join(t.TempDir(), "report.json")
+
+	resetResults()
+	if out, err := runCaptured(t, "-format=json", "-o", report, tmpDir, "1K"); err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rep jsonReport
+	if err := json.Unmarshal(data, &rep); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, data)
+	}
+	want := []scanError{
+		{Path: filepath.Join(tmpDir, "locked"), Op: "read directory", Class: classPermission, Errno: int(syscall.EACCES), Message: syscall.EACCES.Error()},
+		{Path: filepath.Join(tmpDir, "open", "bad"), Op: "stat", Class: classPermission, Errno: int(syscall.EACCES), Message: syscall.EACCES.Error()},
+	}
+	if len(rep.Errors) != len(want) {
+		t.Fatalf("errors = %+v, want %+v", rep.Errors, want)
+	}
+	for i := range want {
+		if rep.Errors[i] != want[i] {
+			t.Errorf("error %d = %+v, want %+v", i, rep.Errors[i], want[i])
+		}
+	}
+	if rep.SchemaVersion != jsonSchemaVersion {
+		t.Errorf("schema_version = %q, want %q", rep.SchemaVersion, jsonSchemaVersion)
+	}
+	if s := rep.Summary; s == nil || s.ErrorCount != 2 || s.Errors != 2 {
+		t.Errorf("summary = %+v, want an error_count of 2", rep.Summary)
+	}
+
+	resetResults()
+	out, err := runCaptured(t, "-format=ndjson", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("ndjson run: %v\n%s", err, out)
+	}
+	var errs []ndjsonError
+	var sum ndjsonSummary
+	for _, line := range strings.Split(out, "\n") {
+		switch {
+		case strings.HasPrefix(line, `{"type":"error"`):
+			var e ndjsonError
+			if err := json.Unmarshal([]byte(line), &e); err != nil {
+				t.Fatalf("invalid line %q: %v", line, err)
+			}
+			errs = append(errs, e)
+		case strings.HasPrefix(line, `{"type":"summary"`):
+			if err := json.Unmarshal([]byte(line), &sum); err != nil {
+				t.Fatalf("invalid line %q: %v", line, err)
+			}
+		}
+	}
+	if len(errs) != 2 || sum.ErrorCount != 2 || sum.SchemaVersion != jsonSchemaVersion {
+		t.Errorf("ndjson: %d error lines, summary %+v; want 2 and an error_count of 2\n%s", len(errs), sum, out)
+	}
+}
+
+// schemaFields are the fields every document of a major schema version
+// carries. A field may only leave this list with a new major version.
+var schemaFields = map[string]map[string][]string{
+	"1": {
+		"report":    {"schema_version", "root", "threshold", "exclude", "total", "entries", "errors", "mount_crossings", "summary"},
+		"entry":     {"path", "size", "human_size", "is_dir"},
+		"summary":   {"total", "files", "dirs", "entries_shown", "errors", "error_count", "elapsed_seconds"},
+		"ndjson":    {"type", "path", "size", "is_dir", "time"},
+		"ndjsonEnd": {"type", "root", "total", "entries", "time", "schema_version", "error_count"},
+	},
+}
+
+// missingFields returns the names missing from the JSON object obj.
+func missingFields(obj []byte, names []string) []string {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(obj, &m); err != nil {
+		return names
+	}
+	var missing []string
+	for _, name := range names {
+		if _, ok := m[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+func TestJSONSchemaFields(t *testing.T) {
+	major, _, _ := strings.Cut(jsonSchemaVersion, ".")
+	fields, ok := schemaFields[major]
+	if !ok {
+		t.Fatalf("no field list for schema major version %s", major)
+	}
+	tmpDir := createTestDir(t, map[string]string{"a/f": strings.Repeat("x", 2000)})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+
+	resetResults()
+	out, err := runCaptured(t, "-format=json", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	var rep struct {
+		Entries []json.RawMessage `json:"entries"`
+		Summary json.RawMessage   `json:"summary"`
+	}
+	if err := json.Unmarshal([]byte(out), &rep); err != nil || len(rep.Entries) == 0 {
+		t.Fatalf("invalid report (%v):\n%s", err, out)
+	}
+	check := func(kind string, obj []byte) {
+		if missing := missingFields(obj, fields[kind]); len(missing) > 0 {
+			t.Errorf("%s lacks %v:\n%s", kind, missing, obj)
+		}
+	}
+	check("report", []byte(out))
+	check("entry", rep.Entries[0])
+	check("summary", rep.Summary)
+
+	resetResults()
+	out, err = runCaptured(t, "-format=ndjson", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("ndjson run: %v\n%s", err, out)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	check("ndjson", []byte(lines[0]))
+	check("ndjsonEnd", []byte(lines[len(lines)-1]))
+}
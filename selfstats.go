@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// selfStatsInterval is how often the goroutine count is sampled. Sampling
+// keeps the spawn path in the walk free of bookkeeping.
+const selfStatsInterval = 20 * time.Millisecond
+
+// selfStats is the scan's own resource usage (-self-stats).
+type selfStats struct {
+	Wall           time.Duration
+	User, System   time.Duration
+	HaveCPU        bool
+	PeakRSS        uint64 // bytes; zero when the platform does not report it
+	PeakGoroutines int
+	GCCycles       uint32
+}
+
+// selfStatsSampler measures resource usage between start and stop.
+type selfStatsSampler struct {
+	start      time.Time
+	startUsage processUsage
+	startGC    uint32
+
+	mu   sync.Mutex
+	peak int
+
+	done     chan struct{}
+	haltOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// startSelfStats begins measuring and sampling the goroutine count.
+func startSelfStats() *selfStatsSampler {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	s := &selfStatsSampler{
+		start:      time.Now(),
+		startUsage: readProcessUsage(),
+		startGC:    ms.NumGC,
+		peak:       runtime.NumGoroutine(),
+		done:       make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.sample()
+	return s
+}
+
+func (s *selfStatsSampler) sample() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(selfStatsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.notePeak()
+		}
+	}
+}
+
+func (s *selfStatsSampler) notePeak() {
+	n := runtime.NumGoroutine()
+	s.mu.Lock()
+	if n > s.peak {
+		s.peak = n
+	}
+	s.mu.Unlock()
+}
+
+// halt ends sampling. It is safe to call more than once.
+func (s *selfStatsSampler) halt() {
+	s.haltOnce.Do(func() {
+		close(s.done)
+		s.wg.Wait()
+	})
+}
+
+// stop ends sampling and returns the usage since start.
+func (s *selfStatsSampler) stop() selfStats {
+	s.notePeak()
+	s.halt()
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	end := readProcessUsage()
+	st := selfStats{
+		Wall:           time.Since(s.start),
+		HaveCPU:        end.ok && s.startUsage.ok,
+		PeakRSS:        end.peakRSS,
+		PeakGoroutines: s.peak,
+		GCCycles:       ms.NumGC - s.startGC,
+	}
+	if st.HaveCPU {
+		st.User = end.user - s.startUsage.user
+		st.System = end.system - s.startUsage.system
+	}
+	return st
+}
+
+// print writes the resource usage section.
+func (st selfStats) print() {
+	fmt.Fprintln(stdout, "\nScan resource usage:")
+	fmt.Fprintf(stdout, "  Wall time:        %v\n", st.Wall.Round(time.Millisecond))
+	if st.HaveCPU {
+		fmt.Fprintf(stdout, "  CPU time:         %v (user %v, system %v)\n",
+			(st.User + st.System).Round(time.Millisecond), st.User.Round(time.Millisecond), st.System.Round(time.Millisecond))
+	} else {
+		fmt.Fprintln(stdout, "  CPU time:         not available on this platform")
+	}
+	if st.PeakRSS > 0 {
+		fmt.Fprintf(stdout, "  Peak RSS:         %s\n", humanReadableSize(st.PeakRSS))
+	} else {
+		fmt.Fprintln(stdout, "  Peak RSS:         not available on this platform")
+	}
+	fmt.Fprintf(stdout, "  Peak goroutines:  %d\n", st.PeakGoroutines)
+	fmt.Fprintf(stdout, "  GC cycles:        %d\n", st.GCCycles)
+}
+
+// jsonSelfStats is selfStats in the JSON report, with times in seconds.
+// CPU times and peak RSS are absent where the platform does not report
+// them.
+type jsonSelfStats struct {
+	Wall           float64  `json:"wall_seconds"`
+	User           *float64 `json:"user_seconds,omitempty"`
+	System         *float64 `json:"system_seconds,omitempty"`
+	PeakRSS        uint64   `json:"peak_rss_bytes,omitempty"`
+	PeakGoroutines int      `json:"peak_goroutines"`
+	GCCycles       uint32   `json:"gc_cycles"`
+}
+
+// report converts st for the JSON report.
+func (st selfStats) report() *jsonSelfStats {
+	r := &jsonSelfStats{
+		Wall:           st.Wall.Seconds(),
+		PeakRSS:        st.PeakRSS,
+		PeakGoroutines: st.PeakGoroutines,
+		GCCycles:       st.GCCycles,
+	}
+	if st.HaveCPU {
+		user, system := st.User.Seconds(), st.System.Seconds()
+		r.User, r.System = &user, &system
+	}
+	return r
+}
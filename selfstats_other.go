@@ -0,0 +1,17 @@
+//go:build !unix
+
+package main
+
+import "time"
+
+// processUsage is a snapshot of process CPU time and peak RSS.
+type processUsage struct {
+	user, system time.Duration
+	peakRSS      uint64
+	ok           bool
+}
+
+// readProcessUsage reports that CPU time and peak RSS are unavailable.
+func readProcessUsage() processUsage {
+	return processUsage{}
+}
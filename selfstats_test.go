@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSelfStatsConsistent(t *testing.T) {
+	resetResults()
+	files := map[string]string{}
+	for i := 0; i < 20; i++ {
+		files[fmt.Sprintf("d%02d/f.txt", i)] = "x"
+	}
+	tmpDir := createTestDir(t, files)
+	defer os.RemoveAll(tmpDir)
+
+	// Burn some CPU in the walk and force a GC so every counter moves.
+	var once sync.Once
+	oldRead := readDir
+	defer func() { readDir = oldRead }()
+	readDir = func(p string) ([]fs.DirEntry, error) {
+		once.Do(runtime.GC)
+		for end := time.Now().Add(2 * time.Millisecond); time.Now().Before(end); {
+		}
+		time.Sleep(selfStatsInterval)
+		return oldRead(p)
+	}
+
+	sampler := startSelfStats()
+	walkDirRecursive(tmpDir, 1, map[string]struct{}{})
+	st := sampler.stop()
+
+	if st.Wall <= 0 {
+		t.Errorf("wall time = %v, want > 0", st.Wall)
+	}
+	if st.PeakGoroutines < 2 {
+		t.Errorf("peak goroutines = %d, want the walk's goroutines counted", st.PeakGoroutines)
+	}
+	if st.GCCycles < 1 {
+		t.Errorf("GC cycles = %d, want at least the forced one", st.GCCycles)
+	}
+	if runtime.GOOS == "windows" {
+		return
+	}
+	if !st.HaveCPU || st.User+st.System <= 0 {
+		t.Errorf("CPU time = %v user + %v system, want > 0", st.User, st.System)
+	}
+	if limit := st.Wall * time.Duration(runtime.NumCPU()); st.User+st.System > limit+10*time.Millisecond {
+		t.Errorf("CPU time %v exceeds wall time × cores (%v)", st.User+st.System, limit)
+	}
+	if st.PeakRSS == 0 {
+		t.Error("peak RSS not reported")
+	}
+}
+
+func TestSelfStatsReport(t *testing.T) {
+	resetResults()
+	tmpDir := createTestDir(t, map[string]string{"a.txt": "aaa"})
+	defer os.RemoveAll(tmpDir)
+
+	out, err := runCaptured(t, "-no-hints", "-self-stats", tmpDir, "1")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	for _, want := range []string{"Scan resource usage:", "Wall time:", "CPU time:", "Peak RSS:", "Peak goroutines:", "GC cycles:"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestSelfStatsJSON(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{"a.txt": "aaa"})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+
+	for _, flag := range []bool{false, true} {
+		resetResults()
+		args := []string{"-format=json", tmpDir, "1"}
+		if flag {
+			args = append([]string{"-self-stats"}, args...)
+		}
+		out, err := runCaptured(t, args...)
+		if err != nil {
+			t.Fatalf("run: %v\n%s", err, out)
+		}
+		var rep jsonReport
+		if err := json.Unmarshal([]byte(out), &rep); err != nil {
+			t.Fatalf("output is not a JSON document: %v\n%s", err, out)
+		}
+		if !flag {
+			if rep.SelfStats != nil {
+				t.Errorf("self_stats present without -self-stats: %+v", *rep.SelfStats)
+			}
+			continue
+		}
+		st := rep.SelfStats
+		if st == nil {
+			t.Fatalf("self_stats missing:\n%s", out)
+		}
+		if st.Wall <= 0 || st.PeakGoroutines < 1 {
+			t.Errorf("self_stats = %+v, want wall time and goroutines", *st)
+		}
+		if runtime.GOOS != "windows" && (st.User == nil || st.System == nil || st.PeakRSS == 0) {
+			t.Errorf("self_stats = %+v, want CPU times and peak RSS", *st)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+//go:build unix
+
+package main
+
+import (
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// processUsage is a getrusage snapshot of the whole process.
+type processUsage struct {
+	user, system time.Duration
+	peakRSS      uint64
+	ok           bool
+}
+
+// readProcessUsage reads CPU time and peak RSS via getrusage.
+func readProcessUsage() processUsage {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return processUsage{}
+	}
+	rss := uint64(ru.Maxrss)
+	if runtime.GOOS != "darwin" && runtime.GOOS != "ios" {
+		rss *= 1024 // kilobytes everywhere but Apple platforms
+	}
+	return processUsage{
+		user:    time.Duration(ru.Utime.Nano()),
+		system:  time.Duration(ru.Stime.Nano()),
+		peakRSS: rss,
+		ok:      true,
+	}
+}
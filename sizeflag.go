@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sizeFlag is a flag.Value for sizes. It accepts exactly what the min_size
+// argument accepts and, if allowPercent is set, a percentage such as "5%"
+// whose meaning (usually of a filesystem's capacity) is up to the flag.
+// Every size-taking flag should be a sizeFlag so that the syntax never
+// drifts between them.
+type sizeFlag struct {
+	Bytes   uint64
+	Percent float64 // set instead of Bytes for a percentage
+	IsSet   bool
+
+	allowPercent bool
+	text         string // as given, for reparse
+}
+
+// sizeVar defines a size flag on fs.
+func sizeVar(fs *flag.FlagSet, p *sizeFlag, name string, allowPercent bool, usage string) {
+	*p = sizeFlag{allowPercent: allowPercent}
+	fs.Var(p, name, usage)
+}
+
+// String implements flag.Value.
+func (f *sizeFlag) String() string {
+	if f == nil || !f.IsSet {
+		return ""
+	}
+	if f.Percent > 0 {
+		return strconv.FormatFloat(f.Percent, 'f', -1, 64) + "%"
+	}
+	return strconv.FormatUint(f.Bytes, 10)
+}
+
+// Set implements flag.Value. The flag package prefixes errors with the
+// flag's name; the message adds an example of the accepted syntax.
+func (f *sizeFlag) Set(s string) error {
+	example := "want a size such as 1.5G or 1536MiB"
+	if f.allowPercent {
+		example += ", or a percentage such as 5%"
+	}
+	if num, ok := strings.CutSuffix(strings.TrimSpace(s), "%"); ok {
+		if !f.allowPercent {
+			return fmt.Errorf("percentages are not accepted here; %s", example)
+		}
+		p, err := strconv.ParseFloat(num, 64)
+		if err != nil || p <= 0 || p > 100 {
+			return fmt.Errorf("invalid percentage %q; %s", s, example)
+		}
+		f.Bytes, f.Percent, f.IsSet = 0, p, true
+		return nil
+	}
+	n, err := parseSize(s)
+	if err != nil {
+		return fmt.Errorf("%v; %s", err, example)
+	}
+	f.Bytes, f.Percent, f.IsSet, f.text = n, 0, true, s
+	return nil
+}
+
+// reparse reads a set size again, for when the units it is read in have
+// changed since (-si).
+func (f *sizeFlag) reparse() error {
+	if !f.IsSet || f.Percent > 0 {
+		return nil
+	}
+	return f.Set(f.text)
+}
+
+// reparseSizeFlags reparses every size flag on fs that was set (-si).
+func reparseSizeFlags(fs *flag.FlagSet) error {
+	var err error
+	fs.VisitAll(func(fl *flag.Flag) {
+		f, ok := fl.Value.(*sizeFlag)
+		if !ok || err != nil {
+			return
+		}
+		if e := f.reparse(); e != nil {
+			err = fmt.Errorf("invalid value %q for flag -%s: %v", f.text, fl.Name, e)
+		}
+	})
+	return err
+}
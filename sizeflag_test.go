@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSizeFlag(t *testing.T) {
+	var limit, share sizeFlag
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	sizeVar(fs, &limit, "limit", false, "a size")
+	sizeVar(fs, &share, "share", true, "a size or percentage")
+
+	for _, name := range []string{"limit", "share"} {
+		for in, want := range map[string]uint64{
+			"1.5G":    1536 * 1024 * 1024,
+			"1536MiB": 1536 * 1024 * 1024,
+			"1,5G":    1536 * 1024 * 1024,
+			"4096":    4096,
+		} {
+			if err := fs.Set(name, in); err != nil {
+				t.Errorf("-%s=%s: %v", name, in, err)
+				continue
+			}
+			f := fs.Lookup(name).Value.(*sizeFlag)
+			if !f.IsSet || f.Bytes != want {
+				t.Errorf("-%s=%s = %+v, want %d bytes", name, in, f, want)
+			}
+		}
+	}
+
+	err := fs.Parse([]string{"-limit=abc"})
+	if err == nil || !strings.Contains(err.Error(), "-limit") || !strings.Contains(err.Error(), "1.5G") {
+		t.Errorf("-limit=abc error = %v, want flag name and an example", err)
+	}
+	if err := fs.Set("limit", "5%"); err == nil {
+		t.Error("-limit accepted a percentage")
+	}
+	if err := fs.Set("share", "5%"); err != nil || share.Percent != 5 || share.Bytes != 0 {
+		t.Errorf("-share=5%% = %+v, %v", share, err)
+	}
+	for _, bad := range []string{"0%", "101%", "x%"} {
+		if err := fs.Set("share", bad); err == nil {
+			t.Errorf("-share=%s accepted", bad)
+		}
+	}
+}
+
+func TestSIReparsesEverySizeFlag(t *testing.T) {
+	tmpDir := t.TempDir()
+	fakeMounts(t, nil)
+	var parsed *flag.FlagSet
+	flagsParsed = func(fs *flag.FlagSet) { parsed = fs }
+	defer func() { flagsParsed = nil }()
+
+	// Find the size flags, then give every one of them 1G before -si.
+	resetResults()
+	if out, err := runCaptured(t, tmpDir, "1G"); err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	var args, names []string
+	parsed.VisitAll(func(fl *flag.Flag) {
+		if _, ok := fl.Value.(*sizeFlag); ok {
+			args = append(args, "-"+fl.Name+"=1G")
+			names = append(names, fl.Name)
+		}
+	})
+	if len(names) == 0 {
+		t.Fatal("no size flags registered")
+	}
+	args = append(args, "-si", tmpDir, "1G")
+
+	resetResults()
+	if out, err := runCaptured(t, args...); err != nil {
+		t.Fatalf("run %q: %v\n%s", args, err, out)
+	}
+	for _, name := range names {
+		if f := parsed.Lookup(name).Value.(*sizeFlag); f.Bytes != 1e9 {
+			t.Errorf("-%s=1G -si = %d bytes, want 1000000000", name, f.Bytes)
+		}
+	}
+}
+
+func TestEverySizeFlagIsASizeFlag(t *testing.T) {
+	tmpDir := t.TempDir()
+	fakeMounts(t, nil)
+	var parsed *flag.FlagSet
+	flagsParsed = func(fs *flag.FlagSet) { parsed = fs }
+	defer func() { flagsParsed = nil }()
+	resetResults()
+	if out, err := runCaptured(t, tmpDir, "1G"); err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+
+	// The flags that take one size. A new one belongs here, and a size
+	// read as a plain number, or described as "this much", is caught.
+	known := map[string]bool{"free": true, "min-unique": true}
+	seen := 0
+	parsed.VisitAll(func(fl *flag.Flag) {
+		f, isSize := fl.Value.(*sizeFlag)
+		looksSized := strings.HasPrefix(fmt.Sprintf("%T", fl.Value), "*flag.uint64") || strings.Contains(fl.Usage, "this much")
+		switch {
+		case isSize && !known[fl.Name]:
+			t.Errorf("-%s is a size flag this test does not know", fl.Name)
+		case !isSize && (known[fl.Name] || looksSized):
+			t.Errorf("-%s takes a size but is a %T, not a *sizeFlag", fl.Name, fl.Value)
+		}
+		if !isSize {
+			return
+		}
+		seen++
+		for in, want := range map[string]uint64{"1.5G": 1536 << 20, "1Gi": 1 << 30} {
+			if err := f.Set(in); err != nil || f.Bytes != want {
+				t.Errorf("-%s=%s = %d bytes, %v; want %d", fl.Name, in, f.Bytes, err, want)
+			}
+		}
+		for _, bad := range []string{"junk", "1.5Q", ""} {
+			if err := f.Set(bad); err == nil {
+				t.Errorf("-%s=%q accepted", fl.Name, bad)
+			}
+		}
+	})
+	if seen != len(known) {
+		t.Errorf("found %d of the %d known size flags", seen, len(known))
+	}
+}
@@ -1,15 +1,23 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"math/bits"
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // FileInfo holds information about a file or directory.
@@ -17,129 +25,945 @@ type FileInfo struct {
 	Path  string
 	Size  uint64
 	IsDir bool
+
+	// MemoryBacked marks entries on tmpfs/ramfs, which use RAM rather than disk.
+	MemoryBacked bool
+
+	// SELinuxContext and HasACL are filled in by -audit-labels.
+	SELinuxContext string
+	HasACL         bool
+
+	// OpenBy lists the processes holding the file open (-check-open).
+	OpenBy []fileUser
+
+	// Cached is the estimated part of a file in the page cache, set when
+	// CacheProbed (-peek-cache).
+	Cached      uint64
+	CacheProbed bool
+
+	// OldestMTime and NewestMTime bound the modification times of all files
+	// below a directory. They are only set when trackDirTimes is enabled.
+	OldestMTime, NewestMTime time.Time
+
+	// ModTime is a file's modification time, set when trackDirTimes is
+	// enabled.
+	ModTime time.Time
+	// DirMTime is a directory's own modification time, set when
+	// trackSelfTimes reports true (-dir-times).
+	DirMTime time.Time
+
+	// Owner is the entry's owning user and group, filled in by -show-owner.
+	Owner *entryOwner
+
+	// Device is the storage holding the entry, filled in by -show-device.
+	Device *blockDevice
+
+	// Symlink marks a listed symlink, whose size is the link's own and
+	// not its target's. LinkTarget is where it points, as os.Readlink
+	// gives it.
+	Symlink    bool
+	LinkTarget string
+
+	// Context marks an ancestor shown by -show-ancestors only to place
+	// listed entries; it does not qualify and is not counted.
+	Context bool
+
+	// Peek holds a listed directory's largest immediate children, largest
+	// first, when -peek is given.
+	Peek []peekChild
+
+	// ParentSize is the walk-time total of the entry's parent directory,
+	// filled in for -percent-of=parent.
+	ParentSize uint64
+
+	// FileCount is the number of files anywhere below a directory. It is
+	// only set when trackFileCounts is enabled.
+	FileCount uint64
+
+	// LowerBound marks directories whose size is a lower bound because
+	// they are, or contain, a partially listed directory.
+	LowerBound bool
+
+	// Unique and Shared are the bytes deleting the entry would and would
+	// not free, when trackLinks is set.
+	Unique, Shared uint64
+
+	// PathViolations are the -path-audit rules the entry's path breaks.
+	PathViolations []pathViolation
+
+	// Annotations hold the values of the -annotate annotators, in order.
+	Annotations []annotation
+}
+
+// datedFile is a qualifying file together with its modification time.
+type datedFile struct {
+	Path    string
+	Size    uint64
+	ModTime time.Time
 }
 
 var (
 	results      []FileInfo
 	resultsMutex sync.Mutex
+
+	// oldestFile and newestFile are the qualifying files with the earliest
+	// and latest modification times. They are guarded by resultsMutex.
+	oldestFile, newestFile *datedFile
+
+	// skippedEntries counts, per directory, the entries that could not be
+	// read. Those directories' sizes are lower bounds.
+	skippedEntries = make(map[string]int)
+	skippedMutex   sync.Mutex
+)
+
+// readDir and entryInfo are the filesystem operations used by the walk.
+// Tests replace them to inject failures and delays.
+var (
+	readDir   = os.ReadDir
+	entryInfo = func(e fs.DirEntry) (fs.FileInfo, error) { return e.Info() }
 )
 
+var (
+	// errAmbiguousSeparator is returned for numbers using both "." and ",".
+	errAmbiguousSeparator = errors.New("ambiguous decimal separator: write 1.5G or 1,5G, not both")
+	// errDigitGrouping is returned for grouped numbers such as "1,000K"
+	// unless -locale-numbers is set.
+	errDigitGrouping = errors.New("digit grouping is not supported: write 1000K instead of 1,000K, or pass -locale-numbers")
+
+	// groupedNumber matches numbers with comma thousands separators.
+	groupedNumber = regexp.MustCompile(`^\d{1,3}(,\d{3})+(\.\d+)?$`)
+
+	// localeNumbers enables parsing of grouped numbers in parseSize.
+	localeNumbers bool
+)
+
+// normalizeNumber rewrites the numeric part of a size into the form
+// strconv.ParseFloat expects. A single comma is accepted as a decimal
+// separator; grouping commas are only accepted when localeNumbers is set.
+func normalizeNumber(num string) (string, error) {
+	if !strings.Contains(num, ",") {
+		return num, nil
+	}
+	if localeNumbers && groupedNumber.MatchString(num) {
+		return strings.ReplaceAll(num, ",", ""), nil
+	}
+	if strings.Contains(num, ".") {
+		return "", errAmbiguousSeparator
+	}
+	if groupedNumber.MatchString(num) {
+		return "", errDigitGrouping
+	}
+	if strings.Count(num, ",") == 1 {
+		return strings.Replace(num, ",", ".", 1), nil
+	}
+	return "", fmt.Errorf("invalid size number: %s", num)
+}
+
 // parseSize converts a human-readable size string (e.g., "100M", "2G") to bytes.
 func parseSize(sizeStr string) (uint64, error) {
-	re := regexp.MustCompile(`(?i)^([\d\.]+)\s*([kmgtp]?b?)$`)
+	re := regexp.MustCompile(`(?i)^([\d\.,]+)\s*((?:[kmgtp]i?)?b?)$`)
 	matches := re.FindStringSubmatch(strings.TrimSpace(sizeStr))
 	if len(matches) != 3 {
 		return 0, fmt.Errorf("invalid size format: %s", sizeStr)
 	}
 
-	size, err := strconv.ParseFloat(matches[1], 64)
+	num, err := normalizeNumber(matches[1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", sizeStr, err)
+	}
+	size, err := strconv.ParseFloat(num, 64)
 	if err != nil {
 		return 0, fmt.Errorf("invalid size number: %s", matches[1])
 	}
 
+	// With -si only the "i" units are binary: 1GB is 10^9 and 1GiB 2^30.
 	unit := strings.ToUpper(matches[2])
+	base := float64(sizeUnit())
+	if strings.Contains(unit, "I") {
+		base = 1024
+	}
 	switch {
+	case strings.HasPrefix(unit, "P"):
+		size *= base * base * base * base * base
 	case strings.HasPrefix(unit, "T"):
-		size *= 1024 * 1024 * 1024 * 1024
+		size *= base * base * base * base
 	case strings.HasPrefix(unit, "G"):
-		size *= 1024 * 1024 * 1024
+		size *= base * base * base
 	case strings.HasPrefix(unit, "M"):
-		size *= 1024 * 1024
+		size *= base * base
 	case strings.HasPrefix(unit, "K"):
-		size *= 1024
+		size *= base
 	}
 
+	// Converting a float beyond the uint64 range is implementation-defined.
+	if size >= math.MaxUint64 {
+		return 0, fmt.Errorf("size too large: %s", sizeStr)
+	}
 	return uint64(size), nil
 }
 
-// humanReadableSize converts a size in bytes to a human-readable string.
+// roundDown makes humanReadableSize truncate to sizePrecision decimals
+// instead of rounding half up (-rounding=down), for quota-style displays
+// that must never overstate usage.
+var roundDown bool
+
+// sizePrecision is the number of decimals humanReadableSize shows, 0 to
+// maxPrecision (-precision).
+var sizePrecision = 2
+
+// maxPrecision is the most decimals -precision accepts.
+const maxPrecision = 6
+
+// siUnits makes sizes decimal (-si): humanReadableSize shows powers of
+// 1000 as KB, MB, GB, and parseSize reads units without an "i" that way.
+var siUnits bool
+
+// sizeUnit is the factor between size units, 1000 with -si and otherwise
+// 1024.
+func sizeUnit() uint64 {
+	if siUnits {
+		return 1000
+	}
+	return 1024
+}
+
+// humanReadableSize converts a size in bytes to a human-readable string
+// with sizePrecision decimals. Values that round to 1024 of a unit (1000
+// with -si) are shown as 1 of the next.
 func humanReadableSize(size uint64) string {
-	if size < 1024 {
+	unit := sizeUnit()
+	if size < unit {
 		return fmt.Sprintf("%d B", size)
 	}
-	const unit = 1024
-	div, exp := int64(unit), 0
+	suffix := "iB"
+	if siUnits {
+		suffix = "B"
+	}
+	div, exp := unit, 0
 	for n := size / unit; n >= unit; n /= unit {
 		div *= unit
 		exp++
 	}
-	return fmt.Sprintf("%.2f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+	scale := uint64(1)
+	for range sizePrecision {
+		scale *= 10
+	}
+	scaled := scaledSize(size, div, scale)
+	if scaled >= scale*unit && exp < 5 {
+		div *= unit
+		exp++
+		scaled = scaledSize(size, div, scale)
+	}
+	if sizePrecision == 0 {
+		return fmt.Sprintf("%d %c%s", scaled, "KMGTPE"[exp], suffix)
+	}
+	return fmt.Sprintf("%d.%0*d %c%s", scaled/scale, sizePrecision, scaled%scale, "KMGTPE"[exp], suffix)
+}
+
+// scaledSize returns size/div in units of 1/scale, rounded half up or
+// down according to roundDown. It works in integers so that boundary
+// values are exact.
+func scaledSize(size, div, scale uint64) uint64 {
+	hi, lo := bits.Mul64(size, scale)
+	if !roundDown {
+		var carry uint64
+		lo, carry = bits.Add64(lo, div/2, 0)
+		hi += carry
+	}
+	q, _ := bits.Div64(hi, lo, div)
+	return q
+}
+
+// addDirResult adds a qualifying directory, with its file time range and
+// file count when trackDirTimes and trackFileCounts are enabled.
+func addDirResult(path string, st subtreeStats) {
+	res := FileInfo{Path: path, Size: st.Size, IsDir: true}
+	if trackDirTimes {
+		res.OldestMTime, res.NewestMTime = st.Oldest, st.Newest
+	}
+	if trackSelfTimes() {
+		res.DirMTime = st.Self
+	}
+	if trackFileCounts {
+		res.FileCount = st.Files
+	}
+	if trackLinks {
+		res.Unique, res.Shared = st.Unique, st.Shared
+	}
+	res.LowerBound = st.LowerBound
+	resultsMutex.Lock()
+	appendResult(res)
+	resultsMutex.Unlock()
+}
+
+// appendResult records one result, streaming it when -format=ndjson is
+// active. The caller holds resultsMutex.
+func appendResult(res FileInfo) {
+	if parentSizes != nil {
+		parentSizes.want(filepath.Dir(res.Path))
+	}
+	if resultStream != nil {
+		resultStream.emit(res)
+		return
+	}
+	results = append(results, res)
 }
 
-// addResult adds a file or directory to the results slice in a thread-safe manner.
-func addResult(path string, size uint64, isDir bool) {
+// addFileResult adds a qualifying file to the results and updates the
+// oldest/newest file tracking under the same lock.
+func addFileResult(res FileInfo, modTime time.Time) {
 	resultsMutex.Lock()
-	results = append(results, FileInfo{Path: path, Size: size, IsDir: isDir})
+	appendResult(res)
+	if oldestFile == nil || modTime.Before(oldestFile.ModTime) {
+		oldestFile = &datedFile{Path: res.Path, Size: res.Size, ModTime: modTime}
+	}
+	if newestFile == nil || modTime.After(newestFile.ModTime) {
+		newestFile = &datedFile{Path: res.Path, Size: res.Size, ModTime: modTime}
+	}
 	resultsMutex.Unlock()
 }
 
-// walkDirRecursive performs a parallel, post-order traversal of a directory tree.
+// errSizeOverflow is returned when summed sizes no longer fit in a uint64.
+var errSizeOverflow = errors.New("size accumulation overflow — data exceeds 16 EiB or filesystem reports bogus sizes")
+
+// sizeOverflowed is set when any accumulation wrapped; totals are then
+// saturated at the maximum and must not be trusted.
+var sizeOverflowed atomic.Bool
+
+// addSize returns a+b, saturating and flagging sizeOverflowed instead of
+// silently wrapping around.
+func addSize(a, b uint64) uint64 {
+	sum, carry := bits.Add64(a, b, 0)
+	if carry != 0 {
+		sizeOverflowed.Store(true)
+		return math.MaxUint64
+	}
+	return sum
+}
+
+// recordSkip notes that path, an entry of dir or dir itself, could not be
+// read: op failed with err. The JSON formats report the error.
+func recordSkip(dir, path, op string, err error) {
+	skippedMutex.Lock()
+	skippedEntries[dir]++
+	skippedMutex.Unlock()
+	if scanErrors == nil && resultStream == nil {
+		return
+	}
+	e := newScanError(path, op, err)
+	if scanErrors != nil {
+		scanErrors.add(e)
+	}
+	if resultStream != nil {
+		resultsMutex.Lock()
+		resultStream.emitError(e)
+		resultsMutex.Unlock()
+	}
+}
+
+// walkDirRecursive performs a parallel, post-order traversal of a directory
+// tree and returns its total size. A walk aborted by -fatal-errors or a
+// signal returns the partial total; use walkDir to see why.
 func walkDirRecursive(path string, threshold uint64, excludeSet map[string]struct{}) uint64 {
-	entries, err := os.ReadDir(path)
+	st, _ := walkDir(path, threshold, excludeSet)
+	return st.Size
+}
+
+// walkDir is walkDirRecursive reporting the full subtree totals and
+// whether the walk was aborted.
+func walkDir(path string, threshold uint64, excludeSet map[string]struct{}) (subtreeStats, error) {
+	w := newWalker(threshold, excludeSet)
+	return w.run(path)
+}
+
+// scanDir lists one directory, accounts for its files and queues its
+// subdirectories. It never waits for the children: their totals reach n
+// through complete once they finish.
+func (w *walker) scanDir(n *dirNode) {
+	defer w.complete(n)
+
+	path := n.path
+	openFiles.acquire()
+	var listStart time.Time
+	if perf != nil && path == perf.root {
+		listStart = time.Now()
+	}
+	// With a listing budget the directory is read in chunks. A directory
+	// queued again by -finish-partials is read to the end, skipping what
+	// its first pass counted.
+	partial := false
+	if n.skip != nil {
+		noteFinishedPartial()
+	}
+	entries, err := withRetry(func() ([]fs.DirEntry, error) {
+		if dirListTimeout <= 0 && n.skip == nil {
+			return readDir(path)
+		}
+		budget := dirListTimeout
+		if n.skip != nil {
+			budget = 0
+		}
+		entries, p, err := listChunked(path, budget, n.skip)
+		partial = p
+		return entries, err
+	})
+	openFiles.release()
+	if perf != nil {
+		perf.recordReadDir(path, len(entries), err != nil)
+		if path == perf.root {
+			perf.recordWall(path, time.Since(listStart))
+		}
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading directory %s: %v\n", path, err)
-		return 0
+		// ReadDir returns the entries it managed to read before the
+		// error; keep going with those rather than dropping the subtree.
+		fmt.Fprintf(stderr, "Error reading directory %s: %v\n", displayPath(path), err)
+		recordSkip(path, path, "read directory", err)
+		w.noteError(path, err)
+		if ncdu != nil {
+			ncdu.markError(path)
+		}
+		if len(entries) == 0 {
+			return
+		}
 	}
 
-	var totalSize uint64
-	var wg sync.WaitGroup
-	sizeChannel := make(chan uint64, len(entries))
+	if auditChanges != nil {
+		auditChanges.noteDir(path)
+	}
 
+	var files subtreeStats
+	var prints []printEntry
+	var names []string
+	var peek childHeap
+	var onDevice deviceTally
+	var own []string
+	if ownOutputs != nil {
+		own = ownOutputs[anchoredPath(path)]
+	}
+	subdirs := 0
 	for _, entry := range entries {
-		// Check if the directory/file name is in the exclude set
-		if _, excluded := excludeSet[entry.Name()]; excluded {
-			continue // Skip this entry completely
+		// Exclusion comes first: an excluded entry is neither stat'ed
+		// nor scheduled.
+		fullPath := filepath.Join(path, entry.Name())
+		if isExcluded(w.excludeSet, entry.Name()) || excludeAnchored && (isExcluded(w.excludeSet, anchoredPath(fullPath)) || matchesExcludePattern(anchoredPath(fullPath))) {
+			if ncdu != nil {
+				ncdu.addExcluded(path, entry.Name(), "pattern")
+			}
+			continue
+		}
+		if own != nil && isOwnOutput(own, entry.Name()) {
+			continue
+		}
+		if pathAudit != nil {
+			pathAudit.record(fullPath)
+		}
+		if blobDirs != nil {
+			names = append(names, entry.Name())
 		}
 
-		fullPath := filepath.Join(path, entry.Name())
+		kind := reparseKindOf(fullPath, entry)
+		switch kind {
+		case reparseJunction:
+			follow, action := false, "not followed"
+			if followJunctions {
+				follow, action = w.enterJunction(fullPath)
+			}
+			noteReparse(fullPath, kind, action)
+			if follow {
+				w.push(n.child(fullPath))
+				subdirs++
+			}
+			continue
+		case reparseSymlink:
+			noteReparse(fullPath, kind, "not followed")
+		}
+		if symlinks != nil && entry.Type()&fs.ModeSymlink != 0 {
+			symlinks.record(fullPath)
+		}
 
 		if entry.IsDir() {
-			wg.Add(1)
-			go func(p string) {
-				defer wg.Done()
-				subdirSize := walkDirRecursive(p, threshold, excludeSet)
-				if subdirSize >= threshold {
-					addResult(p, subdirSize, true)
+			if deniedMounts != nil && skipDeniedMount(fullPath) {
+				if ncdu != nil {
+					ncdu.addExcluded(path, entry.Name(), "otherfs")
 				}
-				sizeChannel <- subdirSize
-			}(fullPath)
-		} else {
-			info, err := entry.Info()
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error getting info for %s: %v\n", fullPath, err)
 				continue
 			}
-			fileSize := uint64(info.Size())
-			if fileSize >= threshold {
-				addResult(fullPath, fileSize, false)
+			w.push(n.child(fullPath))
+			subdirs++
+			continue
+		}
+
+		info, err := withRetry(func() (fs.FileInfo, error) { return entryInfo(entry) })
+		if err == nil && info.Size() < 0 {
+			err = errNegativeSize
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "Error getting info for %s: %v\n", displayPath(fullPath), err)
+			recordSkip(path, fullPath, "stat", err)
+			w.noteError(fullPath, err)
+			if perf != nil {
+				perf.recordError(path)
+			}
+			if ncdu != nil {
+				ncdu.addItem(path, ncduItem{Name: entry.Name(), ReadErr: true})
+			}
+			continue
+		}
+		fileSize := uint64(info.Size())
+		if auditChanges != nil {
+			auditChanges.noteFile(fullPath, info.ModTime())
+		}
+		if kind == reparsePlaceholder {
+			if logicalSize {
+				noteReparse(fullPath, kind, "counted at logical size "+humanReadableSize(fileSize))
+			} else {
+				noteReparse(fullPath, kind, "counted as 0 B, logical size "+humanReadableSize(fileSize))
+				fileSize = 0
+			}
+		}
+		noteFileSize(fileSize)
+		if allowances != nil {
+			allowances.add(fullPath, fileSize)
+		}
+		if ncdu != nil {
+			ncdu.addFile(path, entry.Name(), fileSize)
+		}
+		if heat != nil {
+			heat.add(fileSize, info.ModTime())
+		}
+		if perChild != nil {
+			perChild.record(fullPath, fileSize, false)
+		}
+		var links subtreeStats
+		if trackLinks {
+			links.addFileLinks(info, fileSize)
+		}
+		if fileSize >= w.threshold {
+			res := FileInfo{Path: fullPath, Size: fileSize}
+			if entry.Type()&fs.ModeSymlink != 0 {
+				res.Symlink = true
+				res.LinkTarget, _ = os.Readlink(fullPath)
+			}
+			if trackDirTimes {
+				res.ModTime = info.ModTime()
+			}
+			if trackLinks {
+				res.Unique, res.Shared = links.Unique, links.Shared
+			}
+			addFileResult(res, info.ModTime())
+		}
+		if dupeDirs != nil {
+			prints = append(prints, printEntry{name: entry.Name(), size: fileSize})
+		}
+		if peeks != nil {
+			peek.offer(peekChild{Name: entry.Name(), Size: fileSize}, peeks.n)
+		}
+		if devices != nil {
+			onDevice.add(info, fileSize)
+		}
+		files.Size = addSize(files.Size, fileSize)
+		files.Files++
+		if trackDirTimes {
+			files.addTime(info.ModTime())
+		}
+		if trackLinks {
+			files.mergeLinks(links)
+		}
+	}
+	if len(prints) > 0 {
+		n.addPrints(prints...)
+	}
+	if len(names) > 0 {
+		n.addNames(names)
+	}
+	if len(peek) > 0 {
+		peeks.addPeek(n, peek...)
+	}
+	if len(onDevice) > 0 {
+		devices.addUsage(onDevice)
+	}
+	if partial {
+		if finishPartials {
+			// Keep the node pending until a second pass has listed the
+			// rest, after everything else that is queued.
+			if n.skip == nil {
+				n.skip = make(map[string]bool, len(entries))
+			}
+			for _, e := range entries {
+				n.skip[e.Name()] = true
 			}
-			totalSize += fileSize
+			n.pending.Add(1)
+			w.pushLast(n)
+		} else {
+			recordPartial(path, len(entries))
+			files.LowerBound = true
+		}
+	}
+	if dirEntryCounts != nil {
+		n.mu.Lock()
+		n.entries += subdirs + int(files.Files)
+		n.mu.Unlock()
+	}
+	if trackSelfTimes() && n.skip == nil {
+		if info, err := os.Stat(path); err == nil {
+			n.mu.Lock()
+			n.modTime = info.ModTime()
+			n.mu.Unlock()
+		}
+	}
+	n.merge(files)
+	if showProgress {
+		w.files.Add(int64(files.Files))
+		w.bytes.Add(int64(files.Size))
+	}
+}
+
+// finishDir is called once a directory and all of its descendants are
+// done. It records the directory and decides what its parent sees. The
+// walk root is left to the caller.
+func (w *walker) finishDir(n *dirNode) subtreeStats {
+	sub := n.total
+	sub.Dirs++
+	sub.Self = n.modTime
+	if dirEntryCounts != nil && sub.Size >= w.threshold {
+		dirEntryCounts.record(n.path, n.entries)
+	}
+	if parentSizes != nil {
+		parentSizes.finishDir(n.path, sub.Size)
+	}
+	if blobDirs != nil && sub.Size >= w.threshold {
+		blobDirs.record(n.path, sub.Size, n.names)
+	}
+	if peeks != nil {
+		peeks.finishDir(n, sub.Size >= w.threshold)
+	}
+	n.names = nil
+	if n.parent == nil {
+		return sub
+	}
+	recordCrossing(n.path)
+	if perChild != nil {
+		perChild.record(n.path, sub.Size, true)
+	}
+	if perf != nil && n.parent != nil && n.parent.path == perf.root {
+		perf.recordWall(n.path, time.Since(n.queued))
+	}
+	if sub.Size >= w.threshold {
+		addDirResult(n.path, sub)
+	}
+	if _, ok := memoryMounts[n.path]; ok {
+		// Memory-backed mounts are reported separately and do not count
+		// toward the disk usage of ancestors.
+		recordMemoryMount(n.path, sub.Size)
+		sub = subtreeStats{}
+	}
+	return sub
+}
+
+// resolveRoot returns the absolute path used to match the scan root against
+// the mount table. When resolve is set and root is a symlink, the anchor is
+// the link's real target, which is also returned as linkTarget for the
+// banner; otherwise the root is taken literally.
+func resolveRoot(root string, resolve bool) (anchor, linkTarget string, err error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return "", "", err
+	}
+	if !resolve {
+		return abs, "", nil
+	}
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", "", err
+	}
+	if li, err := os.Lstat(root); err == nil && li.Mode()&fs.ModeSymlink != 0 {
+		linkTarget = real
+	}
+	return real, linkTarget, nil
+}
+
+// dropEmpty removes zero-size entries from list, returning the filtered
+// slice and the number of entries removed.
+func dropEmpty(list []FileInfo) ([]FileInfo, int) {
+	kept := list[:0]
+	for _, res := range list {
+		if res.Size > 0 {
+			kept = append(kept, res)
+		}
+	}
+	return kept, len(list) - len(kept)
+}
+
+// sortResults orders results with directories first, then by size descending.
+func sortResults(list []FileInfo) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].IsDir != list[j].IsDir {
+			return list[i].IsDir
 		}
+		if list[i].Size != list[j].Size {
+			return list[i].Size > list[j].Size
+		}
+		return list[i].Path < list[j].Path
+	})
+}
+
+// printResults writes the result table rows, each directory followed by
+// its -peek children.
+func printResults(list []FileInfo) {
+	for i, row := range resultRows(list) {
+		fmt.Fprintf(stdout, "%s\n%s", row, peekLines("       ", list[i]))
+	}
+}
+
+// resultRows formats the rows of list, with -graph bars if enabled.
+func resultRows(list []FileInfo) []string {
+	rows := make([]string, len(list))
+	for i, res := range list {
+		rows[i] = resultRow(res)
+	}
+	if bars != nil {
+		rows = bars.rows(list, rows)
 	}
+	return rows
+}
 
-	// Wait for all subdirectory goroutines to finish
-	wg.Wait()
-	close(sizeChannel)
+// resultRow formats one result table row, without the newline.
+func resultRow(res FileInfo) string {
+	var color func(c column) string
+	if colors != nil && !res.Context {
+		color = func(c column) string { return colors.cellColor(c, res) }
+	}
+	row := textCells(columnsFor(textColumns), func(c column) string { return c.text(res) }, color)
+	if colors != nil && res.Context {
+		row = sgrDim + row + sgrReset
+	}
+	return row + symlinkSuffix(res) + contextSuffix(res) + labelSuffix(res) + inUseSuffix(res) + cacheSuffix(res) + dirTimesSuffix(res) + linkSuffix(res) + partialSuffix(res) + annotationSuffix(res) + pathAuditSuffix(res)
+}
 
-	// Collect all subdirectory sizes from the channel
-	for size := range sizeChannel {
-		totalSize += size
+// printSkipped lists the directories with unreadable entries, whose sizes
+// are therefore lower bounds.
+func printSkipped() {
+	dirs := make([]string, 0, len(skippedEntries))
+	total := 0
+	for dir, n := range skippedEntries {
+		dirs = append(dirs, dir)
+		total += n
 	}
+	sort.Strings(dirs)
+	fmt.Fprintf(stdout, "\nSkipped %d unreadable entries; sizes of these directories are lower bounds:\n", total)
+	for _, dir := range dirs {
+		fmt.Fprintf(stdout, "  %s (%d skipped)\n", displayPath(dir), skippedEntries[dir])
+	}
+}
 
-	return totalSize
+// describeDatedFile formats a file as "path (date, size)" for the summary.
+func describeDatedFile(f *datedFile) string {
+	return fmt.Sprintf("%s (%s, %s)", displayPath(f.Path), f.ModTime.Format("2006-01-02"), humanReadableSize(f.Size))
 }
 
+// flagsParsed, when set, is given run's flag set once the flags are
+// read. Tests use it to reach flags whose values live in run.
+var flagsParsed func(*flag.FlagSet)
 
 func run(args []string) error {
+	setupOutput(os.Stdout, os.Stderr)
+	if len(args) > 1 && args[1] == "doctor" {
+		return runDoctor(args[2:])
+	}
+	if len(args) > 1 && args[1] == "trend" {
+		return runTrend(args[2:])
+	}
+	// spacehogs check is a scan compared against a baseline.
+	checkMode := len(args) > 1 && args[1] == "check"
+	if checkMode {
+		args = append([]string{args[0]}, args[2:]...)
+	}
+
 	fs := flag.NewFlagSet("spacehogs", flag.ContinueOnError)
+	fs.SetOutput(stderr)
 	var excludeDirs string
-	fs.StringVar(&excludeDirs, "exclude", "proc,dev,sys", "Comma-separated list of directory names to exclude")
+	var showExtremes bool
+	var maxOpenFiles int
+	var includeTmpfs bool
+	var noHints bool
+	var auditLabels bool
+	var excludeEmpty bool
+	var perfReportFlag bool
+	var noResolveRoot bool
+	var absolutePaths, resolveSymlinks bool
+	var checkOpen bool
+	var allOlderThan time.Duration
+	var outSpec string
+	var findLogsFlag bool
+	var excludeStats bool
+	var rounding string
+	var format string
+	var noHeader bool
+	var delimiter string
+	var listTimeout time.Duration
+	var annotateSpec string
+	var sortKey string
+	var linkStats bool
+	var minUnique sizeFlag
+	var freeTarget sizeFlag
+	var selfStatsFlag bool
+	var historyFile string
+	var historyKeep int
+	var debugFlag bool
+	var perChildTop int
+	var symlinkReportFlag bool
+	var fromListing string
+	var checkOnly bool
+	var fatalErrors string
+	var heatmapOut, sizeBuckets, ageBuckets string
+	var syslogTop int
+	var canonicalPaths bool
+	var force bool
+	var includeFuse bool
+	var fsAllow, fsDeny string
+	var pathAuditSpec string
+	var dupeDirsFlag, verifyContent, fuzzyDupes bool
+	var detectBlobDirs bool
+	var blobDirCutoff float64
+	var outputFile string
+	var compressSpec string
+	var columnsSpec string
+	var analyzeImages bool
+	var treeView bool
+	var graph, asciiBars bool
+	var graphScale string
+	var percentBase string
+	var showAncestors bool
+	var noSummary bool
+	var quiet, verbose bool
+	var exactBytes bool
+	var peekTop int
+	var showDevice bool
+	var showOwner bool
+	var cacheReportFlag, peekCache bool
+	var groupDigitsFlag bool
+	var separator string
+	var print0 bool
+	var auditDeterminism, auditSerial bool
+	var imageAllocLimit float64
+	var colorMode, colorTiers string
+	var baselineName string
+	var writeBaseline, forceDiff bool
+	var templateText, templateFile, summaryText, summaryFile string
+	fs.StringVar(&excludeDirs, "exclude", "proc,dev,sys", "Comma-separated list of directory names to exclude; an entry containing a path separator excludes just that path, taken from the scan root unless absolute or starting with ./ or ../, and may use * ? [...] wildcards within a component")
+	fs.BoolVar(&includeFuse, "include-fuse", false, "Descend into FUSE and 9p mounts ("+defaultDenyFSTypes+"), which are skipped by default as slow or endless")
+	fs.StringVar(&fsAllow, "fs-allow", "", "Comma-separated filesystem types to descend into even if denied, e.g. fuse.sshfs; * matches any characters")
+	fs.StringVar(&fsDeny, "fs-deny", "", "Comma-separated filesystem types to skip in addition to the defaults, e.g. nfs4,cifs")
+	fs.StringVar(&pathAuditSpec, "path-audit", "", "Check every path against a destination's limits: windows, onedrive, iso9660, or custom:path=N,component=N,depth=N,chars=...")
+	fs.BoolVar(&dupeDirsFlag, "dupe-dirs", false, "Report directory trees that look like copies of each other, matched by file names and sizes, ranked by the space deleting all but one would free")
+	fs.BoolVar(&verifyContent, "verify-content", false, "With -dupe-dirs, also compare the contents of a sample of files in each group")
+	fs.BoolVar(&fuzzyDupes, "fuzzy", false, "With -dupe-dirs, also report near copies: trees with the same names whose sizes differ")
+	fs.BoolVar(&detectBlobDirs, "detect-blobdirs", false, "Report directories at or over the threshold whose files are mostly machine-named: UUIDs, hashes, base64 or random strings")
+	fs.Float64Var(&blobDirCutoff, "blobdir-cutoff", 80, "With -detect-blobdirs, the percentage of names that must look generated to report a directory")
+	fs.BoolVar(&force, "force", false, "Scan the root even when an anchored -exclude names it")
+	fs.BoolVar(&excludeStats, "exclude-stats", false, "Report how many entries each -exclude name matched, and which matched nothing")
+	fs.StringVar(&format, "format", "text", "Output format: text; json for a single JSON document on stdout; csv; tsv (see -delimiter); xml; html for a self-contained page; ncdu for the whole tree in ncdu's export format (ncdu -f); or ndjson to stream unsorted results as JSON lines as they are found")
+	fs.DurationVar(&listTimeout, "dir-list-timeout", 0, "Stop listing a directory after this long and report its size as a lower bound; 0 waits for every listing")
+	fs.BoolVar(&finishPartials, "finish-partials", false, "Come back to directories cut short by -dir-list-timeout and finish them after the rest of the scan")
+	fs.StringVar(&baselineName, "baseline", "", "With spacehogs check, the baseline file of tracked file sizes and allowances to compare against")
+	fs.BoolVar(&writeBaseline, "update-baseline", false, "With spacehogs check, write the scan's files to -baseline instead of comparing")
+	fs.BoolVar(&forceDiff, "force-diff", false, "With spacehogs check, compare against a -baseline whose sizes were measured with other options, such as -logical-size, instead of refusing")
+	fs.StringVar(&colorMode, "color", "auto", "Color the text listing: auto colors a terminal unless NO_COLOR is set, always, or never")
+	fs.StringVar(&colorTiers, "color-tiers", "3,10", "Multiples of the threshold at which sizes turn yellow and red")
+	fs.StringVar(&columnsSpec, "columns", "", "Comma-separated columns for the text, csv and tsv listings, in order: "+columnNames()+"; mtime is a directory's newest file, percent the share of the scan total or of -percent-of")
+	fs.BoolVar(&groupDigitsFlag, "group-digits", false, "Group the digits of byte counts in the text listing, as in 1,234,567, with the locale's separator unless -separator is given; csv, tsv and json never group")
+	fs.StringVar(&separator, "separator", "", "Digit grouping separator for -group-digits, which it implies: ',', '.', '_' or space")
+	fs.BoolVar(&exactBytes, "bytes", false, "Show exact byte counts, right-aligned, instead of humanized sizes in the text listing's size column; csv and tsv carry bytes already")
+	fs.StringVar(&percentBase, "percent-of", "total", "What the percent column is a share of: total for the scan total, parent for the directory holding the entry, or fs for the size of the root's filesystem")
+	fs.IntVar(&peekTop, "peek", 0, "Show the N largest immediate children of each listed directory under its row in the text listing and -tree, and as a peek array in -format=json")
+	fs.BoolVar(&showOwner, "show-owner", false, "Show the user and group owning each listed entry, as owner and group columns and a JSON field with the numeric ids and names")
+	fs.BoolVar(&showDevice, "show-device", false, "Show the block device holding each listed entry, with the physical volumes below LVM and RAID devices (Linux), as a device column and JSON field, and sum file usage by device")
+	fs.BoolVar(&cacheReportFlag, "cache-report", false, "Sample the page cache before and after the walk and rate the scan cold or warm by how much filesystem metadata it had to read (Linux)")
+	fs.BoolVar(&peekCache, "peek-cache", false, "Estimate how much of each listed file is in the page cache, shown on its row and summed in -cache-report, which it implies in the text report (Linux)")
+	fs.BoolVar(&showAncestors, "show-ancestors", false, "Also show the unlisted directories above each listed entry, up to the root, as context rows in the text listing, -tree and -format=json; they are not counted")
+	fs.BoolVar(&print0, "print0", false, "Write only the path of each listed entry, each followed by a NUL byte, for xargs -0; nothing else goes to stdout")
+	fs.StringVar(&delimiter, "delimiter", "\t", "Field separator for -format=tsv: a single-byte character")
+	fs.StringVar(&sortKey, "sort", "size", "Order of listed entries: size, unique for the bytes deleting an entry would free (hard links counted), or mtime for least recently modified first")
+	fs.BoolVar(&linkStats, "link-stats", false, "Show how much of each entry is unique and how much is shared through hard links")
+	sizeVar(fs, &freeTarget, "free", false, "Plan the fewest listed entries whose deletion frees at least this much, counting hard links, and show the free space it would leave")
+	sizeVar(fs, &minUnique, "min-unique", false, "Only list entries whose deletion would free at least this much, counting hard links")
+	fs.BoolVar(&treeView, "tree", false, "Show the listing as a tree under the root, children largest first, with what each directory's listed children leave out")
+	fs.BoolVar(&graph, "graph", false, "Append a bar to each row of the text listing, sized against the -graph-scale")
+	fs.StringVar(&graphScale, "graph-scale", "max", "What a full -graph bar stands for: max for the largest listed entry, or total for the scan total")
+	fs.BoolVar(&asciiBars, "ascii", false, "Draw -graph bars with '#' instead of block characters, as is done anyway outside a UTF-8 locale")
+	fs.BoolVar(&analyzeImages, "analyze-images", false, "Read the headers of listed qcow2, VMDK, VDI and raw disk images and add their virtual size, allocated size and allocation share as columns")
+	fs.Float64Var(&imageAllocLimit, "image-alloc-limit", 80, "With -analyze-images, flag images with more than this percentage of their virtual size allocated")
+	fs.StringVar(&annotateSpec, "annotate", "", "Add columns from annotators to the listed entries: sidecar (first line of <path>.meta)")
+	fs.BoolVar(&canonicalPaths, "canonical-paths", false, "Write paths in -format json, ndjson, csv, tsv and xml output and in -history relative to the root with forward slashes; the terminal listing keeps native paths")
+	fs.BoolVar(&noHeader, "no-header", false, "Omit the header row of -format=csv, for appending to an existing file")
+	fs.BoolVar(&siUnits, "si", false, "Show sizes in powers of 1000 (KB, MB, GB) and read sizes without an \"i\", such as 1GB or 1G, as decimal; 1GiB stays binary")
+	fs.StringVar(&rounding, "rounding", "half-up", "How sizes are rounded to -precision decimals: half-up or down (truncate)")
+	fs.IntVar(&sizePrecision, "precision", 2, fmt.Sprintf("Decimals shown in human-readable sizes, 0 to %d", maxPrecision))
+	fs.BoolVar(&selfStatsFlag, "self-stats", false, "Report the scan's own wall and CPU time, peak RSS, peak goroutines and GC cycles")
+	fs.BoolVar(&showExtremes, "oldest-newest", false, "Report the oldest and newest files above the threshold")
+	fs.BoolVar(&includeTmpfs, "include-tmpfs", false, "Count tmpfs/ramfs contents as disk usage instead of reporting them separately")
+	fs.BoolVar(&quiet, "q", false, "Print only the rows of the text listing, without the banner, table heading, notes, hints and summary; implied when stdout is not a terminal, unless -verbose is given")
+	fs.BoolVar(&quiet, "quiet", false, "Same as -q")
+	fs.BoolVar(&verbose, "verbose", false, "Print the banner, table heading and summary even when stdout is not a terminal")
+	fs.BoolVar(&noSummary, "no-summary", false, "Omit the footer of totals, counts, errors and elapsed time, and the summary object of -format=json")
+	fs.BoolVar(&noHints, "no-hints", false, "Do not suggest a better threshold when there are no or very many results")
+	fs.BoolVar(&excludeEmpty, "exclude-empty", false, "Do not list zero-size files and directories")
+	fs.BoolVar(&perfReportFlag, "perf-report", false, "Report walk time, directory reads, entries and errors per top-level subtree")
+	fs.BoolVar(&absolutePaths, "absolute", false, "Make the scan root absolute before walking, so that every reported path is absolute and cleaned; the default for the machine formats other than -print0")
+	fs.BoolVar(&resolveSymlinks, "resolve-symlinks", false, "Resolve symlinks in the scan root to its real path, which implies -absolute")
+	fs.BoolVar(&noResolveRoot, "no-resolve-root", false, "Do not resolve a symlinked scan root for mount checks")
+	fs.IntVar(&maxRetries, "retries", 2, "Number of retries for transient I/O errors (EIO, ESTALE, EINTR, EAGAIN)")
+	fs.DurationVar(&retryDelay, "retry-delay", 10*time.Millisecond, "Initial delay between retries; doubled for each further attempt")
+	fs.BoolVar(&localeNumbers, "locale-numbers", false, "Accept comma digit grouping in sizes, e.g. 1,000K")
+	fs.BoolVar(&checkOpen, "check-open", false, "Flag listed files that a process currently holds open (Linux)")
+	fs.BoolVar(&auditLabels, "audit-labels", false, "Show SELinux contexts and POSIX ACL presence of listed entries (Linux)")
+	fs.BoolVar(&showDirTimes, "dir-mtimes", false, "Show the oldest and newest file modification time below each listed directory")
+	fs.StringVar(&dirTimes, "dir-times", "descendants", "Which time a directory entry carries in the mtime column, -sort=mtime and JSON: descendants for its newest file's, self for the directory's own, or both, which adds the own time as dir_mtime")
+	fs.Func("all-older-than", "List only directories whose newest file is older than this age (e.g. 90d, 720h)", func(s string) error {
+		d, err := parseAge(s)
+		allOlderThan = d
+		return err
+	})
+	fs.BoolVar(&findLogsFlag, "find-logs", false, "Flag listed files that look like active logs and measure their growth")
+	fs.Int64Var(&minFiles, "min-files", -1, "List only directories with at least this many files below them")
+	fs.Int64Var(&maxFiles, "max-files", -1, "List only directories with at most this many files below them")
+	fs.StringVar(&historyFile, "history", "", "Append a one-line JSON summary of this run to FILE (see \"trend\")")
+	fs.IntVar(&historyKeep, "history-keep", 0, "Keep only the last N lines of the -history file; 0 keeps all")
+	fs.StringVar(&fatalErrors, "fatal-errors", "", "Abort the scan with exit status 3 on any error of these classes: permission, io, notfound, timeout, other")
+	fs.BoolVar(&checkOnly, "check", false, "Validate flags, arguments and output destinations, then exit without scanning")
+	fs.StringVar(&fromListing, "from-listing", "", "Build results from a listing of \"size<TAB>path\" or plain path lines instead of walking")
+	fs.StringVar(&heatmapOut, "heatmap", "", "Write bytes by age and size bucket to a file (JSON if it ends in .json, CSV otherwise) and show a preview")
+	fs.StringVar(&sizeBuckets, "buckets", defaultSizeBuckets, "Ascending size bucket edges for -heatmap")
+	fs.StringVar(&ageBuckets, "age-buckets", defaultAgeBuckets, "Ascending age bucket edges for -heatmap, in days (90d) or a Go duration")
+	fs.BoolVar(&symlinkReportFlag, "symlink-report", false, "List symlinks whose targets are at least min_size, and dangling ones, without following them")
+	fs.IntVar(&perChildTop, "per-child-top", 0, "For each top-level directory, show its total and its N largest entries")
+	fs.StringVar(&outputFile, "o", "", "Write the results to this file instead of stdout, replacing it only once the scan has succeeded")
+	fs.StringVar(&compressSpec, "compress", "auto", "Compress the results written to -o or stdout: gzip, none, or auto for gzip when -o ends in .gz")
+	fs.StringVar(&templateText, "template", "", "Print each result through this Go text/template instead of the report, e.g. '{{.Human}}\t{{.Path}}'; fields .Path, .Bytes, .Human, .IsDir, .Type; funcs humanize, basename, dirname")
+	fs.StringVar(&templateFile, "template-file", "", "Read -template from this file")
+	fs.StringVar(&summaryText, "summary-template", "", "Print a final line through this template; fields .Root, .Total, .Human, .Threshold, .Entries")
+	fs.StringVar(&summaryFile, "summary-template-file", "", "Read -summary-template from this file")
+	fs.StringVar(&outSpec, "out", "", "Also send results to a destination: syslog:[facility][/tag]")
+	fs.IntVar(&syslogTop, "syslog-top", 0, "Number of top entries sent to syslog after the summary line")
+	fs.BoolVar(&followJunctions, "follow-junctions", false, "Descend into Windows junctions, skipping ones that would loop or repeat a target")
+	fs.BoolVar(&logicalSize, "logical-size", false, "Count cloud placeholder files (OneDrive) at their logical size instead of 0")
+	fs.IntVar(&walkWorkers, "workers", 0, "Number of directories listed in parallel; 0 picks a default from the CPU count")
+	fs.BoolVar(&showProgress, "progress", false, "Show live scan progress on stderr")
+	fs.BoolVar(&auditDeterminism, "audit-determinism", false, "Scan twice in a row and report, instead of the listing, every entry the passes disagree on: changed on disk, explained by an unreadable entry, or unexplained (a bug)")
+	fs.BoolVar(&auditSerial, "audit-serial", false, "With -audit-determinism, list one directory at a time in the second pass")
+	fs.BoolVar(&debugFlag, "debug", false, "Dump the walk's scheduler state to stderr when it makes no progress for 10s")
+	fs.IntVar(&maxOpenFiles, "max-open-files", defaultMaxOpenFiles(), "Maximum number of files held open at once; defaults to the open file limit minus headroom")
 
 	fs.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [options] <directory> <min_size>\n", args[0])
-		fmt.Fprintf(os.Stderr, "Size format: number[unit] (e.g., 100M, 1.5G)\n")
-		fmt.Fprintf(os.Stderr, "Units: B, K, M, G, T, P\n\n")
-		fmt.Println("Options:")
+		fmt.Fprintf(stderr, "Usage: %s [options] <directory> <min_size>\n", args[0])
+		fmt.Fprintf(stderr, "       %s doctor [directory]\n", args[0])
+		fmt.Fprintf(stderr, "       %s trend [-force-diff] -history=FILE\n", args[0])
+		fmt.Fprintf(stderr, "       %s check -baseline=FILE [-update-baseline] [options] <directory> <min_size>\n", args[0])
+		fmt.Fprintf(stderr, "Size format: number[unit] (e.g., 100M, 1.5G)\n")
+		fmt.Fprintf(stderr, "Units: B, K, M, G, T, P, optionally as KiB, MiB, ... (all powers of 1024; with -si, only the KiB forms are)\n")
+		fmt.Fprintf(stderr, "A comma may be used as the decimal separator (1,5G)\n\n")
+		fmt.Fprintln(stdout, "Options:")
 		fs.PrintDefaults()
 	}
 
@@ -152,87 +976,1192 @@ func run(args []string) error {
 		return fmt.Errorf("invalid number of arguments")
 	}
 
-	// Build the exclude set
-	excludeSet := make(map[string]struct{})
-	if excludeDirs != "" {
-		for _, dir := range strings.Split(excludeDirs, ",") {
-			trimmed := strings.TrimSpace(dir)
-			if trimmed != "" {
-				excludeSet[trimmed] = struct{}{}
-			}
+	// Size flags are read as they are parsed, possibly before -si.
+	if siUnits {
+		if err := reparseSizeFlags(fs); err != nil {
+			return err
 		}
 	}
+	if flagsParsed != nil {
+		flagsParsed(fs)
+	}
 
-	scanPath := fs.Arg(0)
-	minSizeStr := fs.Arg(1)
-
-	// Clean the path to remove any trailing slashes for consistent output
-	scanPath = filepath.Clean(scanPath)
-
-	// Check if the top-level directory itself is excluded
-	if _, excluded := excludeSet[filepath.Base(scanPath)]; excluded {
-		fmt.Printf("Top-level directory '%s' is in the exclude list. Nothing to do.\n", scanPath)
-		return nil
+	if sizePrecision < 0 || sizePrecision > maxPrecision {
+		return fmt.Errorf("error: -precision must be between 0 and %d, not %d", maxPrecision, sizePrecision)
+	}
+	switch rounding {
+	case "half-up":
+		roundDown = false
+	case "down":
+		roundDown = true
+	default:
+		return fmt.Errorf("error: -rounding must be half-up or down, not %q", rounding)
+	}
+	entryTmpl, err := parseOutputTemplate("template", templateText, templateFile, templateEntry{})
+	if err != nil {
+		return fmt.Errorf("error: -template: %v", err)
+	}
+	summaryTmpl, err := parseOutputTemplate("summary-template", summaryText, summaryFile, templateSummary{})
+	if err != nil {
+		return fmt.Errorf("error: -summary-template: %v", err)
+	}
+	if entryTmpl != nil || summaryTmpl != nil {
+		if format != "text" {
+			return fmt.Errorf("error: -template and -summary-template replace -format=%s; use one or the other", format)
+		}
+		format = "template"
+	}
+	if print0 {
+		if format != "text" {
+			return fmt.Errorf("error: -print0 replaces -format=%s; use one or the other", format)
+		}
+		format = "print0"
+	}
+	if quiet && verbose {
+		return fmt.Errorf("error: -q and -verbose cannot be used together")
+	}
+	if quiet && auditDeterminism {
+		return fmt.Errorf("error: -audit-determinism prints its own report and cannot be used with -q")
+	}
+	// A listing read by another program gets only its rows, unless it is
+	// a report of its own: a check or an audit. The machine formats carry
+	// no banner or heading to begin with.
+	if format != "text" {
+		quiet = false
+	} else if !verbose && !checkMode && !auditDeterminism && !stdoutIsTerminal() {
+		quiet = true
+	}
+	if quiet {
+		noHints, noSummary = true, true
 	}
 
-	threshold, err := parseSize(minSizeStr)
+	// In the machine-readable formats stdout carries only their output;
+	// everything the text report would print there is dropped, and stderr
+	// is unchanged.
+	var machineOut io.Writer
+	switch format {
+	case "text":
+	case "json", "ndjson", "csv", "tsv", "xml", "html", "ncdu", "template", "print0":
+		terminal := stdout
+		machineOut, stdout = terminal, io.Discard
+		defer func() { stdout = terminal }()
+	default:
+		return fmt.Errorf("error: -format must be text, json, csv, tsv, xml, html, ncdu or ndjson, not %q", format)
+	}
+	compression, err := compressionFor(compressSpec, outputFile)
 	if err != nil {
+		return err
+	}
+	if compression == "gzip" && outputFile == "" && machineOut == nil {
+		return fmt.Errorf("error: -compress=gzip with the text format needs -o")
+	}
+	var delim byte
+	if format == "tsv" {
+		d, err := parseDelimiter(delimiter)
+		if err != nil {
+			return fmt.Errorf("error: -delimiter: %v", err)
+		}
+		delim = d
+	}
+	if format == "ncdu" && fromListing != "" {
+		return fmt.Errorf("error: -format=ncdu exports the walked tree and cannot be used with -from-listing")
+	}
+	if format == "ndjson" {
+		// Streamed results are never collected, so nothing that works on
+		// the finished list can run.
+		listFlags := []struct {
+			name string
+			set  bool
+		}{
+			{"-history", historyFile != ""}, {"-out", outSpec != ""}, {"-find-logs", findLogsFlag},
+			{"-audit-labels", auditLabels}, {"-annotate", annotateSpec != ""},
+			{"-sort=unique", sortKey == "unique"}, {"-sort=mtime", sortKey == "mtime"}, {"-path-audit", pathAuditSpec != ""},
+			{"-free", freeTarget.IsSet}, {"-analyze-images", analyzeImages},
+			{"-show-ancestors", showAncestors},
+		}
+		for _, f := range listFlags {
+			if f.set {
+				return fmt.Errorf("error: %s needs the full result list and cannot be used with -format=ndjson", f.name)
+			}
+		}
+	}
+	if (verifyContent || fuzzyDupes) && !dupeDirsFlag {
+		return fmt.Errorf("error: -verify-content and -fuzzy need -dupe-dirs")
+	}
+	if detectBlobDirs && fromListing != "" {
+		return fmt.Errorf("error: -detect-blobdirs reads directory listings and cannot be used with -from-listing")
+	}
+	if blobDirCutoff <= 0 || blobDirCutoff > 100 {
+		return fmt.Errorf("error: -blobdir-cutoff must be over 0 and at most 100")
+	}
+	if auditSerial && !auditDeterminism {
+		return fmt.Errorf("error: -audit-serial needs -audit-determinism")
+	}
+	if auditDeterminism && (format != "text" || fromListing != "") {
+		return fmt.Errorf("error: -audit-determinism compares two walks and prints its own report; it cannot be used with -format=%s or -from-listing", format)
+	}
+	if peekTop < 0 {
+		return fmt.Errorf("error: -peek must not be negative")
+	}
+	if peekTop > 0 && format != "text" && format != "json" {
+		return fmt.Errorf("error: -peek applies to the text and json formats, not %s", format)
+	}
+	if peekTop > 0 && fromListing != "" {
+		return fmt.Errorf("error: -peek collects children during the walk and cannot be used with -from-listing")
+	}
+	if peekCache && ((format != "text" && format != "json") || fromListing != "") {
+		return fmt.Errorf("error: -peek-cache applies to the text and json formats of a walk, not -format=%s or -from-listing", format)
+	}
+	cacheReportFlag = cacheReportFlag || (peekCache && format == "text")
+	if cacheReportFlag && (format != "text" || fromListing != "") {
+		return fmt.Errorf("error: -cache-report measures the walk in the text report; it cannot be used with -format=%s or -from-listing", format)
+	}
+	if dupeDirsFlag && fromListing != "" {
+		return fmt.Errorf("error: -dupe-dirs fingerprints the walked tree and cannot be used with -from-listing")
+	}
+	if checkMode && baselineName == "" {
+		return fmt.Errorf("error: spacehogs check needs -baseline=FILE")
+	}
+	if !checkMode && (baselineName != "" || writeBaseline || forceDiff) {
+		return fmt.Errorf("error: -baseline, -update-baseline and -force-diff are used with spacehogs check")
+	}
+	var baseline *baselineFile
+	if checkMode && !writeBaseline {
+		b, err := readBaseline(baselineName)
+		if err != nil {
+			return fmt.Errorf("error: -baseline: %v", err)
+		}
+		baseline = b
+	}
+	if _, err := colorEnabled(colorMode, nil, ""); err != nil {
 		return fmt.Errorf("error: %v", err)
 	}
-
-	fi, err := os.Stat(scanPath)
+	warnTier, alarmTier, err := parseColorTiers(colorTiers)
 	if err != nil {
-		return fmt.Errorf("error accessing '%s': %v", scanPath, err)
+		return fmt.Errorf("error: -color-tiers: %v", err)
 	}
-	if !fi.IsDir() {
-		return fmt.Errorf("error: '%s' is not a directory", scanPath)
+	if treeView && (format != "text" || columnsSpec != "" || exactBytes) {
+		return fmt.Errorf("error: -tree is a text view and cannot be used with -format=%s, -columns or -bytes", format)
 	}
-
-	hrThreshold := humanReadableSize(threshold)
-	fmt.Printf("Scanning directory: %s\n", scanPath)
-	fmt.Printf("Minimum size threshold: %s\n", hrThreshold)
-	if len(excludeSet) > 0 {
-		fmt.Printf("Excluding: %s\n", excludeDirs)
+	if graphScale != "max" && graphScale != "total" {
+		return fmt.Errorf("error: -graph-scale must be max or total, not %q", graphScale)
 	}
-	fmt.Println("\nTYPE   SIZE        NAME")
-	fmt.Println("--------------------------------")
-
-	// Start the recursive scan.
-	totalSize := walkDirRecursive(scanPath, threshold, excludeSet)
-
-	// Add the top-level directory to the results if it meets the threshold
-	if totalSize >= threshold {
-		addResult(scanPath, totalSize, true)
+	if graph && treeView {
+		return fmt.Errorf("error: -graph cannot be used with -tree")
 	}
-
-	// Sort results: directories first, then by size descending
-	sort.Slice(results, func(i, j int) bool {
-		if results[i].IsDir != results[j].IsDir {
-			return results[i].IsDir
+	digitSeparator = 0
+	if separator != "" {
+		sep, err := parseSeparator(separator)
+		if err != nil {
+			return fmt.Errorf("error: %v", err)
+		}
+		digitSeparator = sep
+	} else if groupDigitsFlag {
+		digitSeparator = localeSeparator(os.Getenv)
+	}
+	listColumns = nil
+	if columnsSpec != "" {
+		if format != "text" && format != "csv" && format != "tsv" {
+			return fmt.Errorf("error: -columns applies to the text, csv and tsv formats, not %s", format)
 		}
-		if results[i].Size != results[j].Size {
-			return results[i].Size > results[j].Size
+		cols, err := parseColumns(columnsSpec)
+		if err != nil {
+			return fmt.Errorf("error: -columns: %v", err)
 		}
-		return results[i].Path < results[j].Path
-	})
+		listColumns = cols
+	}
+	if hasColumn("device") {
+		showDevice = true
+	}
+	if showDevice && format != "text" && format != "csv" && format != "tsv" && format != "json" {
+		return fmt.Errorf("error: -show-device applies to the text, csv, tsv and json formats, not %s", format)
+	}
+	if hasColumn("owner") || hasColumn("group") {
+		showOwner = true
+	}
+	if showOwner && format != "text" && format != "csv" && format != "tsv" && format != "json" {
+		return fmt.Errorf("error: -show-owner applies to the text, csv, tsv and json formats, not %s", format)
+	}
+	if hasColumn("context") || hasColumn("acl") {
+		auditLabels = true
+	}
+	if auditLabels && format != "text" && format != "csv" && format != "tsv" && format != "json" {
+		return fmt.Errorf("error: -audit-labels applies to the text, csv, tsv and json formats, not %s", format)
+	}
+	if hasColumn("open_by") {
+		checkOpen = true
+	}
+	if dirTimes != "descendants" && dirTimes != "self" && dirTimes != "both" {
+		return fmt.Errorf("error: -dir-times must be descendants, self or both, not %q", dirTimes)
+	}
+	if hasColumn("dir_mtime") && dirTimes == "descendants" {
+		dirTimes = "both"
+	}
+	if trackSelfTimes() && fromListing != "" {
+		return fmt.Errorf("error: -dir-times=%s reads directories during the walk and cannot be used with -from-listing", dirTimes)
+	}
+	// The text listing shows labels as a suffix; CSV and TSV need columns.
+	labelColumns := auditLabels && (format == "csv" || format == "tsv")
+	linkColumns := linkStats && (format == "csv" || format == "tsv")
+	openColumn := checkOpen && (format == "csv" || format == "tsv")
+	if (showDevice || showOwner || labelColumns || linkColumns || openColumn) && listColumns == nil && format != "json" {
+		cols := map[string][]column{"text": textColumns, "csv": csvColumns, "tsv": tsvColumns}[format]
+		if linkColumns {
+			cols = withColumnsBeforePath(cols, "unique", "shared")
+		}
+		if openColumn {
+			cols = withColumnsBeforePath(cols, "open_by")
+		}
+		if labelColumns {
+			cols = withColumnsBeforePath(cols, "context", "acl")
+		}
+		if showOwner {
+			cols = withColumnsBeforePath(cols, "owner", "group")
+		}
+		if showDevice {
+			cols = withColumnsBeforePath(cols, "device")
+		}
+		listColumns = cols
+	}
+	// CSV and TSV carry exact bytes by default; -bytes only changes them
+	// when -columns asks for the humanized size.
+	if exactBytes && (format == "text" || listColumns != nil) {
+		listColumns = exactSizes(columnsFor(textColumns))
+	}
+	switch percentBase {
+	case "total", "parent", "fs":
+	default:
+		return fmt.Errorf("error: -percent-of must be total, parent or fs, not %q", percentBase)
+	}
+	if percentBase != "total" && !hasColumn("percent") {
+		return fmt.Errorf("error: -percent-of needs the percent column in -columns")
+	}
+	var auditProfile pathProfile
+	if pathAuditSpec != "" {
+		p, err := parsePathProfile(pathAuditSpec)
+		if err != nil {
+			return fmt.Errorf("error: -path-audit: %v", err)
+		}
+		auditProfile = p
+	}
+	var policy fsPolicy
+	if !includeFuse {
+		policy.deny, _ = parseFSTypes(defaultDenyFSTypes)
+	}
+	if fsDeny != "" {
+		types, err := parseFSTypes(fsDeny)
+		if err != nil {
+			return fmt.Errorf("error: -fs-deny: %v", err)
+		}
+		policy.deny = append(policy.deny, types...)
+	}
+	if fsAllow != "" {
+		types, err := parseFSTypes(fsAllow)
+		if err != nil {
+			return fmt.Errorf("error: -fs-allow: %v", err)
+		}
+		policy.allow = types
+	}
+	fatalClasses = nil
+	if fatalErrors != "" {
+		classes, err := parseErrorClasses(fatalErrors)
+		if err != nil {
+			return fmt.Errorf("error: -fatal-errors: %v", err)
+		}
+		fatalClasses = classes
+	}
+	if sortKey != "size" && sortKey != "unique" && sortKey != "mtime" {
+		return fmt.Errorf("error: -sort must be size, unique or mtime, not %q", sortKey)
+	}
+	trackLinks = linkStats || sortKey == "unique" || minUnique.IsSet || freeTarget.IsSet || hasColumn("unique") || hasColumn("shared")
+	if listTimeout < 0 {
+		return fmt.Errorf("error: -dir-list-timeout must not be negative")
+	}
+	dirListTimeout = listTimeout
+	if maxRetries < 0 {
+		return fmt.Errorf("error: -retries must not be negative")
+	}
+	if maxOpenFiles < 1 {
+		return fmt.Errorf("error: -max-open-files must be at least 1")
+	}
+	openFiles = newFDBudget(maxOpenFiles)
+	if walkWorkers < 0 {
+		return fmt.Errorf("error: -workers must not be negative")
+	}
+	debugWatchdog = debugFlag
+
+	if checkOpen && runtime.GOOS != "linux" {
+		return fmt.Errorf("error: -check-open is only supported on Linux")
+	}
+
+	var syslogOut *syslogTarget
+	if outSpec != "" {
+		target, err := parseSyslogOut(outSpec)
+		if err != nil {
+			return fmt.Errorf("error: -out: %v", err)
+		}
+		if !syslogAvailable {
+			return fmt.Errorf("error: -out: %v", errSyslogUnsupported)
+		}
+		syslogOut = &target
+	}
+	if minFiles < -1 || maxFiles < -1 {
+		return fmt.Errorf("error: -min-files and -max-files must not be negative")
+	}
+	if minFiles >= 0 && maxFiles >= 0 && minFiles > maxFiles {
+		return fmt.Errorf("error: -min-files %d is greater than -max-files %d", minFiles, maxFiles)
+	}
+	if perChildTop < 0 {
+		return fmt.Errorf("error: -per-child-top must not be negative")
+	}
+	if historyKeep < 0 {
+		return fmt.Errorf("error: -history-keep must not be negative")
+	}
+	if syslogTop < 0 {
+		return fmt.Errorf("error: -syslog-top must not be negative")
+	}
+
+	heat = nil
+	if heatmapOut != "" {
+		h, err := newHeatmap(sizeBuckets, ageBuckets, time.Now())
+		if err != nil {
+			return fmt.Errorf("error: %v", err)
+		}
+		heat = h
+	}
+
+	var annotators []Annotator
+	if annotateSpec != "" {
+		var err error
+		if annotators, err = parseAnnotators(annotateSpec); err != nil {
+			return fmt.Errorf("error: -annotate: %v", err)
+		}
+	}
+	var images *imageAnalyzer
+	if analyzeImages {
+		if imageAllocLimit <= 0 {
+			return fmt.Errorf("error: -image-alloc-limit must be a positive percentage")
+		}
+		images = newImageAnalyzer(imageAllocLimit)
+		annotators = append(annotators, images.annotators()...)
+	}
+
+	var labels labelReader
+	if auditLabels {
+		var err error
+		if labels, err = loadLabelReader(); err != nil {
+			return fmt.Errorf("error: -audit-labels: %v", err)
+		}
+	}
+	var prober cacheProber
+	if cacheReportFlag || peekCache {
+		var err error
+		if prober, err = loadCacheProber(); err != nil {
+			name := "-cache-report"
+			if !cacheReportFlag {
+				name = "-peek-cache"
+			}
+			return fmt.Errorf("error: %s: %v", name, err)
+		}
+	}
+
+	scanPath := fs.Arg(0)
+	minSizeStr := fs.Arg(1)
+
+	// Clean the path to remove any trailing slashes for consistent output
+	scanPath = filepath.Clean(scanPath)
+
+	// Machine formats are read by programs that may run elsewhere, so
+	// their paths are absolute unless -absolute=false says otherwise. A
+	// listing's paths are matched against the root as given.
+	absoluteSet := false
+	fs.Visit(func(f *flag.Flag) { absoluteSet = absoluteSet || f.Name == "absolute" })
+	if !absoluteSet && machineOut != nil && format != "print0" && fromListing == "" {
+		absolutePaths = true
+	}
+	absolutePaths = absolutePaths || resolveSymlinks
+	if absolutePaths && fromListing != "" {
+		return fmt.Errorf("error: -absolute and -resolve-symlinks cannot be used with -from-listing, whose paths are matched as given")
+	}
+	if absolutePaths {
+		abs, err := filepath.Abs(scanPath)
+		if err != nil {
+			return fmt.Errorf("error resolving '%s': %v", scanPath, err)
+		}
+		scanPath = abs
+	}
+	// Only the symlinks the user asks to see through are resolved; the
+	// walk below the root never follows them.
+	if resolveSymlinks {
+		real, err := filepath.EvalSymlinks(scanPath)
+		if err != nil {
+			return fmt.Errorf("error resolving '%s': %v", scanPath, err)
+		}
+		scanPath = real
+	}
+
+	// Build the exclude set. Anchored entries are keyed by absolute path
+	// and looked up by anchoredPath, never by entry name, so tmp/ under
+	// a root of . does not also exclude a/tmp.
+	excludeSet := make(map[string]struct{})
+	var excludeNames []string
+	excludeAnchored, excludePatterns = false, nil
+	excludeWorkDir, _ = os.Getwd()
+	if excludeDirs != "" {
+		for _, dir := range strings.Split(excludeDirs, ",") {
+			trimmed := strings.TrimSpace(dir)
+			pattern := false
+			if trimmed != "" && isAnchoredExclude(trimmed) {
+				p, ok := anchorExclude(scanPath, trimmed)
+				if !ok {
+					fmt.Fprintf(stderr, "Warning: -exclude %s is not below %s and matches nothing.\n", displayPath(trimmed), displayPath(scanPath))
+					continue
+				}
+				if hasWildcard(trimmed) {
+					if _, err := filepath.Match(p, ""); err != nil {
+						return fmt.Errorf("error: -exclude %s: malformed pattern", trimmed)
+					}
+					pattern = true
+				}
+				trimmed = p
+				excludeAnchored = true
+			}
+			if _, dup := excludeSet[trimmed]; trimmed != "" && !dup {
+				excludeSet[trimmed] = struct{}{}
+				excludeNames = append(excludeNames, trimmed)
+				if pattern {
+					excludePatterns = append(excludePatterns, trimmed)
+				}
+			}
+		}
+	}
+	excludeHits = nil
+	if excludeStats {
+		excludeHits = newExcludeHits(excludeSet)
+	}
+
+	// Check if the top-level directory itself is excluded. Only an
+	// anchored entry can name it: -exclude=dev still scans /dev when
+	// that is what was asked for.
+	if _, excluded := excludeSet[anchoredPath(scanPath)]; excluded && excludeAnchored {
+		if !force {
+			return &rootExcludedError{Path: scanPath}
+		}
+		fmt.Fprintf(stderr, "Warning: top-level directory '%s' is in the exclude list; scanning it because of -force.\n", displayPath(scanPath))
+	}
+
+	threshold, err := parseSize(minSizeStr)
+	if err != nil {
+		return fmt.Errorf("error: %v", err)
+	}
+	opts := normalizeOptions(scanPath, scanOptions{
+		LogicalSize:     logicalSize,
+		FollowJunctions: followJunctions,
+		Exclude:         excludeNames,
+		FSDeny:          policy.deny,
+		FSAllow:         policy.allow,
+		IncludeTmpfs:    includeTmpfs,
+		Threshold:       threshold,
+		MinFiles:        minFiles,
+		MaxFiles:        maxFiles,
+		ExcludeEmpty:    excludeEmpty,
+		AllOlderThan:    olderThanOption(allOlderThan),
+		MinUnique:       minUnique.Bytes,
+	})
+	// A baseline is only a fair yardstick for a scan measured the same
+	// way; one that counted other entries is compared, with a warning.
+	if baseline != nil && baseline.Options != nil && baseline.Fingerprint != opts.fingerprint() {
+		metric, filter := compareOptions(*baseline.Options, opts)
+		if len(metric) > 0 && !forceDiff {
+			return &incompatibleOptionsError{What: "the scan and -baseline " + baselineName, Differences: metric}
+		}
+		fmt.Fprintf(stderr, "Warning: -baseline %s was written with other options: %s\n", baselineName, strings.Join(append(metric, filter...), "; "))
+	}
+
+	// An imported listing may describe a filesystem that is not mounted
+	// here, so the root is only checked when it is walked.
+	var listing *os.File
+	var rootAnchor, linkTarget string
+	if fromListing != "" {
+		listing, err = os.Open(fromListing)
+		if err != nil {
+			return fmt.Errorf("error: -from-listing: %v", err)
+		}
+		defer listing.Close()
+	} else {
+		fi, err := os.Stat(scanPath)
+		if err != nil {
+			return fmt.Errorf("error accessing '%s': %v", scanPath, err)
+		}
+		if !fi.IsDir() {
+			return fmt.Errorf("error: '%s' is not a directory", scanPath)
+		}
+
+		// A symlinked root is resolved once, so that mount-based checks use
+		// the real location while output keeps the form the user typed.
+		rootAnchor, linkTarget, err = resolveRoot(scanPath, !noResolveRoot)
+		if err != nil {
+			return fmt.Errorf("error resolving '%s': %v", scanPath, err)
+		}
+	}
+
+	outputs := []struct{ flag, path string }{{"o", outputFile}, {"history", historyFile}, {"heatmap", heatmapOut}}
+	if writeBaseline {
+		outputs = append(outputs, struct{ flag, path string }{"baseline", baselineName})
+	}
+	ownOutputs = nil
+	for _, out := range outputs {
+		if out.path == "" {
+			continue
+		}
+		if err := checkWritable(out.path); err != nil {
+			return fmt.Errorf("error: -%s: cannot write %s: %v", out.flag, out.path, err)
+		}
+		noteOwnOutput(out.path)
+	}
+	if checkOnly {
+		fmt.Fprintf(stdout, "Configuration OK: %s with threshold %s.\n", displayPath(scanPath), humanReadableSize(threshold))
+		return nil
+	}
+
+	// -o takes the results: the document of a machine format, whose text
+	// report then goes to the terminal after all, or else the text report
+	// from its table on. The banner, warnings and progress stay on the
+	// terminal.
+	var outFile *atomicFile
+	var fileOut io.Writer
+	var gz *gzipOutput
+	if outputFile != "" {
+		f, err := createAtomic(outputFile)
+		if err != nil {
+			return fmt.Errorf("error: -o: %v", err)
+		}
+		outFile = f
+		defer outFile.abort()
+		var w io.Writer = outFile
+		if compression == "gzip" {
+			gz = newGzipOutput(outFile)
+			defer gz.close()
+			w = gz
+		}
+		fileOut = &lockedWriter{sink: &outputSink{statusW: io.Discard}, w: w}
+		if machineOut != nil {
+			stdout, machineOut = machineOut, fileOut
+			fileOut = nil
+		}
+	} else if compression == "gzip" {
+		gz = newGzipOutput(machineOut)
+		defer gz.close()
+		machineOut = gz
+	}
+
+	var cutoff time.Time
+	if allOlderThan > 0 {
+		cutoff = time.Now().Add(-allOlderThan)
+	}
+
+	hrThreshold := humanReadableSize(threshold)
+	banner := stdout
+	if quiet {
+		banner = io.Discard
+	}
+	if listing != nil {
+		fmt.Fprintf(banner, "Reading listing: %s for %s\n", displayPath(fromListing), displayPath(scanPath))
+	} else if linkTarget != "" {
+		fmt.Fprintf(banner, "Scanning directory: %s via symlink %s\n", displayPath(linkTarget), displayPath(scanPath))
+	} else {
+		fmt.Fprintf(banner, "Scanning directory: %s\n", displayPath(scanPath))
+	}
+	fmt.Fprintf(banner, "Minimum size threshold: %s\n", hrThreshold)
+	if len(excludeSet) > 0 {
+		fmt.Fprintf(banner, "Excluding: %s\n", excludeDirs)
+	}
+	if minFiles >= 0 || maxFiles >= 0 {
+		fmt.Fprintf(banner, "Listing: %s\n", listingCondition(threshold))
+	}
+	if allOlderThan > 0 {
+		fmt.Fprintf(banner, "Only directories whose newest file predates: %s\n", cutoff.Format("2006-01-02 15:04"))
+	}
+	if gz != nil {
+		dest := "stdout"
+		if outputFile != "" {
+			dest = displayPath(outputFile)
+		}
+		fmt.Fprintf(banner, "Output: gzip-compressed to %s\n", dest)
+	}
+	if fileOut != nil {
+		terminal := stdout
+		stdout = fileOut
+		defer func() { stdout = terminal }()
+	}
+	// Colors are for a reader at a terminal; a listing written with -o
+	// stays plain even with -color=always.
+	colors = nil
+	if on, _ := colorEnabled(colorMode, stdout, os.Getenv("NO_COLOR")); on && fileOut == nil {
+		colors = &palette{threshold: threshold, warn: warnTier, alarm: alarmTier}
+		defer func() { colors = nil }()
+	}
+	if !treeView && !auditDeterminism && !quiet {
+		fmt.Fprintln(stdout, "\n"+textHeading())
+		fmt.Fprintln(stdout, "--------------------------------")
+	}
+
+	memoryMounts, memoryRoots, memoryBytes = nil, nil, 0
+	resetMountCrossings()
+	resetMountPolicy()
+	rootInMemory := false
+	if listing == nil {
+		table, err := loadMountTable()
+		switch {
+		case err != nil && !includeTmpfs:
+			fmt.Fprintf(stderr, "Warning: cannot read mount table, tmpfs is not separated: %v\n", err)
+		case err != nil:
+		case !includeTmpfs:
+			rootInMemory = setupMemoryMounts(table, scanPath, rootAnchor)
+			fallthrough
+		default:
+			setupMountCrossings(table, scanPath, rootAnchor)
+			setupMountPolicy(table, scanPath, rootAnchor, policy)
+		}
+	}
+
+	perf = nil
+	if perfReportFlag {
+		perf = newPerfReport(scanPath)
+	}
+	symlinks = nil
+	if symlinkReportFlag {
+		symlinks = newSymlinkReport(threshold)
+	}
+	pathAudit = nil
+	if pathAuditSpec != "" {
+		pathAudit = newPathAuditor(scanPath, auditProfile)
+	}
+	allowances = nil
+	if baseline != nil && len(baseline.Allowances) > 0 {
+		allowances = newAllowanceTally(scanPath, baseline)
+	}
+	dirEntryCounts = nil
+	if treeView {
+		dirEntryCounts = newTreeCounts()
+		defer func() { dirEntryCounts = nil }()
+	}
+	percentOf, parentSizes, columnFS = percentBase, nil, 0
+	if showAncestors {
+		parentSizes = newParentTotals(scanPath)
+	}
+	switch percentBase {
+	case "parent":
+		if parentSizes == nil {
+			parentSizes = newParentTotals("")
+		}
+	case "fs":
+		size, err := filesystemSize(scanPath)
+		if err != nil {
+			return fmt.Errorf("error: -percent-of=fs: %v", err)
+		}
+		columnFS = size
+	}
+	blobDirs = nil
+	if detectBlobDirs {
+		blobDirs = newBlobDirIndex(blobDirCutoff)
+	}
+	peeks = nil
+	if peekTop > 0 {
+		peeks = newPeekIndex(peekTop)
+	}
+	devices = nil
+	if showDevice {
+		devices = newDeviceIndex(loadDeviceResolver())
+	}
+	owners = nil
+	if showOwner {
+		owners = newOwnerIndex(loadOwnerResolver())
+	}
+	dupeDirs = nil
+	if dupeDirsFlag {
+		dupeDirs = newDupeDirIndex(threshold)
+	}
+	ncdu = nil
+	if format == "ncdu" {
+		ncdu = newNcduTree(scanPath)
+		defer func() { ncdu = nil }()
+	}
+	perChild = nil
+	if perChildTop > 0 {
+		perChild = newChildTops(scanPath, perChildTop)
+	}
+	largestFileSeen.Store(0)
+	partialMutex.Lock()
+	partialDirs, finishedPartials = nil, 0
+	partialMutex.Unlock()
+	reparseNotes = nil
+	sizeOverflowed.Store(false)
+	retryCount.Store(0)
+
+	var sampler *selfStatsSampler
+	if selfStatsFlag {
+		sampler = startSelfStats()
+		defer sampler.halt()
+	}
+	trackDirTimes = showDirTimes || allOlderThan > 0 || hasColumn("mtime") || sortKey == "mtime" || format == "json" || trackSelfTimes()
+	trackFileCounts = minFiles >= 0 || maxFiles >= 0 || hasColumn("count") || format == "json"
+
+	scanErrors = nil
+	if format == "json" {
+		scanErrors = &scanErrorLog{}
+		defer func() { scanErrors = nil }()
+	}
+	resultStream = nil
+	if format == "ndjson" {
+		resultStream = newNDJSONStream(machineOut, func(res FileInfo) bool {
+			return (!excludeEmpty || res.Size > 0) &&
+				(allOlderThan <= 0 || allOlder(res, cutoff)) &&
+				(!trackFileCounts || fileCountOK(res)) &&
+				(!minUnique.IsSet || res.Unique >= minUnique.Bytes)
+		})
+		resultStream.rootInMemory = rootInMemory
+		if canonicalPaths {
+			resultStream.canonicalRoot = scanPath
+		}
+		if checkOpen {
+			// Streamed files cannot wait for the walk to end, so they
+			// are checked against the files open when it starts.
+			resultStream.openBy = findFileUsers(procRoot, nil)
+		}
+		defer func() { resultStream = nil }()
+	}
+
+	// Start the recursive scan. From here a signal stops the walk and run
+	// returns the *interruptedError without writing anything further.
+	var cache *cacheReport
+	if prober != nil {
+		cache = startCacheReport(prober, peekCache)
+	}
+	scanStart := time.Now()
+	stopSignals := watchSignals()
+	defer stopSignals()
+	var rootStats subtreeStats
+	var listed listingStats
+	if listing != nil {
+		rootStats, listed, err = importListing(listing, scanPath, threshold, excludeSet)
+		if err != nil {
+			return fmt.Errorf("error reading listing %s: %v", fromListing, err)
+		}
+		err = interruption()
+	} else if auditDeterminism {
+		return runDeterminismAudit(scanPath, threshold, excludeSet, auditSerial)
+	} else {
+		rootStats, err = walkDir(scanPath, threshold, excludeSet)
+	}
+	if err != nil {
+		if resultStream != nil {
+			resultStream.abort(scanPath, rootStats.Size, err)
+		}
+		if format == "json" {
+			list := results
+			if canonicalPaths {
+				list = canonicalResults(scanPath, results)
+			}
+			writeTruncatedJSON(machineOut, scanPath, threshold, excludeNames, rootStats.Size, list, canonicalPaths, err)
+		}
+		return err
+	}
+	if cache != nil {
+		cache.finish(rootStats)
+	}
+	totalSize := rootStats.Size
+	columnTotal = totalSize
+	if parentSizes != nil {
+		parentSizes.fill(results)
+	}
+
+	if sizeOverflowed.Load() {
+		return fmt.Errorf("error: %w", errSizeOverflow)
+	}
+
+	// Add the top-level directory to the results if it meets the threshold
+	if totalSize >= threshold {
+		addDirResult(scanPath, rootStats)
+	}
+	if peeks != nil {
+		peeks.fill(results)
+	}
+	if rootInMemory {
+		recordMemoryMount(scanPath, totalSize)
+	}
+
+	suppressedEmpty := 0
+	if excludeEmpty {
+		results, suppressedEmpty = dropEmpty(results)
+	}
+
+	if allOlderThan > 0 {
+		results = keepAllOlderThan(results, cutoff)
+	}
+	if trackFileCounts {
+		results = keepFileCounts(results)
+	}
+	if minUnique.IsSet {
+		results = keepMinUnique(results, minUnique.Bytes)
+	}
+
+	// Memory-backed entries are listed in their own section.
+	var memoryResults []FileInfo
+	if len(memoryRoots) > 0 {
+		diskResults := results[:0:0]
+		for _, res := range results {
+			if isMemoryBacked(res.Path) {
+				res.MemoryBacked = true
+				memoryResults = append(memoryResults, res)
+			} else {
+				diskResults = append(diskResults, res)
+			}
+		}
+		results = diskResults
+	}
+
+	if labels != nil {
+		annotateLabels(results, labels)
+		annotateLabels(memoryResults, labels)
+	}
+	if checkOpen {
+		annotateOpenFiles(results)
+		annotateOpenFiles(memoryResults)
+	}
+	if cache != nil && peekCache {
+		cache.probe(results)
+		cache.probe(memoryResults)
+	}
+	if owners != nil {
+		owners.annotate(results)
+		owners.annotate(memoryResults)
+	}
+	if devices != nil {
+		devices.annotate(results)
+		devices.annotate(memoryResults)
+	}
+	if pathAudit != nil {
+		pathAudit.annotate(results)
+		pathAudit.annotate(memoryResults)
+	}
+	if len(annotators) > 0 {
+		annotateEntries(results, annotators, annotateConcurrency)
+		annotateEntries(memoryResults, annotators, annotateConcurrency)
+	}
+
+	sortList := sortResults
+	switch sortKey {
+	case "unique":
+		sortList = sortByUnique
+	case "mtime":
+		sortList = sortByMTime
+	}
+	sortList(results)
+	// Context rows are for display only; results keep the qualifying
+	// entries that everything after the listing counts.
+	shown := results
+	if showAncestors {
+		shown = withAncestors(scanPath, results)
+		sortList(shown)
+	}
+	// Bars only ever reach the text listing: machine formats discard it.
+	bars = nil
+	if graph {
+		bars = &barChart{columns: 80, ascii: asciiBars || !utf8Locale(os.Getenv)}
+		if fileOut == nil {
+			bars.columns = graphColumns(os.Stdout, os.Getenv("COLUMNS"))
+		}
+		if graphScale == "total" {
+			bars.total = totalSize
+		}
+		defer func() { bars = nil }()
+	}
+	if treeView {
+		if !quiet {
+			fmt.Fprintln(stdout)
+		}
+		if !quiet || len(shown) > 0 {
+			printTree(buildTree(scanPath, totalSize, shown), 0)
+		}
+	} else {
+		printResults(shown)
+	}
+
+	if len(memoryRoots) > 0 {
+		sortList(memoryResults)
+		if !quiet {
+			fmt.Fprintln(stdout, "\nMemory-backed (tmpfs/ramfs), not counted as disk usage:")
+		}
+		printResults(memoryResults)
+		if !quiet {
+			fmt.Fprintf(stdout, "Memory-backed subtotal: %s\n", humanReadableSize(memoryBytes))
+		}
+	}
+
+	if perChild != nil {
+		perChild.print()
+	}
+
+	if symlinks != nil {
+		symlinks.print()
+	}
+
+	if pathAudit != nil {
+		pathAudit.print()
+	}
+
+	if images != nil {
+		images.print()
+	}
+
+	if blobDirs != nil {
+		blobDirs.print()
+	}
+
+	if dupeDirs != nil {
+		groups := dupeDirs.groups(fuzzyDupes)
+		if verifyContent {
+			groups = verifyGroups(groups)
+		}
+		printDupeDirs(groups, verifyContent)
+	}
+
+	if freeTarget.IsSet {
+		// Memory-backed entries free RAM, not disk, and are not offered.
+		printFreePlan(scanPath, planFree(scanPath, freeTarget.Bytes, results))
+	}
+
+	// A baseline violation fails the run, but only once every output has
+	// been written.
+	var baselineErr error
+	if baseline != nil {
+		vs, shrunk := compareBaseline(baseline, scanPath, threshold, allowances, results, memoryResults)
+		printBaselineCheck(baselineName, vs, shrunk)
+		if len(vs) > 0 {
+			baselineErr = &baselineError{File: baselineName, Violations: len(vs)}
+		}
+	}
+
+	if heat != nil {
+		heat.print()
+		if err := heat.export(heatmapOut); err != nil {
+			return fmt.Errorf("error: writing heatmap: %v", err)
+		}
+	}
+
+	if len(reparseNotes) > 0 && !quiet {
+		printReparseNotes()
+	}
+
+	if findLogsFlag {
+		printLogs(findLogs(append(append([]FileInfo(nil), results...), memoryResults...), logGrowthInterval))
+	}
+
+	if labels != nil {
+		printLabelSummary(summarizeLabels(append(append([]FileInfo(nil), results...), memoryResults...)))
+	}
+
+	if devices != nil {
+		printDeviceSummary(devices.rollup())
+	}
+
+	if cache != nil && cacheReportFlag {
+		cache.print()
+	}
+
+	if perf != nil {
+		perf.print()
+	}
+
+	// The notes on how the scan went are left out of a quiet listing;
+	// the errors behind them are on stderr.
+	if !quiet {
+		printMountSummary()
+		printSkippedMounts()
+
+		if n := retryCount.Load(); n > 0 {
+			fmt.Fprintf(stdout, "\nRetried %d transient I/O errors.\n", n)
+		}
+
+		if suppressedEmpty > 0 {
+			fmt.Fprintf(stdout, "\nSuppressed %d empty entries.\n", suppressedEmpty)
+		}
+	}
+
+	if excludeStats && len(excludeNames) > 0 {
+		printExcludeStats(excludeNames)
+	}
+
+	if listing != nil {
+		printListingStats(listed)
+	}
+
+	if len(skippedEntries) > 0 && !quiet {
+		printSkipped()
+	}
+
+	if len(partialDirs) > 0 && !quiet {
+		printPartials()
+	}
+	if finishedPartials > 0 && !quiet {
+		fmt.Fprintf(stdout, "\nFinished %d partially listed directories in a second pass.\n", finishedPartials)
+	}
+
+	if showExtremes && oldestFile != nil {
+		fmt.Fprintln(stdout)
+		fmt.Fprintf(stdout, "Oldest file above threshold: %s\n", describeDatedFile(oldestFile))
+		fmt.Fprintf(stdout, "Newest file above threshold: %s\n", describeDatedFile(newestFile))
+	}
+
+	var usage *selfStats
+	if sampler != nil {
+		st := sampler.stop()
+		st.print()
+		usage = &st
+	}
+
+	if !noHints {
+		allResults := append(results, memoryResults...)
+		if hint := thresholdHint(allResults, threshold, largestFileSeen.Load()); hint != "" {
+			fmt.Fprintf(stdout, "\nHint: %s\n", hint)
+		}
+	}
+
+	var summary *scanSummary
+	if !noSummary {
+		s := newScanSummary(rootStats, len(results)+len(memoryResults), time.Since(scanStart))
+		s.print()
+		summary = &s
+	}
+
+	// Artifacts get canonical paths; the text listing above stays native.
+	outResults, outMemory := results, memoryResults
+	if canonicalPaths {
+		outResults, outMemory = canonicalResults(scanPath, results), canonicalResults(scanPath, memoryResults)
+	}
+	switch format {
+	case "ndjson":
+		if err := resultStream.finish(scanPath, totalSize); err != nil {
+			return fmt.Errorf("error: %v", err)
+		}
+	case "json":
+		entries := outResults
+		if showAncestors {
+			entries = shown
+			if canonicalPaths {
+				entries = canonicalResults(scanPath, shown)
+			}
+		}
+		rep := newJSONReport(scanPath, threshold, excludeNames, totalSize, entries, outMemory)
+		rep.Filesystems, rep.MountCrossings = traversedFilesystems(), mountCrossings()
+		rep.SkippedMounts = skippedFilesystems()
+		if devices != nil {
+			rep.Devices = devices.rollup()
+		}
+		if usage != nil {
+			rep.SelfStats = usage.report()
+		}
+		if labels != nil {
+			rep.Labels = summarizeLabels(append(append([]FileInfo(nil), results...), memoryResults...)).report()
+		}
+		if showExtremes && oldestFile != nil {
+			oldest, newest := oldestFile.Path, newestFile.Path
+			if canonicalPaths {
+				oldest, newest = canonicalPath(scanPath, oldest), canonicalPath(scanPath, newest)
+			}
+			rep.OldestFile, rep.NewestFile = newJSONDatedFile(oldestFile, oldest), newJSONDatedFile(newestFile, newest)
+		}
+		rep.Errors = scanErrors.report(scanPath, canonicalPaths)
+		rep.CanonicalPaths = canonicalPaths
+		rep.Summary = summary
+		if err := writeJSONReport(machineOut, rep); err != nil {
+			return fmt.Errorf("error: writing JSON: %v", err)
+		}
+	case "csv":
+		if err := writeCSVResults(machineOut, !noHeader, annotatorNames(annotators), outResults, outMemory); err != nil {
+			return fmt.Errorf("error: writing CSV: %v", err)
+		}
+	case "tsv":
+		if err := writeTSVResults(machineOut, delim, outResults, outMemory); err != nil {
+			return fmt.Errorf("error: writing TSV: %v", err)
+		}
+	case "xml":
+		doc := newXMLScan(scanPath, threshold, totalSize, outResults, outMemory)
+		doc.CanonicalPaths = canonicalPaths
+		if err := writeXMLScan(machineOut, doc); err != nil {
+			return fmt.Errorf("error: writing XML: %v", err)
+		}
+	case "ncdu":
+		if err := ncdu.write(machineOut, time.Now()); err != nil {
+			return fmt.Errorf("error: writing ncdu export: %v", err)
+		}
+	case "print0":
+		// The paths are for commands to act on, so they stay native.
+		if err := writePrint0(machineOut, results, memoryResults); err != nil {
+			return fmt.Errorf("error: -print0: %v", err)
+		}
+	case "template":
+		sum := templateSummary{Root: scanPath, Total: totalSize, Threshold: threshold}
+		if err := writeTemplateResults(machineOut, entryTmpl, summaryTmpl, sum, outResults, outMemory); err != nil {
+			return fmt.Errorf("error: -template: %v", err)
+		}
+	case "html":
+		// The page is for people, so it keeps native paths like the text
+		// listing.
+		rep := newHTMLReport(scanPath, threshold, totalSize, results, memoryResults)
+		if err := writeHTMLReport(machineOut, rep); err != nil {
+			return fmt.Errorf("error: writing HTML: %v", err)
+		}
+	}
+
+	// A signal during the report leaves -o, -history and the baseline as
+	// they were, like one during the walk.
+	if err := interruption(); err != nil {
+		return err
+	}
+	if gz != nil {
+		if err := gz.close(); err != nil {
+			return fmt.Errorf("error: compressing output: %v", err)
+		}
+	}
+	if outFile != nil {
+		if err := outFile.commit(); err != nil {
+			return fmt.Errorf("error: -o: %v", err)
+		}
+	}
+
+	if historyFile != "" {
+		rec := newHistoryRecord(time.Now(), scanPath, totalSize, results)
+		rec.Options, rec.Fingerprint = &opts, opts.fingerprint()
+		if canonicalPaths {
+			rec.canonicalize()
+		}
+		if err := appendHistory(historyFile, rec, historyKeep); err != nil {
+			return fmt.Errorf("error: writing history: %v", err)
+		}
+	}
+
+	if syslogOut != nil {
+		msgs := syslogMessages(scanPath, totalSize, threshold, results, syslogTop)
+		if err := sendSyslog(*syslogOut, msgs); err != nil {
+			return fmt.Errorf("error: sending results to syslog: %v", err)
+		}
+	}
 
-	// Display results
-	for _, res := range results {
-		typeStr := "[FILE]"
-		if res.IsDir {
-			typeStr = "[DIR] "
+	if writeBaseline {
+		n, err := updateBaseline(baselineName, scanPath, opts, results, memoryResults)
+		if err != nil {
+			return fmt.Errorf("error: -update-baseline: %v", err)
 		}
-		fmt.Printf("%s %-10s  %s\n",
-			typeStr,
-			humanReadableSize(res.Size),
-			res.Path)
+		fmt.Fprintf(stdout, "\nBaseline %s updated: %d tracked %s.\n", baselineName, n, plural(n, "file", "files"))
 	}
-	return nil
+	return baselineErr
 }
 
 func main() {
 	if err := run(os.Args); err != nil {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(stderr, "%v\n", err)
+		os.Exit(exitCode(err))
 	}
 }
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"reflect"
 	"sort"
 	"strings"
 	"testing"
+	"time"
 )
 
 // Helper function to create a temporary directory structure for testing
@@ -43,7 +48,69 @@ func createTestDir(t *testing.T, files map[string]string) string {
 func resetResults() {
 	resultsMutex.Lock()
 	results = nil
+	oldestFile, newestFile = nil, nil
 	resultsMutex.Unlock()
+	skippedMutex.Lock()
+	skippedEntries = make(map[string]int)
+	skippedMutex.Unlock()
+}
+
+// resetWalkOptions restores the walk settings run leaves behind, so that
+// tests calling the walk directly afterwards see the defaults.
+func resetWalkOptions() {
+	trackDirTimes, showDirTimes, dirTimes = false, false, "descendants"
+	trackFileCounts, minFiles, maxFiles = false, -1, -1
+	trackLinks = false
+	dirListTimeout, finishPartials = 0, false
+	fatalClasses = nil
+	heat, perf, perChild, symlinks, excludeHits = nil, nil, nil, nil, nil
+	ncdu, pathAudit, dupeDirs = nil, nil, nil
+	listColumns, allowances, colors, bars, blobDirs = nil, nil, nil, nil, nil
+	percentOf, parentSizes = "total", nil
+	peeks, devices, owners = nil, nil, nil
+	followJunctions, logicalSize = false, false
+	siUnits, sizePrecision, digitSeparator = false, 2, 0
+	showProgress, debugWatchdog = false, false
+	walkWorkers = 0
+	excludeAnchored, excludePatterns, excludeWorkDir = false, nil, ""
+	ownOutputs = nil
+	memoryMounts = nil
+	mountPoints = nil
+}
+
+// runCaptured calls run with the given arguments and returns everything it
+// wrote to stdout and stderr.
+// capturedTerminal makes runCaptured's pipe count as a terminal, so that
+// tests see the full report rather than the implied -q listing.
+var capturedTerminal = true
+
+func runCaptured(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	if capturedTerminal {
+		old := stdoutIsTerminal
+		stdoutIsTerminal = func() bool { return true }
+		defer func() { stdoutIsTerminal = old }()
+	}
+	oldStdout, oldStderr := os.Stdout, os.Stderr
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	os.Stdout, os.Stderr = w, w
+
+	outCh := make(chan []byte)
+	go func() {
+		out, _ := io.ReadAll(r)
+		outCh <- out
+	}()
+
+	runErr := run(append([]string{"spacehogs"}, args...))
+	resetWalkOptions()
+
+	w.Close()
+	os.Stdout, os.Stderr = oldStdout, oldStderr
+	setupOutput(os.Stdout, os.Stderr)
+	return string(<-outCh), runErr
 }
 
 func TestParseSize(t *testing.T) {
@@ -64,6 +131,17 @@ func TestParseSize(t *testing.T) {
 		{"abc", 0, true},    // Invalid format
 		{"100XYZ", 0, true}, // Invalid unit
 		{"-50M", 0, true},   // Negative value (parsefloat handles this, but the logic should handle it)
+		{"1P", 1024 * 1024 * 1024 * 1024 * 1024, false},
+		{"1,5G", uint64(1.5 * 1024 * 1024 * 1024), false}, // Comma decimal separator
+		{"2,25K", uint64(2.25 * 1024), false},
+		{"0,5M", 512 * 1024, false},
+		{"1,5.0G", 0, true}, // Both separators
+		{"1,000K", 0, true}, // Grouping needs -locale-numbers
+		{"1,2,3K", 0, true},
+		{"1536MiB", 1536 * 1024 * 1024, false}, // IEC spelling, same powers of 1024
+		{"2GiB", 2 * 1024 * 1024 * 1024, false},
+		{"4ki", 4 * 1024, false},
+		{"100iB", 0, true}, // "i" needs a unit letter
 	}
 
 	for _, test := range tests {
@@ -75,6 +153,43 @@ func TestParseSize(t *testing.T) {
 			t.Errorf("For input '%s', expected size: %d, got: %d", test.input, test.expected, size)
 		}
 	}
+
+	errorTests := []struct {
+		input    string
+		expected error
+	}{
+		{"1,5.0G", errAmbiguousSeparator},
+		{"1.000,5K", errAmbiguousSeparator},
+		{"1,000K", errDigitGrouping},
+		{"1,000,000", errDigitGrouping},
+	}
+	for _, test := range errorTests {
+		_, err := parseSize(test.input)
+		if !errors.Is(err, test.expected) {
+			t.Errorf("For input '%s', expected error %q, got: %v", test.input, test.expected, err)
+		}
+	}
+}
+
+func TestParseSizeLocaleNumbers(t *testing.T) {
+	localeNumbers = true
+	defer func() { localeNumbers = false }()
+
+	tests := []struct {
+		input    string
+		expected uint64
+	}{
+		{"1,000K", 1000 * 1024},
+		{"1,000,000", 1000000},
+		{"1,234.5K", uint64(1234.5 * 1024)},
+		{"1,5G", uint64(1.5 * 1024 * 1024 * 1024)}, // Not a grouping pattern, still a decimal comma
+	}
+	for _, test := range tests {
+		size, err := parseSize(test.input)
+		if err != nil || size != test.expected {
+			t.Errorf("For input '%s' with -locale-numbers, expected %d, got %d (%v)", test.input, test.expected, size, err)
+		}
+	}
 }
 
 func TestHumanReadableSize(t *testing.T) {
@@ -92,6 +207,12 @@ func TestHumanReadableSize(t *testing.T) {
 		{2 * 1024 * 1024 * 1024, "2.00 GiB"},
 		{1024 * 1024 * 1024 * 1024, "1.00 TiB"},
 		{2345678901234, "2.13 TiB"},
+		{1048575, "1.00 MiB"}, // would be 1024.00 KiB without promotion
+		{1048577, "1.00 MiB"},
+		{1073741823, "1.00 GiB"},
+		{1073741825, "1.00 GiB"},
+		{1023*1024 + 1018, "1023.99 KiB"},
+		{1<<64 - 1, "16.00 EiB"},
 	}
 
 	for _, test := range tests {
@@ -100,21 +221,291 @@ func TestHumanReadableSize(t *testing.T) {
 			t.Errorf("For input %d, expected '%s', got '%s'", test.input, test.expected, result)
 		}
 	}
+
+	precisionTests := []struct {
+		precision int
+		input     uint64
+		expected  string
+	}{
+		{0, 1024, "1 KiB"},
+		{0, 1535, "1 KiB"},
+		{0, 1536, "2 KiB"}, // rounded, not truncated
+		{0, 1023*1024 + 511, "1023 KiB"},
+		{0, 1023*1024 + 922, "1 MiB"}, // 1023.9 KiB rounds to 1024
+		{0, 1023, "1023 B"},
+		{1, 1023*1024 + 921, "1023.9 KiB"},
+		{1, 1023*1024 + 973, "1.0 MiB"}, // would be 1024.0 KiB without promotion
+		{1, 1536, "1.5 KiB"},
+		{3, 1536, "1.500 KiB"},
+		{3, 2345678901234, "2.133 TiB"},
+		{6, 1048575, "1023.999023 KiB"},
+		{6, 1<<64 - 1, "16.000000 EiB"},
+	}
+	for _, test := range precisionTests {
+		sizePrecision = test.precision
+		if result := humanReadableSize(test.input); result != test.expected {
+			t.Errorf("Precision %d, input %d: expected '%s', got '%s'", test.precision, test.input, test.expected, result)
+		}
+	}
+	sizePrecision = 2
+
+	// With -rounding=down, values just below a boundary are truncated and
+	// stay in the smaller unit.
+	roundDown = true
+	defer func() { roundDown = false }()
+	downTests := []struct {
+		input    uint64
+		expected string
+	}{
+		{1023, "1023 B"},
+		{1048575, "1023.99 KiB"},
+		{1048576, "1.00 MiB"},
+		{1048577, "1.00 MiB"},
+		{1073741823, "1023.99 MiB"},
+		{1073741824, "1.00 GiB"},
+		{1073741825, "1.00 GiB"},
+		{1536, "1.50 KiB"},
+		{1535, "1.49 KiB"},
+	}
+	for _, test := range downTests {
+		if result := humanReadableSize(test.input); result != test.expected {
+			t.Errorf("rounding down %d: expected '%s', got '%s'", test.input, test.expected, result)
+		}
+	}
+}
+
+func TestHumanReadableSizeSI(t *testing.T) {
+	siUnits = true
+	defer func() { siUnits = false }()
+	tests := []struct {
+		input    uint64
+		expected string
+	}{
+		{0, "0 B"},
+		{999, "999 B"},
+		{1000, "1.00 KB"},
+		{1024, "1.02 KB"},
+		{1500, "1.50 KB"},
+		{999994, "999.99 KB"},
+		{999995, "1.00 MB"}, // would be 1000.00 KB without promotion
+		{1000000, "1.00 MB"},
+		{2500000000, "2.50 GB"},
+		{1000000000000, "1.00 TB"},
+		{1<<64 - 1, "18.45 EB"},
+	}
+	for _, test := range tests {
+		if result := humanReadableSize(test.input); result != test.expected {
+			t.Errorf("SI %d: expected '%s', got '%s'", test.input, test.expected, result)
+		}
+	}
+}
+
+func TestParseSizeSI(t *testing.T) {
+	siUnits = true
+	defer func() { siUnits = false }()
+	tests := []struct {
+		input    string
+		expected uint64
+	}{
+		{"999", 999},
+		{"1K", 1000},
+		{"1KB", 1000},
+		{"1KiB", 1024},
+		{"1.5GB", 1500000000},
+		{"1G", 1000000000},
+		{"2GiB", 2 * 1024 * 1024 * 1024},
+		{"1TB", 1000000000000},
+	}
+	for _, test := range tests {
+		size, err := parseSize(test.input)
+		if err != nil || size != test.expected {
+			t.Errorf("SI %q: got %d, %v; want %d", test.input, size, err, test.expected)
+		}
+	}
+}
+
+func TestSIFlag(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{"f": strings.Repeat("x", 1500)})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+
+	resetResults()
+	// 1.48K is 1480 bytes with -si but 1515 without, even when given
+	// before -si.
+	out, err := runCaptured(t, "-min-unique=1.48K", "-si", tmpDir, "1KB")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	for _, want := range []string{"Minimum size threshold: 1.00 KB\n", "1.50 KB"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if !strings.Contains(out, filepath.Join(tmpDir, "f")+"  ") {
+		t.Errorf("1500-byte file not listed with -min-unique=1.48K:\n%s", out)
+	}
+}
+
+func TestPrecisionFlag(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{"f": strings.Repeat("x", 1536)})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+
+	resetResults()
+	out, err := runCaptured(t, "-precision=0", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	for _, want := range []string{"Minimum size threshold: 1 KiB\n", "[FILE] 2 KiB "} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	for _, bad := range []string{"-precision=-1", "-precision=7"} {
+		if _, err := runCaptured(t, bad, tmpDir, "1K"); err == nil {
+			t.Errorf("%s accepted", bad)
+		}
+	}
+}
+
+func TestQuietListing(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"a/big": strings.Repeat("x", 3000),
+		"small": "x",
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+	capturedTerminal = false
+	defer func() { capturedTerminal = true }()
+
+	// On a pipe only the rows are written.
+	resetResults()
+	out, err := runCaptured(t, tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	want := fmt.Sprintf("[DIR]  2.93 KiB    %s\n[DIR]  2.93 KiB    %s\n[FILE] 2.93 KiB    %s\n",
+		tmpDir, filepath.Join(tmpDir, "a"), filepath.Join(tmpDir, "a", "big"))
+	if out != want {
+		t.Errorf("piped output = %q, want %q", out, want)
+	}
+
+	resetResults()
+	if out, err := runCaptured(t, "-tree", tmpDir, "1M"); err != nil || out != "" {
+		t.Errorf("piped run without results wrote %q, %v; want nothing", out, err)
+	}
+
+	resetResults()
+	out, err = runCaptured(t, "-verbose", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("verbose run: %v\n%s", err, out)
+	}
+	for _, line := range []string{"Scanning directory: ", "Minimum size threshold: ", "TYPE", "Scanned "} {
+		if !strings.Contains(out, line) {
+			t.Errorf("-verbose output missing %q:\n%s", line, out)
+		}
+	}
+
+	// The machine formats are the same either way.
+	resetResults()
+	out, err = runCaptured(t, "-format=csv", tmpDir, "1K")
+	if err != nil || !strings.HasPrefix(out, "type,size_bytes,size_human,path\n") {
+		t.Errorf("piped CSV lost its header: %v\n%s", err, out)
+	}
+	resetResults()
+	out, err = runCaptured(t, "-format=json", tmpDir, "1K")
+	var rep jsonReport
+	if err != nil || json.Unmarshal([]byte(out), &rep) != nil || rep.Summary == nil || len(rep.Entries) != 3 {
+		t.Errorf("piped JSON changed: %v\n%s", err, out)
+	}
+
+	if _, err := runCaptured(t, "-q", "-verbose", tmpDir, "1K"); err == nil {
+		t.Error("-q accepted with -verbose")
+	}
+
+	// -q applies on a terminal too.
+	capturedTerminal = true
+	resetResults()
+	if out, err := runCaptured(t, "-quiet", tmpDir, "1K"); err != nil || out != want {
+		t.Errorf("-quiet output = %q, %v; want %q", out, err, want)
+	}
+}
+
+func TestAbsolutePaths(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{"real/sub/big": strings.Repeat("x", 3000)})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+	// The temporary directory itself may be reached through a symlink,
+	// as on macOS.
+	realDir, err := filepath.EvalSymlinks(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("real", filepath.Join(tmpDir, "link")); err != nil {
+		t.Skipf("cannot create symlinks: %v", err)
+	}
+	wd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	resetResults()
+	out, err := runCaptured(t, "-absolute", "-no-summary", "./link/", "1K")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	cwd, _ := os.Getwd()
+	link := filepath.Join(cwd, "link")
+	for _, want := range []string{" via symlink " + link + "\n", "  " + filepath.Join(link, "sub", "big") + "\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("-absolute output missing %q:\n%s", want, out)
+		}
+	}
+
+	// Machine formats are absolute by default, symlinks left alone.
+	resetResults()
+	out, err = runCaptured(t, "-format=json", "link", "1K")
+	var rep jsonReport
+	if err != nil || json.Unmarshal([]byte(out), &rep) != nil {
+		t.Fatalf("json run: %v\n%s", err, out)
+	}
+	if rep.Root != link || len(rep.Entries) == 0 {
+		t.Errorf("JSON root = %q with %d entries, want %q", rep.Root, len(rep.Entries), link)
+	}
+	for _, e := range rep.Entries {
+		if !filepath.IsAbs(e.Path) || !pathWithin(e.Path, link) {
+			t.Errorf("JSON path %q not absolute under %s", e.Path, link)
+		}
+	}
+
+	resetResults()
+	out, err = runCaptured(t, "-format=csv", "-absolute=false", "link", "1K")
+	if err != nil || !strings.Contains(out, ","+filepath.Join("link", "sub", "big")+"\n") {
+		t.Errorf("-absolute=false CSV not relative: %v\n%s", err, out)
+	}
+
+	resetResults()
+	out, err = runCaptured(t, "-format=csv", "-resolve-symlinks", "link", "1K")
+	if err != nil || !strings.Contains(out, ","+filepath.Join(realDir, "real", "sub", "big")+"\n") {
+		t.Errorf("-resolve-symlinks CSV not under the real path: %v\n%s", err, out)
+	}
 }
 
 func TestWalkDirRecursive(t *testing.T) {
 	tests := []struct {
-		name        string
-		files       map[string]string
-		threshold   uint64
-		exclude     []string
-		expected    []FileInfo
-		expectedSum uint64 // total size returned by walkDirRecursive
+		name          string
+		files         map[string]string
+		threshold     uint64
+		exclude       []string
+		expected      []FileInfo
+		expectedSum   uint64 // total size returned by walkDirRecursive
+		expectedFiles uint64 // files counted below the root
 	}{
 		{
 			name: "basic traversal with small files",
 			files: map[string]string{
-				"file1.txt":      "hello", // 5 bytes
+				"file1.txt":         "hello", // 5 bytes
 				"subdir1/file2.txt": "world", // 5 bytes
 				"subdir2/file3.txt": "!",     // 1 byte
 			},
@@ -124,10 +515,11 @@ func TestWalkDirRecursive(t *testing.T) {
 				{Path: "file1.txt", Size: 5, IsDir: false},
 				{Path: "subdir1/file2.txt", Size: 5, IsDir: false},
 				{Path: "subdir2/file3.txt", Size: 1, IsDir: false},
-				{Path: "subdir1", Size: 5, IsDir: true}, // subdir1 contains only file2.txt
-				{Path: "subdir2", Size: 1, IsDir: true}, // subdir2 contains only file3.txt
+				{Path: "subdir1", Size: 5, IsDir: true, FileCount: 1}, // subdir1 contains only file2.txt
+				{Path: "subdir2", Size: 1, IsDir: true, FileCount: 1}, // subdir2 contains only file3.txt
 			},
-			expectedSum: 11, // 5 + 5 + 1
+			expectedSum:   11, // 5 + 5 + 1
+			expectedFiles: 3,
 		},
 		{
 			name: "threshold filtering - files below threshold",
@@ -140,27 +532,29 @@ func TestWalkDirRecursive(t *testing.T) {
 			expected: []FileInfo{
 				{Path: "file1.txt", Size: 5, IsDir: false},
 			},
-			expectedSum: 6, // file1.txt (5) + file2.txt (1)
+			expectedSum:   6, // file1.txt (5) + file2.txt (1)
+			expectedFiles: 2,
 		},
 		{
 			name: "threshold filtering - directory below threshold",
 			files: map[string]string{
-				"dirA/fileA.txt": "aaa", // 3 bytes
+				"dirA/fileA.txt": "aaa",    // 3 bytes
 				"dirB/fileB.txt": "bbbbbb", // 6 bytes
 			},
 			threshold: 5,
 			exclude:   []string{},
 			expected: []FileInfo{
 				{Path: "dirB/fileB.txt", Size: 6, IsDir: false},
-				{Path: "dirB", Size: 6, IsDir: true},
+				{Path: "dirB", Size: 6, IsDir: true, FileCount: 1},
 			},
-			expectedSum: 9, // dirA (3) + dirB (6)
+			expectedSum:   9, // dirA (3) + dirB (6)
+			expectedFiles: 2,
 		},
 		{
 			name: "exclude directories",
 			files: map[string]string{
-				"included_dir/file1.txt": "111", // 3 bytes
-				"excluded_dir/file2.txt": "2222", // 4 bytes
+				"included_dir/file1.txt": "111",   // 3 bytes
+				"excluded_dir/file2.txt": "2222",  // 4 bytes
 				"another_file.txt":       "33333", // 5 bytes
 			},
 			threshold: 1,
@@ -168,9 +562,10 @@ func TestWalkDirRecursive(t *testing.T) {
 			expected: []FileInfo{
 				{Path: "included_dir/file1.txt", Size: 3, IsDir: false},
 				{Path: "another_file.txt", Size: 5, IsDir: false},
-				{Path: "included_dir", Size: 3, IsDir: true},
+				{Path: "included_dir", Size: 3, IsDir: true, FileCount: 1},
 			},
-			expectedSum: 8, // included_dir (3) + another_file.txt (5)
+			expectedSum:   8, // included_dir (3) + another_file.txt (5)
+			expectedFiles: 2, // excluded_dir/file2.txt is not counted
 		},
 	}
 
@@ -185,7 +580,10 @@ func TestWalkDirRecursive(t *testing.T) {
 				excludeSet[e] = struct{}{}
 			}
 
-			actualSum := walkDirRecursive(tmpDir, test.threshold, excludeSet)
+			trackFileCounts = true
+			defer func() { trackFileCounts = false }()
+			root, _ := walkDir(tmpDir, test.threshold, excludeSet)
+			actualSum := root.Size
 
 			// Clean up paths in expected results to be relative to tmpDir
 			for i := range test.expected {
@@ -218,35 +616,38 @@ func TestWalkDirRecursive(t *testing.T) {
 			if actualSum != test.expectedSum {
 				t.Errorf("WalkDirRecursive() total sum mismatch.\nExpected: %d\nActual: %d", test.expectedSum, actualSum)
 			}
+			if root.Files != test.expectedFiles {
+				t.Errorf("WalkDirRecursive() file count mismatch.\nExpected: %d\nActual: %d", test.expectedFiles, root.Files)
+			}
 		})
 	}
 }
 
 func TestRun(t *testing.T) {
 	tests := []struct {
-		name        string
-		args        []string
-		setup       func(t *testing.T) (string, func()) // Returns setup path and a cleanup function
-		expectError bool
-		errorContains string
+		name                   string
+		args                   []string
+		setup                  func(t *testing.T) (string, func()) // Returns setup path and a cleanup function
+		expectError            bool
+		errorContains          string
 		expectedOutputContains []string
 	}{
 		{
-			name: "invalid number of arguments",
-			args: []string{"spacehogs", "onedir"}, // Missing min_size
-			expectError: true,
+			name:          "invalid number of arguments",
+			args:          []string{"spacehogs", "onedir"}, // Missing min_size
+			expectError:   true,
 			errorContains: "invalid number of arguments",
 		},
 		{
-			name: "invalid size argument",
-			args: []string{"spacehogs", ".", "10MBB"}, // Invalid size format
-			expectError: true,
+			name:          "invalid size argument",
+			args:          []string{"spacehogs", ".", "10MBB"}, // Invalid size format
+			expectError:   true,
 			errorContains: "invalid size format",
 		},
 		{
-			name: "invalid path argument - non-existent",
-			args: []string{"spacehogs", "/no/such/dir", "1K"},
-			expectError: true,
+			name:          "invalid path argument - non-existent",
+			args:          []string{"spacehogs", "/no/such/dir", "1K"},
+			expectError:   true,
 			errorContains: "no such file or directory",
 		},
 		{
@@ -261,7 +662,7 @@ func TestRun(t *testing.T) {
 				file.Close()
 				return "", func() { os.Remove("testfile.txt") }
 			},
-			expectError: true,
+			expectError:   true,
 			errorContains: "is not a directory",
 		},
 		{
@@ -274,7 +675,20 @@ func TestRun(t *testing.T) {
 				}
 				return "", func() { os.RemoveAll("excluded_dir") }
 			},
-			expectError: false, // No error, just a message to stdout
+			expectError: false, // A name excludes entries below the root, not the root itself
+		},
+		{
+			name: "anchored top-level directory exclusion",
+			args: []string{"spacehogs", "-exclude=./excluded_dir", "excluded_dir", "1K"},
+			setup: func(t *testing.T) (string, func()) {
+				err := os.Mkdir("excluded_dir", 0755)
+				if err != nil {
+					t.Fatalf("Failed to create dir: %v", err)
+				}
+				return "", func() { os.RemoveAll("excluded_dir") }
+			},
+			expectError:   true,
+			errorContains: "is in the exclude list",
 		},
 		{
 			name: "successful run with output",
@@ -329,7 +743,8 @@ func TestRun(t *testing.T) {
 			w.Close()
 			os.Stdout = oldStdout
 			os.Stderr = oldStderr
-			
+			setupOutput(os.Stdout, os.Stderr)
+
 			output, readErr := io.ReadAll(r)
 			if readErr != nil {
 				t.Fatalf("failed to read from pipe: %v", readErr)
@@ -357,3 +772,117 @@ func TestRun(t *testing.T) {
 		})
 	}
 }
+
+func TestOldestNewestTracking(t *testing.T) {
+	resetResults()
+	tmpDir := createTestDir(t, map[string]string{
+		"old.bin":        strings.Repeat("o", 100),
+		"sub/newest.bin": strings.Repeat("n", 200),
+		"sub/middle.bin": strings.Repeat("m", 300),
+		"tiny.txt":       "x", // below threshold, must not count even though it is newest
+	})
+	defer os.RemoveAll(tmpDir)
+
+	mtimes := map[string]time.Time{
+		"old.bin":        time.Date(2014, 6, 2, 12, 0, 0, 0, time.UTC),
+		"sub/newest.bin": time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		"sub/middle.bin": time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC),
+		"tiny.txt":       time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC),
+	}
+	for name, mtime := range mtimes {
+		if err := os.Chtimes(filepath.Join(tmpDir, name), mtime, mtime); err != nil {
+			t.Fatalf("Failed to set mtime on %s: %v", name, err)
+		}
+	}
+
+	walkDirRecursive(tmpDir, 100, map[string]struct{}{})
+
+	if oldestFile == nil || newestFile == nil {
+		t.Fatalf("expected oldest and newest files to be tracked, got %v and %v", oldestFile, newestFile)
+	}
+	if oldestFile.Path != filepath.Join(tmpDir, "old.bin") || !oldestFile.ModTime.Equal(mtimes["old.bin"]) || oldestFile.Size != 100 {
+		t.Errorf("unexpected oldest file: %+v", *oldestFile)
+	}
+	if newestFile.Path != filepath.Join(tmpDir, "sub/newest.bin") || !newestFile.ModTime.Equal(mtimes["sub/newest.bin"]) || newestFile.Size != 200 {
+		t.Errorf("unexpected newest file: %+v", *newestFile)
+	}
+
+	want := filepath.Join(tmpDir, "old.bin") + " (2014-06-02, 100 B)"
+	if got := describeDatedFile(oldestFile); got != want {
+		t.Errorf("describeDatedFile() = %q, want %q", got, want)
+	}
+}
+
+func TestWalkSkipsUnreadableEntryAndContinues(t *testing.T) {
+	resetResults()
+	tmpDir := createTestDir(t, map[string]string{
+		"sub/bad.txt":   "xxxxxxxx", // 8 bytes, stat fails
+		"sub/good1.txt": "aaa",      // 3 bytes
+		"sub/good2.txt": "bb",       // 2 bytes
+	})
+	defer os.RemoveAll(tmpDir)
+
+	oldInfo := entryInfo
+	entryInfo = func(e fs.DirEntry) (fs.FileInfo, error) {
+		if e.Name() == "bad.txt" {
+			return nil, errors.New("invalid argument")
+		}
+		return e.Info()
+	}
+	defer func() { entryInfo = oldInfo }()
+
+	oldStderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	setupOutput(os.Stdout, os.Stderr)
+	total := walkDirRecursive(tmpDir, 1, map[string]struct{}{})
+	os.Stderr.Close()
+	os.Stderr = oldStderr
+	setupOutput(os.Stdout, os.Stderr)
+
+	if total != 5 {
+		t.Errorf("total = %d, want 5 (siblings of the bad entry must still count)", total)
+	}
+	sub := filepath.Join(tmpDir, "sub")
+	if skippedEntries[sub] != 1 || len(skippedEntries) != 1 {
+		t.Errorf("skippedEntries = %v, want one skip attributed to %s", skippedEntries, sub)
+	}
+}
+
+func TestExcludeEmpty(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"data.txt":         "12345",
+		"empty.txt":        "",
+		"emptydir/":        "",
+		"nested/empty.log": "",
+	})
+	defer os.RemoveAll(tmpDir)
+
+	resetResults()
+	output, err := runCaptured(t, tmpDir, "0")
+	if err != nil {
+		t.Fatalf("run() error: %v", err)
+	}
+	for _, name := range []string{"empty.txt", "emptydir", "nested"} {
+		if !strings.Contains(output, filepath.Join(tmpDir, name)) {
+			t.Errorf("without -exclude-empty, %s should be listed:\n%s", name, output)
+		}
+	}
+
+	resetResults()
+	output, err = runCaptured(t, "-exclude-empty", tmpDir, "0")
+	if err != nil {
+		t.Fatalf("run() error: %v", err)
+	}
+	for _, name := range []string{"empty.txt", "emptydir", "nested"} {
+		if strings.Contains(output, filepath.Join(tmpDir, name)) {
+			t.Errorf("with -exclude-empty, %s should not be listed:\n%s", name, output)
+		}
+	}
+	if !strings.Contains(output, filepath.Join(tmpDir, "data.txt")) {
+		t.Errorf("non-empty file missing from output:\n%s", output)
+	}
+	// empty.txt, emptydir, nested and nested/empty.log.
+	if !strings.Contains(output, "Suppressed 4 empty entries.") {
+		t.Errorf("missing suppression count:\n%s", output)
+	}
+}
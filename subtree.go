@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// subtreeStats is what a directory walk reports to its parent: the summed
+// size, the number of files and, when trackDirTimes is set, the range of
+// file modification times found anywhere below it.
+type subtreeStats struct {
+	Size           uint64
+	Files          uint64
+	Oldest, Newest time.Time
+
+	// Dirs counts the directories in the subtree, itself included.
+	Dirs uint64
+
+	// Unique and Shared split the subtree's files, each inode counted
+	// once, by whether deleting the subtree would free them. They are
+	// only kept when trackLinks is set; linked holds the multiply-linked
+	// files whose other links have not been seen yet.
+	Unique, Shared uint64
+	linked         map[fileID]*linkedFile
+
+	// LowerBound is set when a directory below was only partially
+	// listed within -dir-list-timeout.
+	LowerBound bool
+
+	// Self is the directory's own modification time (-dir-times). It is
+	// not merged into the parent.
+	Self time.Time
+}
+
+// merge folds a child's totals into s.
+func (s *subtreeStats) merge(child subtreeStats) {
+	s.Size = addSize(s.Size, child.Size)
+	s.Files += child.Files
+	s.Dirs += child.Dirs
+	s.LowerBound = s.LowerBound || child.LowerBound
+	if !child.Oldest.IsZero() {
+		s.addTime(child.Oldest)
+		s.addTime(child.Newest)
+	}
+	if trackLinks {
+		s.mergeLinks(child)
+	}
+}
+
+var (
+	// trackFileCounts records the recursive file count on directory
+	// results, for -min-files, -max-files, the count column and the JSON
+	// report.
+	trackFileCounts bool
+
+	// minFiles and maxFiles bound the recursive file count of listed
+	// directories; -1 means no bound.
+	minFiles, maxFiles int64 = -1, -1
+)
+
+// fileCountOK reports whether a result passes -min-files and -max-files.
+// The bounds are inclusive and only apply to directories.
+func fileCountOK(res FileInfo) bool {
+	if !res.IsDir {
+		return true
+	}
+	if minFiles >= 0 && res.FileCount < uint64(minFiles) {
+		return false
+	}
+	if maxFiles >= 0 && res.FileCount > uint64(maxFiles) {
+		return false
+	}
+	return true
+}
+
+// keepFileCounts drops the directories that fail fileCountOK.
+func keepFileCounts(list []FileInfo) []FileInfo {
+	kept := list[:0]
+	for _, res := range list {
+		if fileCountOK(res) {
+			kept = append(kept, res)
+		}
+	}
+	return kept
+}
+
+// listingCondition describes the combined size and file count condition
+// for the banner.
+func listingCondition(threshold uint64) string {
+	parts := []string{"size >= " + humanReadableSize(threshold)}
+	if minFiles >= 0 {
+		parts = append(parts, "files >= "+strconv.FormatInt(minFiles, 10))
+	}
+	if maxFiles >= 0 {
+		parts = append(parts, "files <= "+strconv.FormatInt(maxFiles, 10))
+	}
+	return fmt.Sprintf("directories with %s", strings.Join(parts, " AND "))
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileCountFilters(t *testing.T) {
+	files := map[string]string{
+		"few/big.bin":   strings.Repeat("x", 5000), // passes size, 1 file
+		"tiny/a.txt":    "a",                       // fails size, 1 file
+		"tiny/deeper/b": "b",
+	}
+	for i := 0; i < 10; i++ {
+		files[filepath.Join("many", "sub", string(rune('a'+i))+".txt")] = strings.Repeat("y", 300)
+	}
+	tmpDir := createTestDir(t, files)
+	defer os.RemoveAll(tmpDir)
+	// Rows end in "  <path>\n"; the banner line has a single space.
+	row := func(p string) string { return "  " + p + "\n" }
+	dir := func(name string) string { return row(filepath.Join(tmpDir, name)) }
+
+	tests := []struct {
+		name    string
+		args    []string
+		listed  []string
+		missing []string
+	}{
+		{"max excludes many", []string{"-max-files=1"}, []string{dir("few")}, []string{dir("many"), dir("tiny")}},
+		{"max boundary", []string{"-max-files=10"}, []string{dir("few"), dir("many"), row(filepath.Join(tmpDir, "many", "sub"))}, []string{row(tmpDir)}},
+		{"min boundary", []string{"-min-files=10"}, []string{dir("many")}, []string{dir("few"), dir("tiny")}},
+		{"min excludes all", []string{"-min-files=12"}, []string{row(tmpDir)}, []string{dir("many"), dir("few")}},
+		{"both", []string{"-min-files=2", "-max-files=10"}, []string{dir("many")}, []string{dir("few"), dir("tiny"), row(tmpDir)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetResults()
+			args := append([]string{"-no-hints"}, test.args...)
+			out, err := runCaptured(t, append(args, tmpDir, "2K")...)
+			if err != nil {
+				t.Fatalf("run: %v", err)
+			}
+			for _, want := range test.listed {
+				if !strings.Contains(out, want) {
+					t.Errorf("%q not listed:\n%s", strings.TrimSpace(want), out)
+				}
+			}
+			for _, bad := range test.missing {
+				if strings.Contains(out, bad) {
+					t.Errorf("%q listed but should be filtered:\n%s", strings.TrimSpace(bad), out)
+				}
+			}
+			if !strings.Contains(out, "[FILE]") {
+				t.Errorf("file entries must not be filtered by file counts:\n%s", out)
+			}
+		})
+	}
+}
+
+func TestListingCondition(t *testing.T) {
+	defer func() { minFiles, maxFiles = -1, -1 }()
+	minFiles, maxFiles = 2, 9
+	want := "directories with size >= 1.00 KiB AND files >= 2 AND files <= 9"
+	if got := listingCondition(1024); got != want {
+		t.Errorf("listingCondition = %q, want %q", got, want)
+	}
+}
+
+func TestFileCountFlagValidation(t *testing.T) {
+	tmpDir := t.TempDir()
+	if _, err := runCaptured(t, "-min-files=5", "-max-files=4", tmpDir, "1K"); err == nil {
+		t.Error("min above max accepted")
+	}
+	if _, err := runCaptured(t, "-max-files=-3", tmpDir, "1K"); err == nil {
+		t.Error("negative -max-files accepted")
+	}
+}
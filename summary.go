@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// scanSummary is the footer of a scan: what was visited, what is shown
+// and how long it took. -format=json carries it as "summary".
+type scanSummary struct {
+	Total  uint64 `json:"total"`
+	Files  uint64 `json:"files"`
+	Dirs   uint64 `json:"dirs"`
+	Shown  int    `json:"entries_shown"`
+	Errors int    `json:"errors"`
+	// ErrorCount is Errors under the name the errors array goes with.
+	// Errors stays for schema version 1.
+	ErrorCount int `json:"error_count"`
+	// Elapsed is the wall time of the scan and report, in seconds.
+	Elapsed float64 `json:"elapsed_seconds"`
+}
+
+// newScanSummary builds the footer from the walk's totals. Errors are the
+// entries that could not be read, each of which the walk recorded as
+// skipped.
+func newScanSummary(st subtreeStats, shown int, elapsed time.Duration) scanSummary {
+	errors := 0
+	skippedMutex.Lock()
+	for _, n := range skippedEntries {
+		errors += n
+	}
+	skippedMutex.Unlock()
+	return scanSummary{
+		Total:      st.Size,
+		Files:      st.Files,
+		Dirs:       st.Dirs,
+		Shown:      shown,
+		Errors:     errors,
+		ErrorCount: errors,
+		Elapsed:    elapsed.Seconds(),
+	}
+}
+
+// print writes the footer line.
+func (s scanSummary) print() {
+	elapsed := time.Duration(s.Elapsed * float64(time.Second)).Round(time.Millisecond)
+	fmt.Fprintf(stdout, "\nScanned %s in %d %s and %d %s: %d %s shown, %d %s, %v.\n",
+		humanReadableSize(s.Total), s.Files, plural(int(s.Files), "file", "files"),
+		s.Dirs, plural(int(s.Dirs), "directory", "directories"),
+		s.Shown, plural(s.Shown, "entry", "entries"), s.Errors, plural(s.Errors, "error", "errors"), elapsed)
+}
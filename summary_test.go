@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestScanSummary(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"a/big":      strings.Repeat("x", 3000),
+		"a/b/small":  "x",
+		"c/other":    "xx",
+		"locked/f":   "x",
+		"top-level1": "x",
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+	noRetrySleep(t)
+
+	// The locked directory cannot be listed, so its file goes uncounted.
+	old := readDir
+	readDir = func(name string) ([]fs.DirEntry, error) {
+		if filepath.Base(name) == "locked" {
+			return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EACCES}
+		}
+		return old(name)
+	}
+	defer func() { readDir = old }()
+
+	resetResults()
+	out, err := runCaptured(t, tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	want := "\nScanned 2.93 KiB in 4 files and 5 directories: 3 entries shown, 1 error, "
+	if !strings.Contains(out, want) {
+		t.Errorf("output lacks %q:\n%s", want, out)
+	}
+
+	resetResults()
+	out, err = runCaptured(t, "-no-summary", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	if strings.Contains(out, "Scanned ") {
+		t.Errorf("-no-summary printed the footer:\n%s", out)
+	}
+}
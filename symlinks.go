@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// linkInfo is a symlink met during the walk and what it points at. The
+// target is stat'ed once and never traversed, so links cannot cause cycles
+// and their targets never count toward any total.
+type linkInfo struct {
+	Path   string
+	Target string
+	Exists bool
+	Size   uint64
+	IsDir  bool
+}
+
+// symlinkReport collects the symlinks of interest (-symlink-report): those
+// whose target is at least the threshold, and dangling ones. It is nil
+// unless the flag is given.
+type symlinkReport struct {
+	threshold uint64
+
+	mu       sync.Mutex
+	big      []linkInfo
+	dangling []linkInfo
+	// dirLinks counts links to directories. A directory's own size says
+	// nothing about its contents, and walking it is what the report avoids.
+	dirLinks int
+}
+
+// symlinks is the active report, if any.
+var symlinks *symlinkReport
+
+// newSymlinkReport returns an empty report.
+func newSymlinkReport(threshold uint64) *symlinkReport {
+	return &symlinkReport{threshold: threshold}
+}
+
+// record inspects the symlink at path.
+func (r *symlinkReport) record(path string) {
+	target, err := os.Readlink(path)
+	if err != nil {
+		return
+	}
+	li := linkInfo{Path: path, Target: target}
+	if fi, err := os.Stat(path); err == nil {
+		li.Exists = true
+		li.IsDir = fi.IsDir()
+		if fi.Size() > 0 && !li.IsDir {
+			li.Size = uint64(fi.Size())
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case !li.Exists:
+		r.dangling = append(r.dangling, li)
+	case li.IsDir:
+		r.dirLinks++
+	case li.Size >= r.threshold:
+		r.big = append(r.big, li)
+	}
+}
+
+// symlinkSuffix renders where a listed symlink points.
+func symlinkSuffix(res FileInfo) string {
+	if !res.Symlink || res.LinkTarget == "" {
+		return ""
+	}
+	return " -> " + displayPath(res.LinkTarget)
+}
+
+// print writes the symlink section.
+func (r *symlinkReport) print() {
+	sort.Slice(r.big, func(i, j int) bool {
+		if r.big[i].Size != r.big[j].Size {
+			return r.big[i].Size > r.big[j].Size
+		}
+		return r.big[i].Path < r.big[j].Path
+	})
+	sort.Slice(r.dangling, func(i, j int) bool { return r.dangling[i].Path < r.dangling[j].Path })
+
+	fmt.Fprintf(stdout, "\nSymlinks to targets of at least %s (not counted above):\n", humanReadableSize(r.threshold))
+	if len(r.big) == 0 {
+		fmt.Fprintln(stdout, "  none")
+	}
+	for _, li := range r.big {
+		fmt.Fprintf(stdout, "  [FILE] %-10s  %s -> %s\n", humanReadableSize(li.Size), displayPath(li.Path), displayPath(li.Target))
+	}
+	if r.dirLinks > 0 {
+		fmt.Fprintf(stdout, "  (%d symlinks to directories were not sized)\n", r.dirLinks)
+	}
+	if len(r.dangling) > 0 {
+		fmt.Fprintf(stdout, "Dangling symlinks (%d):\n", len(r.dangling))
+		for _, li := range r.dangling {
+			fmt.Fprintf(stdout, "  %s -> %s (missing)\n", displayPath(li.Path), displayPath(li.Target))
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSymlinkReport(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"outside/big.bin":   strings.Repeat("x", 5000),
+		"outside/small.txt": "tiny",
+		"tree/real.txt":     "abc",
+	})
+	defer os.RemoveAll(tmpDir)
+	tree := filepath.Join(tmpDir, "tree")
+	links := map[string]string{
+		"big":   filepath.Join(tmpDir, "outside", "big.bin"),
+		"small": filepath.Join(tmpDir, "outside", "small.txt"),
+		"data":  filepath.Join(tmpDir, "outside"),
+		"gone":  filepath.Join(tmpDir, "nowhere"),
+	}
+	var linkBytes uint64
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(tree, name)); err != nil {
+			t.Skipf("cannot create symlinks: %v", err)
+		}
+		linkBytes += uint64(len(target)) // a symlink's own size is its target's length
+	}
+
+	resetResults()
+	symlinks = newSymlinkReport(1024)
+	defer func() { symlinks = nil }()
+	total := walkDirRecursive(tree, 1, map[string]struct{}{})
+	if total != 3+linkBytes {
+		t.Errorf("total = %d, want %d: link targets must not count", total, 3+linkBytes)
+	}
+
+	if len(symlinks.big) != 1 || symlinks.big[0].Path != filepath.Join(tree, "big") || symlinks.big[0].Size != 5000 {
+		t.Errorf("big links = %+v, want only tree/big at 5000 bytes", symlinks.big)
+	}
+	if symlinks.dirLinks != 1 {
+		t.Errorf("dirLinks = %d, want 1 (tree/data)", symlinks.dirLinks)
+	}
+	if len(symlinks.dangling) != 1 || symlinks.dangling[0].Target != links["gone"] {
+		t.Errorf("dangling links = %+v, want tree/gone", symlinks.dangling)
+	}
+
+	resetResults()
+	out, err := runCaptured(t, "-no-hints", "-symlink-report", tree, "1K")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	for _, want := range []string{
+		"Symlinks to targets of at least 1.00 KiB (not counted above):",
+		"[FILE] 4.88 KiB    " + filepath.Join(tree, "big") + " -> " + links["big"],
+		"(1 symlinks to directories were not sized)",
+		"Dangling symlinks (1):",
+		filepath.Join(tree, "gone") + " -> " + links["gone"] + " (missing)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "small.txt") {
+		t.Errorf("link to a small target listed:\n%s", out)
+	}
+}
+
+func TestListedSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks have no size of their own on Windows")
+	}
+	tmpDir := createTestDir(t, map[string]string{
+		"outside/big.bin": strings.Repeat("x", 5000),
+		"tree/real.txt":   "abc",
+	})
+	defer os.RemoveAll(tmpDir)
+	tree := filepath.Join(tmpDir, "tree")
+	links := map[string]string{
+		"relative": filepath.Join("..", "outside", "big.bin"),
+		"absolute": filepath.Join(tmpDir, "outside", "big.bin"),
+		"dangling": "nowhere",
+	}
+	var linkBytes uint64
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(tree, name)); err != nil {
+			t.Skipf("cannot create symlinks: %v", err)
+		}
+		linkBytes += uint64(len(target))
+	}
+	fakeMounts(t, nil)
+
+	resetResults()
+	out, err := runCaptured(t, "-format=json", tree, "1B")
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	var rep jsonReport
+	if err := json.Unmarshal([]byte(out), &rep); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if rep.Total != 3+linkBytes {
+		t.Errorf("total = %d, want %d: links count at their own size", rep.Total, 3+linkBytes)
+	}
+	got := make(map[string]jsonEntry)
+	for _, e := range rep.Entries {
+		got[filepath.Base(e.Path)] = e
+	}
+	for name, target := range links {
+		if e := got[name]; e.LinkTarget != target || e.Size != uint64(len(target)) {
+			t.Errorf("%s: link_target %q, size %d; want %q, %d", name, e.LinkTarget, e.Size, target, len(target))
+		}
+	}
+	if e := got["real.txt"]; e.LinkTarget != "" {
+		t.Errorf("regular file has link_target %q", e.LinkTarget)
+	}
+
+	resetResults()
+	out, err = runCaptured(t, tree, "1B")
+	if err != nil {
+		t.Fatalf("text run: %v\n%s", err, out)
+	}
+	for name, target := range links {
+		size := humanReadableSize(uint64(len(target)))
+		row := "[LINK] " + size + strings.Repeat(" ", 12-len(size)) + filepath.Join(tree, name) + " -> " + target
+		if !strings.Contains(out, row) {
+			t.Errorf("listing missing %q:\n%s", row, out)
+		}
+	}
+	if !strings.Contains(out, "[FILE] ") || strings.Contains(out, "real.txt ->") {
+		t.Errorf("regular file shown as a link:\n%s", out)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// syslogMaxMessage bounds the message body sent to syslog. RFC 3164
+// relays may drop anything beyond 1024 bytes including the header, so the
+// body stays well under that.
+const syslogMaxMessage = 900
+
+// errSyslogUnsupported is returned where log/syslog is unavailable.
+var errSyslogUnsupported = errors.New("syslog output is not supported on this platform")
+
+// syslogTarget is a parsed "-out syslog:[facility][/tag]" destination.
+type syslogTarget struct {
+	facility string
+	tag      string
+}
+
+// parseSyslogOut parses the value of -out. Only syslog destinations exist.
+func parseSyslogOut(spec string) (syslogTarget, error) {
+	rest, ok := strings.CutPrefix(spec, "syslog:")
+	if !ok {
+		return syslogTarget{}, fmt.Errorf("unsupported output destination %q: want syslog:[facility][/tag]", spec)
+	}
+	target := syslogTarget{facility: "user", tag: "spacehogs"}
+	facility, tag, hasTag := strings.Cut(rest, "/")
+	if facility != "" {
+		target.facility = strings.ToLower(facility)
+	}
+	if hasTag && tag != "" {
+		target.tag = tag
+	}
+	if _, ok := syslogFacilities[target.facility]; !ok {
+		return syslogTarget{}, fmt.Errorf("unknown syslog facility %q", facility)
+	}
+	return target, nil
+}
+
+// syslogFacilities lists the accepted facility names with their RFC 5424
+// codes.
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslogMessages builds the summary line and one message per entry for the
+// first top entries of list. Each message is a set of key=value fields.
+func syslogMessages(root string, total, threshold uint64, list []FileInfo, top int) []string {
+	msgs := []string{fitSyslogMessage(func(path string) string {
+		return fmt.Sprintf("summary total=%d entries=%d threshold=%d root=%s", total, len(list), threshold, path)
+	}, root)}
+	for i, res := range list {
+		if i == top {
+			break
+		}
+		kind := "file"
+		if res.IsDir {
+			kind = "dir"
+		}
+		rank := i + 1
+		msgs = append(msgs, fitSyslogMessage(func(path string) string {
+			return fmt.Sprintf("entry rank=%d type=%s size=%d path=%s", rank, kind, res.Size, path)
+		}, res.Path))
+	}
+	return msgs
+}
+
+// fitSyslogMessage formats a message around a quoted path, shortening the
+// path in the middle and adding truncated=1 when the result would exceed
+// syslogMaxMessage.
+func fitSyslogMessage(format func(path string) string, path string) string {
+	msg := format(strconv.Quote(path))
+	if len(msg) <= syslogMaxMessage {
+		return msg
+	}
+	const marker = " truncated=1"
+	overhead := len(format(`""`)) + len(marker)
+	short := truncateMiddle(path, syslogMaxMessage-overhead)
+	// Quoting may expand the kept bytes; trim further until it fits.
+	for len(format(strconv.Quote(short)))+len(marker) > syslogMaxMessage && len(short) > 0 {
+		short = truncateMiddle(short, len(short)-8)
+	}
+	return format(strconv.Quote(short)) + marker
+}
+
+// truncateMiddle shortens s to at most max bytes by replacing its middle
+// with "...", cutting only at UTF-8 boundaries so the head and tail stay
+// valid.
+func truncateMiddle(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	keep := max - 3
+	if keep <= 0 {
+		return ""
+	}
+	head := keep / 2
+	for head > 0 && !utf8.RuneStart(s[head]) {
+		head--
+	}
+	tail := len(s) - (keep - head)
+	for tail < len(s) && !utf8.RuneStart(s[tail]) {
+		tail++
+	}
+	return s[:head] + "..." + s[tail:]
+}
@@ -0,0 +1,11 @@
+//go:build windows || plan9
+
+package main
+
+// syslogAvailable reports whether -out syslog: can be used.
+const syslogAvailable = false
+
+// sendSyslog reports that syslog output is unavailable.
+func sendSyslog(target syslogTarget, msgs []string) error {
+	return errSyslogUnsupported
+}
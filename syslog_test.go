@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestParseSyslogOut(t *testing.T) {
+	tests := []struct {
+		spec     string
+		facility string
+		tag      string
+		ok       bool
+	}{
+		{"syslog:", "user", "spacehogs", true},
+		{"syslog:local0", "local0", "spacehogs", true},
+		{"syslog:LOCAL3/hogs", "local3", "hogs", true},
+		{"syslog:/hogs", "user", "hogs", true},
+		{"syslog:nosuch", "", "", false},
+		{"json:/tmp/out.json", "", "", false},
+	}
+	for _, test := range tests {
+		got, err := parseSyslogOut(test.spec)
+		if (err == nil) != test.ok {
+			t.Errorf("parseSyslogOut(%q) error = %v, want ok=%v", test.spec, err, test.ok)
+			continue
+		}
+		if test.ok && (got.facility != test.facility || got.tag != test.tag) {
+			t.Errorf("parseSyslogOut(%q) = %+v, want %s/%s", test.spec, got, test.facility, test.tag)
+		}
+	}
+}
+
+func TestSyslogMessagesTruncateLongPaths(t *testing.T) {
+	long := "/data/" + strings.Repeat("ä", 600) + "/tail.bin"
+	list := []FileInfo{
+		{Path: "/data", Size: 3000, IsDir: true},
+		{Path: long, Size: 2000},
+		{Path: "/data/small", Size: 1000},
+	}
+	msgs := syslogMessages("/data", 3000, 1000, list, 2)
+	if len(msgs) != 3 {
+		t.Fatalf("got %d messages, want summary + 2 entries: %q", len(msgs), msgs)
+	}
+	if msgs[0] != `summary total=3000 entries=3 threshold=1000 root="/data"` {
+		t.Errorf("summary = %q", msgs[0])
+	}
+	if msgs[1] != `entry rank=1 type=dir size=3000 path="/data"` {
+		t.Errorf("first entry = %q", msgs[1])
+	}
+	m := msgs[2]
+	if len(m) > syslogMaxMessage || !strings.HasSuffix(m, " truncated=1") {
+		t.Errorf("long entry not truncated and marked (%d bytes): %q", len(m), m)
+	}
+	if !utf8.ValidString(m) || !strings.Contains(m, "...") || !strings.Contains(m, "/tail.bin\"") {
+		t.Errorf("truncated entry lost its tail or broke UTF-8: %q", m)
+	}
+}
@@ -0,0 +1,31 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"log/syslog"
+)
+
+// syslogAvailable reports whether -out syslog: can be used.
+const syslogAvailable = true
+
+// syslogNetwork and syslogAddr select the syslog daemon; empty values use
+// the local one (which journald also listens on). Tests point them at their
+// own socket.
+var syslogNetwork, syslogAddr string
+
+// sendSyslog delivers msgs to target at informational priority.
+func sendSyslog(target syslogTarget, msgs []string) error {
+	priority := syslog.Priority(syslogFacilities[target.facility]<<3) | syslog.LOG_INFO
+	w, err := syslog.Dial(syslogNetwork, syslogAddr, priority, target.tag)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	for _, msg := range msgs {
+		if err := w.Info(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
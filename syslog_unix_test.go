@@ -0,0 +1,58 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogOutput(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "log.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: sock, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("cannot listen on unix datagram socket: %v", err)
+	}
+	defer conn.Close()
+	syslogNetwork, syslogAddr = "unixgram", sock
+	defer func() { syslogNetwork, syslogAddr = "", "" }()
+
+	resetResults()
+	tmpDir := createTestDir(t, map[string]string{
+		"big.bin":       strings.Repeat("x", 3000),
+		"sub/other.bin": strings.Repeat("y", 2000),
+	})
+	defer os.RemoveAll(tmpDir)
+
+	if _, err := runCaptured(t, "-no-hints", "-out", "syslog:local3/hogs", "-syslog-top", "2", tmpDir, "1K"); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	var got []string
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for len(got) < 3 {
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("read after %d messages: %v", len(got), err)
+		}
+		got = append(got, string(buf[:n]))
+	}
+
+	// local3.info is (19<<3)|6.
+	for _, msg := range got {
+		if !strings.HasPrefix(msg, "<158>") || !strings.Contains(msg, " hogs[") {
+			t.Errorf("message has wrong priority or tag: %q", msg)
+		}
+	}
+	if !strings.Contains(got[0], "summary total=5000 entries=4 threshold=1024") {
+		t.Errorf("summary = %q", got[0])
+	}
+	if !strings.Contains(got[1], "entry rank=1 type=dir size=5000") || !strings.Contains(got[2], "entry rank=2 type=dir size=2000") {
+		t.Errorf("entries = %q", got[1:])
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// templateEntry is what -template renders for each result.
+type templateEntry struct {
+	Path  string
+	Bytes uint64
+	Human string
+	IsDir bool
+	Type  string // "dir" or "file"
+}
+
+// templateSummary is what -summary-template renders once, after the
+// results.
+type templateSummary struct {
+	Root      string
+	Total     uint64
+	Human     string
+	Threshold uint64
+	Entries   int
+}
+
+// templateFuncs are the helpers available to both templates.
+var templateFuncs = template.FuncMap{
+	"humanize": humanReadableSize,
+	"basename": filepath.Base,
+	"dirname":  filepath.Dir,
+}
+
+// parseOutputTemplate parses a -template or -summary-template, given
+// inline as text or in the file named by file. Both empty gives nil. The
+// template is tried on a zero value of sample so that a misspelt field is
+// caught now rather than after the scan.
+func parseOutputTemplate(name, text, file string, sample any) (*template.Template, error) {
+	if text != "" && file != "" {
+		return nil, fmt.Errorf("give -%s or -%s-file, not both", name, name)
+	}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		// An editor's final newline would otherwise double every line.
+		text = strings.TrimSuffix(string(data), "\n")
+	}
+	if text == "" {
+		return nil, nil
+	}
+	t, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.Execute(io.Discard, sample); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// writeTemplateResults renders each result through entry, one per line,
+// then the summary line if summary is set. Either template may be nil.
+func writeTemplateResults(w io.Writer, entry, summary *template.Template, sum templateSummary, lists ...[]FileInfo) error {
+	bw := bufio.NewWriter(w)
+	for _, list := range lists {
+		for _, res := range list {
+			sum.Entries++
+			if entry == nil {
+				continue
+			}
+			typ := "file"
+			if res.IsDir {
+				typ = "dir"
+			}
+			e := templateEntry{Path: res.Path, Bytes: res.Size, Human: humanReadableSize(res.Size), IsDir: res.IsDir, Type: typ}
+			if err := entry.Execute(bw, e); err != nil {
+				return err
+			}
+			bw.WriteByte('\n')
+		}
+	}
+	if summary != nil {
+		sum.Human = humanReadableSize(sum.Total)
+		if err := summary.Execute(bw, sum); err != nil {
+			return err
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
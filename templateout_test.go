@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteTemplateResults(t *testing.T) {
+	entry, err := parseOutputTemplate("template", `{{.Type}} {{.Bytes}} {{.Human}} {{basename .Path}} in {{dirname .Path}}{{if .IsDir}}/{{end}}`, "", templateEntry{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err := parseOutputTemplate("summary-template", `{{.Entries}} entries, {{.Human}} ({{.Total}}) under {{.Root}}, min {{humanize .Threshold}}`, "", templateSummary{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := []FileInfo{
+		{Path: filepath.Join("data", "logs"), Size: 3072, IsDir: true},
+		{Path: filepath.Join("data", "logs", "app.log"), Size: 2048},
+	}
+	var buf bytes.Buffer
+	sum := templateSummary{Root: "data", Total: 4096, Threshold: 1024}
+	if err := writeTemplateResults(&buf, entry, summary, sum, list); err != nil {
+		t.Fatal(err)
+	}
+	want := "dir 3072 3.00 KiB logs in data/\n" +
+		"file 2048 2.00 KiB app.log in " + filepath.Join("data", "logs") + "\n" +
+		"2 entries, 4.00 KiB (4096) under data, min 1.00 KiB\n"
+	if buf.String() != want {
+		t.Errorf("output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestParseOutputTemplateErrors(t *testing.T) {
+	tests := []struct{ text, wantErr string }{
+		{"{{.Path", "unclosed action"},
+		{"{{.Size}}", "can't evaluate field Size"},
+		{"{{shout .Path}}", `function "shout" not defined`},
+	}
+	for _, tt := range tests {
+		if _, err := parseOutputTemplate("template", tt.text, "", templateEntry{}); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("parseOutputTemplate(%q) error = %v, want %q", tt.text, err, tt.wantErr)
+		}
+	}
+	if _, err := parseOutputTemplate("template", "{{.Path}}", "x.tmpl", templateEntry{}); err == nil {
+		t.Error("accepted both -template and -template-file")
+	}
+}
+
+func TestRunTemplate(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"dir/big.bin": strings.Repeat("x", 2000),
+	})
+	defer os.RemoveAll(tmpDir)
+	tmplFile := filepath.Join(t.TempDir(), "line.tmpl")
+	if err := os.WriteFile(tmplFile, []byte("{{.Bytes}} {{basename .Path}}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	resetResults()
+	out, err := runCaptured(t, "-template-file="+tmplFile, "-summary-template=total {{.Total}}", "-exclude=nothing", tmpDir, "1K")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	want := "2000 " + filepath.Base(tmpDir) + "\n2000 dir\n2000 big.bin\ntotal 2000\n"
+	if out != want {
+		t.Errorf("output:\n%q\nwant:\n%q", out, want)
+	}
+
+	// A bad template fails before anything is scanned.
+	resetResults()
+	out, err = runCaptured(t, "-template={{.Nope}}", tmpDir, "1K")
+	if err == nil || !strings.Contains(err.Error(), "-template") || strings.Contains(out, "Scanning") {
+		t.Errorf("bad template: err = %v, output:\n%s", err, out)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !(linux || darwin || freebsd)
+
+package main
+
+import "os"
+
+// terminalColumns is not implemented on this platform; graphWidth falls
+// back to $COLUMNS.
+func terminalColumns(f *os.File) int {
+	return 0
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// treeCounts records how many direct entries each listed directory has,
+// so that -tree can say how many it leaves out. It is nil unless -tree is
+// given.
+type treeCounts struct {
+	mu      sync.Mutex
+	entries map[string]int
+}
+
+// dirEntryCounts is the active record, if any.
+var dirEntryCounts *treeCounts
+
+func newTreeCounts() *treeCounts {
+	return &treeCounts{entries: make(map[string]int)}
+}
+
+// record notes that the directory at path has n direct entries.
+func (c *treeCounts) record(path string, n int) {
+	c.mu.Lock()
+	c.entries[path] = n
+	c.mu.Unlock()
+}
+
+// lookup returns the entry count of the directory at path, if known.
+func (c *treeCounts) lookup(path string) (int, bool) {
+	if c == nil {
+		return 0, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n, ok := c.entries[path]
+	return n, ok
+}
+
+// treeNode is one listed entry in the -tree view.
+type treeNode struct {
+	res      FileInfo
+	name     string // path relative to the parent node
+	children []*treeNode
+}
+
+// buildTree links the listed entries under root to their nearest listed
+// ancestor. Entries whose ancestors were filtered out hang from the
+// closest one that is shown, named by their path from it. When the root
+// itself is not listed it is stood in for by an entry of size total.
+func buildTree(root string, total uint64, list []FileInfo) *treeNode {
+	nodes := make(map[string]*treeNode, len(list)+1)
+	top := &treeNode{res: FileInfo{Path: root, Size: total, IsDir: true}, name: root}
+	nodes[root] = top
+	for _, res := range list {
+		if res.Path == root {
+			top.res = res
+			continue
+		}
+		nodes[res.Path] = &treeNode{res: res}
+	}
+	for _, res := range list {
+		if res.Path == root {
+			continue
+		}
+		n := nodes[res.Path]
+		parent := top
+		// The root is in nodes, so the search ends there at the latest.
+		for dir := filepath.Dir(res.Path); pathWithin(dir, root); dir = filepath.Dir(dir) {
+			if p, ok := nodes[dir]; ok {
+				parent = p
+				break
+			}
+		}
+		n.name = relSlash(parent.res.Path, res.Path, filepath.Separator)
+		parent.children = append(parent.children, n)
+	}
+	for _, n := range nodes {
+		sort.Slice(n.children, func(i, j int) bool {
+			a, b := n.children[i].res, n.children[j].res
+			if a.Size != b.Size {
+				return a.Size > b.Size
+			}
+			return a.Path < b.Path
+		})
+	}
+	return top
+}
+
+// printTree writes the tree, each level indented two more spaces and
+// children largest first. A directory's line is followed by a summary of
+// what its listed children do not account for.
+func printTree(n *treeNode, depth int) {
+	indent := strings.Repeat("  ", depth)
+	name := n.name
+	if depth == 0 {
+		name = displayPath(name)
+	}
+	if n.res.IsDir && depth > 0 {
+		name += "/"
+	}
+	fmt.Fprintf(stdout, "%s%-10s  %s%s\n%s", indent, humanReadableSize(n.res.Size), name, contextSuffix(n.res), peekLines(indent+"  ", n.res))
+	if !n.res.IsDir {
+		return
+	}
+	var shown uint64
+	direct := make(map[string]bool)
+	for _, c := range n.children {
+		printTree(c, depth+1)
+		shown = addSize(shown, c.res.Size)
+		first, _, _ := strings.Cut(c.name, "/")
+		direct[first] = true
+	}
+	rest := uint64(0)
+	if n.res.Size > shown {
+		rest = n.res.Size - shown
+	}
+	entries, known := dirEntryCounts.lookup(n.res.Path)
+	switch {
+	case known && entries > len(direct):
+		k := entries - len(direct)
+		fmt.Fprintf(stdout, "%s  ... %d smaller %s (%s)\n", indent, k, plural(k, "entry", "entries"), humanReadableSize(rest))
+	case !known && rest > 0:
+		fmt.Fprintf(stdout, "%s  ... smaller entries (%s)\n", indent, humanReadableSize(rest))
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunTree(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"var/log/journal/a": strings.Repeat("j", 5000),
+		"var/log/syslog":    strings.Repeat("s", 3000),
+		"var/log/tiny":      "t",
+		"var/cache/c":       strings.Repeat("c", 2000),
+		"etc/x":             "x",
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+
+	resetResults()
+	out, err := runCaptured(t, "-no-hints", "-tree", tmpDir, "1500B")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	want := "\n" +
+		"9.77 KiB    " + tmpDir + "\n" +
+		"  9.77 KiB    var/\n" +
+		"    7.81 KiB    log/\n" +
+		"      4.88 KiB    journal/\n" +
+		"        4.88 KiB    a\n" +
+		"      2.93 KiB    syslog\n" +
+		"      ... 1 smaller entry (1 B)\n" +
+		"    1.95 KiB    cache/\n" +
+		"      1.95 KiB    c\n" +
+		"  ... 1 smaller entry (1 B)\n"
+	if !strings.Contains(out, want) {
+		t.Errorf("tree is\n%s\nwant\n%s", out, want)
+	}
+	if strings.Contains(out, "TYPE   SIZE") {
+		t.Errorf("-tree still printed the flat table heading:\n%s", out)
+	}
+
+	// A relative root nests the same way.
+	wd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	body := want[strings.Index(want[1:], "\n")+1:]
+	for _, root := range []string{".", "./"} {
+		resetResults()
+		out, err := runCaptured(t, "-no-hints", "-tree", root, "1500B")
+		if err != nil {
+			t.Fatalf("run on %s failed: %v\n%s", root, err, out)
+		}
+		if !strings.Contains(out, body) {
+			t.Errorf("tree of %s is\n%s\nwant\n%s", root, out, body)
+		}
+	}
+}
+
+func TestBuildTreeSkipsHiddenAncestors(t *testing.T) {
+	root := "r"
+	list := []FileInfo{
+		{Path: root, Size: 100, IsDir: true},
+		{Path: filepath.Join(root, "a", "b", "big"), Size: 60},
+		{Path: filepath.Join(root, "c"), Size: 30, IsDir: true},
+	}
+	top := buildTree(root, 100, list)
+	if len(top.children) != 2 || top.children[0].name != "a/b/big" || top.children[1].name != "c" {
+		var names []string
+		for _, c := range top.children {
+			names = append(names, c.name)
+		}
+		t.Errorf("root children = %q, want [a/b/big c]", names)
+	}
+}
+
+func TestRunTreeRejectsMachineFormats(t *testing.T) {
+	if _, err := runCaptured(t, "-tree", "-format=json", t.TempDir(), "1K"); err == nil {
+		t.Error("-tree accepted with -format=json")
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseDelimiter validates a -delimiter value. It must be one ASCII
+// character other than a line break, because tools such as cut -d only
+// split on single bytes.
+func parseDelimiter(s string) (byte, error) {
+	if s == `\t` {
+		return '\t', nil
+	}
+	if utf8.RuneCountInString(s) != 1 {
+		return 0, fmt.Errorf("delimiter %q must be a single character", s)
+	}
+	if len(s) != 1 {
+		return 0, fmt.Errorf("delimiter %q is a multi-byte character; use a single-byte one such as | or ;", s)
+	}
+	if s == "\n" || s == "\r" {
+		return 0, fmt.Errorf("delimiter must not be a line break")
+	}
+	return s[0], nil
+}
+
+// writeTSVResults writes one unpadded row per result, by default type,
+// size in bytes and path, fields separated by delim, followed by any
+// annotations. Values are not escaped, so a path containing the delimiter
+// or a line break is an error; the rows are checked before anything is
+// written so that a failure never leaves a truncated table behind.
+func writeTSVResults(w io.Writer, delim byte, lists ...[]FileInfo) error {
+	var buf bytes.Buffer
+	cols := columnsFor(tsvColumns)
+	bad := string([]byte{delim}) + "\n\r"
+	for _, list := range lists {
+		for _, res := range list {
+			var fields, free []string
+			for _, c := range cols {
+				v := c.value(res)
+				fields = append(fields, v)
+				if c.free {
+					free = append(free, v)
+				}
+			}
+			for _, a := range res.Annotations {
+				fields = append(fields, a.Value)
+				free = append(free, a.Value)
+			}
+			for _, f := range free {
+				if strings.ContainsAny(f, bad) {
+					return fmt.Errorf("%q contains the delimiter %q or a line break; choose another with -delimiter or use -format=csv", f, delim)
+				}
+			}
+			buf.WriteString(strings.Join(fields, string([]byte{delim})))
+			buf.WriteByte('\n')
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseDelimiter(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    byte
+		wantErr string
+	}{
+		{`\t`, '\t', ""},
+		{"\t", '\t', ""},
+		{"|", '|', ""},
+		{";", ';', ""},
+		{"", 0, "single character"},
+		{"||", 0, "single character"},
+		{"│", 0, "multi-byte"},
+		{"é", 0, "multi-byte"},
+		{"\n", 0, "line break"},
+	}
+	for _, tt := range tests {
+		got, err := parseDelimiter(tt.in)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseDelimiter(%q) error = %v, want %q", tt.in, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseDelimiter(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestRunTSVFormat(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"d/one":  strings.Repeat("x", 300),
+		"d/two":  strings.Repeat("y", 200),
+		"d/tiny": "z",
+	})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+
+	resetResults()
+	out, err := runCaptured(t, "-format=tsv", "-delimiter=|", tmpDir, "150B")
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	want := "dir|501|" + tmpDir + "\n" +
+		"dir|501|" + filepath.Join(tmpDir, "d") + "\n" +
+		"file|300|" + filepath.Join(tmpDir, "d", "one") + "\n" +
+		"file|200|" + filepath.Join(tmpDir, "d", "two") + "\n"
+	if out != want {
+		t.Errorf("output =\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestRunTSVRejectsDelimiterInPath(t *testing.T) {
+	name := "a|b"
+	if runtime.GOOS == "windows" {
+		name = "a;b"
+	}
+	tmpDir := createTestDir(t, map[string]string{name: strings.Repeat("x", 300)})
+	defer os.RemoveAll(tmpDir)
+	fakeMounts(t, nil)
+
+	resetResults()
+	out, err := runCaptured(t, "-format=tsv", "-delimiter="+name[1:2], tmpDir, "150B")
+	if err == nil || !strings.Contains(err.Error(), "contains the delimiter") {
+		t.Fatalf("error = %v, want the path rejected", err)
+	}
+	if strings.Contains(out, "dir") {
+		t.Errorf("rows were written before the failure:\n%s", out)
+	}
+}
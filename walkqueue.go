@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// walkWorkers is the number of goroutines listing directories; zero picks
+// a default from GOMAXPROCS. The walk cannot deadlock whatever its value:
+// the queue is unbounded and no worker ever waits for another directory.
+var walkWorkers int
+
+// defaultWalkWorkers returns the worker count used when walkWorkers is 0.
+// Listing is I/O bound, so this is well above the number of CPUs.
+func defaultWalkWorkers() int {
+	return max(8*runtime.GOMAXPROCS(0), 32)
+}
+
+// dirNode is a directory in flight. pending counts its own listing plus
+// every child that has not finished; the node is complete when it drops to
+// zero.
+type dirNode struct {
+	path    string
+	parent  *dirNode
+	queued  time.Time
+	pending atomic.Int64
+
+	mu    sync.Mutex
+	total subtreeStats
+
+	// skip names the entries already counted when a partially listed
+	// directory is queued again by -finish-partials.
+	skip map[string]bool
+
+	// prints are the children's fingerprint entries for -dupe-dirs.
+	prints []printEntry
+
+	// entries counts the files and subdirectories listed, for -tree.
+	entries int
+
+	// names samples the children's names for -detect-blobdirs.
+	names []string
+
+	// peek holds the largest children seen so far for -peek.
+	peek childHeap
+
+	// modTime is the directory's own modification time (-dir-times).
+	modTime time.Time
+}
+
+// child returns a new node for a subdirectory of n, counting it as pending
+// on n before it can possibly finish.
+func (n *dirNode) child(path string) *dirNode {
+	n.pending.Add(1)
+	if ncdu != nil {
+		ncdu.addDir(path)
+	}
+	c := &dirNode{path: path, parent: n, queued: time.Now()}
+	c.pending.Store(1)
+	return c
+}
+
+// merge folds totals into n.
+func (n *dirNode) merge(st subtreeStats) {
+	n.mu.Lock()
+	n.total.merge(st)
+	n.mu.Unlock()
+}
+
+// walker schedules directory listings on a fixed pool of workers. Parents
+// never block on children: each finished directory hands its totals to
+// its parent through complete, so a directory with any fanout needs no
+// more than one worker at a time.
+type walker struct {
+	threshold  uint64
+	excludeSet map[string]struct{}
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []*dirNode
+	closed bool
+	// current is the directory each worker is listing, for the watchdog.
+	current map[int]string
+	// junctionTargets are the resolved targets of followed junctions.
+	junctionTargets map[string]bool
+
+	done     chan subtreeStats
+	ctx      context.Context
+	cancel   context.CancelFunc
+	fatal    *fatalError  // first error in fatalClasses, guarded by mu
+	finished atomic.Int64 // directories completed, the watchdog's progress mark
+	// files and bytes count what has been seen so far, for -progress.
+	files, bytes atomic.Int64
+}
+
+// newWalker returns a walker for one scan.
+func newWalker(threshold uint64, excludeSet map[string]struct{}) *walker {
+	w := &walker{
+		threshold:  threshold,
+		excludeSet: excludeSet,
+		current:    make(map[int]string),
+		done:       make(chan subtreeStats, 1),
+	}
+	w.cond = sync.NewCond(&w.mu)
+	w.ctx, w.cancel = context.WithCancel(runCtx)
+	return w
+}
+
+// run walks the tree at root and returns its totals. The error is a
+// *fatalError when the walk was aborted by -fatal-errors, or an
+// *interruptedError when a signal stopped it, and the totals are then
+// incomplete.
+func (w *walker) run(root string) (subtreeStats, error) {
+	n := &dirNode{path: root, queued: time.Now()}
+	n.pending.Store(1)
+	w.push(n)
+
+	workers := walkWorkers
+	if workers <= 0 {
+		workers = defaultWalkWorkers()
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			w.work(id)
+		}(i)
+	}
+	var stopWatchdog, stopProgress func()
+	if debugWatchdog {
+		stopWatchdog = w.watch(watchdogInterval)
+	}
+	if showProgress {
+		stopProgress = w.startProgress()
+	}
+
+	var total subtreeStats
+	select {
+	case total = <-w.done:
+	case <-w.ctx.Done():
+	}
+	w.cancel()
+
+	if stopWatchdog != nil {
+		stopWatchdog()
+	}
+	if stopProgress != nil {
+		stopProgress()
+	}
+	w.mu.Lock()
+	w.closed = true
+	w.cond.Broadcast()
+	w.mu.Unlock()
+	wg.Wait()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.fatal != nil {
+		return total, w.fatal
+	}
+	return total, interruption()
+}
+
+// noteError reports an error met while scanning path and aborts the walk
+// if its class is in fatalClasses. Only the first fatal error is kept.
+func (w *walker) noteError(path string, err error) {
+	if fatalClasses == nil {
+		return
+	}
+	class := classifyError(err)
+	if !fatalClasses[class] {
+		return
+	}
+	w.mu.Lock()
+	if w.fatal == nil {
+		w.fatal = &fatalError{Class: class, Path: path, Err: err}
+	}
+	w.mu.Unlock()
+	w.cancel()
+}
+
+// push queues a directory for listing. It never blocks.
+func (w *walker) push(n *dirNode) {
+	w.mu.Lock()
+	w.queue = append(w.queue, n)
+	w.cond.Signal()
+	w.mu.Unlock()
+}
+
+// pushLast queues a directory behind everything already queued, so that it
+// is listed only once the rest of the queue has drained.
+func (w *walker) pushLast(n *dirNode) {
+	w.mu.Lock()
+	w.queue = append([]*dirNode{n}, w.queue...)
+	w.cond.Signal()
+	w.mu.Unlock()
+}
+
+// work lists queued directories until the walk is over.
+func (w *walker) work(id int) {
+	for {
+		w.mu.Lock()
+		for len(w.queue) == 0 && !w.closed {
+			w.cond.Wait()
+		}
+		if w.closed || w.ctx.Err() != nil {
+			w.mu.Unlock()
+			return
+		}
+		// Last in, first out keeps the queue close to the depth of the
+		// tree rather than its width.
+		n := w.queue[len(w.queue)-1]
+		w.queue[len(w.queue)-1] = nil
+		w.queue = w.queue[:len(w.queue)-1]
+		w.current[id] = n.path
+		w.mu.Unlock()
+
+		w.scanDir(n)
+
+		w.mu.Lock()
+		delete(w.current, id)
+		w.mu.Unlock()
+	}
+}
+
+// complete drops one pending unit of n and, while that finishes a node,
+// passes its totals up to the parent. The root's totals end the walk.
+func (w *walker) complete(n *dirNode) {
+	for n.pending.Add(-1) == 0 {
+		sub := w.finishDir(n)
+		w.finished.Add(1)
+		if n.parent == nil {
+			w.done <- sub
+			return
+		}
+		if dupeDirs != nil {
+			dupeDirs.finishDir(n, sub)
+		}
+		if peeks != nil {
+			peeks.addPeek(n.parent, peekChild{Name: filepath.Base(n.path), Size: sub.Size, IsDir: true})
+		}
+		n.parent.merge(sub)
+		n = n.parent
+	}
+}
+
+// debugWatchdog enables the no-progress watchdog (-debug).
+var debugWatchdog bool
+
+// watchdogInterval is how long the walk may go without finishing a
+// directory before the watchdog dumps its state.
+var watchdogInterval = 10 * time.Second
+
+// watch starts the watchdog and returns a function that stops it.
+func (w *walker) watch(interval time.Duration) func() {
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		last := w.finished.Load()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				now := w.finished.Load()
+				if now == last {
+					w.dumpState(interval)
+				}
+				last = now
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-stopped
+	}
+}
+
+// dumpState writes the scheduler state to stderr.
+func (w *walker) dumpState(stalled time.Duration) {
+	w.mu.Lock()
+	queued := len(w.queue)
+	busy := make([]string, 0, len(w.current))
+	for _, p := range w.current {
+		busy = append(busy, p)
+	}
+	w.mu.Unlock()
+	sort.Strings(busy)
+
+	msg := fmt.Sprintf("debug: no directory finished in %v; %d finished, %d queued, %d workers busy, %d/%d files open\n",
+		stalled, w.finished.Load(), queued, len(busy), openFiles.inUse(), openFiles.limit())
+	for _, p := range busy {
+		msg += fmt.Sprintf("debug:   listing %s\n", displayPath(p))
+	}
+	fmt.Fprint(stderr, msg)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// walkWithin runs walkDirRecursive and fails the test instead of hanging
+// if it does not return in time.
+func walkWithin(t *testing.T, d time.Duration, root string) uint64 {
+	t.Helper()
+	done := make(chan uint64, 1)
+	go func() { done <- walkDirRecursive(root, 1, map[string]struct{}{}) }()
+	select {
+	case total := <-done:
+		return total
+	case <-time.After(d):
+		t.Fatalf("walk of %s did not finish within %v", root, d)
+		return 0
+	}
+}
+
+func TestWalkFanoutExceedsWorkers(t *testing.T) {
+	files := map[string]string{}
+	want := uint64(0)
+	// 200 directories at the top, and 50 under each of the first three, so
+	// fanout dwarfs the worker count at two depths.
+	for i := 0; i < 200; i++ {
+		files[fmt.Sprintf("d%03d/f", i)] = "ab"
+		want += 2
+		if i < 3 {
+			for j := 0; j < 50; j++ {
+				files[fmt.Sprintf("d%03d/s%02d/deeper/g", i, j)] = "xyz"
+				want += 3
+			}
+		}
+	}
+	tmpDir := createTestDir(t, files)
+	defer os.RemoveAll(tmpDir)
+
+	oldWorkers := walkWorkers
+	defer func() { walkWorkers = oldWorkers }()
+	for _, workers := range []int{1, 2, 3} {
+		t.Run(fmt.Sprintf("workers=%d", workers), func(t *testing.T) {
+			resetResults()
+			walkWorkers = workers
+			if total := walkWithin(t, 20*time.Second, tmpDir); total != want {
+				t.Errorf("total = %d, want %d", total, want)
+			}
+			// Every directory and every file is >= 1 byte; the root is left
+			// to the caller.
+			if wantResults := 200 + 150*2 + len(files); len(results) != wantResults {
+				t.Errorf("got %d results, want %d", len(results), wantResults)
+			}
+		})
+	}
+}
+
+func TestWalkRandomizedStress(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	oldWorkers, oldRead := walkWorkers, readDir
+	defer func() { walkWorkers, readDir = oldWorkers, oldRead }()
+	readDir = func(p string) ([]fs.DirEntry, error) {
+		if strings.HasSuffix(p, "7") {
+			time.Sleep(time.Millisecond)
+		}
+		return oldRead(p)
+	}
+
+	for round := 0; round < 8; round++ {
+		files := map[string]string{}
+		var want uint64
+		var grow func(prefix string, depth int)
+		grow = func(prefix string, depth int) {
+			for i := rng.Intn(4); i > 0; i-- {
+				size := rng.Intn(5) + 1
+				files[filepath.Join(prefix, fmt.Sprintf("f%d", i))] = strings.Repeat("x", size)
+				want += uint64(size)
+			}
+			if depth == 0 {
+				files[prefix+"/"] = ""
+				return
+			}
+			for i := rng.Intn(7); i > 0; i-- {
+				grow(filepath.Join(prefix, fmt.Sprintf("d%d", i)), depth-1)
+			}
+		}
+		grow("top", 4)
+		tmpDir := createTestDir(t, files)
+
+		resetResults()
+		walkWorkers = rng.Intn(8) + 1
+		if total := walkWithin(t, 30*time.Second, tmpDir); total != want {
+			t.Errorf("round %d with %d workers: total = %d, want %d", round, walkWorkers, total, want)
+		}
+		os.RemoveAll(tmpDir)
+	}
+}
+
+func TestWatchdogDumpsStateWhenStalled(t *testing.T) {
+	resetResults()
+	tmpDir := createTestDir(t, map[string]string{
+		"stuck/f": "a",
+		"fine/f":  "b",
+	})
+	defer os.RemoveAll(tmpDir)
+	stuck := filepath.Join(tmpDir, "stuck")
+
+	release := make(chan struct{})
+	oldRead, oldInterval, oldDebug := readDir, watchdogInterval, debugWatchdog
+	defer func() { readDir, watchdogInterval, debugWatchdog = oldRead, oldInterval, oldDebug }()
+	var buf bytes.Buffer
+	stdout, stderr = newOutputs(&buf, &buf, true)
+	defer setupOutput(os.Stdout, os.Stderr)
+
+	readDir = func(p string) ([]fs.DirEntry, error) {
+		if p == stuck {
+			<-release
+		}
+		return oldRead(p)
+	}
+	watchdogInterval = 20 * time.Millisecond
+	debugWatchdog = true
+
+	go func() {
+		time.Sleep(10 * watchdogInterval)
+		close(release)
+	}()
+	if total := walkWithin(t, 10*time.Second, tmpDir); total != 2 {
+		t.Errorf("total = %d, want 2", total)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "debug: no directory finished in 20ms") {
+		t.Errorf("watchdog did not report the stall:\n%s", out)
+	}
+	if !strings.Contains(out, "debug:   listing "+stuck+"\n") {
+		t.Errorf("watchdog did not name the stuck directory:\n%s", out)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// xmlScan is the document written by -format=xml.
+type xmlScan struct {
+	XMLName        xml.Name   `xml:"scan"`
+	Root           string     `xml:"root,attr"`
+	Threshold      uint64     `xml:"threshold,attr"`
+	Total          uint64     `xml:"total,attr"`
+	CanonicalPaths bool       `xml:"canonical_paths,attr,omitempty"`
+	Entries        []xmlEntry `xml:"entry"`
+}
+
+// xmlEntry is one listed file or directory.
+type xmlEntry struct {
+	Path         string `xml:"path,attr"`
+	Bytes        uint64 `xml:"bytes,attr"`
+	Dir          bool   `xml:"dir,attr"`
+	MemoryBacked bool   `xml:"memory_backed,attr,omitempty"`
+	LowerBound   bool   `xml:"lower_bound,attr,omitempty"`
+}
+
+// xmlText makes s safe for an XML attribute. Filenames need not be valid
+// UTF-8, and XML has no way to carry the raw bytes, so invalid sequences
+// become U+FFFD; the encoder escapes the rest.
+func xmlText(s string) string {
+	return strings.ToValidUTF8(s, "\uFFFD")
+}
+
+// newXMLScan builds the document from the sorted results, memory-backed
+// entries after the disk entries as in the text output.
+func newXMLScan(root string, threshold, total uint64, lists ...[]FileInfo) xmlScan {
+	doc := xmlScan{Root: xmlText(root), Threshold: threshold, Total: total}
+	for _, list := range lists {
+		for _, res := range list {
+			doc.Entries = append(doc.Entries, xmlEntry{
+				Path:         xmlText(res.Path),
+				Bytes:        res.Size,
+				Dir:          res.IsDir,
+				MemoryBacked: res.MemoryBacked,
+				LowerBound:   res.LowerBound,
+			})
+		}
+	}
+	return doc
+}
+
+// writeXMLScan writes doc as an indented XML document with its declaration.
+func writeXMLScan(w io.Writer, doc xmlScan) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
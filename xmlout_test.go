@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteXMLScanGolden(t *testing.T) {
+	root := "/data"
+	results := []FileInfo{
+		{Path: root, Size: 4096, IsDir: true},
+		{Path: root + "/R&D <old>", Size: 2048, IsDir: true},
+		{Path: root + "/R&D <old>/café \"q\".bin", Size: 2000},
+		{Path: root + "/bad\xffname", Size: 1500, LowerBound: true},
+	}
+	memory := []FileInfo{{Path: root + "/run/shm", Size: 1024, IsDir: true, MemoryBacked: true}}
+
+	var buf bytes.Buffer
+	if err := writeXMLScan(&buf, newXMLScan(root, 1024, 4096, results, memory)); err != nil {
+		t.Fatalf("writeXMLScan: %v", err)
+	}
+	want, err := os.ReadFile(filepath.Join("testdata", "scan.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != string(want) {
+		t.Errorf("XML output differs from testdata/scan.xml:\n%s\nwant:\n%s", got, want)
+	}
+
+	var back xmlScan
+	if err := xml.Unmarshal(buf.Bytes(), &back); err != nil {
+		t.Fatalf("output does not parse: %v", err)
+	}
+	if len(back.Entries) != 5 || back.Entries[2].Path != "/data/R&D <old>/café \"q\".bin" || back.Entries[3].Path != "/data/bad�name" {
+		t.Errorf("parsed entries = %+v", back.Entries)
+	}
+}
+
+func TestRunXMLFormat(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"dir/big.bin": strings.Repeat("x", 200),
+		"small":       "x",
+	})
+	defer os.RemoveAll(tmpDir)
+
+	fakeMounts(t, nil)
+	resetResults()
+	out, err := runCaptured(t, "-format=xml", "-canonical-paths", "-exclude=nothing", tmpDir, "100B")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	var doc xmlScan
+	if err := xml.Unmarshal([]byte(out), &doc); err != nil {
+		t.Fatalf("output is not an XML document: %v\n%s", err, out)
+	}
+	if doc.Root != tmpDir || doc.Threshold != 100 || doc.Total != 201 || !doc.CanonicalPaths {
+		t.Errorf("scan = %+v", doc)
+	}
+	var paths []string
+	for _, e := range doc.Entries {
+		paths = append(paths, e.Path)
+	}
+	if got, want := strings.Join(paths, " "), ". dir dir/big.bin"; got != want {
+		t.Errorf("paths = %q, want %q", got, want)
+	}
+}